@@ -0,0 +1,141 @@
+package ack
+
+import (
+	"errors"
+	"fmt"
+	"html/template"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"rds-backup-monitor/lambda/storage"
+)
+
+// Links are opened from email clients, some of which fetch every link in a
+// message. GET therefore only shows a confirmation form; the acknowledgement
+// is stored when the form is posted.
+var pageTemplate = template.Must(template.New("page").Parse(`<!DOCTYPE html>
+<html>
+<head><meta charset="utf-8"><title>RDS Backup Monitor</title></head>
+<body>
+<h1>{{.Title}}</h1>
+<p>{{.Message}}</p>
+{{- if .Params}}
+<form method="post">
+{{- range $name, $values := .Params}}{{range $values}}
+<input type="hidden" name="{{$name}}" value="{{.}}">
+{{- end}}{{end}}
+<button type="submit">{{.Title}}</button>
+</form>
+{{- end}}
+</body>
+</html>
+`))
+
+type page struct {
+	Title   string
+	Message string
+	Params  url.Values
+}
+
+// Handler serves the acknowledge and snooze API.
+type Handler struct {
+	signer *Signer
+	store  storage.AcknowledgementStore
+}
+
+func NewHandler(signer *Signer, store storage.AcknowledgementStore) *Handler {
+	return &Handler{signer: signer, store: store}
+}
+
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	action := strings.Trim(r.URL.Path, "/")
+
+	switch r.Method {
+	case http.MethodGet:
+		request, err := h.signer.Verify(action, r.URL.Query())
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		writePage(w, http.StatusOK, page{
+			Title:   title(action),
+			Message: describe(request),
+			Params:  r.URL.Query(),
+		})
+
+	case http.MethodPost:
+		if err := r.ParseForm(); err != nil {
+			writeError(w, fmt.Errorf("%w: %v", ErrInvalidRequest, err))
+			return
+		}
+		request, err := h.signer.Verify(action, r.PostForm)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+
+		now := h.signer.now()
+		ack := storage.Acknowledgement{
+			Region:       request.Region,
+			DatabaseType: request.DatabaseType,
+			DatabaseID:   request.DatabaseID,
+			Action:       request.Action,
+			CreatedAt:    now,
+			Until:        now.Add(request.Duration),
+		}
+		if err := h.store.PutAcknowledgement(r.Context(), ack); err != nil {
+			fmt.Printf("Unable to store acknowledgement: %v\n", err)
+			writePage(w, http.StatusInternalServerError, page{Title: "Error", Message: "The request could not be saved, please try again."})
+			return
+		}
+
+		fmt.Printf("Stored %s of %s %s in region %s until %s\n",
+			ack.Action, ack.DatabaseType, ack.DatabaseID, ack.Region, ack.Until.Format(time.RFC3339))
+		writePage(w, http.StatusOK, page{
+			Title: "Done",
+			Message: fmt.Sprintf("Notifications about %s %s in %s are muted until %s or until it recovers.",
+				ack.DatabaseType, ack.DatabaseID, ack.Region, ack.Until.UTC().Format(time.RFC1123)),
+		})
+
+	default:
+		w.Header().Set("Allow", "GET, POST")
+		writePage(w, http.StatusMethodNotAllowed, page{Title: "Error", Message: "Method not allowed."})
+	}
+}
+
+func title(action string) string {
+	if action == ActionSnooze {
+		return "Snooze"
+	}
+	return "Acknowledge"
+}
+
+func describe(request Request) string {
+	if request.Action == ActionSnooze {
+		return fmt.Sprintf("Mute notifications about %s %s in %s for %s?",
+			request.DatabaseType, request.DatabaseID, request.Region, request.Duration)
+	}
+	return fmt.Sprintf("Mute notifications about %s %s in %s until it recovers?",
+		request.DatabaseType, request.DatabaseID, request.Region)
+}
+
+func writeError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, ErrInvalidSignature):
+		writePage(w, http.StatusForbidden, page{Title: "Error", Message: "This link is not valid."})
+	case errors.Is(err, ErrLinkExpired):
+		writePage(w, http.StatusForbidden, page{Title: "Error", Message: "This link has expired."})
+	default:
+		writePage(w, http.StatusBadRequest, page{Title: "Error", Message: err.Error()})
+	}
+}
+
+func writePage(w http.ResponseWriter, status int, p page) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(status)
+	if err := pageTemplate.Execute(w, p); err != nil {
+		fmt.Printf("Unable to render page: %v\n", err)
+	}
+}
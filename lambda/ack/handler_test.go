@@ -0,0 +1,90 @@
+package ack
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"rds-backup-monitor/lambda/storage"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// failingStore fails to store acknowledgements.
+type failingStore struct {
+	*storage.MemoryStore
+}
+
+func (s failingStore) PutAcknowledgement(ctx context.Context, ack storage.Acknowledgement) error {
+	return fmt.Errorf("store error")
+}
+
+func TestHandler(t *testing.T) {
+	signer := newTestSigner()
+	links := signer.Links("us-east-1", "instance", "db-1")
+	_, snoozeParams := linkParams(t, links.Snooze)
+
+	t.Run("GET shows a confirmation form without storing", func(t *testing.T) {
+		store := storage.NewMemoryStore()
+		recorder := httptest.NewRecorder()
+		NewHandler(signer, store).ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, links.Snooze, nil))
+
+		assert.Equal(t, http.StatusOK, recorder.Code)
+		assert.Contains(t, recorder.Body.String(), "Mute notifications about instance db-1 in us-east-1 for 4h0m0s?")
+		assert.Contains(t, recorder.Body.String(), `<form method="post">`)
+		assertNoAcknowledgements(t, store)
+	})
+
+	t.Run("POST stores a snooze", func(t *testing.T) {
+		store := storage.NewMemoryStore()
+		request := httptest.NewRequest(http.MethodPost, "/snooze", strings.NewReader(snoozeParams.Encode()))
+		request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		recorder := httptest.NewRecorder()
+		NewHandler(signer, store).ServeHTTP(recorder, request)
+
+		assert.Equal(t, http.StatusOK, recorder.Code)
+		acks, err := store.GetAcknowledgements(context.Background(), "us-east-1")
+		require.NoError(t, err)
+		require.Contains(t, acks, "instance/db-1")
+		ack := acks["instance/db-1"]
+		assert.Equal(t, "snooze", ack.Action)
+		assert.True(t, testNow.Add(signer.snoozeDuration).Equal(ack.Until))
+	})
+
+	t.Run("rejects tampered links", func(t *testing.T) {
+		store := storage.NewMemoryStore()
+		recorder := httptest.NewRecorder()
+		NewHandler(signer, store).ServeHTTP(recorder,
+			httptest.NewRequest(http.MethodGet, strings.Replace(links.Snooze, "db-1", "db-2", 1), nil))
+
+		assert.Equal(t, http.StatusForbidden, recorder.Code)
+		assertNoAcknowledgements(t, store)
+	})
+
+	t.Run("reports storage errors", func(t *testing.T) {
+		request := httptest.NewRequest(http.MethodPost, "/snooze", strings.NewReader(snoozeParams.Encode()))
+		request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		recorder := httptest.NewRecorder()
+		NewHandler(signer, failingStore{storage.NewMemoryStore()}).ServeHTTP(recorder, request)
+
+		assert.Equal(t, http.StatusInternalServerError, recorder.Code)
+	})
+
+	t.Run("rejects other methods", func(t *testing.T) {
+		recorder := httptest.NewRecorder()
+		NewHandler(signer, storage.NewMemoryStore()).ServeHTTP(recorder, httptest.NewRequest(http.MethodDelete, links.Ack, nil))
+
+		assert.Equal(t, http.StatusMethodNotAllowed, recorder.Code)
+	})
+}
+
+func assertNoAcknowledgements(t *testing.T, store storage.AcknowledgementStore) {
+	t.Helper()
+	acks, err := store.GetAcknowledgements(context.Background(), "us-east-1")
+	require.NoError(t, err)
+	assert.Empty(t, acks)
+}
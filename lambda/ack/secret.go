@@ -0,0 +1,27 @@
+package ack
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/secretsmanager"
+)
+
+type SecretsClient interface {
+	GetSecretValue(ctx context.Context, params *secretsmanager.GetSecretValueInput, optFns ...func(*secretsmanager.Options)) (*secretsmanager.GetSecretValueOutput, error)
+}
+
+// LoadSecret returns the link signing secret stored in Secrets Manager.
+func LoadSecret(ctx context.Context, client SecretsClient, secretArn string) ([]byte, error) {
+	result, err := client.GetSecretValue(ctx, &secretsmanager.GetSecretValueInput{
+		SecretId: aws.String(secretArn),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("unable to read link signing secret %s: %v", secretArn, err)
+	}
+	if aws.ToString(result.SecretString) == "" {
+		return nil, fmt.Errorf("link signing secret %s is empty", secretArn)
+	}
+	return []byte(aws.ToString(result.SecretString)), nil
+}
@@ -0,0 +1,138 @@
+package ack
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"rds-backup-monitor/lambda/notifications"
+)
+
+// Actions an operator can take through a signed link.
+const (
+	// ActionAck mutes a database until it recovers, at most for MaxAckDuration.
+	ActionAck = "ack"
+	// ActionSnooze mutes a database for the duration in the link.
+	ActionSnooze = "snooze"
+)
+
+// MaxAckDuration bounds how long an acknowledgement mutes a database that
+// never recovers, e.g. because it was deleted.
+const MaxAckDuration = 30 * 24 * time.Hour
+
+// LinkTTL is how long a signed link can be used after it was sent.
+const LinkTTL = 7 * 24 * time.Hour
+
+var (
+	ErrInvalidRequest   = errors.New("invalid request")
+	ErrInvalidSignature = errors.New("invalid signature")
+	ErrLinkExpired      = errors.New("link expired")
+)
+
+// Request is a verified acknowledge or snooze request.
+type Request struct {
+	Action       string
+	Region       string
+	DatabaseType string
+	DatabaseID   string
+	// Duration is how long the database is muted.
+	Duration time.Duration
+}
+
+// Signer creates and verifies action links. Links carry an HMAC-SHA256 of
+// their parameters, so the API needs no other authentication.
+type Signer struct {
+	secret         []byte
+	baseURL        string
+	snoozeDuration time.Duration
+	now            func() time.Time
+}
+
+// NewSigner returns a signer for links to the API at baseURL. Snooze links
+// mute a database for snoozeDuration.
+func NewSigner(secret []byte, baseURL string, snoozeDuration time.Duration) *Signer {
+	return &Signer{
+		secret:         secret,
+		baseURL:        strings.TrimSuffix(baseURL, "/"),
+		snoozeDuration: snoozeDuration,
+		now:            time.Now,
+	}
+}
+
+// Links returns the signed acknowledge and snooze links of a database. It
+// implements notifications.LinkSigner.
+func (s *Signer) Links(region, databaseType, databaseID string) notifications.ActionLinks {
+	expires := s.now().Add(LinkTTL)
+	return notifications.ActionLinks{
+		Ack:    s.link(Request{Action: ActionAck, Region: region, DatabaseType: databaseType, DatabaseID: databaseID, Duration: MaxAckDuration}, expires),
+		Snooze: s.link(Request{Action: ActionSnooze, Region: region, DatabaseType: databaseType, DatabaseID: databaseID, Duration: s.snoozeDuration}, expires),
+	}
+}
+
+func (s *Signer) link(request Request, expires time.Time) string {
+	query := url.Values{}
+	query.Set("region", request.Region)
+	query.Set("type", request.DatabaseType)
+	query.Set("id", request.DatabaseID)
+	query.Set("duration", request.Duration.String())
+	query.Set("expires", strconv.FormatInt(expires.Unix(), 10))
+	query.Set("sig", s.sign(request, expires.Unix()))
+	return s.baseURL + "/" + request.Action + "?" + query.Encode()
+}
+
+// Verify checks the parameters of a link for action and returns the request
+// they describe.
+func (s *Signer) Verify(action string, params url.Values) (Request, error) {
+	if action != ActionAck && action != ActionSnooze {
+		return Request{}, fmt.Errorf("%w: unknown action %q", ErrInvalidRequest, action)
+	}
+
+	request := Request{
+		Action:       action,
+		Region:       params.Get("region"),
+		DatabaseType: params.Get("type"),
+		DatabaseID:   params.Get("id"),
+	}
+	if request.Region == "" || request.DatabaseID == "" ||
+		(request.DatabaseType != "instance" && request.DatabaseType != "cluster") {
+		return Request{}, fmt.Errorf("%w: missing or invalid resource", ErrInvalidRequest)
+	}
+
+	duration, err := time.ParseDuration(params.Get("duration"))
+	if err != nil || duration <= 0 {
+		return Request{}, fmt.Errorf("%w: invalid duration", ErrInvalidRequest)
+	}
+	request.Duration = duration
+
+	expires, err := strconv.ParseInt(params.Get("expires"), 10, 64)
+	if err != nil {
+		return Request{}, fmt.Errorf("%w: invalid expiry", ErrInvalidRequest)
+	}
+
+	signature, err := hex.DecodeString(params.Get("sig"))
+	if err != nil || !hmac.Equal(signature, s.mac(request, expires)) {
+		return Request{}, ErrInvalidSignature
+	}
+	if s.now().Unix() > expires {
+		return Request{}, ErrLinkExpired
+	}
+
+	return request, nil
+}
+
+func (s *Signer) sign(request Request, expires int64) string {
+	return hex.EncodeToString(s.mac(request, expires))
+}
+
+func (s *Signer) mac(request Request, expires int64) []byte {
+	mac := hmac.New(sha256.New, s.secret)
+	fmt.Fprintf(mac, "%s\n%s\n%s\n%s\n%s\n%d",
+		request.Action, request.Region, request.DatabaseType, request.DatabaseID, request.Duration, expires)
+	return mac.Sum(nil)
+}
@@ -0,0 +1,93 @@
+package ack
+
+import (
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var testNow = time.Date(2024, 11, 20, 12, 0, 0, 0, time.UTC)
+
+func newTestSigner() *Signer {
+	signer := NewSigner([]byte("test-secret"), "https://example.lambda-url.us-east-1.on.aws/", 4*time.Hour)
+	signer.now = func() time.Time { return testNow }
+	return signer
+}
+
+// linkParams splits a link into its action and query parameters.
+func linkParams(t *testing.T, link string) (string, url.Values) {
+	t.Helper()
+	parsed, err := url.Parse(link)
+	assert.NoError(t, err)
+	return strings.Trim(parsed.Path, "/"), parsed.Query()
+}
+
+func TestSignerLinks(t *testing.T) {
+	signer := newTestSigner()
+	links := signer.Links("us-east-1", "instance", "db-1")
+
+	assert.True(t, strings.HasPrefix(links.Ack, "https://example.lambda-url.us-east-1.on.aws/ack?"))
+	assert.True(t, strings.HasPrefix(links.Snooze, "https://example.lambda-url.us-east-1.on.aws/snooze?"))
+
+	action, params := linkParams(t, links.Snooze)
+	request, err := signer.Verify(action, params)
+	assert.NoError(t, err)
+	assert.Equal(t, Request{
+		Action: ActionSnooze, Region: "us-east-1", DatabaseType: "instance", DatabaseID: "db-1", Duration: 4 * time.Hour,
+	}, request)
+
+	action, params = linkParams(t, links.Ack)
+	request, err = signer.Verify(action, params)
+	assert.NoError(t, err)
+	assert.Equal(t, MaxAckDuration, request.Duration)
+}
+
+func TestSignerVerify(t *testing.T) {
+	signer := newTestSigner()
+	_, valid := linkParams(t, signer.Links("us-east-1", "cluster", "aurora-1").Snooze)
+
+	with := func(name, value string) url.Values {
+		params := url.Values{}
+		for key, values := range valid {
+			params[key] = append([]string(nil), values...)
+		}
+		params.Set(name, value)
+		return params
+	}
+
+	tests := []struct {
+		name    string
+		action  string
+		params  url.Values
+		now     time.Time
+		wantErr error
+	}{
+		{name: "valid link", action: ActionSnooze, params: valid, now: testNow},
+		{name: "other action", action: ActionAck, params: valid, now: testNow, wantErr: ErrInvalidSignature},
+		{name: "unknown action", action: "delete", params: valid, now: testNow, wantErr: ErrInvalidRequest},
+		{name: "tampered duration", action: ActionSnooze, params: with("duration", "720h0m0s"), now: testNow, wantErr: ErrInvalidSignature},
+		{name: "tampered resource", action: ActionSnooze, params: with("id", "aurora-2"), now: testNow, wantErr: ErrInvalidSignature},
+		{name: "invalid type", action: ActionSnooze, params: with("type", "table"), now: testNow, wantErr: ErrInvalidRequest},
+		{name: "missing signature", action: ActionSnooze, params: with("sig", ""), now: testNow, wantErr: ErrInvalidSignature},
+		{name: "expired", action: ActionSnooze, params: valid, now: testNow.Add(LinkTTL + time.Second), wantErr: ErrLinkExpired},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			signer.now = func() time.Time { return tt.now }
+			_, err := signer.Verify(tt.action, tt.params)
+			if tt.wantErr != nil {
+				assert.ErrorIs(t, err, tt.wantErr)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+
+	other := NewSigner([]byte("other-secret"), "", time.Hour)
+	_, err := other.Verify(ActionSnooze, valid)
+	assert.ErrorIs(t, err, ErrInvalidSignature)
+}
@@ -0,0 +1,57 @@
+// Command ackapi serves the acknowledge and snooze API. It runs as a Lambda
+// function URL, or as a local HTTP server when started with -listen:
+//
+//	ACK_SECRET=... DYNAMODB_TABLE_NAME=... ACCOUNT_ID=... go run ./lambda/ackapi -listen :8080
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"time"
+
+	"rds-backup-monitor/lambda/ack"
+	"rds-backup-monitor/lambda/storage"
+
+	"github.com/aws/aws-lambda-go/lambdaurl"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/secretsmanager"
+)
+
+func main() {
+	listen := flag.String("listen", "", "address to serve on instead of running as a Lambda function URL")
+	flag.Parse()
+
+	ctx := context.Background()
+	cfg, err := config.LoadDefaultConfig(ctx)
+	if err != nil {
+		panic(fmt.Sprintf("unable to load SDK config: %v", err))
+	}
+
+	// The secret can be given directly when running locally
+	secret := []byte(os.Getenv("ACK_SECRET"))
+	if len(secret) == 0 {
+		secret, err = ack.LoadSecret(ctx, secretsmanager.NewFromConfig(cfg), os.Getenv("ACK_SECRET_ARN"))
+		if err != nil {
+			panic(err.Error())
+		}
+	}
+
+	// The base URL and snooze duration are only used to create links, which
+	// this command never does
+	store := storage.NewDynamoDBStore(dynamodb.NewFromConfig(cfg), os.Getenv("DYNAMODB_TABLE_NAME"), os.Getenv("ACCOUNT_ID"))
+	handler := ack.NewHandler(ack.NewSigner(secret, "", time.Hour), store)
+
+	if *listen != "" {
+		fmt.Printf("Listening on %s\n", *listen)
+		if err := http.ListenAndServe(*listen, handler); err != nil {
+			panic(err.Error())
+		}
+		return
+	}
+
+	lambdaurl.Start(handler)
+}
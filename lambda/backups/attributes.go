@@ -0,0 +1,77 @@
+package backups
+
+import (
+	"context"
+	"fmt"
+
+	"rds-backup-monitor/lambda/storage"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/rds"
+	rdsTypes "github.com/aws/aws-sdk-go-v2/service/rds/types"
+)
+
+// SnapshotAttributesClient reads the sharing attributes of manual snapshots.
+type SnapshotAttributesClient interface {
+	DescribeDBSnapshotAttributes(ctx context.Context, params *rds.DescribeDBSnapshotAttributesInput, optFns ...func(*rds.Options)) (*rds.DescribeDBSnapshotAttributesOutput, error)
+	DescribeDBClusterSnapshotAttributes(ctx context.Context, params *rds.DescribeDBClusterSnapshotAttributesInput, optFns ...func(*rds.Options)) (*rds.DescribeDBClusterSnapshotAttributesOutput, error)
+}
+
+// restoreAttribute lists the accounts allowed to copy or restore a snapshot;
+// the value "all" makes the snapshot public.
+const restoreAttribute = "restore"
+
+// FindPublicSnapshots returns the identifiers of the snapshots that any AWS
+// account can restore. Only available manual snapshots can be shared, so the
+// attributes of other snapshots are not read.
+func FindPublicSnapshots(ctx context.Context, client SnapshotAttributesClient, snapshots []storage.SnapshotInfo) (map[string]bool, error) {
+	public := make(map[string]bool)
+
+	for _, snapshot := range snapshots {
+		if snapshot.CreationType != "manual" || snapshot.Status != "available" {
+			continue
+		}
+
+		var attributes []rdsTypes.DBSnapshotAttribute
+		switch snapshot.SnapshotType {
+		case "instance":
+			output, err := client.DescribeDBSnapshotAttributes(ctx, &rds.DescribeDBSnapshotAttributesInput{
+				DBSnapshotIdentifier: aws.String(snapshot.SnapshotID),
+			})
+			if err != nil {
+				return nil, fmt.Errorf("error getting attributes of DB snapshot %s: %v", snapshot.SnapshotID, err)
+			}
+			if output.DBSnapshotAttributesResult != nil {
+				attributes = output.DBSnapshotAttributesResult.DBSnapshotAttributes
+			}
+		case "cluster":
+			output, err := client.DescribeDBClusterSnapshotAttributes(ctx, &rds.DescribeDBClusterSnapshotAttributesInput{
+				DBClusterSnapshotIdentifier: aws.String(snapshot.SnapshotID),
+			})
+			if err != nil {
+				return nil, fmt.Errorf("error getting attributes of DB cluster snapshot %s: %v", snapshot.SnapshotID, err)
+			}
+			if output.DBClusterSnapshotAttributesResult != nil {
+				for _, attribute := range output.DBClusterSnapshotAttributesResult.DBClusterSnapshotAttributes {
+					attributes = append(attributes, rdsTypes.DBSnapshotAttribute{
+						AttributeName:   attribute.AttributeName,
+						AttributeValues: attribute.AttributeValues,
+					})
+				}
+			}
+		}
+
+		for _, attribute := range attributes {
+			if aws.ToString(attribute.AttributeName) != restoreAttribute {
+				continue
+			}
+			for _, value := range attribute.AttributeValues {
+				if value == "all" {
+					public[snapshot.SnapshotID] = true
+				}
+			}
+		}
+	}
+
+	return public, nil
+}
@@ -0,0 +1,90 @@
+package backups
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"rds-backup-monitor/lambda/storage"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/rds"
+	rdsTypes "github.com/aws/aws-sdk-go-v2/service/rds/types"
+	"github.com/stretchr/testify/assert"
+)
+
+type mockAttributesClient struct {
+	// restore holds the restore attribute values by snapshot identifier
+	restore map[string][]string
+	calls   []string
+	err     error
+}
+
+func (m *mockAttributesClient) DescribeDBSnapshotAttributes(ctx context.Context, params *rds.DescribeDBSnapshotAttributesInput, optFns ...func(*rds.Options)) (*rds.DescribeDBSnapshotAttributesOutput, error) {
+	id := aws.ToString(params.DBSnapshotIdentifier)
+	m.calls = append(m.calls, id)
+	return &rds.DescribeDBSnapshotAttributesOutput{
+		DBSnapshotAttributesResult: &rdsTypes.DBSnapshotAttributesResult{
+			DBSnapshotAttributes: []rdsTypes.DBSnapshotAttribute{
+				{AttributeName: aws.String("restore"), AttributeValues: m.restore[id]},
+			},
+		},
+	}, m.err
+}
+
+func (m *mockAttributesClient) DescribeDBClusterSnapshotAttributes(ctx context.Context, params *rds.DescribeDBClusterSnapshotAttributesInput, optFns ...func(*rds.Options)) (*rds.DescribeDBClusterSnapshotAttributesOutput, error) {
+	id := aws.ToString(params.DBClusterSnapshotIdentifier)
+	m.calls = append(m.calls, id)
+	return &rds.DescribeDBClusterSnapshotAttributesOutput{
+		DBClusterSnapshotAttributesResult: &rdsTypes.DBClusterSnapshotAttributesResult{
+			DBClusterSnapshotAttributes: []rdsTypes.DBClusterSnapshotAttribute{
+				{AttributeName: aws.String("restore"), AttributeValues: m.restore[id]},
+			},
+		},
+	}, m.err
+}
+
+func TestFindPublicSnapshots(t *testing.T) {
+	snapshots := []storage.SnapshotInfo{
+		{SnapshotID: "public-instance", SnapshotType: "instance", CreationType: "manual", Status: "available"},
+		{SnapshotID: "shared-instance", SnapshotType: "instance", CreationType: "manual", Status: "available"},
+		{SnapshotID: "public-cluster", SnapshotType: "cluster", CreationType: "manual", Status: "available"},
+		{SnapshotID: "rds:automated", SnapshotType: "instance", CreationType: "automated", Status: "available"},
+		{SnapshotID: "creating", SnapshotType: "instance", CreationType: "manual", Status: "creating"},
+	}
+
+	tests := []struct {
+		name    string
+		client  *mockAttributesClient
+		want    map[string]bool
+		wantErr bool
+	}{
+		{
+			name: "public snapshots",
+			client: &mockAttributesClient{restore: map[string][]string{
+				"public-instance": {"all"},
+				"shared-instance": {"210987654321"},
+				"public-cluster":  {"210987654321", "all"},
+			}},
+			want: map[string]bool{"public-instance": true, "public-cluster": true},
+		},
+		{
+			name:    "error",
+			client:  &mockAttributesClient{err: fmt.Errorf("throttled")},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := FindPublicSnapshots(context.Background(), tt.client, snapshots)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+			assert.Equal(t, []string{"public-instance", "shared-instance", "public-cluster"}, tt.client.calls)
+		})
+	}
+}
@@ -2,8 +2,12 @@ package backups
 
 import (
 	"context"
+	"iter"
 	"rds-backup-monitor/lambda/storage"
 	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	rdsTypes "github.com/aws/aws-sdk-go-v2/service/rds/types"
 )
 
 func filterSnapshots[T SnapshotFilter](snapshots []T, cutoffTime time.Time) []T {
@@ -16,23 +20,48 @@ func filterSnapshots[T SnapshotFilter](snapshots []T, cutoffTime time.Time) []T
 	return filtered
 }
 
+// pages yields the pages of a paginated listing as they are fetched, up to and
+// including the first error.
+func pages[T any](ctx context.Context, nextPage func(context.Context) ([]T, error), hasMore func() bool) iter.Seq2[[]T, error] {
+	return func(yield func([]T, error) bool) {
+		for hasMore() {
+			page, err := nextPage(ctx)
+			if !yield(page, err) || err != nil {
+				return
+			}
+		}
+	}
+}
+
 func getFilteredSnapshotsGeneric[T SnapshotFilter](
 	ctx context.Context,
 	nextPage func(context.Context) ([]T, error),
 	hasMore func() bool,
 	cutoffTime time.Time,
 ) ([]T, error) {
-	var allSnapshots []T
+	// Each page is filtered as it arrives, so only the snapshots created after
+	// the cutoff are kept, not the whole listing
+	var filtered []T
 
-	for hasMore() {
-		snapshots, err := nextPage(ctx)
+	for snapshots, err := range pages(ctx, nextPage, hasMore) {
 		if err != nil {
 			return nil, err
 		}
-		allSnapshots = append(allSnapshots, snapshots...)
+		filtered = append(filtered, filterSnapshots(snapshots, cutoffTime)...)
 	}
 
-	return filterSnapshots(allSnapshots, cutoffTime), nil
+	return filtered, nil
+}
+
+func tagMap(tagList []rdsTypes.Tag) map[string]string {
+	if len(tagList) == 0 {
+		return nil
+	}
+	tags := make(map[string]string, len(tagList))
+	for _, tag := range tagList {
+		tags[aws.ToString(tag.Key)] = aws.ToString(tag.Value)
+	}
+	return tags
 }
 
 func ProcessSnapshots(instanceSnapshots []DBSnapshotWrapper, clusterSnapshots []DBClusterSnapshotWrapper) []storage.SnapshotInfo {
@@ -41,20 +70,43 @@ func ProcessSnapshots(instanceSnapshots []DBSnapshotWrapper, clusterSnapshots []
 	for _, snapshot := range instanceSnapshots {
 		results = append(results, storage.SnapshotInfo{
 			SnapshotID:   *snapshot.DBSnapshotIdentifier,
+			SnapshotArn:  aws.ToString(snapshot.DBSnapshotArn),
 			SnapshotType: "instance",
+			CreationType: aws.ToString(snapshot.SnapshotType),
+			SourceID:     aws.ToString(snapshot.DBInstanceIdentifier),
 			CreateTime:   *snapshot.SnapshotCreateTime,
 			Status:       string(*snapshot.Status),
+			Tags:         tagMap(snapshot.TagList),
+			StorageGiB:   aws.ToInt32(snapshot.AllocatedStorage),
+			Encrypted:    aws.ToBool(snapshot.Encrypted),
 		})
 	}
 
 	for _, snapshot := range clusterSnapshots {
 		results = append(results, storage.SnapshotInfo{
 			SnapshotID:   *snapshot.DBClusterSnapshotIdentifier,
+			SnapshotArn:  aws.ToString(snapshot.DBClusterSnapshotArn),
 			SnapshotType: "cluster",
+			CreationType: aws.ToString(snapshot.SnapshotType),
+			SourceID:     aws.ToString(snapshot.DBClusterIdentifier),
 			CreateTime:   *snapshot.SnapshotCreateTime,
 			Status:       string(*snapshot.Status),
+			Tags:         tagMap(snapshot.TagList),
+			StorageGiB:   aws.ToInt32(snapshot.AllocatedStorage),
+			Encrypted:    aws.ToBool(snapshot.StorageEncrypted),
 		})
 	}
 
 	return results
 }
+
+// CreatedAfter returns the snapshots created after cutoffTime.
+func CreatedAfter(snapshots []storage.SnapshotInfo, cutoffTime time.Time) []storage.SnapshotInfo {
+	var filtered []storage.SnapshotInfo
+	for _, snapshot := range snapshots {
+		if snapshot.CreateTime.After(cutoffTime) {
+			filtered = append(filtered, snapshot)
+		}
+	}
+	return filtered
+}
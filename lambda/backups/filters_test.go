@@ -2,6 +2,7 @@ package backups
 
 import (
 	"context"
+	"rds-backup-monitor/lambda/storage"
 	"testing"
 	"time"
 
@@ -166,3 +167,44 @@ func TestProcessSnapshots(t *testing.T) {
 		})
 	}
 }
+
+func TestProcessSnapshots_CopiesMetadata(t *testing.T) {
+	now := time.Now()
+
+	results := ProcessSnapshots([]DBSnapshotWrapper{
+		{
+			DBSnapshot: &rdsTypes.DBSnapshot{
+				DBSnapshotIdentifier: aws.String("rds:db-1-2024-11-20"),
+				DBSnapshotArn:        aws.String("arn:aws:rds:us-west-2:123456789012:snapshot:rds:db-1-2024-11-20"),
+				DBInstanceIdentifier: aws.String("db-1"),
+				SnapshotType:         aws.String("automated"),
+				SnapshotCreateTime:   &now,
+				Status:               aws.String("available"),
+				Encrypted:            aws.Bool(true),
+				TagList: []rdsTypes.Tag{
+					{Key: aws.String("env"), Value: aws.String("prod")},
+				},
+			},
+		},
+	}, nil)
+
+	assert.Len(t, results, 1)
+	assert.Equal(t, "db-1", results[0].SourceID)
+	assert.Equal(t, "automated", results[0].CreationType)
+	assert.Equal(t, "arn:aws:rds:us-west-2:123456789012:snapshot:rds:db-1-2024-11-20", results[0].SnapshotArn)
+	assert.Equal(t, map[string]string{"env": "prod"}, results[0].Tags)
+	assert.True(t, results[0].Encrypted)
+}
+
+func TestCreatedAfter(t *testing.T) {
+	now := time.Now()
+	snapshots := []storage.SnapshotInfo{
+		{SnapshotID: "old", CreateTime: now.Add(-48 * time.Hour)},
+		{SnapshotID: "new", CreateTime: now.Add(-time.Hour)},
+	}
+
+	filtered := CreatedAfter(snapshots, now.Add(-24*time.Hour))
+
+	assert.Len(t, filtered, 1)
+	assert.Equal(t, "new", filtered[0].SnapshotID)
+}
@@ -5,12 +5,15 @@ import (
 	"fmt"
 	"time"
 
+	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/service/rds"
 )
 
 type RDSClient interface {
 	DescribeDBSnapshots(ctx context.Context, params *rds.DescribeDBSnapshotsInput, optFns ...func(*rds.Options)) (*rds.DescribeDBSnapshotsOutput, error)
 	DescribeDBClusterSnapshots(ctx context.Context, params *rds.DescribeDBClusterSnapshotsInput, optFns ...func(*rds.Options)) (*rds.DescribeDBClusterSnapshotsOutput, error)
+	DescribeDBInstances(ctx context.Context, params *rds.DescribeDBInstancesInput, optFns ...func(*rds.Options)) (*rds.DescribeDBInstancesOutput, error)
+	DescribeDBClusters(ctx context.Context, params *rds.DescribeDBClustersInput, optFns ...func(*rds.Options)) (*rds.DescribeDBClustersOutput, error)
 }
 
 func (s DBSnapshotWrapper) GetCreateTime() *time.Time {
@@ -66,3 +69,51 @@ func GetFilteredClusterSnapshots(ctx context.Context, rdsClient RDSClient, cutof
 		cutoffTime,
 	)
 }
+
+// ListDatabases returns the DB clusters and the DB instances that are not part
+// of a cluster. Cluster members are skipped because their backups are taken at
+// the cluster level.
+func ListDatabases(ctx context.Context, rdsClient RDSClient) ([]Database, error) {
+	var databases []Database
+
+	instancePaginator := rds.NewDescribeDBInstancesPaginator(rdsClient, &rds.DescribeDBInstancesInput{})
+	for instancePaginator.HasMorePages() {
+		output, err := instancePaginator.NextPage(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("error getting DB instances page: %v", err)
+		}
+		for _, instance := range output.DBInstances {
+			if instance.DBClusterIdentifier != nil {
+				continue
+			}
+			databases = append(databases, Database{
+				Identifier:            aws.ToString(instance.DBInstanceIdentifier),
+				Arn:                   aws.ToString(instance.DBInstanceArn),
+				Type:                  "instance",
+				Engine:                aws.ToString(instance.Engine),
+				BackupRetentionPeriod: aws.ToInt32(instance.BackupRetentionPeriod),
+				Tags:                  tagMap(instance.TagList),
+			})
+		}
+	}
+
+	clusterPaginator := rds.NewDescribeDBClustersPaginator(rdsClient, &rds.DescribeDBClustersInput{})
+	for clusterPaginator.HasMorePages() {
+		output, err := clusterPaginator.NextPage(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("error getting DB clusters page: %v", err)
+		}
+		for _, cluster := range output.DBClusters {
+			databases = append(databases, Database{
+				Identifier:            aws.ToString(cluster.DBClusterIdentifier),
+				Arn:                   aws.ToString(cluster.DBClusterArn),
+				Type:                  "cluster",
+				Engine:                aws.ToString(cluster.Engine),
+				BackupRetentionPeriod: aws.ToInt32(cluster.BackupRetentionPeriod),
+				Tags:                  tagMap(cluster.TagList),
+			})
+		}
+	}
+
+	return databases, nil
+}
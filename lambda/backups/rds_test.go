@@ -15,6 +15,8 @@ import (
 type mockRDSClient struct {
 	describeDBSnapshotsOutput *rds.DescribeDBSnapshotsOutput
 	describeDBClustersOutput  *rds.DescribeDBClusterSnapshotsOutput
+	dbInstancesOutput         *rds.DescribeDBInstancesOutput
+	dbClustersOutput          *rds.DescribeDBClustersOutput
 	err                       error
 }
 
@@ -26,6 +28,14 @@ func (m *mockRDSClient) DescribeDBClusterSnapshots(ctx context.Context, params *
 	return m.describeDBClustersOutput, m.err
 }
 
+func (m *mockRDSClient) DescribeDBInstances(ctx context.Context, params *rds.DescribeDBInstancesInput, optFns ...func(*rds.Options)) (*rds.DescribeDBInstancesOutput, error) {
+	return m.dbInstancesOutput, m.err
+}
+
+func (m *mockRDSClient) DescribeDBClusters(ctx context.Context, params *rds.DescribeDBClustersInput, optFns ...func(*rds.Options)) (*rds.DescribeDBClustersOutput, error) {
+	return m.dbClustersOutput, m.err
+}
+
 func TestGetFilteredSnapshots(t *testing.T) {
 	ctx := context.Background()
 	now := time.Now()
@@ -123,3 +133,81 @@ func TestGetFilteredClusterSnapshots(t *testing.T) {
 		})
 	}
 }
+
+func TestListDatabases(t *testing.T) {
+	ctx := context.Background()
+
+	tests := []struct {
+		name    string
+		client  *mockRDSClient
+		want    []Database
+		wantErr bool
+	}{
+		{
+			name: "lists standalone instances and clusters",
+			client: &mockRDSClient{
+				dbInstancesOutput: &rds.DescribeDBInstancesOutput{
+					DBInstances: []types.DBInstance{
+						{
+							DBInstanceIdentifier:  aws.String("db-1"),
+							DBInstanceArn:         aws.String("arn:aws:rds:us-west-2:123456789012:db:db-1"),
+							Engine:                aws.String("postgres"),
+							BackupRetentionPeriod: aws.Int32(7),
+							TagList:               []types.Tag{{Key: aws.String("team"), Value: aws.String("payments")}},
+						},
+						{
+							DBInstanceIdentifier: aws.String("cluster-1-instance-1"),
+							DBClusterIdentifier:  aws.String("cluster-1"),
+						},
+					},
+				},
+				dbClustersOutput: &rds.DescribeDBClustersOutput{
+					DBClusters: []types.DBCluster{
+						{
+							DBClusterIdentifier:   aws.String("cluster-1"),
+							DBClusterArn:          aws.String("arn:aws:rds:us-west-2:123456789012:cluster:cluster-1"),
+							Engine:                aws.String("aurora-mysql"),
+							BackupRetentionPeriod: aws.Int32(1),
+						},
+					},
+				},
+			},
+			want: []Database{
+				{
+					Identifier:            "db-1",
+					Arn:                   "arn:aws:rds:us-west-2:123456789012:db:db-1",
+					Type:                  "instance",
+					Engine:                "postgres",
+					BackupRetentionPeriod: 7,
+					Tags:                  map[string]string{"team": "payments"},
+				},
+				{
+					Identifier:            "cluster-1",
+					Arn:                   "arn:aws:rds:us-west-2:123456789012:cluster:cluster-1",
+					Type:                  "cluster",
+					Engine:                "aurora-mysql",
+					BackupRetentionPeriod: 1,
+				},
+			},
+		},
+		{
+			name: "handles error from AWS",
+			client: &mockRDSClient{
+				err: fmt.Errorf("AWS error"),
+			},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			databases, err := ListDatabases(ctx, tt.client)
+			if tt.wantErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+				assert.Equal(t, tt.want, databases)
+			}
+		})
+	}
+}
@@ -0,0 +1,139 @@
+package backups
+
+import (
+	"context"
+	"fmt"
+	"iter"
+	"time"
+
+	"rds-backup-monitor/lambda/storage"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/rds"
+)
+
+// Snapshot listings of a region, scanned in this order.
+const (
+	ListingInstance = "instance"
+	ListingCluster  = "cluster"
+)
+
+// Position is where a snapshot scan of a region continues: the listing and the
+// marker of its next page. The zero Position is the first page of instance
+// snapshots.
+type Position struct {
+	Listing string
+	Marker  string
+}
+
+// Page is a page of snapshots of a region. Next is the position of the page
+// after it; Last is set on the last cluster snapshot page.
+type Page struct {
+	Snapshots []storage.SnapshotInfo
+	Next      Position
+	Last      bool
+}
+
+// SnapshotPages yields the pages of the instance and then the cluster
+// snapshots of a region from position, fetching each page only once the
+// previous one was consumed. The snapshots of a page are converted and limited
+// to those created after cutoffTime, so a page holds no more than the RDS
+// response it came from. Iteration ends after the last page or the first
+// error.
+func SnapshotPages(ctx context.Context, rdsClient RDSClient, position Position, cutoffTime time.Time) iter.Seq2[Page, error] {
+	return func(yield func(Page, error) bool) {
+		for {
+			page, err := fetchPage(ctx, rdsClient, position, cutoffTime)
+			if !yield(page, err) || err != nil || page.Last {
+				return
+			}
+			position = page.Next
+		}
+	}
+}
+
+func fetchPage(ctx context.Context, rdsClient RDSClient, position Position, cutoffTime time.Time) (Page, error) {
+	var page Page
+	var marker *string
+
+	switch position.Listing {
+	case "", ListingInstance:
+		output, err := rdsClient.DescribeDBSnapshots(ctx, &rds.DescribeDBSnapshotsInput{
+			Marker: optionalString(position.Marker),
+		})
+		if err != nil {
+			return Page{}, fmt.Errorf("error getting DB snapshots page: %v", err)
+		}
+		wrappers := make([]DBSnapshotWrapper, len(output.DBSnapshots))
+		for i := range output.DBSnapshots {
+			wrappers[i] = DBSnapshotWrapper{&output.DBSnapshots[i]}
+		}
+		page.Snapshots = ProcessSnapshots(filterSnapshots(wrappers, cutoffTime), nil)
+		marker = output.Marker
+		position.Listing = ListingInstance
+	case ListingCluster:
+		output, err := rdsClient.DescribeDBClusterSnapshots(ctx, &rds.DescribeDBClusterSnapshotsInput{
+			Marker: optionalString(position.Marker),
+		})
+		if err != nil {
+			return Page{}, fmt.Errorf("error getting DB cluster snapshots page: %v", err)
+		}
+		wrappers := make([]DBClusterSnapshotWrapper, len(output.DBClusterSnapshots))
+		for i := range output.DBClusterSnapshots {
+			wrappers[i] = DBClusterSnapshotWrapper{&output.DBClusterSnapshots[i]}
+		}
+		page.Snapshots = ProcessSnapshots(nil, filterSnapshots(wrappers, cutoffTime))
+		marker = output.Marker
+	default:
+		return Page{}, fmt.Errorf("unknown snapshot listing %q", position.Listing)
+	}
+
+	switch {
+	case aws.ToString(marker) != "":
+		page.Next = Position{Listing: position.Listing, Marker: aws.ToString(marker)}
+	case position.Listing == ListingInstance:
+		page.Next = Position{Listing: ListingCluster}
+	default:
+		page.Last = true
+	}
+	return page, nil
+}
+
+// ScanSnapshots passes the pages of SnapshotPages to visit, which is called
+// for empty pages as well. Before fetching a page it calls stop; once stop
+// returns true the scan ends early and returns the position of the next page.
+// done is set when every page was seen.
+func ScanSnapshots(ctx context.Context, rdsClient RDSClient, position Position, cutoffTime time.Time,
+	stop func() bool, visit func([]storage.SnapshotInfo) error) (next Position, done bool, err error) {
+
+	if position.Listing == "" {
+		position.Listing = ListingInstance
+	}
+	if stop() {
+		return position, false, nil
+	}
+
+	for page, err := range SnapshotPages(ctx, rdsClient, position, cutoffTime) {
+		if err != nil {
+			return position, false, err
+		}
+		if err := visit(page.Snapshots); err != nil {
+			return position, false, err
+		}
+		if page.Last {
+			return Position{}, true, nil
+		}
+		position = page.Next
+		if stop() {
+			return position, false, nil
+		}
+	}
+	return position, false, nil
+}
+
+func optionalString(value string) *string {
+	if value == "" {
+		return nil
+	}
+	return aws.String(value)
+}
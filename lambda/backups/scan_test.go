@@ -0,0 +1,220 @@
+package backups
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"testing"
+	"time"
+
+	"rds-backup-monitor/lambda/storage"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/rds"
+	"github.com/aws/aws-sdk-go-v2/service/rds/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// benchmarkSnapshots is the number of synthetic snapshots of the benchmarks,
+// listed in pages of 100 like the RDS API does by default.
+const benchmarkSnapshots = 100_000
+
+// pagedRDSClient serves instance and cluster snapshots in pages of pageSize,
+// using the index of the next snapshot as marker.
+type pagedRDSClient struct {
+	mockRDSClient
+	instanceSnapshots []types.DBSnapshot
+	clusterSnapshots  []types.DBClusterSnapshot
+	pageSize          int
+	calls             int
+}
+
+func (m *pagedRDSClient) page(marker *string, total int) (start, end int, next *string) {
+	start, _ = strconv.Atoi(aws.ToString(marker))
+	end = min(start+m.pageSize, total)
+	if end < total {
+		next = aws.String(strconv.Itoa(end))
+	}
+	return start, end, next
+}
+
+func (m *pagedRDSClient) DescribeDBSnapshots(ctx context.Context, params *rds.DescribeDBSnapshotsInput, optFns ...func(*rds.Options)) (*rds.DescribeDBSnapshotsOutput, error) {
+	m.calls++
+	start, end, next := m.page(params.Marker, len(m.instanceSnapshots))
+	return &rds.DescribeDBSnapshotsOutput{DBSnapshots: m.instanceSnapshots[start:end], Marker: next}, nil
+}
+
+func (m *pagedRDSClient) DescribeDBClusterSnapshots(ctx context.Context, params *rds.DescribeDBClusterSnapshotsInput, optFns ...func(*rds.Options)) (*rds.DescribeDBClusterSnapshotsOutput, error) {
+	m.calls++
+	start, end, next := m.page(params.Marker, len(m.clusterSnapshots))
+	return &rds.DescribeDBClusterSnapshotsOutput{DBClusterSnapshots: m.clusterSnapshots[start:end], Marker: next}, nil
+}
+
+func newPagedRDSClient(instances, clusters, pageSize int, createTime time.Time) *pagedRDSClient {
+	client := &pagedRDSClient{pageSize: pageSize}
+	for i := 0; i < instances; i++ {
+		client.instanceSnapshots = append(client.instanceSnapshots, types.DBSnapshot{
+			DBSnapshotIdentifier: aws.String(fmt.Sprintf("instance-%d", i)),
+			DBInstanceIdentifier: aws.String("orders"),
+			SnapshotCreateTime:   aws.Time(createTime),
+			Status:               aws.String("available"),
+		})
+	}
+	for i := 0; i < clusters; i++ {
+		client.clusterSnapshots = append(client.clusterSnapshots, types.DBClusterSnapshot{
+			DBClusterSnapshotIdentifier: aws.String(fmt.Sprintf("cluster-%d", i)),
+			DBClusterIdentifier:         aws.String("catalog"),
+			SnapshotCreateTime:          aws.Time(createTime),
+			Status:                      aws.String("available"),
+		})
+	}
+	return client
+}
+
+func TestScanSnapshots(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now()
+	never := func() bool { return false }
+
+	t.Run("scans every page of both listings", func(t *testing.T) {
+		client := newPagedRDSClient(5, 3, 2, now)
+
+		var ids []string
+		position, done, err := ScanSnapshots(ctx, client, Position{}, now.Add(-time.Hour), never,
+			func(snapshots []storage.SnapshotInfo) error {
+				for _, snapshot := range snapshots {
+					ids = append(ids, snapshot.SnapshotType+"/"+snapshot.SnapshotID)
+				}
+				return nil
+			})
+
+		require.NoError(t, err)
+		assert.True(t, done)
+		assert.Equal(t, Position{}, position)
+		assert.Equal(t, []string{
+			"instance/instance-0", "instance/instance-1", "instance/instance-2", "instance/instance-3", "instance/instance-4",
+			"cluster/cluster-0", "cluster/cluster-1", "cluster/cluster-2",
+		}, ids)
+		assert.Equal(t, 5, client.calls)
+	})
+
+	t.Run("skips snapshots created before the cutoff", func(t *testing.T) {
+		client := newPagedRDSClient(3, 0, 10, now.AddDate(0, 0, -30))
+
+		pages := 0
+		_, done, err := ScanSnapshots(ctx, client, Position{}, now.AddDate(0, 0, -7), never,
+			func(snapshots []storage.SnapshotInfo) error {
+				pages++
+				assert.Empty(t, snapshots)
+				return nil
+			})
+
+		require.NoError(t, err)
+		assert.True(t, done)
+		assert.Equal(t, 2, pages, "empty pages are visited")
+	})
+
+	t.Run("stops and resumes at the position of the next page", func(t *testing.T) {
+		client := newPagedRDSClient(5, 3, 2, now)
+
+		var ids []string
+		visit := func(snapshots []storage.SnapshotInfo) error {
+			for _, snapshot := range snapshots {
+				ids = append(ids, snapshot.SnapshotID)
+			}
+			return nil
+		}
+
+		calls := 0
+		stopAfterFour := func() bool {
+			calls++
+			return calls > 4
+		}
+		position, done, err := ScanSnapshots(ctx, client, Position{}, time.Time{}, stopAfterFour, visit)
+		require.NoError(t, err)
+		assert.False(t, done)
+		assert.Equal(t, Position{Listing: ListingCluster, Marker: "2"}, position)
+
+		position, done, err = ScanSnapshots(ctx, client, position, time.Time{}, never, visit)
+		require.NoError(t, err)
+		assert.True(t, done)
+		assert.Equal(t, Position{}, position)
+		assert.Equal(t, []string{"instance-0", "instance-1", "instance-2", "instance-3", "instance-4",
+			"cluster-0", "cluster-1", "cluster-2"}, ids)
+	})
+
+	t.Run("returns page errors", func(t *testing.T) {
+		client := &mockRDSClient{err: fmt.Errorf("throttled")}
+		_, done, err := ScanSnapshots(ctx, client, Position{}, time.Time{}, never,
+			func([]storage.SnapshotInfo) error { return nil })
+		assert.ErrorContains(t, err, "error getting DB snapshots page: throttled")
+		assert.False(t, done)
+	})
+}
+
+func TestSnapshotPages(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now()
+
+	t.Run("fetches a page only once the previous one was consumed", func(t *testing.T) {
+		client := newPagedRDSClient(10, 10, 2, now)
+
+		for page, err := range SnapshotPages(ctx, client, Position{}, time.Time{}) {
+			require.NoError(t, err)
+			assert.Len(t, page.Snapshots, 2)
+			assert.Equal(t, Position{Listing: ListingInstance, Marker: "2"}, page.Next)
+			break
+		}
+		assert.Equal(t, 1, client.calls)
+	})
+
+	t.Run("marks the last cluster page", func(t *testing.T) {
+		client := newPagedRDSClient(1, 1, 2, now)
+
+		var pages []Page
+		for page, err := range SnapshotPages(ctx, client, Position{}, time.Time{}) {
+			require.NoError(t, err)
+			pages = append(pages, page)
+		}
+		require.Len(t, pages, 2)
+		assert.Equal(t, Position{Listing: ListingCluster}, pages[0].Next)
+		assert.False(t, pages[0].Last)
+		assert.True(t, pages[1].Last)
+	})
+
+	t.Run("rejects an unknown listing", func(t *testing.T) {
+		for _, err := range SnapshotPages(ctx, &mockRDSClient{}, Position{Listing: "proxy"}, time.Time{}) {
+			assert.ErrorContains(t, err, `unknown snapshot listing "proxy"`)
+		}
+	})
+}
+
+// newBenchmarkClient lists benchmarkSnapshots instance snapshots, one in ten
+// of them created after cutoff.
+func newBenchmarkClient(b *testing.B, cutoff time.Time) *pagedRDSClient {
+	b.Helper()
+	client := newPagedRDSClient(benchmarkSnapshots, 0, 100, cutoff.Add(-time.Hour))
+	for i := 0; i < len(client.instanceSnapshots); i += 10 {
+		client.instanceSnapshots[i].SnapshotCreateTime = aws.Time(cutoff.Add(time.Hour))
+	}
+	return client
+}
+
+func BenchmarkGetFilteredSnapshots(b *testing.B) {
+	ctx := context.Background()
+	cutoff := time.Now().AddDate(0, 0, -7)
+	client := newBenchmarkClient(b, cutoff)
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		snapshots, err := GetFilteredSnapshots(ctx, client, cutoff)
+		if err != nil {
+			b.Fatal(err)
+		}
+		if len(snapshots) != benchmarkSnapshots/10 {
+			b.Fatalf("got %d snapshots", len(snapshots))
+		}
+	}
+}
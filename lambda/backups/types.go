@@ -17,3 +17,13 @@ type DBSnapshotWrapper struct {
 type DBClusterSnapshotWrapper struct {
 	*rdsTypes.DBClusterSnapshot
 }
+
+// Database is a DB instance or DB cluster whose snapshots are monitored.
+type Database struct {
+	Identifier            string
+	Arn                   string
+	Type                  string
+	Engine                string
+	BackupRetentionPeriod int32
+	Tags                  map[string]string
+}
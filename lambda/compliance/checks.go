@@ -0,0 +1,124 @@
+package compliance
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"rds-backup-monitor/lambda/backups"
+	"rds-backup-monitor/lambda/storage"
+)
+
+// DefaultMinRetentionDays is used when no minimum retention is configured.
+const DefaultMinRetentionDays = 7
+
+// Evaluate runs every check against inventory and returns the violations
+// ordered by ID.
+func Evaluate(inventory Inventory, rules Rules) []Violation {
+	var violations []Violation
+
+	lastSuccessful := make(map[string]time.Time)
+	for _, snapshot := range inventory.Snapshots {
+		key := snapshot.SnapshotType + "/" + snapshot.SourceID
+		if snapshot.Status == "available" && snapshot.CreateTime.After(lastSuccessful[key]) {
+			lastSuccessful[key] = snapshot.CreateTime
+		}
+		violations = append(violations, checkSnapshot(inventory, snapshot)...)
+	}
+
+	for _, database := range inventory.Databases {
+		violations = append(violations, checkDatabase(inventory.Region, database,
+			lastSuccessful[database.Type+"/"+database.Identifier], rules)...)
+	}
+
+	sort.Slice(violations, func(i, j int) bool {
+		return violations[i].ID() < violations[j].ID()
+	})
+	return violations
+}
+
+func checkSnapshot(inventory Inventory, snapshot storage.SnapshotInfo) []Violation {
+	if snapshot.Status != "available" {
+		return nil
+	}
+
+	resourceType := ResourceDBSnapshot
+	if snapshot.SnapshotType == "cluster" {
+		resourceType = ResourceDBClusterSnapshot
+	}
+	violation := Violation{
+		Region:       inventory.Region,
+		ResourceType: resourceType,
+		ResourceArn:  snapshot.SnapshotArn,
+		ResourceID:   snapshot.SnapshotID,
+	}
+
+	var violations []Violation
+	if inventory.PublicSnapshots[snapshot.SnapshotID] {
+		public := violation
+		public.Check = CheckPublicSnapshot
+		public.Severity = SeverityCritical
+		public.Title = fmt.Sprintf("RDS snapshot %s is public", snapshot.SnapshotID)
+		public.Description = fmt.Sprintf("Any AWS account can copy or restore snapshot %s of DB %s %s.",
+			snapshot.SnapshotID, snapshot.SnapshotType, snapshot.SourceID)
+		violations = append(violations, public)
+	}
+	if !snapshot.Encrypted {
+		unencrypted := violation
+		unencrypted.Check = CheckUnencryptedSnapshot
+		unencrypted.Severity = SeverityMedium
+		unencrypted.Title = fmt.Sprintf("RDS snapshot %s is not encrypted", snapshot.SnapshotID)
+		unencrypted.Description = fmt.Sprintf("Snapshot %s of DB %s %s is stored without encryption at rest.",
+			snapshot.SnapshotID, snapshot.SnapshotType, snapshot.SourceID)
+		violations = append(violations, unencrypted)
+	}
+	return violations
+}
+
+func checkDatabase(region string, database backups.Database, lastSuccessful time.Time, rules Rules) []Violation {
+	resourceType := ResourceDBInstance
+	if database.Type == "cluster" {
+		resourceType = ResourceDBCluster
+	}
+	label := "DB " + database.Type
+	violation := Violation{
+		Region:       region,
+		ResourceType: resourceType,
+		ResourceArn:  database.Arn,
+		ResourceID:   database.Identifier,
+	}
+
+	var violations []Violation
+	if lastSuccessful.Before(rules.CoverageStart) {
+		missing := violation
+		missing.Check = CheckMissingCoverage
+		missing.Severity = SeverityHigh
+		missing.Title = fmt.Sprintf("RDS %s %s has no recent backup", label, database.Identifier)
+		if lastSuccessful.IsZero() {
+			missing.Description = fmt.Sprintf("No available snapshot of %s %s was found.", label, database.Identifier)
+		} else {
+			missing.Description = fmt.Sprintf("The last available snapshot of %s %s was created at %s.",
+				label, database.Identifier, lastSuccessful.UTC().Format(time.RFC3339))
+		}
+		violations = append(violations, missing)
+	}
+
+	minRetention := rules.MinRetentionDays
+	if minRetention <= 0 {
+		minRetention = DefaultMinRetentionDays
+	}
+	if int(database.BackupRetentionPeriod) < minRetention {
+		retention := violation
+		retention.Check = CheckRetention
+		retention.Severity = SeverityMedium
+		retention.Title = fmt.Sprintf("RDS %s %s keeps backups for too short a time", label, database.Identifier)
+		retention.Description = fmt.Sprintf("%s %s keeps automated backups for %d days, the minimum is %d days.",
+			label, database.Identifier, database.BackupRetentionPeriod, minRetention)
+		if database.BackupRetentionPeriod == 0 {
+			retention.Severity = SeverityHigh
+			retention.Description = fmt.Sprintf("%s %s has automated backups disabled.", label, database.Identifier)
+		}
+		violations = append(violations, retention)
+	}
+	return violations
+}
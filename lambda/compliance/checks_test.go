@@ -0,0 +1,79 @@
+package compliance
+
+import (
+	"testing"
+	"time"
+
+	"rds-backup-monitor/lambda/backups"
+	"rds-backup-monitor/lambda/storage"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEvaluate(t *testing.T) {
+	now := time.Date(2024, 11, 20, 12, 0, 0, 0, time.UTC)
+	rules := Rules{MinRetentionDays: 7, CoverageStart: now.Add(-26 * time.Hour)}
+
+	inventory := Inventory{
+		Region: "us-east-1",
+		Snapshots: []storage.SnapshotInfo{
+			{SnapshotID: "rds:orders-1", SnapshotArn: "arn:snapshot:orders-1", SnapshotType: "instance", SourceID: "orders",
+				Status: "available", Encrypted: true, CreateTime: now.Add(-2 * time.Hour)},
+			{SnapshotID: "orders-export", SnapshotArn: "arn:snapshot:orders-export", SnapshotType: "instance", SourceID: "orders",
+				Status: "available", Encrypted: true, CreateTime: now.Add(-72 * time.Hour)},
+			{SnapshotID: "catalog-1", SnapshotArn: "arn:cluster-snapshot:catalog-1", SnapshotType: "cluster", SourceID: "catalog",
+				Status: "available", CreateTime: now.Add(-48 * time.Hour)},
+			{SnapshotID: "catalog-2", SnapshotArn: "arn:cluster-snapshot:catalog-2", SnapshotType: "cluster", SourceID: "catalog",
+				Status: "failed", CreateTime: now.Add(-time.Hour)},
+		},
+		Databases: []backups.Database{
+			{Identifier: "orders", Arn: "arn:db:orders", Type: "instance", BackupRetentionPeriod: 14},
+			{Identifier: "catalog", Arn: "arn:cluster:catalog", Type: "cluster", BackupRetentionPeriod: 3},
+			{Identifier: "scratch", Arn: "arn:db:scratch", Type: "instance", BackupRetentionPeriod: 0},
+		},
+		PublicSnapshots: map[string]bool{"orders-export": true},
+	}
+
+	violations := Evaluate(inventory, rules)
+
+	type result struct {
+		check    string
+		resource string
+		severity string
+	}
+	var got []result
+	for _, violation := range violations {
+		assert.Equal(t, "us-east-1", violation.Region)
+		assert.NotEmpty(t, violation.Title)
+		assert.NotEmpty(t, violation.Description)
+		got = append(got, result{violation.Check, violation.ResourceArn, violation.Severity})
+	}
+
+	assert.Equal(t, []result{
+		{CheckMissingCoverage, "arn:cluster:catalog", SeverityHigh},
+		{CheckMissingCoverage, "arn:db:scratch", SeverityHigh},
+		{CheckPublicSnapshot, "arn:snapshot:orders-export", SeverityCritical},
+		{CheckRetention, "arn:cluster:catalog", SeverityMedium},
+		{CheckRetention, "arn:db:scratch", SeverityHigh},
+		{CheckUnencryptedSnapshot, "arn:cluster-snapshot:catalog-1", SeverityMedium},
+	}, got)
+
+	assert.Equal(t, ResourceDBClusterSnapshot, violations[5].ResourceType)
+	assert.Equal(t, "DB cluster catalog keeps automated backups for 3 days, the minimum is 7 days.", violations[3].Description)
+	assert.Equal(t, "No available snapshot of DB instance scratch was found.", violations[1].Description)
+}
+
+func TestEvaluate_DefaultRetention(t *testing.T) {
+	inventory := Inventory{
+		Region: "us-east-1",
+		Databases: []backups.Database{
+			{Identifier: "orders", Arn: "arn:db:orders", Type: "instance", BackupRetentionPeriod: 6},
+		},
+	}
+
+	violations := Evaluate(inventory, Rules{})
+
+	assert.Len(t, violations, 1)
+	assert.Equal(t, CheckRetention, violations[0].Check)
+	assert.Equal(t, "retention/arn:db:orders", violations[0].ID())
+}
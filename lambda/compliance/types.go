@@ -0,0 +1,72 @@
+package compliance
+
+import (
+	"time"
+
+	"rds-backup-monitor/lambda/backups"
+	"rds-backup-monitor/lambda/storage"
+)
+
+// Checks evaluated against every region.
+const (
+	// CheckPublicSnapshot flags manual snapshots that any AWS account can restore.
+	CheckPublicSnapshot = "public-snapshot"
+	// CheckUnencryptedSnapshot flags snapshots whose storage is not encrypted.
+	CheckUnencryptedSnapshot = "unencrypted-snapshot"
+	// CheckMissingCoverage flags databases without an available snapshot in the
+	// coverage window.
+	CheckMissingCoverage = "missing-coverage"
+	// CheckRetention flags databases that keep automated backups for fewer days
+	// than required, including databases with automated backups disabled.
+	CheckRetention = "retention"
+)
+
+// Severity labels of violations. They match the ASFF severity labels.
+const (
+	SeverityLow      = "LOW"
+	SeverityMedium   = "MEDIUM"
+	SeverityHigh     = "HIGH"
+	SeverityCritical = "CRITICAL"
+)
+
+// Resource types of violations. They match the ASFF resource types.
+const (
+	ResourceDBInstance        = "AwsRdsDbInstance"
+	ResourceDBCluster         = "AwsRdsDbCluster"
+	ResourceDBSnapshot        = "AwsRdsDbSnapshot"
+	ResourceDBClusterSnapshot = "AwsRdsDbClusterSnapshot"
+)
+
+// Rules configure the thresholds of the checks.
+type Rules struct {
+	// MinRetentionDays is the shortest accepted automated backup retention.
+	MinRetentionDays int
+	// CoverageStart is the start of the coverage window.
+	CoverageStart time.Time
+}
+
+// Inventory is the input of the checks of a single region. PublicSnapshots
+// holds the identifiers of snapshots found by backups.FindPublicSnapshots.
+type Inventory struct {
+	Region          string
+	Snapshots       []storage.SnapshotInfo
+	Databases       []backups.Database
+	PublicSnapshots map[string]bool
+}
+
+// Violation is a resource that fails a check.
+type Violation struct {
+	Check        string `json:"check"`
+	Region       string `json:"region"`
+	ResourceType string `json:"resourceType"`
+	ResourceArn  string `json:"resourceArn"`
+	ResourceID   string `json:"resourceId"`
+	Severity     string `json:"severity"`
+	Title        string `json:"title"`
+	Description  string `json:"description"`
+}
+
+// ID identifies the violation across runs.
+func (v Violation) ID() string {
+	return v.Check + "/" + v.ResourceArn
+}
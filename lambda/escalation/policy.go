@@ -0,0 +1,167 @@
+package escalation
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"rds-backup-monitor/lambda/storage"
+	"rds-backup-monitor/lambda/types"
+)
+
+// Policy is a parsed escalation policy.
+type Policy struct {
+	Intervals     []time.Duration
+	EscalateAfter int
+}
+
+// NewPolicy parses and validates config.
+func NewPolicy(config types.EscalationPolicy) (Policy, error) {
+	if len(config.Intervals) == 0 {
+		return Policy{}, fmt.Errorf("escalation policy needs at least one interval")
+	}
+	if config.EscalateAfter < 0 {
+		return Policy{}, fmt.Errorf("escalateAfter must not be negative")
+	}
+
+	policy := Policy{EscalateAfter: config.EscalateAfter}
+	for _, value := range config.Intervals {
+		interval, err := time.ParseDuration(value)
+		if err != nil {
+			return Policy{}, fmt.Errorf("invalid escalation interval %q: %v", value, err)
+		}
+		if interval <= 0 {
+			return Policy{}, fmt.Errorf("escalation interval %q must be positive", value)
+		}
+		policy.Intervals = append(policy.Intervals, interval)
+	}
+	return policy, nil
+}
+
+// interval returns the time to wait after reminders reminders were sent.
+func (p Policy) interval(reminders int) time.Duration {
+	if reminders >= len(p.Intervals) {
+		return p.Intervals[len(p.Intervals)-1]
+	}
+	return p.Intervals[reminders]
+}
+
+// FindProblems returns the databases of inventory whose latest snapshot failed
+// or that have no available snapshot created after coverageStart.
+func FindProblems(inventory RegionInventory, coverageStart time.Time) []Problem {
+	latest := make(map[string]storage.SnapshotInfo)
+	lastSuccessful := make(map[string]time.Time)
+
+	for _, snapshot := range inventory.Snapshots {
+		key := snapshot.SnapshotType + "/" + snapshot.SourceID
+		if current, ok := latest[key]; !ok || snapshot.CreateTime.After(current.CreateTime) {
+			latest[key] = snapshot
+		}
+		if snapshot.Status == "available" && snapshot.CreateTime.After(lastSuccessful[key]) {
+			lastSuccessful[key] = snapshot.CreateTime
+		}
+	}
+
+	var problems []Problem
+	for _, database := range inventory.Databases {
+		key := database.Type + "/" + database.Identifier
+		problem := Problem{
+			Region:         inventory.Region,
+			DatabaseType:   database.Type,
+			DatabaseID:     database.Identifier,
+			DatabaseArn:    database.Arn,
+			LastSuccessful: lastSuccessful[key],
+			Tags:           database.Tags,
+		}
+		if snapshot, ok := latest[key]; ok {
+			problem.SnapshotID = snapshot.SnapshotID
+			problem.SnapshotStatus = snapshot.Status
+		}
+
+		switch {
+		case storage.IsFailedStatus(problem.SnapshotStatus):
+			problem.Kind = ProblemFailed
+		case problem.LastSuccessful.Before(coverageStart):
+			problem.Kind = ProblemMissing
+		default:
+			continue
+		}
+		problems = append(problems, problem)
+	}
+
+	sort.Slice(problems, func(i, j int) bool {
+		return problems[i].DatabaseID < problems[j].DatabaseID
+	})
+	return problems
+}
+
+// Evaluate compares the problems of a region with the stored escalation states
+// and returns the reminders that are due, the states to store and the states
+// of databases that recovered.
+//
+// A failed snapshot was already reported as a snapshot change, so the first
+// reminder of a failed database waits for the first interval. Missing
+// snapshots produce no change, so they are alerted right away.
+func (p Policy) Evaluate(problems []Problem, states map[string]storage.EscalationState, now time.Time) (
+	reminders []Reminder, updates []storage.EscalationState, resolved []storage.EscalationState) {
+
+	seen := make(map[string]bool)
+
+	for _, problem := range problems {
+		key := problem.DatabaseType + "/" + problem.DatabaseID
+		seen[key] = true
+
+		state, ok := states[key]
+		if !ok {
+			state = storage.EscalationState{
+				Region:       problem.Region,
+				DatabaseType: problem.DatabaseType,
+				DatabaseID:   problem.DatabaseID,
+				Since:        now,
+				LastNotified: now,
+			}
+			state.Problem = problem.Kind
+			state.SnapshotID = problem.SnapshotID
+			updates = append(updates, state)
+
+			if problem.Kind == ProblemMissing {
+				reminders = append(reminders, Reminder{Problem: problem, Since: now})
+			}
+			continue
+		}
+
+		if now.Sub(state.LastNotified) < p.interval(state.Reminders) {
+			// Keep the problem up to date without resetting the schedule
+			if state.Problem != problem.Kind || state.SnapshotID != problem.SnapshotID {
+				state.Problem = problem.Kind
+				state.SnapshotID = problem.SnapshotID
+				updates = append(updates, state)
+			}
+			continue
+		}
+
+		state.Problem = problem.Kind
+		state.SnapshotID = problem.SnapshotID
+		state.Reminders++
+		state.LastNotified = now
+		updates = append(updates, state)
+
+		reminders = append(reminders, Reminder{
+			Problem:   problem,
+			Since:     state.Since,
+			Count:     state.Reminders,
+			Escalated: state.Reminders > p.EscalateAfter,
+		})
+	}
+
+	for key, state := range states {
+		if !seen[key] {
+			resolved = append(resolved, state)
+		}
+	}
+	sort.Slice(resolved, func(i, j int) bool {
+		return resolved[i].Key() < resolved[j].Key()
+	})
+
+	return reminders, updates, resolved
+}
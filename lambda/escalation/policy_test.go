@@ -0,0 +1,185 @@
+package escalation
+
+import (
+	"testing"
+	"time"
+
+	"rds-backup-monitor/lambda/backups"
+	"rds-backup-monitor/lambda/storage"
+	"rds-backup-monitor/lambda/types"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewPolicy(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  types.EscalationPolicy
+		want    Policy
+		wantErr bool
+	}{
+		{
+			name:   "parses intervals",
+			config: types.EscalationPolicy{Intervals: []string{"1h", "4h", "24h"}, EscalateAfter: 2},
+			want:   Policy{Intervals: []time.Duration{time.Hour, 4 * time.Hour, 24 * time.Hour}, EscalateAfter: 2},
+		},
+		{name: "no intervals", config: types.EscalationPolicy{}, wantErr: true},
+		{name: "invalid interval", config: types.EscalationPolicy{Intervals: []string{"1 day"}}, wantErr: true},
+		{name: "non-positive interval", config: types.EscalationPolicy{Intervals: []string{"0s"}}, wantErr: true},
+		{name: "negative escalateAfter", config: types.EscalationPolicy{Intervals: []string{"1h"}, EscalateAfter: -1}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := NewPolicy(tt.config)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestFindProblems(t *testing.T) {
+	now := time.Date(2024, 11, 20, 12, 0, 0, 0, time.UTC)
+	inventory := RegionInventory{
+		Region: "us-east-1",
+		Databases: []backups.Database{
+			{Identifier: "healthy", Type: "instance"},
+			{Identifier: "failing", Type: "instance", Arn: "arn:aws:rds:us-east-1:123456789012:db:failing"},
+			{Identifier: "stale", Type: "cluster", Tags: map[string]string{"team": "data"}},
+			{Identifier: "recovered", Type: "instance"},
+			{Identifier: "unprotected", Type: "instance"},
+		},
+		Snapshots: []storage.SnapshotInfo{
+			{SnapshotID: "healthy-1", SourceID: "healthy", SnapshotType: "instance", Status: "available", CreateTime: now.Add(-2 * time.Hour)},
+			{SnapshotID: "failing-1", SourceID: "failing", SnapshotType: "instance", Status: "available", CreateTime: now.Add(-5 * time.Hour)},
+			{SnapshotID: "failing-2", SourceID: "failing", SnapshotType: "instance", Status: "failed", CreateTime: now.Add(-1 * time.Hour)},
+			{SnapshotID: "stale-1", SourceID: "stale", SnapshotType: "cluster", Status: "available", CreateTime: now.Add(-48 * time.Hour)},
+			{SnapshotID: "recovered-1", SourceID: "recovered", SnapshotType: "instance", Status: "failed", CreateTime: now.Add(-3 * time.Hour)},
+			{SnapshotID: "recovered-2", SourceID: "recovered", SnapshotType: "instance", Status: "available", CreateTime: now.Add(-1 * time.Hour)},
+		},
+	}
+
+	problems := FindProblems(inventory, now.Add(-26*time.Hour))
+
+	assert.Equal(t, []Problem{
+		{
+			Region: "us-east-1", DatabaseType: "instance", DatabaseID: "failing", Kind: ProblemFailed,
+			SnapshotID: "failing-2", SnapshotStatus: "failed", LastSuccessful: now.Add(-5 * time.Hour),
+			DatabaseArn: "arn:aws:rds:us-east-1:123456789012:db:failing",
+		},
+		{
+			Region: "us-east-1", DatabaseType: "cluster", DatabaseID: "stale", Kind: ProblemMissing,
+			SnapshotID: "stale-1", SnapshotStatus: "available", LastSuccessful: now.Add(-48 * time.Hour),
+			Tags: map[string]string{"team": "data"},
+		},
+		{Region: "us-east-1", DatabaseType: "instance", DatabaseID: "unprotected", Kind: ProblemMissing},
+	}, problems)
+}
+
+func TestPolicyEvaluate(t *testing.T) {
+	now := time.Date(2024, 11, 20, 12, 0, 0, 0, time.UTC)
+	policy := Policy{Intervals: []time.Duration{time.Hour, 4 * time.Hour}, EscalateAfter: 2}
+
+	failed := Problem{Region: "us-east-1", DatabaseType: "instance", DatabaseID: "db-1", Kind: ProblemFailed, SnapshotID: "snap-1"}
+	missing := Problem{Region: "us-east-1", DatabaseType: "instance", DatabaseID: "db-2", Kind: ProblemMissing}
+	state := func(problem Problem, reminders int, lastNotified time.Duration) storage.EscalationState {
+		return storage.EscalationState{
+			Region:       problem.Region,
+			DatabaseType: problem.DatabaseType,
+			DatabaseID:   problem.DatabaseID,
+			Problem:      problem.Kind,
+			SnapshotID:   problem.SnapshotID,
+			Since:        now.Add(-24 * time.Hour),
+			LastNotified: now.Add(-lastNotified),
+			Reminders:    reminders,
+		}
+	}
+
+	tests := []struct {
+		name          string
+		problems      []Problem
+		states        []storage.EscalationState
+		wantReminders []Reminder
+		wantUpdates   []storage.EscalationState
+		wantResolved  []storage.EscalationState
+	}{
+		{
+			name:     "new failed problem waits for the first interval",
+			problems: []Problem{failed},
+			wantUpdates: []storage.EscalationState{
+				{Region: "us-east-1", DatabaseType: "instance", DatabaseID: "db-1", Problem: ProblemFailed,
+					SnapshotID: "snap-1", Since: now, LastNotified: now},
+			},
+		},
+		{
+			name:          "new missing problem is alerted right away",
+			problems:      []Problem{missing},
+			wantReminders: []Reminder{{Problem: missing, Since: now}},
+			wantUpdates: []storage.EscalationState{
+				{Region: "us-east-1", DatabaseType: "instance", DatabaseID: "db-2", Problem: ProblemMissing,
+					Since: now, LastNotified: now},
+			},
+		},
+		{
+			name:     "interval not elapsed",
+			problems: []Problem{failed},
+			states:   []storage.EscalationState{state(failed, 1, 3*time.Hour)},
+		},
+		{
+			name:     "reminder due after interval",
+			problems: []Problem{failed},
+			states:   []storage.EscalationState{state(failed, 1, 4*time.Hour)},
+			wantReminders: []Reminder{
+				{Problem: failed, Since: now.Add(-24 * time.Hour), Count: 2},
+			},
+			wantUpdates: []storage.EscalationState{
+				{Region: "us-east-1", DatabaseType: "instance", DatabaseID: "db-1", Problem: ProblemFailed,
+					SnapshotID: "snap-1", Since: now.Add(-24 * time.Hour), LastNotified: now, Reminders: 2},
+			},
+		},
+		{
+			name:     "escalates after N reminders",
+			problems: []Problem{failed},
+			states:   []storage.EscalationState{state(failed, 2, 5*time.Hour)},
+			wantReminders: []Reminder{
+				{Problem: failed, Since: now.Add(-24 * time.Hour), Count: 3, Escalated: true},
+			},
+			wantUpdates: []storage.EscalationState{
+				{Region: "us-east-1", DatabaseType: "instance", DatabaseID: "db-1", Problem: ProblemFailed,
+					SnapshotID: "snap-1", Since: now.Add(-24 * time.Hour), LastNotified: now, Reminders: 3},
+			},
+		},
+		{
+			name:     "changed problem is stored without resetting the schedule",
+			problems: []Problem{{Region: "us-east-1", DatabaseType: "instance", DatabaseID: "db-1", Kind: ProblemMissing}},
+			states:   []storage.EscalationState{state(failed, 1, time.Minute)},
+			wantUpdates: []storage.EscalationState{
+				{Region: "us-east-1", DatabaseType: "instance", DatabaseID: "db-1", Problem: ProblemMissing,
+					Since: now.Add(-24 * time.Hour), LastNotified: now.Add(-time.Minute), Reminders: 1},
+			},
+		},
+		{
+			name:         "recovered database is resolved",
+			states:       []storage.EscalationState{state(failed, 3, time.Hour)},
+			wantResolved: []storage.EscalationState{state(failed, 3, time.Hour)},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			states := make(map[string]storage.EscalationState)
+			for _, s := range tt.states {
+				states[s.Key()] = s
+			}
+
+			reminders, updates, resolved := policy.Evaluate(tt.problems, states, now)
+			assert.Equal(t, tt.wantReminders, reminders)
+			assert.Equal(t, tt.wantUpdates, updates)
+			assert.Equal(t, tt.wantResolved, resolved)
+		})
+	}
+}
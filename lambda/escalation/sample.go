@@ -0,0 +1,23 @@
+package escalation
+
+import "time"
+
+// SampleReminders returns reminders with representative content, used to
+// validate reminder templates at startup.
+func SampleReminders() []Reminder {
+	now := time.Now()
+	return []Reminder{
+		{
+			Problem: Problem{
+				Region: "us-east-1", DatabaseType: "instance", DatabaseID: "sample-db", Kind: ProblemFailed,
+				SnapshotID: "rds:sample-db-1", SnapshotStatus: "failed", LastSuccessful: now.Add(-30 * time.Hour),
+			},
+			Since: now.Add(-6 * time.Hour),
+			Count: 2,
+		},
+		{
+			Problem: Problem{Region: "us-east-1", DatabaseType: "cluster", DatabaseID: "sample-cluster", Kind: ProblemMissing},
+			Since:   now,
+		},
+	}
+}
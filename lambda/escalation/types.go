@@ -0,0 +1,49 @@
+package escalation
+
+import (
+	"time"
+
+	"rds-backup-monitor/lambda/backups"
+	"rds-backup-monitor/lambda/storage"
+)
+
+// Kinds of backup problems that are escalated.
+const (
+	// ProblemFailed means the latest snapshot of the database failed.
+	ProblemFailed = "failed"
+	// ProblemMissing means the database has no available snapshot within the
+	// coverage window.
+	ProblemMissing = "missing"
+)
+
+// RegionInventory is the input of the health evaluation of a single region.
+type RegionInventory struct {
+	Region    string
+	Snapshots []storage.SnapshotInfo
+	Databases []backups.Database
+}
+
+// Problem is an unhealthy database found in the current run.
+type Problem struct {
+	Region       string
+	DatabaseType string
+	DatabaseID   string
+	DatabaseArn  string
+	Kind         string
+	// SnapshotID and SnapshotStatus describe the latest snapshot, if any.
+	SnapshotID     string
+	SnapshotStatus string
+	LastSuccessful time.Time
+	Tags           map[string]string
+}
+
+// Reminder is an alert about a problem that is still unresolved.
+type Reminder struct {
+	Problem
+	// Since is when the problem was first seen.
+	Since time.Time
+	// Count is the number of the reminder; 0 is the first alert of a problem
+	// that is not reported as a snapshot change.
+	Count     int
+	Escalated bool
+}
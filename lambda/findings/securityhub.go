@@ -0,0 +1,193 @@
+package findings
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"rds-backup-monitor/lambda/compliance"
+	"rds-backup-monitor/lambda/storage"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/securityhub"
+	shTypes "github.com/aws/aws-sdk-go-v2/service/securityhub/types"
+)
+
+type SecurityHubClient interface {
+	BatchImportFindings(ctx context.Context, params *securityhub.BatchImportFindingsInput, optFns ...func(*securityhub.Options)) (*securityhub.BatchImportFindingsOutput, error)
+}
+
+const (
+	asffSchemaVersion = "2018-10-08"
+	// generatorPrefix starts the generator and finding IDs of the monitor.
+	generatorPrefix = "rds-backup-monitor/"
+	// maxImportBatch is the BatchImportFindings limit of findings per call.
+	maxImportBatch = 100
+	// refreshInterval is how often unchanged findings are imported again.
+	// Security Hub deletes findings that were not updated for 90 days.
+	refreshInterval = 24 * time.Hour
+)
+
+// findingTypes are the ASFF finding types of each check.
+var findingTypes = map[string][]string{
+	compliance.CheckPublicSnapshot: {
+		"Software and Configuration Checks/AWS Security Best Practices",
+		"Effects/Data Exposure",
+	},
+	compliance.CheckUnencryptedSnapshot: {
+		"Software and Configuration Checks/AWS Security Best Practices",
+	},
+	compliance.CheckMissingCoverage: {
+		"Software and Configuration Checks/AWS Security Best Practices",
+	},
+	compliance.CheckRetention: {
+		"Software and Configuration Checks/AWS Security Best Practices",
+	},
+}
+
+// Sync makes the Security Hub findings of region match violations. New and
+// changed violations are imported right away and unchanged ones once a day.
+// Findings whose violation is gone are imported with a PASSED compliance
+// status and an ARCHIVED record state, which makes Security Hub set their
+// workflow status to RESOLVED. The stored finding records are only
+// updated once every finding was imported.
+func Sync(ctx context.Context, client SecurityHubClient, store storage.FindingStore,
+	account, region string, violations []compliance.Violation, now time.Time) error {
+
+	records, err := store.GetFindingRecords(ctx, region)
+	if err != nil {
+		return err
+	}
+
+	var findings []shTypes.AwsSecurityFinding
+	var updates []storage.FindingRecord
+	current := make(map[string]bool)
+
+	for _, violation := range violations {
+		id := violation.ID()
+		current[id] = true
+
+		payload, err := json.Marshal(violation)
+		if err != nil {
+			return fmt.Errorf("unable to marshal violation %s: %v", id, err)
+		}
+
+		record, ok := records[id]
+		if ok && record.Payload == string(payload) && now.Sub(record.LastImported) < refreshInterval {
+			continue
+		}
+		if !ok {
+			record = storage.FindingRecord{Region: region, ID: id, CreatedAt: now}
+		}
+		record.LastImported = now
+		record.Payload = string(payload)
+
+		findings = append(findings, newFinding(violation, account, record.CreatedAt, now, true))
+		updates = append(updates, record)
+	}
+
+	var resolved []storage.FindingRecord
+	for id, record := range records {
+		if current[id] {
+			continue
+		}
+		var violation compliance.Violation
+		if err := json.Unmarshal([]byte(record.Payload), &violation); err != nil {
+			return fmt.Errorf("unable to unmarshal violation of finding %s: %v", id, err)
+		}
+		findings = append(findings, newFinding(violation, account, record.CreatedAt, now, false))
+		resolved = append(resolved, record)
+	}
+
+	if len(findings) > 0 {
+		fmt.Printf("Importing %d findings into Security Hub in region %s, %d resolved\n", len(findings), region, len(resolved))
+	}
+	if err := importFindings(ctx, client, findings); err != nil {
+		return err
+	}
+
+	if err := store.PutFindingRecords(ctx, updates); err != nil {
+		return err
+	}
+	return store.DeleteFindingRecords(ctx, resolved)
+}
+
+func importFindings(ctx context.Context, client SecurityHubClient, findings []shTypes.AwsSecurityFinding) error {
+	sort.Slice(findings, func(i, j int) bool {
+		return aws.ToString(findings[i].Id) < aws.ToString(findings[j].Id)
+	})
+
+	for start := 0; start < len(findings); start += maxImportBatch {
+		end := min(start+maxImportBatch, len(findings))
+
+		output, err := client.BatchImportFindings(ctx, &securityhub.BatchImportFindingsInput{
+			Findings: findings[start:end],
+		})
+		if err != nil {
+			return fmt.Errorf("unable to import findings into Security Hub: %v", err)
+		}
+		if aws.ToInt32(output.FailedCount) > 0 {
+			var failures []string
+			for _, failure := range output.FailedFindings {
+				failures = append(failures, fmt.Sprintf("%s: %s %s",
+					aws.ToString(failure.Id), aws.ToString(failure.ErrorCode), aws.ToString(failure.ErrorMessage)))
+			}
+			return fmt.Errorf("unable to import %d findings into Security Hub: %s",
+				aws.ToInt32(output.FailedCount), strings.Join(failures, "; "))
+		}
+	}
+	return nil
+}
+
+// newFinding converts violation into an ASFF finding. Active findings fail
+// compliance; inactive ones pass and are archived.
+func newFinding(violation compliance.Violation, account string, createdAt, now time.Time, active bool) shTypes.AwsSecurityFinding {
+	partition := partitionOf(violation.ResourceArn)
+
+	finding := shTypes.AwsSecurityFinding{
+		SchemaVersion: aws.String(asffSchemaVersion),
+		Id:            aws.String(generatorPrefix + violation.ID()),
+		ProductArn: aws.String(fmt.Sprintf("arn:%s:securityhub:%s:%s:product/%s/default",
+			partition, violation.Region, account, account)),
+		GeneratorId:  aws.String(generatorPrefix + violation.Check),
+		AwsAccountId: aws.String(account),
+		Types:        findingTypes[violation.Check],
+		CreatedAt:    aws.String(createdAt.UTC().Format(time.RFC3339)),
+		UpdatedAt:    aws.String(now.UTC().Format(time.RFC3339)),
+		Severity:     &shTypes.Severity{Label: shTypes.SeverityLabel(violation.Severity)},
+		Title:        aws.String(violation.Title),
+		Description:  aws.String(violation.Description),
+		Resources: []shTypes.Resource{
+			{
+				Type:      aws.String(violation.ResourceType),
+				Id:        aws.String(violation.ResourceArn),
+				Region:    aws.String(violation.Region),
+				Partition: shTypes.Partition(partition),
+			},
+		},
+		ProductFields: map[string]string{
+			"rds-backup-monitor/check":      violation.Check,
+			"rds-backup-monitor/resourceId": violation.ResourceID,
+		},
+		Compliance:  &shTypes.Compliance{Status: shTypes.ComplianceStatusFailed},
+		RecordState: shTypes.RecordStateActive,
+	}
+
+	if !active {
+		finding.Compliance.Status = shTypes.ComplianceStatusPassed
+		finding.RecordState = shTypes.RecordStateArchived
+	}
+	return finding
+}
+
+// partitionOf returns the partition of arn, defaulting to aws.
+func partitionOf(arn string) string {
+	parts := strings.SplitN(arn, ":", 3)
+	if len(parts) < 3 || parts[0] != "arn" || parts[1] == "" {
+		return string(shTypes.PartitionAws)
+	}
+	return parts[1]
+}
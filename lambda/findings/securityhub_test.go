@@ -0,0 +1,187 @@
+package findings
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"testing"
+	"time"
+
+	"rds-backup-monitor/lambda/compliance"
+	"rds-backup-monitor/lambda/storage"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/securityhub"
+	shTypes "github.com/aws/aws-sdk-go-v2/service/securityhub/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeSecurityHubClient struct {
+	imported    [][]shTypes.AwsSecurityFinding
+	failedCount int32
+	err         error
+}
+
+func (f *fakeSecurityHubClient) BatchImportFindings(ctx context.Context, params *securityhub.BatchImportFindingsInput, optFns ...func(*securityhub.Options)) (*securityhub.BatchImportFindingsOutput, error) {
+	f.imported = append(f.imported, params.Findings)
+	if f.err != nil {
+		return nil, f.err
+	}
+	output := &securityhub.BatchImportFindingsOutput{
+		FailedCount:  aws.Int32(f.failedCount),
+		SuccessCount: aws.Int32(int32(len(params.Findings)) - f.failedCount),
+	}
+	if f.failedCount > 0 {
+		output.FailedFindings = []shTypes.ImportFindingsError{
+			{Id: params.Findings[0].Id, ErrorCode: aws.String("InvalidInput"), ErrorMessage: aws.String("bad finding")},
+		}
+	}
+	return output, nil
+}
+
+// findingRecord returns the stored record of violation.
+func findingRecord(t *testing.T, violation compliance.Violation, createdAt, lastImported time.Time) storage.FindingRecord {
+	payload, err := json.Marshal(violation)
+	require.NoError(t, err)
+	return storage.FindingRecord{
+		Region:       violation.Region,
+		ID:           violation.ID(),
+		CreatedAt:    createdAt,
+		LastImported: lastImported,
+		Payload:      string(payload),
+	}
+}
+
+func violation(check, resource string) compliance.Violation {
+	return compliance.Violation{
+		Check:        check,
+		Region:       "us-east-1",
+		ResourceType: compliance.ResourceDBInstance,
+		ResourceArn:  "arn:aws:rds:us-east-1:123456789012:db:" + resource,
+		ResourceID:   resource,
+		Severity:     compliance.SeverityHigh,
+		Title:        "RDS DB instance " + resource + " has no recent backup",
+		Description:  "No available snapshot of DB instance " + resource + " was found.",
+	}
+}
+
+func TestSync(t *testing.T) {
+	now := time.Date(2024, 11, 20, 12, 0, 0, 0, time.UTC)
+	created := now.Add(-72 * time.Hour)
+
+	fresh := violation(compliance.CheckMissingCoverage, "fresh")
+	stale := violation(compliance.CheckMissingCoverage, "stale")
+	cleared := violation(compliance.CheckRetention, "cleared")
+	changed := violation(compliance.CheckRetention, "changed")
+	added := violation(compliance.CheckMissingCoverage, "added")
+
+	changedBefore := changed
+	changedBefore.Severity = compliance.SeverityMedium
+
+	ctx := context.Background()
+	store := storage.NewMemoryStore()
+	require.NoError(t, store.PutFindingRecords(ctx, []storage.FindingRecord{
+		findingRecord(t, fresh, created, now.Add(-time.Hour)),
+		findingRecord(t, stale, created, now.Add(-25*time.Hour)),
+		findingRecord(t, cleared, created, now.Add(-time.Hour)),
+		findingRecord(t, changedBefore, created, now.Add(-time.Hour)),
+	}))
+	client := &fakeSecurityHubClient{}
+
+	err := Sync(ctx, client, store, "123456789012", "us-east-1",
+		[]compliance.Violation{fresh, stale, changed, added}, now)
+	require.NoError(t, err)
+
+	require.Len(t, client.imported, 1)
+	byResource := make(map[string]shTypes.AwsSecurityFinding)
+	for _, finding := range client.imported[0] {
+		byResource[aws.ToString(finding.Resources[0].Id)] = finding
+	}
+	assert.NotContains(t, byResource, fresh.ResourceArn, "unchanged findings are refreshed once a day")
+	assert.Len(t, byResource, 4)
+
+	finding := byResource[added.ResourceArn]
+	assert.Equal(t, "2018-10-08", aws.ToString(finding.SchemaVersion))
+	assert.Equal(t, "rds-backup-monitor/missing-coverage/"+added.ResourceArn, aws.ToString(finding.Id))
+	assert.Equal(t, "arn:aws:securityhub:us-east-1:123456789012:product/123456789012/default", aws.ToString(finding.ProductArn))
+	assert.Equal(t, "rds-backup-monitor/missing-coverage", aws.ToString(finding.GeneratorId))
+	assert.Equal(t, now.Format(time.RFC3339), aws.ToString(finding.CreatedAt))
+	assert.Equal(t, shTypes.SeverityLabelHigh, finding.Severity.Label)
+	assert.Equal(t, "AwsRdsDbInstance", aws.ToString(finding.Resources[0].Type))
+	assert.Equal(t, shTypes.PartitionAws, finding.Resources[0].Partition)
+	assert.Equal(t, shTypes.ComplianceStatusFailed, finding.Compliance.Status)
+	assert.Equal(t, shTypes.RecordStateActive, finding.RecordState)
+
+	finding = byResource[stale.ResourceArn]
+	assert.Equal(t, created.Format(time.RFC3339), aws.ToString(finding.CreatedAt))
+	assert.Equal(t, now.Format(time.RFC3339), aws.ToString(finding.UpdatedAt))
+
+	assert.Equal(t, shTypes.SeverityLabelHigh, byResource[changed.ResourceArn].Severity.Label)
+
+	finding = byResource[cleared.ResourceArn]
+	assert.Equal(t, shTypes.ComplianceStatusPassed, finding.Compliance.Status)
+	assert.Equal(t, shTypes.RecordStateArchived, finding.RecordState)
+	assert.Equal(t, cleared.Title, aws.ToString(finding.Title))
+
+	records, err := store.GetFindingRecords(ctx, "us-east-1")
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []string{fresh.ID(), stale.ID(), changed.ID(), added.ID()}, keys(records))
+	assert.Equal(t, now.Add(-time.Hour), records[fresh.ID()].LastImported)
+	assert.Equal(t, now, records[stale.ID()].LastImported)
+	assert.Equal(t, created, records[stale.ID()].CreatedAt)
+	assert.Equal(t, now, records[added.ID()].CreatedAt)
+}
+
+func keys(records map[string]storage.FindingRecord) []string {
+	var ids []string
+	for id := range records {
+		ids = append(ids, id)
+	}
+	return ids
+}
+
+func TestSync_ImportErrors(t *testing.T) {
+	violations := []compliance.Violation{violation(compliance.CheckMissingCoverage, "db-1")}
+
+	tests := []struct {
+		name   string
+		client *fakeSecurityHubClient
+	}{
+		{name: "API error", client: &fakeSecurityHubClient{err: fmt.Errorf("AccessDenied")}},
+		{name: "failed findings", client: &fakeSecurityHubClient{failedCount: 1}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := storage.NewMemoryStore()
+			err := Sync(context.Background(), tt.client, store, "123456789012", "us-east-1", violations, time.Now())
+			assert.Error(t, err)
+
+			records, err := store.GetFindingRecords(context.Background(), "us-east-1")
+			require.NoError(t, err)
+			assert.Empty(t, records, "records must not be stored when the import fails")
+		})
+	}
+}
+
+func TestSync_Batches(t *testing.T) {
+	var violations []compliance.Violation
+	for i := 0; i < 250; i++ {
+		violations = append(violations, violation(compliance.CheckRetention, fmt.Sprintf("db-%03d", i)))
+	}
+
+	client := &fakeSecurityHubClient{}
+	err := Sync(context.Background(), client, storage.NewMemoryStore(), "123456789012", "us-east-1", violations, time.Now())
+
+	require.NoError(t, err)
+	require.Len(t, client.imported, 3)
+	assert.Len(t, client.imported[0], 100)
+	assert.Len(t, client.imported[2], 50)
+}
+
+func TestPartitionOf(t *testing.T) {
+	assert.Equal(t, "aws", partitionOf("arn:aws:rds:us-east-1:123456789012:db:orders"))
+	assert.Equal(t, "aws-cn", partitionOf("arn:aws-cn:rds:cn-north-1:123456789012:db:orders"))
+	assert.Equal(t, "aws", partitionOf("orders"))
+}
@@ -2,27 +2,64 @@ package main
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"net/http"
 	"os"
+	"rds-backup-monitor/lambda/ack"
 	"rds-backup-monitor/lambda/backups"
+	"rds-backup-monitor/lambda/compliance"
+	"rds-backup-monitor/lambda/escalation"
+	"rds-backup-monitor/lambda/findings"
 	"rds-backup-monitor/lambda/notifications"
+	"rds-backup-monitor/lambda/opsitems"
+	"rds-backup-monitor/lambda/regions"
+	"rds-backup-monitor/lambda/reports"
 	"rds-backup-monitor/lambda/storage"
+	"rds-backup-monitor/lambda/suppression"
 	"rds-backup-monitor/lambda/types"
+	"slices"
+	"sort"
 	"strconv"
 	"strings"
 	"time"
+	// Embed the timezone database for suppression windows, the Lambda
+	// runtime does not ship one
+	_ "time/tzdata"
 
 	"github.com/aws/aws-lambda-go/lambda"
+	"github.com/aws/aws-lambda-go/lambdacontext"
+	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/config"
 	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
-	"github.com/aws/aws-sdk-go-v2/service/rds"
+	"github.com/aws/aws-sdk-go-v2/service/eventbridge"
+	ebTypes "github.com/aws/aws-sdk-go-v2/service/eventbridge/types"
+	"github.com/aws/aws-sdk-go-v2/service/secretsmanager"
 	"github.com/aws/aws-sdk-go-v2/service/sns"
 )
 
 var (
-	ddbClient *dynamodb.Client
 	snsClient *sns.Client
 	appConfig types.Configuration
+	templates *notifications.TemplateSet
+	router    *notifications.Router
+	windows   []suppression.Window
+	ignored   notifications.IgnoreRules
+
+	// Keeps the snapshot states and the other rows of the monitor
+	stateStore storage.StateStore
+
+	// Puts resume events for paused region scans; nil when paused scans wait
+	// for the next scheduled run
+	resumeClient *eventbridge.Client
+
+	// SDK clients of each region, kept across warm invocations
+	regionClients = regions.NewCache(regions.LoadDefaultConfig)
+
+	// Escalation is disabled when escalationPolicy is nil
+	escalationPolicy    *escalation.Policy
+	escalationNotifiers []notifications.Notifier
 )
 
 func init() {
@@ -31,9 +68,20 @@ func init() {
 		panic(fmt.Sprintf("unable to load SDK config: %v", err))
 	}
 
-	ddbClient = dynamodb.NewFromConfig(defaultConfig)
 	snsClient = sns.NewFromConfig(defaultConfig)
 
+	// Keep the state in a local file instead of DynamoDB when set
+	if path := os.Getenv("STATE_FILE"); path != "" {
+		fileStore, err := storage.NewFileStore(path)
+		if err != nil {
+			panic(fmt.Sprintf("unable to open state file: %v", err))
+		}
+		stateStore = fileStore
+	} else {
+		stateStore = storage.NewDynamoDBStore(dynamodb.NewFromConfig(defaultConfig),
+			os.Getenv("DYNAMODB_TABLE_NAME"), os.Getenv("ACCOUNT_ID"))
+	}
+
 	// Get snapshot age from environment or use default
 	snapshotAgeDays := 7 // Default to 7 days
 	if ageStr := os.Getenv("SNAPSHOT_AGE_DAYS"); ageStr != "" {
@@ -42,12 +90,108 @@ func init() {
 		}
 	}
 
+	// Get the coverage window for summary reports or use default
+	coverageHours := 26 // A day plus drift of the daily backup window
+	if hoursStr := os.Getenv("REPORT_COVERAGE_HOURS"); hoursStr != "" {
+		if hours, err := strconv.Atoi(hoursStr); err == nil && hours > 0 {
+			coverageHours = hours
+		}
+	}
+
+	// Get the minimum backup retention of the compliance checks or use default
+	minRetentionDays := compliance.DefaultMinRetentionDays
+	if daysStr := os.Getenv("MIN_RETENTION_DAYS"); daysStr != "" {
+		if days, err := strconv.Atoi(daysStr); err == nil && days > 0 {
+			minRetentionDays = days
+		}
+	}
+
+	// Get the number of regions scanned at the same time or use default
+	regionParallelism := regions.DefaultParallelism
+	if countStr := os.Getenv("REGION_PARALLELISM"); countStr != "" {
+		if count, err := strconv.Atoi(countStr); err == nil && count > 0 {
+			regionParallelism = count
+		}
+	}
+
+	// Get the digest limits of each notifier or use defaults
+	maxListedChanges := notifications.DefaultMaxListedChanges
+	if countStr := os.Getenv("MAX_LISTED_CHANGES"); countStr != "" {
+		if count, err := strconv.Atoi(countStr); err == nil && count > 0 {
+			maxListedChanges = count
+		}
+	}
+	maxMessagesPerRun := notifications.DefaultMaxMessagesPerRun
+	if countStr := os.Getenv("MAX_MESSAGES_PER_RUN"); countStr != "" {
+		if count, err := strconv.Atoi(countStr); err == nil && count > 0 {
+			maxMessagesPerRun = count
+		}
+	}
+
+	// Get the retention of the status transition history or use default
+	historyRetentionDays := storage.DefaultHistoryRetentionDays
+	if daysStr := os.Getenv("HISTORY_RETENTION_DAYS"); daysStr != "" {
+		if days, err := strconv.Atoi(daysStr); err == nil && days > 0 {
+			historyRetentionDays = days
+		}
+	}
+
 	// Initialize application configuration
 	appConfig = types.Configuration{
 		Regions:            strings.Split(os.Getenv("REGIONS"), ","),
 		StatusesToMonitor:  strings.Split(os.Getenv("STATUS"), ","),
 		ScheduleExpression: os.Getenv("SCHEDULE_EXPRESSION"),
 		SnapshotAgeDays:    snapshotAgeDays,
+		AccountID:          os.Getenv("ACCOUNT_ID"),
+		MessageFormat:      os.Getenv("MESSAGE_FORMAT"),
+		TemplateDir:        os.Getenv("TEMPLATE_DIR"),
+		SNSTopicArn:        os.Getenv("SNS_TOPIC_ARN"),
+		CoverageHours:      coverageHours,
+		MinRetentionDays:   minRetentionDays,
+		MaxListedChanges:   maxListedChanges,
+		MaxMessagesPerRun:  maxMessagesPerRun,
+		RegionParallelism:  regionParallelism,
+	}
+	appConfig.HistoryRetentionDays = historyRetentionDays
+	appConfig.SecurityHubFindings = os.Getenv("SECURITY_HUB_FINDINGS") == "true"
+	appConfig.OpsItems = os.Getenv("OPS_ITEMS") == "true"
+	appConfig.EventBusName = os.Getenv("EVENT_BUS_NAME")
+
+	// Severity rules and routes are passed as JSON documents
+	if rules := os.Getenv("SEVERITY_RULES"); rules != "" {
+		if err := json.Unmarshal([]byte(rules), &appConfig.SeverityRules); err != nil {
+			panic(fmt.Sprintf("unable to parse SEVERITY_RULES: %v", err))
+		}
+	}
+	if routes := os.Getenv("SEVERITY_ROUTES"); routes != "" {
+		if err := json.Unmarshal([]byte(routes), &appConfig.SeverityRoutes); err != nil {
+			panic(fmt.Sprintf("unable to parse SEVERITY_ROUTES: %v", err))
+		}
+	}
+	if suppressionWindows := os.Getenv("SUPPRESSION_WINDOWS"); suppressionWindows != "" {
+		if err := json.Unmarshal([]byte(suppressionWindows), &appConfig.SuppressionWindows); err != nil {
+			panic(fmt.Sprintf("unable to parse SUPPRESSION_WINDOWS: %v", err))
+		}
+	}
+	if routing := os.Getenv("OWNER_ROUTING"); routing != "" {
+		if err := json.Unmarshal([]byte(routing), &appConfig.OwnerRouting); err != nil {
+			panic(fmt.Sprintf("unable to parse OWNER_ROUTING: %v", err))
+		}
+	}
+	if rules := os.Getenv("IGNORE_RULES"); rules != "" {
+		if err := json.Unmarshal([]byte(rules), &appConfig.IgnoreRules); err != nil {
+			panic(fmt.Sprintf("unable to parse IGNORE_RULES: %v", err))
+		}
+	}
+	if retention := os.Getenv("STATUS_RETENTION_DAYS"); retention != "" {
+		if err := json.Unmarshal([]byte(retention), &appConfig.StatusRetentionDays); err != nil {
+			panic(fmt.Sprintf("unable to parse STATUS_RETENTION_DAYS: %v", err))
+		}
+	}
+	if policy := os.Getenv("ESCALATION_POLICY"); policy != "" {
+		if err := json.Unmarshal([]byte(policy), &appConfig.Escalation); err != nil {
+			panic(fmt.Sprintf("unable to parse ESCALATION_POLICY: %v", err))
+		}
 	}
 
 	// Validate configuration
@@ -60,9 +204,117 @@ func init() {
 	if appConfig.ScheduleExpression == "" {
 		appConfig.ScheduleExpression = "rate(10 minutes)" // Default schedule
 	}
+	if appConfig.MessageFormat == "" {
+		appConfig.MessageFormat = notifications.MessageFormatText
+	}
+	if !notifications.ValidMessageFormat(appConfig.MessageFormat) {
+		panic(fmt.Sprintf("unsupported message format: %s", appConfig.MessageFormat))
+	}
+
+	if err := notifications.ValidateSeverityRules(appConfig.SeverityRules); err != nil {
+		panic(fmt.Sprintf("invalid severity rules: %v", err))
+	}
+	for severity := range appConfig.SeverityRoutes {
+		if !notifications.ValidSeverity(severity) {
+			panic(fmt.Sprintf("unknown severity in routes: %s", severity))
+		}
+	}
+
+	for status, days := range appConfig.StatusRetentionDays {
+		if days <= 0 {
+			panic(fmt.Sprintf("invalid retention of status %s: %d days", status, days))
+		}
+	}
+
+	if appConfig.OwnerRouting != nil {
+		if err := notifications.ValidateOwnerRouting(*appConfig.OwnerRouting); err != nil {
+			panic(fmt.Sprintf("invalid owner routing: %v", err))
+		}
+	}
+
+	windows, err = suppression.NewWindows(appConfig.SuppressionWindows)
+	if err != nil {
+		panic(fmt.Sprintf("invalid suppression windows: %v", err))
+	}
+
+	ignored, err = notifications.NewIgnoreRules(appConfig.IgnoreRules)
+	if err != nil {
+		panic(fmt.Sprintf("invalid ignore rules: %v", err))
+	}
+
+	if appConfig.Escalation != nil {
+		policy, err := escalation.NewPolicy(*appConfig.Escalation)
+		if err != nil {
+			panic(fmt.Sprintf("invalid escalation policy: %v", err))
+		}
+		if appConfig.Escalation.EscalationTopicArn == "" {
+			panic("escalation policy needs an escalationTopicArn")
+		}
+		escalationPolicy = &policy
+	}
+
+	// Load notification templates and validate them against sample data
+	templates, err = notifications.LoadTemplates(appConfig.TemplateDir)
+	if err != nil {
+		panic(fmt.Sprintf("unable to load notification templates: %v", err))
+	}
+
+	// Sign acknowledge and snooze links when the API is deployed
+	if baseURL := os.Getenv("ACK_BASE_URL"); baseURL != "" {
+		secret, err := ack.LoadSecret(context.Background(),
+			secretsmanager.NewFromConfig(defaultConfig), os.Getenv("ACK_SECRET_ARN"))
+		if err != nil {
+			panic(err.Error())
+		}
+		snoozeDuration := 24 * time.Hour
+		if durationStr := os.Getenv("ACK_SNOOZE_DURATION"); durationStr != "" {
+			snoozeDuration, err = time.ParseDuration(durationStr)
+			if err != nil || snoozeDuration <= 0 {
+				panic(fmt.Sprintf("invalid ACK_SNOOZE_DURATION: %s", durationStr))
+			}
+		}
+		templates.SetLinkSigner(ack.NewSigner(secret, baseURL, snoozeDuration))
+	}
+
+	router = notifications.NewSNSRouter(appConfig, templates, snsClient)
+	if appConfig.OwnerRouting != nil {
+		router.SetOwnerRoutes(notifications.NewOwnerRoutes(*appConfig.OwnerRouting, appConfig, templates,
+			snsClient, &http.Client{Timeout: 10 * time.Second}))
+	}
+	if appConfig.EventBusName != "" {
+		router.AddSink(notifications.NewEventBridgeNotifier(appConfig.EventBusName,
+			eventbridge.NewFromConfig(defaultConfig), appConfig))
+	}
+	if os.Getenv("RESUME_IMMEDIATELY") == "true" {
+		resumeClient = eventbridge.NewFromConfig(defaultConfig)
+	}
+	if appConfig.Escalation != nil {
+		escalationNotifiers = []notifications.Notifier{notifications.NewSNSNotifier(
+			appConfig.Escalation.EscalationTopicArn, snsClient, templates, appConfig)}
+	}
+}
+
+func handler(ctx context.Context, event types.InvocationEvent) error {
+	switch event.Mode {
+	case "", "monitor":
+		return runMonitor(ctx)
+	case "report":
+		return runReport(ctx, event.Period)
+	default:
+		return fmt.Errorf("unsupported invocation mode: %s", event.Mode)
+	}
+}
+
+// newRunID identifies the invocation in the history of status transitions:
+// the Lambda request ID, or the start time when running outside Lambda.
+func newRunID(ctx context.Context, now time.Time) string {
+	if lc, ok := lambdacontext.FromContext(ctx); ok && lc.AwsRequestID != "" {
+		return lc.AwsRequestID
+	}
+	return fmt.Sprintf("local-%d", now.UnixNano())
 }
 
-func handler(ctx context.Context) error {
+func runMonitor(ctx context.Context) error {
 	// Log configuration
 	for i, region := range appConfig.Regions {
 		fmt.Printf("Monitoring Region %d: %s\n", i, region)
@@ -74,44 +326,531 @@ func handler(ctx context.Context) error {
 
 	fmt.Printf("Schedule Expression: %s\n", appConfig.ScheduleExpression)
 	fmt.Printf("Snapshot Age: %d days\n", appConfig.SnapshotAgeDays)
+	fmt.Printf("Message Format: %s\n", appConfig.MessageFormat)
+
+	now := time.Now()
+	runID := newRunID(ctx, now)
+	outcome := regions.NewOutcome()
+
+	// A run that overlaps with the previous one only takes the regions that
+	// run is done with, so no region is scanned and notified twice
+	leases, failures := regions.AcquireLeases(ctx, stateStore, appConfig.Regions, runID, regions.DefaultLeaseDuration)
+	outcome.Fail(failures...)
+	defer leases.Release(ctx)
+	held := leases.Regions(appConfig.Regions)
+
+	// Every digest of the run counts against one message limit per
+	// destination, whether relayed, new or a catch-up digest
+	budget := notifications.NewMessageBudget(appConfig.MaxMessagesPerRun)
+
+	// Complete the digests of runs that stopped part way, so their changes
+	// are not detected and sent again
+	pending, err := notifications.RelayOutbox(ctx, router, budget, appConfig, stateStore, held)
+	if err != nil {
+		return fmt.Errorf("unable to complete outbox: %v", err)
+	}
+	scanned := slices.DeleteFunc(held, func(region string) bool {
+		return slices.Contains(pending, region)
+	})
+
+	scanCtx, cancel := scanContext(ctx)
+	defer cancel()
+	scans, failures := regions.Scan(scanCtx, scanned, appConfig.RegionParallelism,
+		func(ctx context.Context, region string) (regionScan, error) {
+			return scanRegion(ctx, region, now, runID)
+		})
+	outcome.Fail(failures...)
 
-	for _, region := range appConfig.Regions {
-		cfg, err := config.LoadDefaultConfig(ctx, config.WithRegion(region))
+	// Merge in the configured order of regions, whatever order they finished in
+	var results []notifications.RegionResult
+	var inventories []escalation.RegionInventory
+	var complianceInventories []compliance.Inventory
+	acknowledgements := make(map[string]map[string]storage.Acknowledgement)
+	var paused []string
+	for _, scan := range scans {
+		if scan.paused {
+			paused = append(paused, scan.region)
+			continue
+		}
+		if !leases.Held(scan.region, time.Now()) {
+			fmt.Printf("Skipping the changes of region %s, its lock was lost during the scan\n", scan.region)
+			continue
+		}
+		outcome.Complete(scan.region, regions.StageScan)
+		results = append(results, scan.result)
+		acknowledgements[scan.region] = scan.acknowledgements
+		if scan.inventory != nil {
+			inventories = append(inventories, *scan.inventory)
+		}
+		if scan.complianceInventory != nil {
+			complianceInventories = append(complianceInventories, *scan.complianceInventory)
+		}
+	}
+
+	// Every step below covers the regions that were scanned, and keeps going
+	// when a step fails so that one failure does not hold back the others.
+	// The errors are returned together at the end, which marks the invocation
+	// as failed.
+	var errs []error
+
+	// Send one summary report for all regions, then persist the new states
+	err = notifications.ProcessSnapshotChanges(ctx, results, appConfig, router, budget, windows, stateStore)
+	if err != nil {
+		errs = append(errs, fmt.Errorf("unable to process snapshot changes: %v", err))
+	}
+
+	if escalationPolicy != nil {
+		if err := runEscalation(ctx, inventories, acknowledgements); err != nil {
+			errs = append(errs, fmt.Errorf("unable to process escalations: %v", err))
+		}
+	}
+
+	if appConfig.SecurityHubFindings {
+		runFindings(ctx, complianceInventories, outcome)
+	}
+
+	if appConfig.OpsItems {
+		runOpsItems(ctx, inventories, outcome)
+	}
+
+	if err := notifyScanFailures(ctx, outcome, now); err != nil {
+		errs = append(errs, fmt.Errorf("unable to notify scan failures: %v", err))
+	}
+
+	// Paused regions resume on the next scheduled run, or right away when a
+	// resume event is configured
+	if len(paused) > 0 && resumeClient != nil {
+		if err := requestResume(ctx, paused); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	return errors.Join(append([]error{outcome.Err()}, errs...)...)
+}
+
+// resumeDetailType is the detail type of the events that start a run to resume
+// paused region scans. The stack routes them from the default event bus to the
+// function.
+const resumeDetailType = "ScanResumeRequested"
+
+// requestResume puts an event on the default event bus that invokes the
+// function again to resume the paused scans of regions.
+func requestResume(ctx context.Context, regions []string) error {
+	detail, err := json.Marshal(map[string]any{"regions": regions})
+	if err != nil {
+		return fmt.Errorf("unable to marshal resume event: %v", err)
+	}
+
+	output, err := resumeClient.PutEvents(ctx, &eventbridge.PutEventsInput{
+		Entries: []ebTypes.PutEventsRequestEntry{{
+			Source:     aws.String(notifications.EventSource),
+			DetailType: aws.String(resumeDetailType),
+			Detail:     aws.String(string(detail)),
+		}},
+	})
+	if err != nil {
+		return fmt.Errorf("unable to request resume of paused scans: %v", err)
+	}
+	if output.FailedEntryCount > 0 {
+		return fmt.Errorf("unable to request resume of paused scans: %s", aws.ToString(output.Entries[0].ErrorMessage))
+	}
+	fmt.Printf("Requested a run to resume the scans of %s\n", strings.Join(regions, ", "))
+	return nil
+}
+
+// notifyScanFailures records the stages that failed for a region and notifies
+// the failures that are new in this run, along with the failures of earlier
+// runs whose stage completed again.
+func notifyScanFailures(ctx context.Context, outcome *regions.Outcome, now time.Time) error {
+	recorded, err := stateStore.GetScanFailures(ctx)
+	if err != nil {
+		return err
+	}
+
+	var failures, resolved []storage.ScanFailure
+	failed := make(map[string]bool)
+	for _, failure := range outcome.Failures() {
+		record := storage.ScanFailure{Region: failure.Region, Stage: failure.Stage, Error: failure.Err.Error(), Since: now}
+		failed[record.Key()] = true
+		if _, ok := recorded[record.Key()]; !ok {
+			failures = append(failures, record)
+		}
+	}
+	for key, record := range recorded {
+		if !failed[key] && outcome.Completed(record.Region, record.Stage) {
+			resolved = append(resolved, record)
+		}
+	}
+	sort.Slice(resolved, func(i, j int) bool {
+		return resolved[i].Key() < resolved[j].Key()
+	})
+
+	err = notifications.SendScanFailures(ctx, failures, resolved, appConfig.AccountID, templates, router)
+	if err != nil {
+		return err
+	}
+	if err := stateStore.PutScanFailures(ctx, failures); err != nil {
+		return err
+	}
+	return stateStore.DeleteScanFailures(ctx, resolved)
+}
+
+// scanDeadlineReserve is the time left for sending notifications and storing
+// states once scanning stops ahead of the Lambda deadline.
+const scanDeadlineReserve = 30 * time.Second
+
+// scanContext returns the context of region scans, which ends
+// scanDeadlineReserve before the deadline of ctx.
+func scanContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		return context.WithCancel(ctx)
+	}
+	return context.WithDeadline(ctx, deadline.Add(-scanDeadlineReserve))
+}
+
+// regionScan is what the scan of a single region contributes to a run. The
+// inventories are nil when no feature needs them. A paused scan contributes
+// nothing until a later run completes it.
+type regionScan struct {
+	region              string
+	paused              bool
+	result              notifications.RegionResult
+	acknowledgements    map[string]storage.Acknowledgement
+	inventory           *escalation.RegionInventory
+	complianceInventory *compliance.Inventory
+}
+
+// checkpointReserve is the time left to store a checkpoint when a region scan
+// pauses ahead of the scan deadline.
+const checkpointReserve = 10 * time.Second
+
+// scanRegion compares the snapshots of region with their recorded states and
+// collects the inventories of the escalation and compliance checks. It only
+// reads, nothing is sent or stored, so regions can be scanned concurrently.
+// A scan that would not finish before the deadline pauses: the pages scanned
+// so far are stored in a checkpoint that the next run resumes from, and the
+// region is left out of this run.
+func scanRegion(ctx context.Context, region string, now time.Time, runID string) (regionScan, error) {
+	clients, err := regionClients.Get(ctx, region)
+	if err != nil {
+		return regionScan{}, err
+	}
+	rdsClient := clients.RDS
+	cutoffDate := now.AddDate(0, 0, -appConfig.SnapshotAgeDays)
+
+	// Compliance checks cover every snapshot, not only the recent ones
+	listCutoff := cutoffDate
+	if appConfig.SecurityHubFindings {
+		listCutoff = time.Time{}
+	}
+
+	// Get existing processed snapshots from the state store
+	snapshotStates, err := stateStore.GetProcessedSnapshots(ctx, region)
+	if err != nil {
+		return regionScan{}, fmt.Errorf("unable to get processed snapshots in region %s: %v", region, err)
+	}
+	processedSnapshots := storage.Statuses(snapshotStates)
+
+	// Continue where the previous run paused
+	checkpoint, err := stateStore.GetCheckpoint(ctx, region)
+	if err != nil {
+		return regionScan{}, err
+	}
+	resumed := checkpoint != nil
+	if resumed {
+		fmt.Printf("Resuming scan of region %s at page %d, started at %s\n",
+			region, checkpoint.Pages+1, checkpoint.StartedAt.Format(time.RFC3339))
+	} else {
+		checkpoint = &storage.Checkpoint{Region: region, StartedAt: now}
+	}
+
+	// Get instance and cluster snapshots based on configured age, until the
+	// deadline comes close. Each page is diffed against the recorded states as
+	// it arrives; unless an inventory needs every snapshot, only the changed
+	// ones and those whose state needs renewal are kept, so memory does not
+	// grow with the size of the region.
+	pause := func() bool {
+		deadline, ok := ctx.Deadline()
+		return ok && time.Until(deadline) < checkpointReserve
+	}
+	position, done, err := backups.ScanSnapshots(ctx, rdsClient,
+		backups.Position{Listing: checkpoint.Listing, Marker: checkpoint.Marker}, listCutoff, pause,
+		func(snapshots []storage.SnapshotInfo) error {
+			checkpoint.Pages++
+			checkpoint.Snapshots = append(checkpoint.Snapshots,
+				notifications.ScannedSnapshots(snapshots, processedSnapshots, snapshotStates, appConfig, now)...)
+			return nil
+		})
+	if err != nil {
+		return regionScan{}, fmt.Errorf("unable to describe snapshots in region %s: %v", region, err)
+	}
+	if !done {
+		checkpoint.Listing, checkpoint.Marker = position.Listing, position.Marker
+		if err := stateStore.PutCheckpoint(ctx, checkpoint); err != nil {
+			return regionScan{}, err
+		}
+		fmt.Printf("Pausing scan of region %s after %d pages, its changes are sent once the scan completes\n",
+			region, checkpoint.Pages)
+		return regionScan{region: region, paused: true}, nil
+	}
+
+	// Databases acknowledged or snoozed by an operator are not notified about
+	acks, err := stateStore.GetAcknowledgements(ctx, region)
+	if err != nil {
+		return regionScan{}, err
+	}
+
+	// Databases whose backups failed, to detect their recovery
+	health, err := stateStore.GetDatabaseHealth(ctx, region)
+	if err != nil {
+		return regionScan{}, err
+	}
+
+	// Databases are only needed for owner tags, escalation reminders,
+	// compliance checks and OpsItems
+	var databases []backups.Database
+	if appConfig.OwnerRouting != nil || escalationPolicy != nil || appConfig.SecurityHubFindings || appConfig.OpsItems {
+		databases, err = backups.ListDatabases(ctx, rdsClient)
 		if err != nil {
-			return fmt.Errorf("unable to load SDK config for region %s: %v", region, err)
+			return regionScan{}, fmt.Errorf("unable to list databases in region %s: %v", region, err)
 		}
+	}
+
+	// Compare with DynamoDB state and collect the changes for the digest
+	allSnapshots := checkpoint.Snapshots
+	filteredSnapshots := backups.CreatedAfter(allSnapshots, cutoffDate)
+	result := notifications.DetectSnapshotChanges(filteredSnapshots, processedSnapshots, appConfig, region)
+	result = notifications.RecordTransitions(result, processedSnapshots, now, runID)
+	result = notifications.RenewStates(result, filteredSnapshots, snapshotStates, appConfig, now)
+	// Owners are assigned first, so ignored changes are counted for their owner
+	if appConfig.OwnerRouting != nil {
+		result = notifications.AssignOwners(result, databases, appConfig.OwnerRouting.TagKeys)
+	}
+	result = notifications.DropIgnored(result, ignored)
+	result = notifications.TrackHealth(result, health)
 
-		rdsClient := rds.NewFromConfig(cfg)
-		cutoffDate := time.Now().AddDate(0, 0, -appConfig.SnapshotAgeDays)
+	scan := regionScan{
+		region:           region,
+		result:           notifications.MuteAcknowledged(result, acks, now),
+		acknowledgements: acks,
+	}
+
+	// Ignored snapshots neither raise nor resolve backup problems
+	if escalationPolicy != nil || appConfig.OpsItems {
+		scan.inventory = &escalation.RegionInventory{
+			Region:    region,
+			Snapshots: ignored.Filter(filteredSnapshots),
+			Databases: databases,
+		}
+	}
 
-		// Get existing processed snapshots from DynamoDB
-		processedSnapshots, err := storage.GetProcessedSnapshots(ctx, ddbClient, region)
+	if appConfig.SecurityHubFindings {
+		publicSnapshots, err := backups.FindPublicSnapshots(ctx, rdsClient, allSnapshots)
 		if err != nil {
-			return fmt.Errorf("unable to get processed snapshots from DynamoDB in region %s: %v", region, err)
+			return regionScan{}, fmt.Errorf("unable to check snapshot sharing in region %s: %v", region, err)
 		}
+		scan.complianceInventory = &compliance.Inventory{
+			Region:          region,
+			Snapshots:       allSnapshots,
+			Databases:       databases,
+			PublicSnapshots: publicSnapshots,
+		}
+	}
 
-		// Get instance snapshots based on configured age
-		snapshots, err := backups.GetFilteredSnapshots(ctx, rdsClient, cutoffDate)
+	// The changes of the region are sent by this run, so a later run starts
+	// over. Should sending fail, the next run scans the region in full.
+	if resumed {
+		if err := stateStore.DeleteCheckpoint(ctx, checkpoint); err != nil {
+			return regionScan{}, err
+		}
+	}
+
+	return scan, nil
+}
+
+// runFindings evaluates the compliance checks of every region and syncs the
+// violations with the Security Hub findings of the region. Failed regions are
+// recorded in outcome.
+func runFindings(ctx context.Context, inventories []compliance.Inventory, outcome *regions.Outcome) {
+	now := time.Now()
+	rules := compliance.Rules{
+		MinRetentionDays: appConfig.MinRetentionDays,
+		CoverageStart:    now.Add(-time.Duration(appConfig.CoverageHours) * time.Hour),
+	}
+
+	for _, inventory := range inventories {
+		clients, err := regionClients.Get(ctx, inventory.Region)
+		if err == nil {
+			violations := compliance.Evaluate(inventory, rules)
+			err = findings.Sync(ctx, clients.SecurityHub, stateStore,
+				appConfig.AccountID, inventory.Region, violations, now)
+		}
 		if err != nil {
-			return fmt.Errorf("unable to describe DB snapshots in region %s: %v", region, err)
+			outcome.Fail(regions.Failure{Region: inventory.Region, Stage: regions.StageSecurityHub, Err: err})
+			continue
 		}
+		outcome.Complete(inventory.Region, regions.StageSecurityHub)
+	}
+}
+
+// runOpsItems opens an OpsItem for every database whose latest snapshot failed
+// or that has no recent backup, and resolves the OpsItems of databases that
+// have a successful snapshot again. Acknowledgements and suppression windows
+// only silence notifications, they do not close OpsItems. Failed regions are
+// recorded in outcome.
+func runOpsItems(ctx context.Context, inventories []escalation.RegionInventory, outcome *regions.Outcome) {
+	now := time.Now()
+	coverageStart := now.Add(-time.Duration(appConfig.CoverageHours) * time.Hour)
 
-		// Get cluster snapshots based on configured age
-		clusterSnapshots, err := backups.GetFilteredClusterSnapshots(ctx, rdsClient, cutoffDate)
+	for _, inventory := range inventories {
+		clients, err := regionClients.Get(ctx, inventory.Region)
+		if err == nil {
+			problems := escalation.FindProblems(inventory, coverageStart)
+			err = opsitems.Sync(ctx, clients.SSM, stateStore, inventory.Region,
+				problems, inventory.Snapshots, now)
+		}
 		if err != nil {
-			return fmt.Errorf("unable to describe DB cluster snapshots in region %s: %v", region, err)
+			outcome.Fail(regions.Failure{Region: inventory.Region, Stage: regions.StageOpsItems, Err: err})
+			continue
 		}
+		outcome.Complete(inventory.Region, regions.StageOpsItems)
+	}
+}
+
+// scanReportRegion lists every snapshot and database of region for a summary
+// report.
+func scanReportRegion(ctx context.Context, region string) (reports.RegionInventory, error) {
+	clients, err := regionClients.Get(ctx, region)
+	if err != nil {
+		return reports.RegionInventory{}, err
+	}
+
+	// Storage totals need every snapshot, not only the recent ones
+	snapshots, err := backups.GetFilteredSnapshots(ctx, clients.RDS, time.Time{})
+	if err != nil {
+		return reports.RegionInventory{}, fmt.Errorf("unable to describe DB snapshots in region %s: %v", region, err)
+	}
+
+	clusterSnapshots, err := backups.GetFilteredClusterSnapshots(ctx, clients.RDS, time.Time{})
+	if err != nil {
+		return reports.RegionInventory{}, fmt.Errorf("unable to describe DB cluster snapshots in region %s: %v", region, err)
+	}
+
+	databases, err := backups.ListDatabases(ctx, clients.RDS)
+	if err != nil {
+		return reports.RegionInventory{}, fmt.Errorf("unable to list databases in region %s: %v", region, err)
+	}
+
+	return reports.RegionInventory{
+		Account:   appConfig.AccountID,
+		Region:    region,
+		Snapshots: backups.ProcessSnapshots(snapshots, clusterSnapshots),
+		Databases: databases,
+	}, nil
+}
+
+// runEscalation sends reminders for databases whose latest snapshot is still
+// failed or missing, and updates the escalation states once they were sent.
+// Databases in the scope of an open suppression window, or acknowledged or
+// snoozed by an operator, are left untouched until the window closes or the
+// acknowledgement expires. Acknowledgements of recovered databases are cleared.
+func runEscalation(ctx context.Context, inventories []escalation.RegionInventory,
+	acknowledgements map[string]map[string]storage.Acknowledgement) error {
+
+	now := time.Now()
+	coverageStart := now.Add(-time.Duration(appConfig.CoverageHours) * time.Hour)
 
-		// Compare with DynamoDB state and send summary report
-		filteredSnapshots := backups.ProcessSnapshots(snapshots, clusterSnapshots)
-		err = notifications.ProcessSnapshotChanges(
-			ctx, filteredSnapshots, processedSnapshots, appConfig, region, snsClient, ddbClient)
+	var reminders []escalation.Reminder
+	var updates, resolved []storage.EscalationState
+	var recovered []storage.Acknowledgement
+
+	for _, inventory := range inventories {
+		states, err := stateStore.GetEscalationStates(ctx, inventory.Region)
 		if err != nil {
-			return fmt.Errorf("unable to process snapshots in region %s: %v", region, err)
+			return err
+		}
+
+		var problems []escalation.Problem
+		acks := acknowledgements[inventory.Region]
+		for _, problem := range escalation.FindProblems(inventory, coverageStart) {
+			key := problem.DatabaseType + "/" + problem.DatabaseID
+			if ack, ok := acks[key]; (ok && ack.Active(now)) || suppressed(problem, now) {
+				delete(states, key)
+				continue
+			}
+			problems = append(problems, problem)
+		}
+
+		regionReminders, regionUpdates, regionResolved := escalationPolicy.Evaluate(problems, states, now)
+		reminders = append(reminders, regionReminders...)
+		updates = append(updates, regionUpdates...)
+		resolved = append(resolved, regionResolved...)
+
+		for _, state := range regionResolved {
+			if ack, ok := acks[state.Key()]; ok {
+				recovered = append(recovered, ack)
+			}
 		}
 	}
 
-	return nil
+	err := notifications.SendReminders(ctx, reminders, appConfig.AccountID, templates, router, escalationNotifiers)
+	if err != nil {
+		return err
+	}
+
+	if err := stateStore.PutEscalationStates(ctx, updates); err != nil {
+		return err
+	}
+	if err := stateStore.DeleteEscalationStates(ctx, resolved); err != nil {
+		return err
+	}
+	return stateStore.DeleteAcknowledgements(ctx, recovered)
+}
+
+func suppressed(problem escalation.Problem, now time.Time) bool {
+	for _, window := range windows {
+		if window.Active(now) && window.Covers(problem.Region, []string{problem.DatabaseID}, problem.Tags) {
+			return true
+		}
+	}
+	return false
+}
+
+// runReport scans every region and sends a backup health summary for period,
+// compared with the report of the same period one week earlier.
+func runReport(ctx context.Context, period string) error {
+	if !reports.ValidPeriod(period) {
+		return fmt.Errorf("unsupported report period: %q", period)
+	}
+	fmt.Printf("Generating %s report\n", period)
+
+	scanCtx, cancel := scanContext(ctx)
+	defer cancel()
+	// A report that leaves out regions would understate failures and gaps
+	inventories, failures := regions.Scan(scanCtx, appConfig.Regions, appConfig.RegionParallelism, scanReportRegion)
+	if len(failures) > 0 {
+		errs := make([]error, len(failures))
+		for i, failure := range failures {
+			errs[i] = failure
+		}
+		return fmt.Errorf("unable to generate %s report: %w", period, errors.Join(errs...))
+	}
+
+	now := time.Now()
+	previous, err := stateStore.GetReportMetrics(ctx, period, reports.PreviousReportDate(now))
+	if err != nil {
+		return err
+	}
+
+	report := reports.BuildReport(period, appConfig.AccountID, now,
+		time.Duration(appConfig.CoverageHours)*time.Hour, inventories, previous)
+
+	if err := notifications.SendReport(ctx, report, templates, router); err != nil {
+		return fmt.Errorf("unable to send %s report: %v", period, err)
+	}
+
+	return stateStore.PutReportMetrics(ctx, report.Metrics)
 }
 
 func main() {
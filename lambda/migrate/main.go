@@ -0,0 +1,84 @@
+// Command migrate rewrites the items of the state table to the key schema
+// scoped by account, region and snapshot ARN. It runs once, from a machine
+// with access to the table and to RDS in every region of the table:
+//
+//	go run ./lambda/migrate -table <table> -account <account> -dry-run
+//
+// Snapshot status rows of the old schema only name the snapshot, so the
+// command lists the snapshots of each region to find their ARNs. Rows of
+// snapshots that no longer exist are deleted.
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	"rds-backup-monitor/lambda/backups"
+	"rds-backup-monitor/lambda/regions"
+	"rds-backup-monitor/lambda/storage"
+
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+)
+
+func main() {
+	table := flag.String("table", os.Getenv("DYNAMODB_TABLE_NAME"), "name of the state table")
+	account := flag.String("account", os.Getenv("ACCOUNT_ID"), "account of the snapshots in the table")
+	dryRun := flag.Bool("dry-run", false, "count the items to migrate without writing")
+	flag.Parse()
+
+	if *table == "" || *account == "" {
+		fmt.Fprintln(os.Stderr, "-table and -account are required")
+		os.Exit(2)
+	}
+
+	ctx := context.Background()
+	cfg, err := config.LoadDefaultConfig(ctx)
+	if err != nil {
+		panic(fmt.Sprintf("unable to load SDK config: %v", err))
+	}
+
+	resolver := &snapshotResolver{clients: regions.NewCache(regions.LoadDefaultConfig)}
+	stats, err := storage.MigrateKeys(ctx, dynamodb.NewFromConfig(cfg), *table, *account, resolver.resolve, *dryRun)
+	fmt.Printf("Snapshots: %d, resources: %d, checkpoints: %d, locks: %d, history: %d, other: %d, dropped: %d\n",
+		stats.Snapshots, stats.Resources, stats.Checkpoints, stats.Locks, stats.History, stats.Other, stats.Dropped)
+	if err != nil {
+		panic(err.Error())
+	}
+	if *dryRun {
+		fmt.Println("Dry run, nothing was written")
+	}
+}
+
+// snapshotResolver lists the snapshots of a region on its first lookup.
+type snapshotResolver struct {
+	clients   *regions.Cache
+	snapshots map[string]map[string][]storage.SnapshotInfo
+}
+
+func (r *snapshotResolver) resolve(ctx context.Context, region, snapshotID string) ([]storage.SnapshotInfo, error) {
+	if r.snapshots == nil {
+		r.snapshots = make(map[string]map[string][]storage.SnapshotInfo)
+	}
+	if _, ok := r.snapshots[region]; !ok {
+		clients, err := r.clients.Get(ctx, region)
+		if err != nil {
+			return nil, err
+		}
+		byID := make(map[string][]storage.SnapshotInfo)
+		for page, err := range backups.SnapshotPages(ctx, clients.RDS, backups.Position{}, time.Time{}) {
+			if err != nil {
+				return nil, err
+			}
+			for _, snapshot := range page.Snapshots {
+				byID[snapshot.SnapshotID] = append(byID[snapshot.SnapshotID], snapshot)
+			}
+		}
+		fmt.Printf("Listed the snapshots of region %s\n", region)
+		r.snapshots[region] = byID
+	}
+	return r.snapshots[region][snapshotID], nil
+}
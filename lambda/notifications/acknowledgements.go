@@ -0,0 +1,51 @@
+package notifications
+
+import (
+	"fmt"
+	"time"
+
+	"rds-backup-monitor/lambda/storage"
+)
+
+// MuteAcknowledged drops the changes of databases that an operator acknowledged
+// or snoozed. Their snapshot states are still recorded. A change to an
+// available snapshot means the database recovered: it is sent, and the
+// acknowledgement is cleared once the digest went out.
+func MuteAcknowledged(result RegionResult, acks map[string]storage.Acknowledgement, now time.Time) RegionResult {
+	if len(acks) == 0 {
+		return result
+	}
+
+	changes := make([]SnapshotStatusChange, 0, len(result.Changes))
+	recovered := make(map[string]bool)
+
+	for _, change := range result.Changes {
+		ack, ok := acks[change.SnapshotType+"/"+change.DBInstance]
+		if !ok || !ack.Active(now) {
+			changes = append(changes, change)
+			continue
+		}
+
+		if change.CurrentStatus == "available" {
+			changes = append(changes, change)
+			if !recovered[ack.Key()] {
+				recovered[ack.Key()] = true
+				result.RecoveredAcknowledgements = append(result.RecoveredAcknowledgements, ack)
+			}
+			continue
+		}
+
+		fmt.Printf("Muting change of snapshot %s, %s %s is %s until %s\n", change.SnapshotID,
+			ack.DatabaseType, ack.DatabaseID, actionPastTense(ack.Action), ack.Until.Format(time.RFC3339))
+	}
+
+	result.Changes = changes
+	return result
+}
+
+func actionPastTense(action string) string {
+	if action == "snooze" {
+		return "snoozed"
+	}
+	return "acknowledged"
+}
@@ -0,0 +1,32 @@
+package notifications
+
+import (
+	"testing"
+	"time"
+
+	"rds-backup-monitor/lambda/storage"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMuteAcknowledged(t *testing.T) {
+	now := time.Date(2024, 11, 20, 12, 0, 0, 0, time.UTC)
+	snoozed := storage.Acknowledgement{Region: "us-east-1", DatabaseType: "instance", DatabaseID: "db-1", Action: "snooze", Until: now.Add(time.Hour)}
+	expired := storage.Acknowledgement{Region: "us-east-1", DatabaseType: "instance", DatabaseID: "db-2", Action: "ack", Until: now.Add(-time.Hour)}
+	acks := map[string]storage.Acknowledgement{snoozed.Key(): snoozed, expired.Key(): expired}
+
+	failed := SnapshotStatusChange{SnapshotID: "snap-1", SnapshotType: "instance", DBInstance: "db-1", CurrentStatus: "failed"}
+	recovered := SnapshotStatusChange{SnapshotID: "snap-2", SnapshotType: "instance", DBInstance: "db-1", CurrentStatus: "available"}
+	expiredChange := SnapshotStatusChange{SnapshotID: "snap-3", SnapshotType: "instance", DBInstance: "db-2", CurrentStatus: "failed"}
+	clusterChange := SnapshotStatusChange{SnapshotID: "snap-4", SnapshotType: "cluster", DBInstance: "db-1", CurrentStatus: "failed"}
+
+	result := MuteAcknowledged(RegionResult{
+		Region:            "us-east-1",
+		Changes:           []SnapshotStatusChange{failed, recovered, expiredChange, clusterChange},
+		SnapshotsToUpdate: []storage.SnapshotInfo{{SnapshotID: "snap-1"}, {SnapshotID: "snap-2"}, {SnapshotID: "snap-3"}, {SnapshotID: "snap-4"}},
+	}, acks, now)
+
+	assert.Equal(t, []SnapshotStatusChange{recovered, expiredChange, clusterChange}, result.Changes)
+	assert.Len(t, result.SnapshotsToUpdate, 4)
+	assert.Equal(t, []storage.Acknowledgement{snoozed}, result.RecoveredAcknowledgements)
+}
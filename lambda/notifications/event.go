@@ -0,0 +1,152 @@
+package notifications
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// EventSchemaVersion identifies the layout of ChangeEvent and ChangeEventBatch.
+// The major version changes when a field is removed or changes meaning; new
+// optional fields only bump the minor version. See schemas/change-event.schema.json.
+const EventSchemaVersion = "1.6"
+
+const eventTypeSnapshotStatusChanged = "SnapshotStatusChanged"
+
+// ChangeEvent is the machine-readable representation of a SnapshotStatusChange.
+type ChangeEvent struct {
+	SchemaVersion string          `json:"schemaVersion"`
+	EventType     string          `json:"eventType"`
+	Account       string          `json:"account"`
+	Region        string          `json:"region"`
+	Severity      string          `json:"severity"`
+	Snapshot      EventSnapshot   `json:"snapshot"`
+	Resource      EventResource   `json:"resource"`
+	Transition    EventTransition `json:"transition"`
+	Recovery      *EventRecovery  `json:"recovery,omitempty"`
+	ObservedAt    time.Time       `json:"observedAt"`
+}
+
+type EventSnapshot struct {
+	ID           string            `json:"id"`
+	Arn          string            `json:"arn,omitempty"`
+	CreationType string            `json:"creationType,omitempty"`
+	CreatedAt    time.Time         `json:"createdAt"`
+	Tags         map[string]string `json:"tags,omitempty"`
+}
+
+type EventResource struct {
+	ID    string `json:"id"`
+	Type  string `json:"type"`
+	Owner string `json:"owner,omitempty"`
+}
+
+type EventTransition struct {
+	From string `json:"from,omitempty"`
+	To   string `json:"to"`
+}
+
+// EventRecovery is set on the event that ended a backup outage.
+type EventRecovery struct {
+	FailedSnapshotID string    `json:"failedSnapshotId"`
+	Since            time.Time `json:"since"`
+	OutageSeconds    int64     `json:"outageSeconds"`
+}
+
+// ChangeEventBatch wraps all change events published in a single notification.
+type ChangeEventBatch struct {
+	SchemaVersion string        `json:"schemaVersion"`
+	Account       string        `json:"account"`
+	Severity      string        `json:"severity"`
+	ObservedAt    time.Time     `json:"observedAt"`
+	ChangeCount   int           `json:"changeCount"`
+	HeldBy        string        `json:"heldBy,omitempty"`
+	Owner         string        `json:"owner,omitempty"`
+	Part          int           `json:"part,omitempty"`
+	Parts         int           `json:"parts,omitempty"`
+	IgnoredCount  int           `json:"ignoredCount,omitempty"`
+	Events        []ChangeEvent `json:"events"`
+	// Summary counts the changes without an event, which are left out when a
+	// digest lists too many changes.
+	Summary []EventChangeGroup `json:"summary,omitempty"`
+}
+
+type EventChangeGroup struct {
+	Region string `json:"region"`
+	Status string `json:"status"`
+	New    bool   `json:"new"`
+	Count  int    `json:"count"`
+}
+
+func newChangeEvent(change SnapshotStatusChange, account string, observedAt time.Time) ChangeEvent {
+	event := ChangeEvent{
+		SchemaVersion: EventSchemaVersion,
+		EventType:     eventTypeSnapshotStatusChanged,
+		Account:       account,
+		Region:        change.Region,
+		Severity:      change.Severity,
+		Snapshot: EventSnapshot{
+			ID:           change.SnapshotID,
+			Arn:          change.SnapshotArn,
+			CreationType: change.CreationType,
+			CreatedAt:    change.CreateTime.UTC(),
+			Tags:         change.Tags,
+		},
+		Resource: EventResource{
+			ID:    change.DBInstance,
+			Type:  change.SnapshotType,
+			Owner: change.Owner,
+		},
+		Transition: EventTransition{
+			From: change.PreviousStatus,
+			To:   change.CurrentStatus,
+		},
+		ObservedAt: observedAt.UTC(),
+	}
+	if change.Recovery != nil {
+		event.Recovery = &EventRecovery{
+			FailedSnapshotID: change.Recovery.FailedSnapshotID,
+			Since:            change.Recovery.Since.UTC(),
+			OutageSeconds:    int64(change.Recovery.Duration / time.Second),
+		}
+	}
+	return event
+}
+
+func newChangeEventBatch(digest Digest, account string, observedAt time.Time) ChangeEventBatch {
+	events := make([]ChangeEvent, len(digest.Changes))
+	for i, change := range digest.Changes {
+		events[i] = newChangeEvent(change, account, observedAt)
+	}
+
+	batch := ChangeEventBatch{
+		SchemaVersion: EventSchemaVersion,
+		Account:       account,
+		Severity:      highestSeverity(digest.allChanges()),
+		ObservedAt:    observedAt.UTC(),
+		ChangeCount:   len(digest.Changes),
+		HeldBy:        digest.HeldBy,
+		Owner:         digest.Owner,
+		Part:          digest.Part,
+		Parts:         digest.Parts,
+		IgnoredCount:  digest.Ignored,
+		Events:        events,
+	}
+	for _, group := range summarize(digest.Summarized) {
+		batch.Summary = append(batch.Summary, EventChangeGroup{
+			Region: group.Region,
+			Status: group.Status,
+			New:    group.New,
+			Count:  group.Count,
+		})
+	}
+	return batch
+}
+
+func formatJSONMessage(digest Digest, account string, observedAt time.Time) (string, error) {
+	payload, err := json.Marshal(newChangeEventBatch(digest, account, observedAt))
+	if err != nil {
+		return "", fmt.Errorf("unable to marshal change events: %v", err)
+	}
+	return string(payload), nil
+}
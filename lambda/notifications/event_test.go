@@ -0,0 +1,112 @@
+package notifications
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFormatJSONMessage(t *testing.T) {
+	observedAt := time.Date(2024, 11, 20, 10, 0, 0, 0, time.UTC)
+	createTime := time.Date(2024, 11, 20, 9, 30, 0, 0, time.UTC)
+
+	tests := []struct {
+		name    string
+		changes []SnapshotStatusChange
+		want    ChangeEventBatch
+	}{
+		{
+			name: "encodes status transition",
+			changes: []SnapshotStatusChange{
+				{
+					SnapshotID:     "snap-1",
+					SnapshotArn:    "arn:aws:rds:us-west-2:123456789012:snapshot:snap-1",
+					SnapshotType:   "instance",
+					CreationType:   "automated",
+					CurrentStatus:  "failed",
+					PreviousStatus: "creating",
+					DBInstance:     "db-1",
+					Region:         "us-west-2",
+					Severity:       SeverityCritical,
+					CreateTime:     createTime,
+				},
+			},
+			want: ChangeEventBatch{
+				SchemaVersion: EventSchemaVersion,
+				Account:       "123456789012",
+				Severity:      SeverityCritical,
+				ObservedAt:    observedAt,
+				ChangeCount:   1,
+				Events: []ChangeEvent{
+					{
+						SchemaVersion: EventSchemaVersion,
+						EventType:     "SnapshotStatusChanged",
+						Account:       "123456789012",
+						Region:        "us-west-2",
+						Severity:      SeverityCritical,
+						Snapshot: EventSnapshot{
+							ID:           "snap-1",
+							Arn:          "arn:aws:rds:us-west-2:123456789012:snapshot:snap-1",
+							CreationType: "automated",
+							CreatedAt:    createTime,
+						},
+						Resource:   EventResource{ID: "db-1", Type: "instance"},
+						Transition: EventTransition{From: "creating", To: "failed"},
+						ObservedAt: observedAt,
+					},
+				},
+			},
+		},
+		{
+			name:    "handles empty changes",
+			changes: []SnapshotStatusChange{},
+			want: ChangeEventBatch{
+				SchemaVersion: EventSchemaVersion,
+				Account:       "123456789012",
+				Severity:      SeverityInfo,
+				ObservedAt:    observedAt,
+				ChangeCount:   0,
+				Events:        []ChangeEvent{},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			message, err := formatJSONMessage(Digest{Changes: tt.changes}, "123456789012", observedAt)
+			assert.NoError(t, err)
+
+			var got ChangeEventBatch
+			assert.NoError(t, json.Unmarshal([]byte(message), &got))
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestFormatJSONMessage_OmitsPreviousStatusForNewSnapshots(t *testing.T) {
+	message, err := formatJSONMessage(Digest{Changes: []SnapshotStatusChange{
+		{SnapshotID: "snap-1", CurrentStatus: "available", Region: "us-west-2", Severity: SeverityInfo},
+	}}, "123456789012", time.Now())
+	assert.NoError(t, err)
+
+	var raw map[string]any
+	assert.NoError(t, json.Unmarshal([]byte(message), &raw))
+	transition := raw["events"].([]any)[0].(map[string]any)["transition"].(map[string]any)
+	assert.NotContains(t, transition, "from")
+	assert.Equal(t, "available", transition["to"])
+}
+
+func TestFormatJSONMessage_Recovery(t *testing.T) {
+	since := time.Date(2024, 11, 19, 6, 0, 0, 0, time.UTC)
+	message, err := formatJSONMessage(Digest{Changes: []SnapshotStatusChange{
+		{SnapshotID: "snap-2", CurrentStatus: "available", Region: "us-west-2", Severity: SeverityInfo,
+			Recovery: &Recovery{FailedSnapshotID: "snap-1", Since: since, Duration: 90 * time.Minute}},
+	}}, "123456789012", time.Now())
+	assert.NoError(t, err)
+
+	var got ChangeEventBatch
+	assert.NoError(t, json.Unmarshal([]byte(message), &got))
+	assert.Equal(t, &EventRecovery{FailedSnapshotID: "snap-1", Since: since, OutageSeconds: 5400}, got.Events[0].Recovery)
+}
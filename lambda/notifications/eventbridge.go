@@ -0,0 +1,97 @@
+package notifications
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"rds-backup-monitor/lambda/types"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/eventbridge"
+	ebTypes "github.com/aws/aws-sdk-go-v2/service/eventbridge/types"
+)
+
+type EventBridgeClient interface {
+	PutEvents(ctx context.Context, params *eventbridge.PutEventsInput, optFns ...func(*eventbridge.Options)) (*eventbridge.PutEventsOutput, error)
+}
+
+const (
+	// EventSource is the source of the events put on the event bus.
+	EventSource = "rds-backup-monitor"
+	// maxPutEventsEntries is the PutEvents limit of entries per call.
+	maxPutEventsEntries = 10
+)
+
+// EventBridgeNotifier puts one SnapshotStatusChanged event per change on an
+// event bus. The detail of each event is a ChangeEvent, described in
+// schemas/snapshot-status-changed.schema.json.
+type EventBridgeNotifier struct {
+	eventBusName string
+	client       EventBridgeClient
+	appConfig    types.Configuration
+}
+
+func NewEventBridgeNotifier(eventBusName string, client EventBridgeClient, appConfig types.Configuration) *EventBridgeNotifier {
+	return &EventBridgeNotifier{
+		eventBusName: eventBusName,
+		client:       client,
+		appConfig:    appConfig,
+	}
+}
+
+func (n *EventBridgeNotifier) Destination() string {
+	return "events:" + n.eventBusName
+}
+
+func (n *EventBridgeNotifier) Notify(ctx context.Context, digest Digest) error {
+	observedAt := time.Now().UTC()
+
+	entries := make([]ebTypes.PutEventsRequestEntry, len(digest.Changes))
+	for i, change := range digest.Changes {
+		detail, err := json.Marshal(newChangeEvent(change, n.appConfig.AccountID, observedAt))
+		if err != nil {
+			return fmt.Errorf("unable to marshal change event: %v", err)
+		}
+
+		entries[i] = ebTypes.PutEventsRequestEntry{
+			EventBusName: aws.String(n.eventBusName),
+			Source:       aws.String(EventSource),
+			DetailType:   aws.String(eventTypeSnapshotStatusChanged),
+			Detail:       aws.String(string(detail)),
+			Time:         aws.Time(observedAt),
+		}
+		if change.SnapshotArn != "" {
+			entries[i].Resources = []string{change.SnapshotArn}
+		}
+	}
+
+	for start := 0; start < len(entries); start += maxPutEventsEntries {
+		end := min(start+maxPutEventsEntries, len(entries))
+
+		output, err := n.client.PutEvents(ctx, &eventbridge.PutEventsInput{Entries: entries[start:end]})
+		if err != nil {
+			return fmt.Errorf("unable to put events on %s: %v", n.eventBusName, err)
+		}
+		if output.FailedEntryCount > 0 {
+			var failures []string
+			for i, entry := range output.Entries {
+				if entry.ErrorCode != nil {
+					failures = append(failures, fmt.Sprintf("%s: %s %s", digest.Changes[start+i].SnapshotID,
+						aws.ToString(entry.ErrorCode), aws.ToString(entry.ErrorMessage)))
+				}
+			}
+			return fmt.Errorf("unable to put %d events on %s: %s",
+				output.FailedEntryCount, n.eventBusName, strings.Join(failures, "; "))
+		}
+	}
+	return nil
+}
+
+// SendMessage does nothing; reports and reminders are meant for people and are
+// not put on the event bus.
+func (n *EventBridgeNotifier) SendMessage(ctx context.Context, messageType string, message RenderedMessage) error {
+	return nil
+}
@@ -0,0 +1,109 @@
+package notifications
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"testing"
+	"time"
+
+	"rds-backup-monitor/lambda/types"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/eventbridge"
+	ebTypes "github.com/aws/aws-sdk-go-v2/service/eventbridge/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type mockEventBridgeClient struct {
+	inputs []*eventbridge.PutEventsInput
+	failed bool
+	err    error
+}
+
+func (m *mockEventBridgeClient) PutEvents(ctx context.Context, params *eventbridge.PutEventsInput, optFns ...func(*eventbridge.Options)) (*eventbridge.PutEventsOutput, error) {
+	m.inputs = append(m.inputs, params)
+	if m.err != nil {
+		return nil, m.err
+	}
+	output := &eventbridge.PutEventsOutput{Entries: make([]ebTypes.PutEventsResultEntry, len(params.Entries))}
+	if m.failed {
+		output.FailedEntryCount = 1
+		output.Entries[0] = ebTypes.PutEventsResultEntry{
+			ErrorCode:    aws.String("InternalFailure"),
+			ErrorMessage: aws.String("try again"),
+		}
+	}
+	return output, nil
+}
+
+func TestEventBridgeNotifier_Notify(t *testing.T) {
+	createTime := time.Date(2024, 11, 20, 3, 0, 0, 0, time.UTC)
+	var changes []SnapshotStatusChange
+	for i := 0; i < 12; i++ {
+		changes = append(changes, SnapshotStatusChange{
+			SnapshotID:     fmt.Sprintf("rds:orders-%02d", i),
+			SnapshotArn:    fmt.Sprintf("arn:aws:rds:us-east-1:123456789012:snapshot:rds:orders-%02d", i),
+			SnapshotType:   "instance",
+			CurrentStatus:  "failed",
+			PreviousStatus: "creating",
+			DBInstance:     "orders",
+			Region:         "us-east-1",
+			Severity:       SeverityCritical,
+			CreateTime:     createTime,
+			Owner:          "payments",
+		})
+	}
+
+	client := &mockEventBridgeClient{}
+	notifier := NewEventBridgeNotifier("platform-events", client, types.Configuration{AccountID: "123456789012"})
+	require.NoError(t, notifier.Notify(context.Background(), Digest{Changes: changes}))
+
+	assert.Equal(t, "events:platform-events", notifier.Destination())
+	require.Len(t, client.inputs, 2)
+	assert.Len(t, client.inputs[0].Entries, 10)
+	assert.Len(t, client.inputs[1].Entries, 2)
+
+	entry := client.inputs[0].Entries[0]
+	assert.Equal(t, "platform-events", aws.ToString(entry.EventBusName))
+	assert.Equal(t, "rds-backup-monitor", aws.ToString(entry.Source))
+	assert.Equal(t, "SnapshotStatusChanged", aws.ToString(entry.DetailType))
+	assert.Equal(t, []string{"arn:aws:rds:us-east-1:123456789012:snapshot:rds:orders-00"}, entry.Resources)
+
+	var detail ChangeEvent
+	require.NoError(t, json.Unmarshal([]byte(aws.ToString(entry.Detail)), &detail))
+	assert.Equal(t, EventSchemaVersion, detail.SchemaVersion)
+	assert.Equal(t, "rds:orders-00", detail.Snapshot.ID)
+	assert.Equal(t, EventResource{ID: "orders", Type: "instance", Owner: "payments"}, detail.Resource)
+	assert.Equal(t, EventTransition{From: "creating", To: "failed"}, detail.Transition)
+}
+
+func TestEventBridgeNotifier_NotifyErrors(t *testing.T) {
+	changes := []SnapshotStatusChange{{SnapshotID: "rds:orders-1", CurrentStatus: "failed", Region: "us-east-1"}}
+
+	tests := []struct {
+		name    string
+		client  *mockEventBridgeClient
+		wantErr string
+	}{
+		{
+			name:    "API error",
+			client:  &mockEventBridgeClient{err: fmt.Errorf("AccessDenied")},
+			wantErr: "unable to put events on bus: AccessDenied",
+		},
+		{
+			name:    "failed entries",
+			client:  &mockEventBridgeClient{failed: true},
+			wantErr: "unable to put 1 events on bus: rds:orders-1: InternalFailure try again",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			notifier := NewEventBridgeNotifier("bus", tt.client, types.Configuration{})
+			err := notifier.Notify(context.Background(), Digest{Changes: changes})
+			assert.EqualError(t, err, tt.wantErr)
+		})
+	}
+}
@@ -0,0 +1,84 @@
+package notifications
+
+import (
+	"sort"
+
+	"rds-backup-monitor/lambda/storage"
+)
+
+// TrackHealth follows the backup health of each database across runs. A
+// failed snapshot marks its database unhealthy until an available snapshot
+// created after the failure is seen; that change then carries a Recovery with
+// the length of the outage. health holds the unhealthy databases of the region
+// keyed by storage.DatabaseHealth.Key.
+func TrackHealth(result RegionResult, health map[string]storage.DatabaseHealth) RegionResult {
+	// Oldest snapshots first, so a failure and its recovery found in the same
+	// run are seen in order
+	order := make([]int, len(result.Changes))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(i, j int) bool {
+		return result.Changes[order[i]].CreateTime.Before(result.Changes[order[j]].CreateTime)
+	})
+
+	unhealthy := make(map[string]storage.DatabaseHealth, len(health))
+	for key, record := range health {
+		unhealthy[key] = record
+	}
+	added := make(map[string]bool)
+
+	changes := make([]SnapshotStatusChange, len(result.Changes))
+	copy(changes, result.Changes)
+
+	for _, i := range order {
+		change := changes[i]
+		key := change.SnapshotType + "/" + change.DBInstance
+		record, ok := unhealthy[key]
+
+		switch {
+		case storage.IsFailedStatus(change.CurrentStatus) && !ok:
+			unhealthy[key] = storage.DatabaseHealth{
+				Region:           result.Region,
+				DatabaseType:     change.SnapshotType,
+				DatabaseID:       change.DBInstance,
+				FailedSnapshotID: change.SnapshotID,
+				Since:            change.CreateTime,
+			}
+			added[key] = true
+		case change.CurrentStatus == "available" && ok && change.CreateTime.After(record.Since):
+			changes[i].Recovery = &Recovery{
+				FailedSnapshotID: record.FailedSnapshotID,
+				Since:            record.Since,
+				Duration:         change.CreateTime.Sub(record.Since),
+			}
+			delete(unhealthy, key)
+			if added[key] {
+				delete(added, key)
+			} else {
+				result.RecoveredHealth = append(result.RecoveredHealth, record)
+			}
+		}
+	}
+
+	for key := range added {
+		result.HealthUpdates = append(result.HealthUpdates, unhealthy[key])
+	}
+	sort.Slice(result.HealthUpdates, func(i, j int) bool {
+		return result.HealthUpdates[i].Key() < result.HealthUpdates[j].Key()
+	})
+
+	result.Changes = changes
+	return result
+}
+
+// recoveries returns the changes of changes that ended an outage.
+func recoveries(changes []SnapshotStatusChange) []SnapshotStatusChange {
+	var recovered []SnapshotStatusChange
+	for _, change := range changes {
+		if change.Recovery != nil {
+			recovered = append(recovered, change)
+		}
+	}
+	return recovered
+}
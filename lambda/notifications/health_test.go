@@ -0,0 +1,82 @@
+package notifications
+
+import (
+	"testing"
+	"time"
+
+	"rds-backup-monitor/lambda/storage"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTrackHealth(t *testing.T) {
+	base := time.Date(2024, 11, 20, 0, 0, 0, 0, time.UTC)
+	stored := storage.DatabaseHealth{
+		Region:           "us-east-1",
+		DatabaseType:     "instance",
+		DatabaseID:       "orders",
+		FailedSnapshotID: "rds:orders-1",
+		Since:            base,
+	}
+	health := map[string]storage.DatabaseHealth{stored.Key(): stored}
+
+	change := func(id, database, status string, created time.Time) SnapshotStatusChange {
+		return SnapshotStatusChange{
+			SnapshotID:    id,
+			SnapshotType:  "instance",
+			DBInstance:    database,
+			CurrentStatus: status,
+			Region:        "us-east-1",
+			CreateTime:    created,
+		}
+	}
+
+	result := TrackHealth(RegionResult{Region: "us-east-1", Changes: []SnapshotStatusChange{
+		// Recovers the stored outage
+		change("rds:orders-2", "orders", "available", base.Add(26*time.Hour)),
+		// Fails and recovers within the same run, listed out of order
+		change("rds:search-2", "search", "available", base.Add(3*time.Hour)),
+		change("rds:search-1", "search", "failed", base.Add(time.Hour)),
+		// Starts a new outage
+		change("rds:billing-1", "billing", "failed", base.Add(2*time.Hour)),
+		// Available, but created before the failure
+		change("rds:billing-0", "billing", "available", base),
+	}}, health)
+
+	require.NotNil(t, result.Changes[0].Recovery)
+	assert.Equal(t, Recovery{FailedSnapshotID: "rds:orders-1", Since: base, Duration: 26 * time.Hour}, *result.Changes[0].Recovery)
+	require.NotNil(t, result.Changes[1].Recovery)
+	assert.Equal(t, 2*time.Hour, result.Changes[1].Recovery.Duration)
+	assert.Nil(t, result.Changes[2].Recovery)
+	assert.Nil(t, result.Changes[3].Recovery)
+	assert.Nil(t, result.Changes[4].Recovery)
+
+	assert.Equal(t, []storage.DatabaseHealth{{
+		Region:           "us-east-1",
+		DatabaseType:     "instance",
+		DatabaseID:       "billing",
+		FailedSnapshotID: "rds:billing-1",
+		Since:            base.Add(2 * time.Hour),
+	}}, result.HealthUpdates)
+	assert.Equal(t, []storage.DatabaseHealth{stored}, result.RecoveredHealth)
+}
+
+func TestTrackHealth_KeepsOutageOpen(t *testing.T) {
+	since := time.Date(2024, 11, 20, 0, 0, 0, 0, time.UTC)
+	stored := storage.DatabaseHealth{Region: "us-east-1", DatabaseType: "cluster", DatabaseID: "catalog", FailedSnapshotID: "snap-1", Since: since}
+
+	result := TrackHealth(RegionResult{Region: "us-east-1", Changes: []SnapshotStatusChange{
+		{SnapshotID: "snap-2", SnapshotType: "cluster", DBInstance: "catalog", CurrentStatus: "failed", CreateTime: since.Add(time.Hour)},
+	}}, map[string]storage.DatabaseHealth{stored.Key(): stored})
+
+	assert.Nil(t, result.Changes[0].Recovery)
+	assert.Empty(t, result.HealthUpdates, "the outage keeps its first failed snapshot")
+	assert.Empty(t, result.RecoveredHealth)
+}
+
+func TestFormatDuration(t *testing.T) {
+	assert.Equal(t, "26h5m", formatDuration(26*time.Hour+5*time.Minute+10*time.Second))
+	assert.Equal(t, "1h0m", formatDuration(time.Hour))
+	assert.Equal(t, "less than a minute", formatDuration(20*time.Second))
+}
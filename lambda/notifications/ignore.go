@@ -0,0 +1,185 @@
+package notifications
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+
+	"rds-backup-monitor/lambda/storage"
+	"rds-backup-monitor/lambda/types"
+)
+
+// IgnoreRules are compiled ignore rules. The zero value ignores nothing.
+type IgnoreRules []ignoreRule
+
+type ignoreRule struct {
+	name         string
+	snapshotID   identifierPattern
+	sourceID     identifierPattern
+	snapshotType []string
+	tags         map[string]string
+}
+
+// identifierPattern is a glob, or a regular expression when written between
+// slashes. The empty pattern matches every identifier.
+type identifierPattern struct {
+	glob   string
+	regexp *regexp.Regexp
+}
+
+func parseIdentifierPattern(pattern string) (identifierPattern, error) {
+	if len(pattern) > 1 && strings.HasPrefix(pattern, "/") && strings.HasSuffix(pattern, "/") {
+		re, err := regexp.Compile(pattern[1 : len(pattern)-1])
+		if err != nil {
+			return identifierPattern{}, err
+		}
+		return identifierPattern{regexp: re}, nil
+	}
+	if _, err := path.Match(pattern, ""); err != nil {
+		return identifierPattern{}, err
+	}
+	return identifierPattern{glob: pattern}, nil
+}
+
+func (p identifierPattern) empty() bool {
+	return p.glob == "" && p.regexp == nil
+}
+
+func (p identifierPattern) matches(value string) bool {
+	if p.regexp != nil {
+		return p.regexp.MatchString(value)
+	}
+	return p.glob == "" || globMatch(p.glob, value)
+}
+
+// NewIgnoreRules validates and compiles rules. Rules without any criteria are
+// rejected, since they would silence every snapshot.
+func NewIgnoreRules(rules []types.IgnoreRule) (IgnoreRules, error) {
+	compiled := make(IgnoreRules, 0, len(rules))
+	for i, rule := range rules {
+		name := rule.Name
+		if name == "" {
+			name = fmt.Sprintf("%d", i)
+		}
+
+		snapshotID, err := parseIdentifierPattern(rule.SnapshotID)
+		if err != nil {
+			return nil, fmt.Errorf("ignore rule %s: invalid snapshotId pattern %q: %v", name, rule.SnapshotID, err)
+		}
+		sourceID, err := parseIdentifierPattern(rule.SourceID)
+		if err != nil {
+			return nil, fmt.Errorf("ignore rule %s: invalid sourceId pattern %q: %v", name, rule.SourceID, err)
+		}
+		for key, value := range rule.Tags {
+			if _, err := path.Match(value, ""); err != nil {
+				return nil, fmt.Errorf("ignore rule %s: invalid pattern %q for tag %s: %v", name, value, key, err)
+			}
+		}
+		if snapshotID.empty() && sourceID.empty() && len(rule.SnapshotType) == 0 && len(rule.Tags) == 0 {
+			return nil, fmt.Errorf("ignore rule %s: matches every snapshot", name)
+		}
+
+		compiled = append(compiled, ignoreRule{
+			name:         name,
+			snapshotID:   snapshotID,
+			sourceID:     sourceID,
+			snapshotType: rule.SnapshotType,
+			tags:         rule.Tags,
+		})
+	}
+	return compiled, nil
+}
+
+// Match returns the name of the first rule matching a snapshot.
+func (r IgnoreRules) Match(snapshot storage.SnapshotInfo) (string, bool) {
+	for _, rule := range r {
+		if rule.matches(snapshot.SnapshotID, snapshot.SourceID, snapshot.SnapshotType, snapshot.Tags) {
+			return rule.name, true
+		}
+	}
+	return "", false
+}
+
+// Filter returns the snapshots that no rule matches.
+func (r IgnoreRules) Filter(snapshots []storage.SnapshotInfo) []storage.SnapshotInfo {
+	if len(r) == 0 {
+		return snapshots
+	}
+	filtered := make([]storage.SnapshotInfo, 0, len(snapshots))
+	for _, snapshot := range snapshots {
+		if _, ok := r.Match(snapshot); !ok {
+			filtered = append(filtered, snapshot)
+		}
+	}
+	return filtered
+}
+
+func (rule ignoreRule) matches(snapshotID, sourceID, snapshotType string, tags map[string]string) bool {
+	if !rule.snapshotID.matches(snapshotID) || !rule.sourceID.matches(sourceID) {
+		return false
+	}
+	if len(rule.snapshotType) > 0 && !contains(rule.snapshotType, snapshotType) {
+		return false
+	}
+	for key, pattern := range rule.tags {
+		value, ok := tags[key]
+		if !ok || !globMatch(pattern, value) {
+			return false
+		}
+	}
+	return true
+}
+
+// DropIgnored moves the changes of snapshots matched by an ignore rule to
+// result.Ignored. Their snapshot states are still recorded.
+func DropIgnored(result RegionResult, rules IgnoreRules) RegionResult {
+	if len(rules) == 0 {
+		return result
+	}
+
+	changes := make([]SnapshotStatusChange, 0, len(result.Changes))
+	for _, change := range result.Changes {
+		matched := false
+		for _, rule := range rules {
+			if rule.matches(change.SnapshotID, change.DBInstance, change.SnapshotType, change.Tags) {
+				fmt.Printf("Ignoring change of snapshot %s to %s, matches ignore rule %s\n",
+					change.SnapshotID, change.CurrentStatus, rule.name)
+				matched = true
+				break
+			}
+		}
+		if matched {
+			result.Ignored = append(result.Ignored, change)
+			continue
+		}
+		changes = append(changes, change)
+	}
+
+	result.Changes = changes
+	return result
+}
+
+// countIgnored counts ignored changes by owner and severity, ordered by both.
+func countIgnored(changes []SnapshotStatusChange) []IgnoredCount {
+	var counts []IgnoredCount
+	index := make(map[IgnoredCount]int)
+	for _, change := range changes {
+		key := IgnoredCount{Owner: change.Owner, Severity: change.Severity}
+		i, ok := index[key]
+		if !ok {
+			i = len(counts)
+			index[key] = i
+			counts = append(counts, key)
+		}
+		counts[i].Count++
+	}
+	sort.Slice(counts, func(i, j int) bool {
+		if counts[i].Owner != counts[j].Owner {
+			return counts[i].Owner < counts[j].Owner
+		}
+		return counts[i].Severity < counts[j].Severity
+	})
+	return counts
+}
@@ -0,0 +1,195 @@
+package notifications
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"rds-backup-monitor/lambda/storage"
+	"rds-backup-monitor/lambda/types"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewIgnoreRules(t *testing.T) {
+	tests := []struct {
+		name    string
+		rules   []types.IgnoreRule
+		wantErr string
+	}{
+		{
+			name:  "valid rules",
+			rules: []types.IgnoreRule{{SnapshotID: "rds:*-temp-*"}, {SourceID: "/^ci-restore-[0-9]+$/"}, {SnapshotType: []string{"cluster"}}},
+		},
+		{
+			name:    "invalid glob",
+			rules:   []types.IgnoreRule{{Name: "temp", SnapshotID: "rds:[temp"}},
+			wantErr: "ignore rule temp: invalid snapshotId pattern",
+		},
+		{
+			name:    "invalid regular expression",
+			rules:   []types.IgnoreRule{{SourceID: "/ci-(restore/"}},
+			wantErr: "ignore rule 0: invalid sourceId pattern",
+		},
+		{
+			name:    "invalid tag pattern",
+			rules:   []types.IgnoreRule{{Tags: map[string]string{"purpose": "[ci"}}},
+			wantErr: "invalid pattern \"[ci\" for tag purpose",
+		},
+		{
+			name:    "rule without criteria",
+			rules:   []types.IgnoreRule{{Name: "everything"}},
+			wantErr: "ignore rule everything: matches every snapshot",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewIgnoreRules(tt.rules)
+			if tt.wantErr != "" {
+				assert.ErrorContains(t, err, tt.wantErr)
+				return
+			}
+			assert.NoError(t, err)
+		})
+	}
+}
+
+func TestIgnoreRulesMatch(t *testing.T) {
+	rules, err := NewIgnoreRules([]types.IgnoreRule{
+		{Name: "temp", SnapshotID: "rds:*-temp-*"},
+		{Name: "ci", SourceID: "/^ci-restore-[0-9]+$/", SnapshotType: []string{"instance"}},
+		{Name: "tagged", Tags: map[string]string{"purpose": "test*"}},
+	})
+	require.NoError(t, err)
+
+	tests := []struct {
+		name     string
+		snapshot storage.SnapshotInfo
+		wantRule string
+	}{
+		{
+			name:     "snapshot identifier glob",
+			snapshot: storage.SnapshotInfo{SnapshotID: "rds:orders-temp-2024", SourceID: "orders"},
+			wantRule: "temp",
+		},
+		{
+			name:     "source identifier regular expression and type",
+			snapshot: storage.SnapshotInfo{SnapshotID: "snap-1", SourceID: "ci-restore-42", SnapshotType: "instance"},
+			wantRule: "ci",
+		},
+		{
+			name:     "other snapshot type",
+			snapshot: storage.SnapshotInfo{SnapshotID: "snap-1", SourceID: "ci-restore-42", SnapshotType: "cluster"},
+		},
+		{
+			name:     "regular expression is anchored by the rule",
+			snapshot: storage.SnapshotInfo{SnapshotID: "snap-1", SourceID: "ci-restore-42-copy", SnapshotType: "instance"},
+		},
+		{
+			name:     "tag glob",
+			snapshot: storage.SnapshotInfo{SnapshotID: "snap-2", SourceID: "orders", Tags: map[string]string{"purpose": "testing"}},
+			wantRule: "tagged",
+		},
+		{
+			name:     "no match",
+			snapshot: storage.SnapshotInfo{SnapshotID: "rds:orders-2024", SourceID: "orders", Tags: map[string]string{"purpose": "prod"}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rule, ok := rules.Match(tt.snapshot)
+			assert.Equal(t, tt.wantRule != "", ok)
+			assert.Equal(t, tt.wantRule, rule)
+		})
+	}
+}
+
+func TestIgnoreRulesFilter(t *testing.T) {
+	rules, err := NewIgnoreRules([]types.IgnoreRule{{SnapshotID: "rds:*-temp-*"}})
+	require.NoError(t, err)
+
+	snapshots := []storage.SnapshotInfo{{SnapshotID: "rds:orders-temp-1"}, {SnapshotID: "rds:orders-1"}}
+	assert.Equal(t, []storage.SnapshotInfo{{SnapshotID: "rds:orders-1"}}, rules.Filter(snapshots))
+	assert.Equal(t, snapshots, IgnoreRules(nil).Filter(snapshots))
+}
+
+func TestDropIgnored(t *testing.T) {
+	rules, err := NewIgnoreRules([]types.IgnoreRule{{SnapshotID: "rds:*-temp-*"}})
+	require.NoError(t, err)
+
+	result := RegionResult{
+		Region: "us-east-1",
+		Changes: []SnapshotStatusChange{
+			{SnapshotID: "rds:orders-temp-1", CurrentStatus: "failed"},
+			{SnapshotID: "rds:orders-1", CurrentStatus: "available"},
+		},
+		SnapshotsToUpdate: []storage.SnapshotInfo{{SnapshotID: "rds:orders-temp-1"}, {SnapshotID: "rds:orders-1"}},
+	}
+
+	result = DropIgnored(result, rules)
+	assert.Equal(t, []SnapshotStatusChange{{SnapshotID: "rds:orders-1", CurrentStatus: "available"}}, result.Changes)
+	assert.Len(t, result.SnapshotsToUpdate, 2, "ignored snapshots are still recorded")
+	assert.Equal(t, []SnapshotStatusChange{{SnapshotID: "rds:orders-temp-1", CurrentStatus: "failed"}}, result.Ignored)
+}
+
+func TestProcessSnapshotChanges_CountsIgnored(t *testing.T) {
+	ignored := func(owner, severity string) SnapshotStatusChange {
+		return SnapshotStatusChange{SnapshotID: "temp", CurrentStatus: "failed", Owner: owner, Severity: severity}
+	}
+
+	t.Run("counts the ignored changes of the run", func(t *testing.T) {
+		notifier := &mockNotifier{destination: "topic"}
+		router := NewRouter([]Notifier{notifier}, nil)
+		results := []RegionResult{
+			{Region: "us-east-1", Changes: []SnapshotStatusChange{{SnapshotID: "snap-1", CurrentStatus: "failed"}},
+				Ignored: []SnapshotStatusChange{ignored("", SeverityCritical), ignored("", SeverityInfo)}},
+			{Region: "eu-west-1", Ignored: []SnapshotStatusChange{ignored("", SeverityCritical)}},
+		}
+
+		err := ProcessSnapshotChanges(context.Background(), results, types.Configuration{}, router, NewMessageBudget(0), nil, storage.NewMemoryStore())
+		require.NoError(t, err)
+		require.Len(t, notifier.notified, 1)
+		assert.Equal(t, 3, notifier.notified[0].Ignored)
+
+		rendered, err := DefaultTemplates().Render(ChannelSNS, newDigestTemplateData(notifier.notified[0], "123456789012", time.Now()))
+		require.NoError(t, err)
+		assert.Contains(t, rendered.Text, "3 changes matched ignore rules and are not listed")
+		assert.Equal(t, "RDS Snapshot Status Update (1 changes, 3 ignored)", rendered.Subject)
+	})
+
+	t.Run("sends the count when every change was ignored", func(t *testing.T) {
+		notifier := &mockNotifier{destination: "topic"}
+		router := NewRouter([]Notifier{notifier}, nil)
+		results := []RegionResult{{Region: "us-east-1", Ignored: []SnapshotStatusChange{ignored("", SeverityCritical)}}}
+
+		err := ProcessSnapshotChanges(context.Background(), results, types.Configuration{}, router, NewMessageBudget(0), nil, storage.NewMemoryStore())
+		require.NoError(t, err)
+		require.Len(t, notifier.notified, 1)
+		assert.Empty(t, notifier.notified[0].Changes)
+		assert.Equal(t, 1, notifier.notified[0].Ignored)
+	})
+
+	t.Run("counts ignored changes for their owner", func(t *testing.T) {
+		fallback := &mockNotifier{destination: "topic"}
+		team := &mockNotifier{destination: "team-a"}
+		router := NewRouter([]Notifier{fallback}, nil)
+		router.SetOwnerRoutes(map[string][]Notifier{"team-a": {team}})
+		results := []RegionResult{{
+			Region:  "us-east-1",
+			Changes: []SnapshotStatusChange{{SnapshotID: "snap-1", CurrentStatus: "failed", Owner: "team-a"}},
+			Ignored: []SnapshotStatusChange{ignored("team-a", SeverityCritical), ignored("team-b", SeverityCritical)},
+		}}
+
+		err := ProcessSnapshotChanges(context.Background(), results, types.Configuration{}, router, NewMessageBudget(0), nil, storage.NewMemoryStore())
+		require.NoError(t, err)
+		require.Len(t, team.notified, 1)
+		assert.Len(t, team.notified[0].Changes, 1)
+		assert.Equal(t, 1, team.notified[0].Ignored)
+		require.Len(t, fallback.notified, 1, "team-b has no route of its own")
+		assert.Empty(t, fallback.notified[0].Changes)
+		assert.Equal(t, 1, fallback.notified[0].Ignored)
+	})
+}
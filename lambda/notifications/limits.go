@@ -0,0 +1,196 @@
+package notifications
+
+import (
+	"fmt"
+	"sort"
+)
+
+// Defaults of the limits applied to change digests.
+const (
+	// DefaultMaxListedChanges is the number of changes listed one by one in
+	// the digest of a notifier; the rest are summarized.
+	DefaultMaxListedChanges = 50
+	// DefaultMaxMessagesPerRun is the number of digest messages a notifier
+	// receives in a single run.
+	DefaultMaxMessagesPerRun = 5
+)
+
+// Message size limits of the notifiers.
+const (
+	// maxSNSMessageBytes is the SNS limit for the message, subject and
+	// message attributes together.
+	maxSNSMessageBytes = 256 * 1024
+	// maxSlackMessageBytes keeps Slack messages below the 40,000 characters
+	// that Slack accepts before truncating.
+	maxSlackMessageBytes = 40000
+)
+
+// sizedNotifier is implemented by notifiers whose messages have a size limit.
+// Digests that do not fit are split into parts.
+type sizedNotifier interface {
+	messageSize(digest Digest) (int, error)
+	maxMessageSize() int
+}
+
+// ChangeGroup counts summarized changes of the same region and status.
+type ChangeGroup struct {
+	Region string
+	Status string
+	// New is set for snapshots seen for the first time.
+	New   bool
+	Count int
+}
+
+func (g ChangeGroup) String() string {
+	noun := "snapshots"
+	if g.Count == 1 {
+		noun = "snapshot"
+	}
+	if g.New {
+		return fmt.Sprintf("%d new %s %s in %s", g.Count, g.Status, noun, g.Region)
+	}
+	return fmt.Sprintf("%d %s changed to %s in %s", g.Count, noun, g.Status, g.Region)
+}
+
+// summarize groups changes by region, status and whether the snapshot is new.
+func summarize(changes []SnapshotStatusChange) []ChangeGroup {
+	type groupKey struct {
+		region, status string
+		new            bool
+	}
+	counts := make(map[groupKey]int)
+	for _, change := range changes {
+		counts[groupKey{change.Region, change.CurrentStatus, change.PreviousStatus == ""}]++
+	}
+
+	groups := make([]ChangeGroup, 0, len(counts))
+	for key, count := range counts {
+		groups = append(groups, ChangeGroup{Region: key.region, Status: key.status, New: key.new, Count: count})
+	}
+	sort.Slice(groups, func(i, j int) bool {
+		if groups[i].Region != groups[j].Region {
+			return groups[i].Region < groups[j].Region
+		}
+		if groups[i].Status != groups[j].Status {
+			return groups[i].Status < groups[j].Status
+		}
+		return groups[i].New
+	})
+	return groups
+}
+
+// MessageBudget counts the digest messages sent to each notifier in a run.
+// A run creates one budget and passes it to every step that sends digests,
+// so the limit covers the relayed, new and catch-up digests together.
+type MessageBudget struct {
+	limit int
+	sent  map[string]int
+}
+
+// NewMessageBudget returns a budget of limit messages per destination, or of
+// DefaultMaxMessagesPerRun when limit is not positive.
+func NewMessageBudget(limit int) *MessageBudget {
+	if limit <= 0 {
+		limit = DefaultMaxMessagesPerRun
+	}
+	return &MessageBudget{limit: limit, sent: make(map[string]int)}
+}
+
+func (b *MessageBudget) remaining(destination string) int {
+	return b.limit - b.sent[destination]
+}
+
+func (b *MessageBudget) spend(destination string) {
+	b.sent[destination]++
+}
+
+// limitDigest prepares the digest of a notifier for sending. The maxListed most
+// important changes are listed, critical changes and recoveries first; the
+// others are summarized. Digests too large for the notifier are split into
+// numbered parts, and parts beyond the remaining message budget are folded
+// into the summary of the last part that is sent. No digest is returned when
+// the budget is used up.
+func limitDigest(digest Digest, notifier Notifier, maxListed, remaining int) ([]Digest, error) {
+	if remaining <= 0 {
+		return nil, nil
+	}
+	if maxListed <= 0 {
+		maxListed = DefaultMaxListedChanges
+	}
+
+	changes := prioritizeChanges(digest.Changes)
+	if len(changes) > maxListed {
+		digest.Summarized = append(digest.Summarized, changes[maxListed:]...)
+		changes = changes[:maxListed]
+	}
+	digest.Changes = sortChanges(changes)
+
+	parts := []Digest{digest}
+	if sized, ok := notifier.(sizedNotifier); ok {
+		var err error
+		if parts, err = splitBySize(digest, sized); err != nil {
+			return nil, err
+		}
+	}
+
+	if len(parts) > remaining {
+		last := parts[remaining-1]
+		for _, part := range parts[remaining:] {
+			last.Summarized = append(last.Summarized, part.Changes...)
+			last.Summarized = append(last.Summarized, part.Summarized...)
+		}
+		parts = append(parts[:remaining-1], last)
+	}
+
+	if len(parts) > 1 {
+		for i := range parts {
+			parts[i].Part = i + 1
+			parts[i].Parts = len(parts)
+		}
+	}
+	return parts, nil
+}
+
+// splitBySize halves digest until every part fits the message size of
+// notifier. The summary stays with the last part. A single change that does
+// not fit is sent on its own.
+func splitBySize(digest Digest, notifier sizedNotifier) ([]Digest, error) {
+	// Measure with a part header, which every part of a split digest carries
+	measured := digest
+	measured.Part, measured.Parts = 1, 2
+	size, err := notifier.messageSize(measured)
+	if err != nil {
+		return nil, err
+	}
+	if size <= notifier.maxMessageSize() || len(digest.Changes) <= 1 {
+		return []Digest{digest}, nil
+	}
+
+	half := len(digest.Changes) / 2
+	first, second := digest, digest
+	first.Changes, first.Summarized = digest.Changes[:half], nil
+	second.Changes = digest.Changes[half:]
+
+	firstParts, err := splitBySize(first, notifier)
+	if err != nil {
+		return nil, err
+	}
+	secondParts, err := splitBySize(second, notifier)
+	if err != nil {
+		return nil, err
+	}
+	return append(firstParts, secondParts...), nil
+}
+
+// prioritizeChanges returns a copy of changes with the most severe first and,
+// within a severity, recoveries first.
+func prioritizeChanges(changes []SnapshotStatusChange) []SnapshotStatusChange {
+	sorted := sortChanges(changes)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		if severityRank[sorted[i].Severity] != severityRank[sorted[j].Severity] {
+			return severityRank[sorted[i].Severity] > severityRank[sorted[j].Severity]
+		}
+		return sorted[i].Recovery != nil && sorted[j].Recovery == nil
+	})
+	return sorted
+}
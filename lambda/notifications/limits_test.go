@@ -0,0 +1,164 @@
+package notifications
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"rds-backup-monitor/lambda/types"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sns"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// sizedMockNotifier measures a digest as 100 bytes per listed change.
+type sizedMockNotifier struct {
+	mockNotifier
+	maxSize int
+}
+
+func (m *sizedMockNotifier) messageSize(digest Digest) (int, error) {
+	return 100 * len(digest.Changes), nil
+}
+
+func (m *sizedMockNotifier) maxMessageSize() int {
+	return m.maxSize
+}
+
+func newChanges(count int, region, status string) []SnapshotStatusChange {
+	changes := make([]SnapshotStatusChange, count)
+	for i := range changes {
+		changes[i] = SnapshotStatusChange{
+			SnapshotID:    fmt.Sprintf("snap-%s-%03d", status, i),
+			DBInstance:    fmt.Sprintf("db-%03d", i),
+			CurrentStatus: status,
+			Region:        region,
+			Severity:      classifySeverity(status),
+		}
+	}
+	return changes
+}
+
+func TestChangeGroupString(t *testing.T) {
+	assert.Equal(t, "312 new available snapshots in us-east-1",
+		ChangeGroup{Region: "us-east-1", Status: "available", New: true, Count: 312}.String())
+	assert.Equal(t, "1 snapshot changed to failed in eu-west-1",
+		ChangeGroup{Region: "eu-west-1", Status: "failed", Count: 1}.String())
+}
+
+func TestSummarize(t *testing.T) {
+	changes := append(newChanges(3, "us-east-1", "available"), newChanges(2, "eu-west-1", "available")...)
+	changes[0].PreviousStatus = "creating"
+
+	assert.Equal(t, []ChangeGroup{
+		{Region: "eu-west-1", Status: "available", New: true, Count: 2},
+		{Region: "us-east-1", Status: "available", New: true, Count: 2},
+		{Region: "us-east-1", Status: "available", Count: 1},
+	}, summarize(changes))
+}
+
+func TestLimitDigest(t *testing.T) {
+	t.Run("lists the most important changes", func(t *testing.T) {
+		changes := append(newChanges(10, "us-east-1", "available"), newChanges(2, "us-east-1", "failed")...)
+		changes[3].Recovery = &Recovery{FailedSnapshotID: "snap-0"}
+
+		parts, err := limitDigest(Digest{Changes: changes}, &mockNotifier{destination: "email"}, 4, 5)
+		require.NoError(t, err)
+		require.Len(t, parts, 1)
+
+		var listed []string
+		for _, change := range parts[0].Changes {
+			listed = append(listed, change.SnapshotID)
+		}
+		assert.ElementsMatch(t, []string{"snap-failed-000", "snap-failed-001", "snap-available-003", "snap-available-000"}, listed)
+		assert.Len(t, parts[0].Summarized, 8)
+		assert.Zero(t, parts[0].Parts)
+	})
+
+	t.Run("splits into numbered parts", func(t *testing.T) {
+		notifier := &sizedMockNotifier{mockNotifier: mockNotifier{destination: "topic"}, maxSize: 1000}
+		parts, err := limitDigest(Digest{Changes: newChanges(30, "us-east-1", "available")}, notifier, 25, 5)
+		require.NoError(t, err)
+
+		require.Len(t, parts, 4)
+		listed := 0
+		for i, part := range parts {
+			assert.Equal(t, i+1, part.Part)
+			assert.Equal(t, 4, part.Parts)
+			assert.LessOrEqual(t, len(part.Changes)*100, 1000)
+			listed += len(part.Changes)
+		}
+		assert.Equal(t, 25, listed)
+		assert.Empty(t, parts[0].Summarized)
+		assert.Len(t, parts[3].Summarized, 5)
+	})
+
+	t.Run("folds parts beyond the message budget into the summary", func(t *testing.T) {
+		notifier := &sizedMockNotifier{mockNotifier: mockNotifier{destination: "topic"}, maxSize: 1000}
+		parts, err := limitDigest(Digest{Changes: newChanges(40, "us-east-1", "available")}, notifier, 40, 2)
+		require.NoError(t, err)
+
+		require.Len(t, parts, 2)
+		assert.Equal(t, 2, parts[1].Parts)
+		assert.Equal(t, 40, len(parts[0].Changes)+len(parts[1].Changes)+len(parts[1].Summarized))
+	})
+
+	t.Run("sends nothing without budget", func(t *testing.T) {
+		parts, err := limitDigest(Digest{Changes: newChanges(1, "us-east-1", "failed")}, &mockNotifier{}, 10, 0)
+		require.NoError(t, err)
+		assert.Empty(t, parts)
+	})
+}
+
+func TestSendDigest_Limits(t *testing.T) {
+	email := &mockNotifier{destination: "email"}
+	events := &mockNotifier{destination: "events"}
+	router := NewRouter([]Notifier{email}, nil)
+	router.AddSink(events)
+
+	limits := digestLimits{maxListed: 5, budget: NewMessageBudget(1)}
+	changes := newChanges(8, "us-east-1", "available")
+
+	deferred, err := sendDigest(context.Background(), router, Digest{Changes: changes}, limits, nil)
+	require.NoError(t, err)
+	assert.False(t, deferred)
+	deferred, err = sendDigest(context.Background(), router, Digest{Changes: changes, HeldBy: "nightly"}, limits, nil)
+	require.NoError(t, err)
+	assert.True(t, deferred, "the second digest is left for the next run")
+
+	require.Len(t, email.notified, 1, "the second digest exceeds the message budget")
+	assert.Len(t, email.notified[0].Changes, 5)
+	assert.Len(t, email.notified[0].Summarized, 3)
+
+	require.Len(t, events.notified, 2, "sinks are exempt from limits")
+	assert.Len(t, events.notified[0].Changes, 8)
+}
+
+func TestSNSNotifier_SplitsLargeDigests(t *testing.T) {
+	client := &mockSNSClient{publishOutput: &sns.PublishOutput{}}
+	notifier := NewSNSNotifier("arn:aws:sns:us-east-1:123456789012:alerts", client, DefaultTemplates(),
+		types.Configuration{MessageFormat: MessageFormatText})
+
+	changes := newChanges(400, "us-east-1", "available")
+	for i := range changes {
+		changes[i].DBInstance = strings.Repeat("d", 900) + changes[i].DBInstance
+	}
+
+	parts, err := limitDigest(Digest{Changes: changes}, notifier, 400, 10)
+	require.NoError(t, err)
+	require.Greater(t, len(parts), 1)
+
+	for _, part := range parts {
+		size, err := notifier.messageSize(part)
+		require.NoError(t, err)
+		assert.LessOrEqual(t, size, maxSNSMessageBytes)
+
+		input, err := buildPublishInput("topic", part, types.Configuration{}, DefaultTemplates(), time.Now())
+		require.NoError(t, err)
+		assert.Contains(t, aws.ToString(input.Subject), fmt.Sprintf("[%d/%d]", part.Part, part.Parts))
+	}
+}
@@ -0,0 +1,245 @@
+package notifications
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"rds-backup-monitor/lambda/types"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sns"
+	snsTypes "github.com/aws/aws-sdk-go-v2/service/sns/types"
+)
+
+// Notifier delivers digests of changes and rendered messages, such as reports
+// and reminders, to a single destination.
+type Notifier interface {
+	Destination() string
+	Notify(ctx context.Context, digest Digest) error
+	SendMessage(ctx context.Context, messageType string, message RenderedMessage) error
+}
+
+// SNSNotifier publishes digests to an SNS topic.
+type SNSNotifier struct {
+	topicArn  string
+	client    SNSClient
+	templates *TemplateSet
+	appConfig types.Configuration
+}
+
+func NewSNSNotifier(topicArn string, client SNSClient, templates *TemplateSet, appConfig types.Configuration) *SNSNotifier {
+	return &SNSNotifier{
+		topicArn:  topicArn,
+		client:    client,
+		templates: templates,
+		appConfig: appConfig,
+	}
+}
+
+func (n *SNSNotifier) Destination() string {
+	return n.topicArn
+}
+
+func (n *SNSNotifier) Notify(ctx context.Context, digest Digest) error {
+	input, err := buildPublishInput(n.topicArn, digest, n.appConfig, n.templates, time.Now())
+	if err != nil {
+		return err
+	}
+
+	_, err = n.client.Publish(ctx, input)
+	if err != nil {
+		return fmt.Errorf("unable to publish SNS message to %s: %v", n.topicArn, err)
+	}
+	return nil
+}
+
+// messageSize returns the size SNS counts against its limit: the message, the
+// subject and the names, types and values of the message attributes.
+func (n *SNSNotifier) messageSize(digest Digest) (int, error) {
+	input, err := buildPublishInput(n.topicArn, digest, n.appConfig, n.templates, time.Now())
+	if err != nil {
+		return 0, err
+	}
+
+	size := len(aws.ToString(input.Message)) + len(aws.ToString(input.Subject))
+	for name, attribute := range input.MessageAttributes {
+		size += len(name) + len(aws.ToString(attribute.DataType)) + len(aws.ToString(attribute.StringValue))
+	}
+	return size, nil
+}
+
+func (n *SNSNotifier) maxMessageSize() int {
+	return maxSNSMessageBytes
+}
+
+// SendMessage publishes the plain-text rendering of a message. SNS cannot
+// deliver HTML, so the HTML body is only used by notifiers that support it.
+func (n *SNSNotifier) SendMessage(ctx context.Context, messageType string, message RenderedMessage) error {
+	_, err := n.client.Publish(ctx, &sns.PublishInput{
+		TopicArn: aws.String(n.topicArn),
+		Subject:  aws.String(message.Subject),
+		Message:  aws.String(message.Text),
+		MessageAttributes: map[string]snsTypes.MessageAttributeValue{
+			"messageType": {
+				DataType:    aws.String("String"),
+				StringValue: aws.String(messageType),
+			},
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("unable to publish %s to %s: %v", messageType, n.topicArn, err)
+	}
+	return nil
+}
+
+// Delivery is the digest routed to a single notifier.
+type Delivery struct {
+	Notifier Notifier
+	Digest   Digest
+	// Sink is set for deliveries to sinks, which receive every change and are
+	// exempt from digest limits.
+	Sink bool
+}
+
+// key identifies the delivery in the outbox: its destination, and the owner
+// of the digest when owners share the destination.
+func (d Delivery) key() string {
+	if d.Digest.Owner == "" {
+		return d.Notifier.Destination()
+	}
+	return d.Notifier.Destination() + " for " + d.Digest.Owner
+}
+
+// Router selects the notifiers for each change based on its owner and severity.
+type Router struct {
+	defaultNotifiers []Notifier
+	routes           map[string][]Notifier
+	ownerRoutes      map[string][]Notifier
+	sinks            []Notifier
+}
+
+// NewRouter returns a router that sends changes to the notifiers registered for
+// their severity in routes, and to defaultNotifiers when there are none.
+func NewRouter(defaultNotifiers []Notifier, routes map[string][]Notifier) *Router {
+	return &Router{
+		defaultNotifiers: defaultNotifiers,
+		routes:           routes,
+	}
+}
+
+// NewSNSRouter builds a router from the SNS topics in appConfig. Topics shared
+// between severities use a single notifier so a change is published to each
+// topic at most once.
+func NewSNSRouter(appConfig types.Configuration, templates *TemplateSet, client SNSClient) *Router {
+	notifiers := make(map[string]Notifier)
+	notifierFor := func(topicArn string) Notifier {
+		if _, ok := notifiers[topicArn]; !ok {
+			notifiers[topicArn] = NewSNSNotifier(topicArn, client, templates, appConfig)
+		}
+		return notifiers[topicArn]
+	}
+
+	routes := make(map[string][]Notifier)
+	for severity, topicArns := range appConfig.SeverityRoutes {
+		for _, topicArn := range topicArns {
+			routes[severity] = append(routes[severity], notifierFor(topicArn))
+		}
+	}
+
+	return NewRouter([]Notifier{notifierFor(appConfig.SNSTopicArn)}, routes)
+}
+
+// SetOwnerRoutes sends the changes of owners in routes to the owner's notifiers
+// instead of the severity routes, in a digest per owner.
+func (r *Router) SetOwnerRoutes(routes map[string][]Notifier) {
+	r.ownerRoutes = routes
+}
+
+// AddSink sends every change to sink in addition to its routed notifiers.
+// Sinks feed other systems rather than people, so they receive neither
+// reports nor reminders.
+func (r *Router) AddSink(sink Notifier) {
+	r.sinks = append(r.sinks, sink)
+}
+
+// DefaultNotifiers returns the notifiers that receive changes without a route.
+func (r *Router) DefaultNotifiers() []Notifier {
+	return r.defaultNotifiers
+}
+
+// Route splits digest by notifier, ordered by destination. Changes routed by
+// owner are split by owner as well, so owners sharing a destination still
+// receive a digest each. Sinks receive every change in a single digest.
+//
+// Ignored changes are counted in the digests they would have been routed to,
+// which are sent for the count alone when no change is routed there. Sinks
+// receive events of changes, so they only count ignored changes along with
+// changes.
+func (r *Router) Route(digest Digest) []Delivery {
+	type deliveryKey struct {
+		destination string
+		owner       string
+	}
+	byKey := make(map[deliveryKey]*Delivery)
+	deliveryFor := func(notifier Notifier, owner string, sink bool) *Delivery {
+		key := deliveryKey{destination: notifier.Destination(), owner: owner}
+		delivery, ok := byKey[key]
+		if !ok {
+			delivery = &Delivery{Notifier: notifier, Digest: Digest{HeldBy: digest.HeldBy, Owner: owner, ID: digest.ID}, Sink: sink}
+			byKey[key] = delivery
+		}
+		return delivery
+	}
+
+	for _, change := range digest.Changes {
+		notifiers, owner := r.notifiersFor(change.Owner, change.Severity)
+		for _, notifier := range notifiers {
+			delivery := deliveryFor(notifier, owner, false)
+			delivery.Digest.Changes = append(delivery.Digest.Changes, change)
+		}
+		for _, sink := range r.sinks {
+			delivery := deliveryFor(sink, "", true)
+			delivery.Digest.Changes = append(delivery.Digest.Changes, change)
+		}
+	}
+
+	for _, ignored := range digest.IgnoredCounts {
+		notifiers, owner := r.notifiersFor(ignored.Owner, ignored.Severity)
+		for _, notifier := range notifiers {
+			deliveryFor(notifier, owner, false).Digest.Ignored += ignored.Count
+		}
+		for _, sink := range r.sinks {
+			if delivery, ok := byKey[deliveryKey{destination: sink.Destination()}]; ok {
+				delivery.Digest.Ignored += ignored.Count
+			}
+		}
+	}
+
+	deliveries := make([]Delivery, 0, len(byKey))
+	for _, delivery := range byKey {
+		deliveries = append(deliveries, *delivery)
+	}
+	sort.Slice(deliveries, func(i, j int) bool {
+		if deliveries[i].Notifier.Destination() != deliveries[j].Notifier.Destination() {
+			return deliveries[i].Notifier.Destination() < deliveries[j].Notifier.Destination()
+		}
+		return deliveries[i].Digest.Owner < deliveries[j].Digest.Owner
+	})
+
+	return deliveries
+}
+
+// notifiersFor returns the notifiers of the changes of owner with severity,
+// and the owner when they are routed by owner.
+func (r *Router) notifiersFor(owner, severity string) ([]Notifier, string) {
+	if notifiers := r.ownerRoutes[owner]; owner != "" && len(notifiers) > 0 {
+		return notifiers, owner
+	}
+	notifiers, ok := r.routes[severity]
+	if !ok || len(notifiers) == 0 {
+		notifiers = r.defaultNotifiers
+	}
+	return notifiers, ""
+}
@@ -0,0 +1,165 @@
+package notifications
+
+import (
+	"context"
+	"fmt"
+	"rds-backup-monitor/lambda/types"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sns"
+	"github.com/stretchr/testify/assert"
+)
+
+type mockNotifier struct {
+	destination string
+	notified    []Digest
+	messages    []RenderedMessage
+	types       []string
+	err         error
+}
+
+func (m *mockNotifier) Destination() string {
+	return m.destination
+}
+
+func (m *mockNotifier) Notify(ctx context.Context, digest Digest) error {
+	m.notified = append(m.notified, digest)
+	return m.err
+}
+
+func (m *mockNotifier) SendMessage(ctx context.Context, messageType string, message RenderedMessage) error {
+	m.messages = append(m.messages, message)
+	m.types = append(m.types, messageType)
+	return m.err
+}
+
+func TestRouterRoute(t *testing.T) {
+	email := &mockNotifier{destination: "email"}
+	pager := &mockNotifier{destination: "pager"}
+	chat := &mockNotifier{destination: "chat"}
+
+	router := NewRouter([]Notifier{email}, map[string][]Notifier{
+		SeverityCritical: {pager, email},
+		SeverityWarning:  {chat},
+	})
+
+	deliveries := router.Route(Digest{Changes: []SnapshotStatusChange{
+		{SnapshotID: "snap-1", Severity: SeverityCritical},
+		{SnapshotID: "snap-2", Severity: SeverityInfo},
+		{SnapshotID: "snap-3", Severity: SeverityWarning},
+	}})
+
+	got := make(map[string][]string)
+	var order []string
+	for _, delivery := range deliveries {
+		order = append(order, delivery.Notifier.Destination())
+		for _, change := range delivery.Digest.Changes {
+			got[delivery.Notifier.Destination()] = append(got[delivery.Notifier.Destination()], change.SnapshotID)
+		}
+	}
+
+	assert.Equal(t, []string{"chat", "email", "pager"}, order)
+	assert.Equal(t, map[string][]string{
+		"email": {"snap-1", "snap-2"},
+		"pager": {"snap-1"},
+		"chat":  {"snap-3"},
+	}, got)
+}
+
+func TestRouterRoute_OwnerRoutes(t *testing.T) {
+	email := &mockNotifier{destination: "email"}
+	pager := &mockNotifier{destination: "pager"}
+	shared := &mockNotifier{destination: "shared"}
+
+	router := NewRouter([]Notifier{email}, map[string][]Notifier{
+		SeverityCritical: {pager},
+	})
+	router.SetOwnerRoutes(map[string][]Notifier{
+		"payments": {shared},
+		"search":   {shared},
+	})
+	router.AddSink(&mockNotifier{destination: "events"})
+
+	deliveries := router.Route(Digest{HeldBy: "nightly", Changes: []SnapshotStatusChange{
+		{SnapshotID: "snap-1", Severity: SeverityCritical, Owner: "payments"},
+		{SnapshotID: "snap-2", Severity: SeverityInfo, Owner: "search"},
+		{SnapshotID: "snap-3", Severity: SeverityInfo, Owner: "unknown"},
+		{SnapshotID: "snap-4", Severity: SeverityCritical},
+	}})
+
+	type delivery struct {
+		destination string
+		owner       string
+		snapshots   []string
+	}
+	var got []delivery
+	for _, d := range deliveries {
+		assert.Equal(t, "nightly", d.Digest.HeldBy)
+		var snapshots []string
+		for _, change := range d.Digest.Changes {
+			snapshots = append(snapshots, change.SnapshotID)
+		}
+		got = append(got, delivery{d.Notifier.Destination(), d.Digest.Owner, snapshots})
+	}
+
+	assert.Equal(t, []delivery{
+		{"email", "", []string{"snap-3"}},
+		{"events", "", []string{"snap-1", "snap-2", "snap-3", "snap-4"}},
+		{"pager", "", []string{"snap-4"}},
+		{"shared", "payments", []string{"snap-1"}},
+		{"shared", "search", []string{"snap-2"}},
+	}, got)
+}
+
+func TestNewSNSRouter(t *testing.T) {
+	client := &mockSNSClient{publishOutput: &sns.PublishOutput{}}
+	appConfig := types.Configuration{
+		SNSTopicArn: "arn:aws:sns:us-west-2:123456789012:default",
+		SeverityRoutes: map[string][]string{
+			SeverityCritical: {"arn:aws:sns:us-west-2:123456789012:pager", "arn:aws:sns:us-west-2:123456789012:default"},
+		},
+	}
+
+	router := NewSNSRouter(appConfig, DefaultTemplates(), client)
+	deliveries := router.Route(Digest{Changes: []SnapshotStatusChange{
+		{SnapshotID: "snap-1", Severity: SeverityCritical, Region: "us-west-2"},
+		{SnapshotID: "snap-2", Severity: SeverityInfo, Region: "us-west-2"},
+	}})
+
+	assert.Len(t, deliveries, 2)
+	assert.Equal(t, "arn:aws:sns:us-west-2:123456789012:default", deliveries[0].Notifier.Destination())
+	assert.Len(t, deliveries[0].Digest.Changes, 2)
+	assert.Equal(t, "arn:aws:sns:us-west-2:123456789012:pager", deliveries[1].Notifier.Destination())
+	assert.Len(t, deliveries[1].Digest.Changes, 1)
+}
+
+func TestSNSNotifierNotify(t *testing.T) {
+	tests := []struct {
+		name    string
+		err     error
+		wantErr bool
+	}{
+		{name: "publishes to topic"},
+		{name: "handles SNS error", err: fmt.Errorf("SNS error"), wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := &mockSNSClient{publishOutput: &sns.PublishOutput{}, err: tt.err}
+			notifier := NewSNSNotifier("arn:aws:sns:us-west-2:123456789012:topic", client, DefaultTemplates(),
+				types.Configuration{MessageFormat: MessageFormatText})
+
+			err := notifier.Notify(context.Background(), Digest{Changes: []SnapshotStatusChange{
+				{SnapshotID: "snap-1", CurrentStatus: "failed", Region: "us-west-2", Severity: SeverityCritical},
+			}})
+			if tt.wantErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+			assert.Equal(t, 1, client.publishCount)
+			assert.Equal(t, "arn:aws:sns:us-west-2:123456789012:topic", aws.ToString(client.lastInput.TopicArn))
+		})
+	}
+}
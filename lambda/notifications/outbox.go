@@ -0,0 +1,167 @@
+package notifications
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"rds-backup-monitor/lambda/storage"
+	"rds-backup-monitor/lambda/types"
+)
+
+// outboxRecord is the payload of an outbox entry: the digest of a run and the
+// region results whose states are stored along with sending it. The record of
+// a catch-up digest has no results, but the held changes that are deleted
+// once it was sent.
+type outboxRecord struct {
+	Digest  Digest
+	Results []RegionResult
+	Held    []storage.HeldChange
+}
+
+// outboxEntry is a decoded outbox entry.
+type outboxEntry struct {
+	entry  *storage.OutboxEntry
+	record outboxRecord
+}
+
+func putOutboxRecord(ctx context.Context, states storage.StateStore, record outboxRecord, now time.Time) (outboxEntry, error) {
+	payload, err := json.Marshal(record)
+	if err != nil {
+		return outboxEntry{}, fmt.Errorf("unable to marshal outbox entry: %v", err)
+	}
+	entry, err := storage.NewOutboxEntry(payload, now)
+	if err != nil {
+		return outboxEntry{}, err
+	}
+	if err := states.PutOutboxEntry(ctx, entry); err != nil {
+		return outboxEntry{}, err
+	}
+
+	record.Digest.ID = entry.ID
+	return outboxEntry{entry: entry, record: record}, nil
+}
+
+// outboxDelivery records the deliveries of an outbox entry by their key, so
+// owners sharing a destination are recorded apart. A nil outboxDelivery
+// records nothing, for digests that are not in the outbox.
+type outboxDelivery struct {
+	states storage.StateStore
+	entry  *storage.OutboxEntry
+}
+
+func (d *outboxDelivery) delivered(key string) bool {
+	return d != nil && d.entry.IsDelivered(key)
+}
+
+func (d *outboxDelivery) markDelivered(ctx context.Context, key string) error {
+	if d == nil {
+		return nil
+	}
+	return d.states.MarkOutboxDelivered(ctx, d.entry, key)
+}
+
+// errOutboxStates marks the failure to store the states of an outbox entry.
+var errOutboxStates = errors.New("unable to store the snapshot states of outbox entry")
+
+// completeOutboxEntry stores the states of the results of an entry and sends
+// its digest to the destinations that did not receive it yet. The entry is
+// deleted once both succeeded, along with the held changes of a catch-up
+// digest; otherwise it is kept for the next run, as it is when a destination
+// reached its message limit. Storing the states again is harmless, since every
+// write puts or deletes the same rows.
+func completeOutboxEntry(ctx context.Context, router *Router, outbox outboxEntry,
+	appConfig types.Configuration, states storage.StateStore, limits digestLimits) error {
+
+	var errs []error
+	if err := persistRegionResults(ctx, states, outbox.record.Results, appConfig); err != nil {
+		errs = append(errs, fmt.Errorf("%w %s: %v", errOutboxStates, outbox.entry.ID, err))
+	}
+	delivery := &outboxDelivery{states: states, entry: outbox.entry}
+	deferred, err := sendDigest(ctx, router, outbox.record.Digest, limits, delivery)
+	if err != nil {
+		errs = append(errs, fmt.Errorf("unable to send digest %s: %v", outbox.entry.ID, err))
+	}
+	if len(errs) > 0 {
+		return errors.Join(errs...)
+	}
+	if deferred {
+		fmt.Printf("Keeping digest %s for the destinations over their message limit\n", outbox.entry.ID)
+		return nil
+	}
+	if err := states.DeleteHeldChanges(ctx, outbox.record.Held); err != nil {
+		return err
+	}
+	return states.DeleteOutboxEntry(ctx, outbox.entry)
+}
+
+// RelayOutbox completes the outbox entries left by runs that stopped part
+// way, oldest first. It runs before regions are scanned, so the states of the
+// entries are stored before changes are detected again; when it fails, the
+// run must not scan, since it would send the changes of the entries again. An
+// entry that cannot be sent is logged and retried by the next run.
+//
+// Only the entries whose regions are all in held, the regions the run holds
+// the locks of, are completed: an entry with a region locked by another run
+// may be that run's digest in flight. The regions of the entries left are
+// returned, and the run must not scan them either. The digests are sent
+// within budget, which the run shares with ProcessSnapshotChanges.
+func RelayOutbox(ctx context.Context, router *Router, budget *MessageBudget, appConfig types.Configuration,
+	states storage.StateStore, held []string) ([]string, error) {
+
+	entries, err := states.GetOutboxEntries(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	limits := digestLimits{maxListed: appConfig.MaxListedChanges, budget: budget}
+	var pending []string
+	for _, entry := range entries {
+		var record outboxRecord
+		if err := json.Unmarshal(entry.Payload, &record); err != nil {
+			return nil, fmt.Errorf("invalid outbox entry %s: %v", entry.ID, err)
+		}
+		if regions := record.regions(); !isSubset(regions, held) {
+			fmt.Printf("Leaving digest %s of %s to the run that holds the locks of %s\n",
+				entry.ID, entry.CreatedAt.Format(time.RFC3339), strings.Join(regions, ", "))
+			pending = append(pending, regions...)
+			continue
+		}
+		record.Digest.ID = entry.ID
+		fmt.Printf("Completing digest %s of %s, sent to %d destinations before\n",
+			entry.ID, entry.CreatedAt.Format(time.RFC3339), len(entry.Delivered))
+
+		err := completeOutboxEntry(ctx, router, outboxEntry{entry: entry, record: record}, appConfig, states, limits)
+		if errors.Is(err, errOutboxStates) {
+			return nil, err
+		}
+		if err != nil {
+			fmt.Printf("Error: %v, retrying on the next run\n", err)
+		}
+	}
+	slices.Sort(pending)
+	return slices.Compact(pending), nil
+}
+
+// regions returns the regions of the results of the record.
+func (r outboxRecord) regions() []string {
+	regions := make([]string, len(r.Results))
+	for i, result := range r.Results {
+		regions[i] = result.Region
+	}
+	return regions
+}
+
+// isSubset reports whether every element of subset is in set.
+func isSubset(subset, set []string) bool {
+	for _, element := range subset {
+		if !slices.Contains(set, element) {
+			return false
+		}
+	}
+	return true
+}
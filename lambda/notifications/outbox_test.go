@@ -0,0 +1,371 @@
+package notifications
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"rds-backup-monitor/lambda/storage"
+	"rds-backup-monitor/lambda/types"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sns"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// errCrash stops a run part way, as if the Lambda environment was terminated.
+var errCrash = errors.New("crash")
+
+// crashingStore keeps everything in memory and crashes the run at the
+// crashAt-th write, before applying it. With err set, storing snapshot states
+// fails.
+type crashingStore struct {
+	*storage.MemoryStore
+	writes  int
+	crashAt int
+	err     error
+}
+
+func newCrashingStore() *crashingStore {
+	return &crashingStore{MemoryStore: storage.NewMemoryStore()}
+}
+
+func (s *crashingStore) write() {
+	s.writes++
+	if s.writes == s.crashAt {
+		panic(errCrash)
+	}
+}
+
+func (s *crashingStore) BatchUpdateSnapshotStates(ctx context.Context, region string, snapshots []storage.SnapshotInfo, retention storage.Retention) error {
+	s.write()
+	if s.err != nil {
+		return s.err
+	}
+	return s.MemoryStore.BatchUpdateSnapshotStates(ctx, region, snapshots, retention)
+}
+
+func (s *crashingStore) AppendHistory(ctx context.Context, region string, transitions []storage.Transition, retentionDays int) error {
+	s.write()
+	return s.MemoryStore.AppendHistory(ctx, region, transitions, retentionDays)
+}
+
+func (s *crashingStore) PutOutboxEntry(ctx context.Context, entry *storage.OutboxEntry) error {
+	s.write()
+	return s.MemoryStore.PutOutboxEntry(ctx, entry)
+}
+
+func (s *crashingStore) MarkOutboxDelivered(ctx context.Context, entry *storage.OutboxEntry, key string) error {
+	s.write()
+	return s.MemoryStore.MarkOutboxDelivered(ctx, entry, key)
+}
+
+func (s *crashingStore) DeleteOutboxEntry(ctx context.Context, entry *storage.OutboxEntry) error {
+	s.write()
+	return s.MemoryStore.DeleteOutboxEntry(ctx, entry)
+}
+
+func (s *crashingStore) DeleteHeldChanges(ctx context.Context, changes []storage.HeldChange) error {
+	s.write()
+	return s.MemoryStore.DeleteHeldChanges(ctx, changes)
+}
+
+func (s *crashingStore) DeleteAcknowledgements(ctx context.Context, acks []storage.Acknowledgement) error {
+	s.write()
+	return s.MemoryStore.DeleteAcknowledgements(ctx, acks)
+}
+
+func (s *crashingStore) PutDatabaseHealth(ctx context.Context, records []storage.DatabaseHealth) error {
+	s.write()
+	return s.MemoryStore.PutDatabaseHealth(ctx, records)
+}
+
+func (s *crashingStore) DeleteDatabaseHealth(ctx context.Context, records []storage.DatabaseHealth) error {
+	s.write()
+	return s.MemoryStore.DeleteDatabaseHealth(ctx, records)
+}
+
+// recordingSNSClient records the digest ID of every message and the number of
+// store writes made before it was published.
+type recordingSNSClient struct {
+	store       *crashingStore
+	err         error
+	digestIDs   []string
+	writesAtPub []int
+}
+
+func (c *recordingSNSClient) Publish(ctx context.Context, params *sns.PublishInput, optFns ...func(*sns.Options)) (*sns.PublishOutput, error) {
+	if c.err != nil {
+		return nil, c.err
+	}
+	c.digestIDs = append(c.digestIDs, aws.ToString(params.MessageAttributes["digestId"].StringValue))
+	c.writesAtPub = append(c.writesAtPub, c.store.writes)
+	return &sns.PublishOutput{}, nil
+}
+
+// runUntilCrash calls run and reports whether it crashed.
+func runUntilCrash(run func()) (crashed bool) {
+	defer func() {
+		if r := recover(); r != nil {
+			if r != errCrash {
+				panic(r)
+			}
+			crashed = true
+		}
+	}()
+	run()
+	return false
+}
+
+// outboxTestTime is when the changes were detected; their transitions must not
+// have expired
+var outboxTestTime = time.Now().UTC().Truncate(time.Second)
+
+func outboxTestResults() []RegionResult {
+	results := []RegionResult{
+		{
+			Region:            "us-west-2",
+			Changes:           []SnapshotStatusChange{{SnapshotID: "snap-1", CurrentStatus: "failed", Region: "us-west-2"}},
+			SnapshotsToUpdate: []storage.SnapshotInfo{{SnapshotID: "snap-1", Status: "failed"}},
+		},
+		{
+			Region:            "eu-west-1",
+			Changes:           []SnapshotStatusChange{{SnapshotID: "snap-2", CurrentStatus: "failed", Region: "eu-west-1"}},
+			SnapshotsToUpdate: []storage.SnapshotInfo{{SnapshotID: "snap-2", Status: "failed"}},
+		},
+	}
+	for i := range results {
+		results[i] = RecordTransitions(results[i], nil, outboxTestTime, "run-1")
+	}
+	return results
+}
+
+// outboxTestRegions are the regions of outboxTestResults.
+var outboxTestRegions = []string{"us-west-2", "eu-west-1"}
+
+func TestProcessSnapshotChanges_RecoversFromCrashAtEveryWrite(t *testing.T) {
+	ctx := context.Background()
+	appConfig := types.Configuration{
+		StatusesToMonitor: []string{"failed"},
+		SnapshotAgeDays:   7,
+		SNSTopicArn:       "arn:aws:sns:us-west-2:123456789012:topic",
+	}
+
+	// Count the writes of a run that does not crash
+	store := newCrashingStore()
+	snsClient := &recordingSNSClient{store: store}
+	require.NoError(t, ProcessSnapshotChanges(ctx, outboxTestResults(), appConfig,
+		NewSNSRouter(appConfig, DefaultTemplates(), snsClient), NewMessageBudget(0), nil, store))
+	totalWrites := store.writes
+
+	for crashAt := 1; crashAt <= totalWrites; crashAt++ {
+		t.Run(fmt.Sprintf("crash at write %d", crashAt), func(t *testing.T) {
+			states := newCrashingStore()
+			states.crashAt = crashAt
+			snsClient := &recordingSNSClient{store: states}
+
+			crashed := runUntilCrash(func() {
+				_ = ProcessSnapshotChanges(ctx, outboxTestResults(), appConfig,
+					NewSNSRouter(appConfig, DefaultTemplates(), snsClient), NewMessageBudget(0), nil, states)
+			})
+			require.True(t, crashed)
+
+			// The next run completes the outbox, then scans: changes whose
+			// states were not stored are detected and sent again
+			states.crashAt = 0
+			router := NewSNSRouter(appConfig, DefaultTemplates(), snsClient)
+			pending, err := RelayOutbox(ctx, router, NewMessageBudget(appConfig.MaxMessagesPerRun), appConfig, states, outboxTestRegions)
+			require.NoError(t, err)
+			require.Empty(t, pending)
+
+			var rescanned []RegionResult
+			for _, result := range outboxTestResults() {
+				snapshotStates, err := states.GetProcessedSnapshots(ctx, result.Region)
+				require.NoError(t, err)
+				processed := storage.Statuses(snapshotStates)
+				redetected := DetectSnapshotChanges(result.SnapshotsToUpdate, processed, appConfig, result.Region)
+				redetected = RecordTransitions(redetected, processed, time.Now(), "run-2")
+				if len(redetected.Changes) > 0 {
+					rescanned = append(rescanned, redetected)
+				}
+			}
+			require.NoError(t, ProcessSnapshotChanges(ctx, rescanned, appConfig, router, NewMessageBudget(0), nil, states))
+
+			// Every state is stored now, and every transition once: either
+			// by the first run or, when it stopped before recording the
+			// digest, by the rescan
+			for _, result := range outboxTestResults() {
+				processed, err := states.GetProcessedSnapshots(ctx, result.Region)
+				require.NoError(t, err)
+				assert.Equal(t, "failed", processed[result.SnapshotsToUpdate[0].SnapshotID].Status)
+
+				timeline, err := states.GetSnapshotTimeline(ctx, result.Region, result.SnapshotsToUpdate[0].Key())
+				require.NoError(t, err)
+				require.Len(t, timeline, 1)
+				assert.Equal(t, "failed", timeline[0].To)
+			}
+
+			// Nothing was lost, and the outbox is empty
+			require.NotEmpty(t, snsClient.digestIDs, "digest lost")
+			entries, err := states.GetOutboxEntries(ctx)
+			require.NoError(t, err)
+			assert.Empty(t, entries)
+
+			// A digest is only sent twice when the run stopped right after
+			// publishing, before recording it; both copies carry the same ID
+			// for subscribers to drop the repeat
+			if len(snsClient.digestIDs) > 1 {
+				require.Len(t, snsClient.digestIDs, 2)
+				assert.Equal(t, snsClient.writesAtPub[0]+1, crashAt)
+				assert.Equal(t, snsClient.digestIDs[0], snsClient.digestIDs[1])
+			}
+			assert.NotEmpty(t, snsClient.digestIDs[0])
+		})
+	}
+}
+
+func TestRelayOutbox(t *testing.T) {
+	ctx := context.Background()
+	appConfig := types.Configuration{
+		StatusesToMonitor: []string{"failed"},
+		SnapshotAgeDays:   7,
+		SNSTopicArn:       "arn:aws:sns:us-west-2:123456789012:topic",
+	}
+
+	t.Run("keeps entries that cannot be sent", func(t *testing.T) {
+		states := newCrashingStore()
+		snsClient := &recordingSNSClient{store: states, err: fmt.Errorf("SNS error")}
+		router := NewSNSRouter(appConfig, DefaultTemplates(), snsClient)
+
+		assert.Error(t, ProcessSnapshotChanges(ctx, outboxTestResults(), appConfig, router, NewMessageBudget(0), nil, states))
+		_, err := RelayOutbox(ctx, router, NewMessageBudget(appConfig.MaxMessagesPerRun), appConfig, states, outboxTestRegions)
+		assert.NoError(t, err)
+
+		entries, err := states.GetOutboxEntries(ctx)
+		require.NoError(t, err)
+		require.Len(t, entries, 1)
+		assert.Empty(t, entries[0].Delivered)
+
+		// Once SNS recovers the digest is sent and the entry removed
+		snsClient.err = nil
+		_, err = RelayOutbox(ctx, router, NewMessageBudget(appConfig.MaxMessagesPerRun), appConfig, states, outboxTestRegions)
+		require.NoError(t, err)
+		assert.Len(t, snsClient.digestIDs, 1)
+		assert.Equal(t, entries[0].ID, snsClient.digestIDs[0])
+
+		entries, err = states.GetOutboxEntries(ctx)
+		require.NoError(t, err)
+		assert.Empty(t, entries)
+	})
+
+	t.Run("stops the run when states cannot be stored", func(t *testing.T) {
+		states := newCrashingStore()
+		snsClient := &recordingSNSClient{store: states, err: fmt.Errorf("SNS error")}
+		router := NewSNSRouter(appConfig, DefaultTemplates(), snsClient)
+		assert.Error(t, ProcessSnapshotChanges(ctx, outboxTestResults(), appConfig, router, NewMessageBudget(0), nil, states))
+
+		states.err = fmt.Errorf("state store error")
+		snsClient.err = nil
+		_, err := RelayOutbox(ctx, router, NewMessageBudget(appConfig.MaxMessagesPerRun), appConfig, states, outboxTestRegions)
+		assert.ErrorIs(t, err, errOutboxStates)
+	})
+
+	t.Run("leaves entries of regions locked by another run", func(t *testing.T) {
+		states := newCrashingStore()
+		snsClient := &recordingSNSClient{store: states, err: fmt.Errorf("SNS error")}
+		router := NewSNSRouter(appConfig, DefaultTemplates(), snsClient)
+		assert.Error(t, ProcessSnapshotChanges(ctx, outboxTestResults(), appConfig, router, NewMessageBudget(0), nil, states))
+
+		snsClient.err = nil
+		pending, err := RelayOutbox(ctx, router, NewMessageBudget(appConfig.MaxMessagesPerRun), appConfig, states, []string{"us-west-2"})
+		require.NoError(t, err)
+		assert.Equal(t, []string{"eu-west-1", "us-west-2"}, pending)
+		assert.Empty(t, snsClient.digestIDs)
+
+		entries, err := states.GetOutboxEntries(ctx)
+		require.NoError(t, err)
+		assert.Len(t, entries, 1)
+	})
+
+	t.Run("records owners sharing a destination apart", func(t *testing.T) {
+		states := newCrashingStore()
+		shared := &mockNotifier{destination: "shared", err: fmt.Errorf("notifier error")}
+		router := NewRouter([]Notifier{&mockNotifier{destination: "default"}}, nil)
+		router.SetOwnerRoutes(map[string][]Notifier{"team-a": {shared}, "team-b": {shared}})
+
+		results := outboxTestResults()
+		results[0].Changes[0].Owner = "team-a"
+		results[1].Changes[0].Owner = "team-b"
+		assert.Error(t, ProcessSnapshotChanges(ctx, results, appConfig, router, NewMessageBudget(0), nil, states))
+
+		// Both owners are sent their digest once the destination recovers
+		shared.err = nil
+		shared.notified = nil
+		_, err := RelayOutbox(ctx, router, NewMessageBudget(appConfig.MaxMessagesPerRun), appConfig, states, outboxTestRegions)
+		require.NoError(t, err)
+		require.Len(t, shared.notified, 2)
+		assert.Equal(t, "team-a", shared.notified[0].Owner)
+		assert.Equal(t, "team-b", shared.notified[1].Owner)
+
+		entries, err := states.GetOutboxEntries(ctx)
+		require.NoError(t, err)
+		assert.Empty(t, entries)
+	})
+
+	t.Run("keeps changes over the message limit for the next run", func(t *testing.T) {
+		states := newCrashingStore()
+		shared := &mockNotifier{destination: "shared"}
+		router := NewRouter([]Notifier{&mockNotifier{destination: "default"}}, nil)
+		router.SetOwnerRoutes(map[string][]Notifier{"team-a": {shared}, "team-b": {shared}})
+
+		results := outboxTestResults()
+		results[0].Changes[0].Owner = "team-a"
+		results[1].Changes[0].Owner = "team-b"
+		require.NoError(t, ProcessSnapshotChanges(ctx, results, appConfig, router, NewMessageBudget(1), nil, states))
+		require.Len(t, shared.notified, 1)
+		assert.Equal(t, "team-a", shared.notified[0].Owner)
+
+		entries, err := states.GetOutboxEntries(ctx)
+		require.NoError(t, err)
+		require.Len(t, entries, 1)
+		assert.Len(t, entries[0].Delivered, 1)
+
+		// The next run sends the deferred digest and removes the entry
+		_, err = RelayOutbox(ctx, router, NewMessageBudget(1), appConfig, states, outboxTestRegions)
+		require.NoError(t, err)
+		require.Len(t, shared.notified, 2)
+		assert.Equal(t, "team-b", shared.notified[1].Owner)
+
+		entries, err = states.GetOutboxEntries(ctx)
+		require.NoError(t, err)
+		assert.Empty(t, entries)
+	})
+
+	t.Run("shares the message budget of the run", func(t *testing.T) {
+		states := newCrashingStore()
+		topic := &mockNotifier{destination: "topic", err: fmt.Errorf("notifier error")}
+		router := NewRouter([]Notifier{topic}, nil)
+		assert.Error(t, ProcessSnapshotChanges(ctx, outboxTestResults(), appConfig, router, NewMessageBudget(1), nil, states))
+
+		// The relayed digest uses up the budget of the run, so the new one
+		// waits for the next run
+		topic.err = nil
+		topic.notified = nil
+		budget := NewMessageBudget(1)
+		_, err := RelayOutbox(ctx, router, budget, appConfig, states, outboxTestRegions)
+		require.NoError(t, err)
+		require.NoError(t, ProcessSnapshotChanges(ctx, outboxTestResults(), appConfig, router, budget, nil, states))
+		assert.Len(t, topic.notified, 1)
+
+		entries, err := states.GetOutboxEntries(ctx)
+		require.NoError(t, err)
+		assert.Len(t, entries, 1)
+
+		_, err = RelayOutbox(ctx, router, NewMessageBudget(1), appConfig, states, outboxTestRegions)
+		require.NoError(t, err)
+		assert.Len(t, topic.notified, 2)
+	})
+}
@@ -0,0 +1,95 @@
+package notifications
+
+import (
+	"fmt"
+	"strings"
+
+	"rds-backup-monitor/lambda/backups"
+	"rds-backup-monitor/lambda/types"
+)
+
+// DefaultOwnerTagKeys are the tags read when the routing table names none.
+var DefaultOwnerTagKeys = []string{"owner", "team"}
+
+// ValidateOwnerRouting checks that every owner has exactly one destination the
+// function can deliver to.
+func ValidateOwnerRouting(routing types.OwnerRouting) error {
+	for owner, destination := range routing.Owners {
+		if owner == "" {
+			return fmt.Errorf("owner routing: empty owner name")
+		}
+		switch {
+		case destination.TopicArn != "" && destination.SlackWebhookURL != "":
+			return fmt.Errorf("owner %s: only one of topicArn and slackWebhookUrl may be set", owner)
+		case destination.TopicArn == "" && destination.SlackWebhookURL == "" && destination.Email != "":
+			return fmt.Errorf("owner %s: email destinations need the topic created by the stack", owner)
+		case destination.TopicArn == "" && destination.SlackWebhookURL == "":
+			return fmt.Errorf("owner %s: no destination", owner)
+		case destination.SlackWebhookURL != "" && !strings.HasPrefix(destination.SlackWebhookURL, "https://"):
+			return fmt.Errorf("owner %s: slackWebhookUrl must be an https URL", owner)
+		}
+	}
+	return nil
+}
+
+// NewOwnerRoutes creates the notifiers of every owner in routing. Owners that
+// share a destination share its notifier.
+func NewOwnerRoutes(routing types.OwnerRouting, appConfig types.Configuration, templates *TemplateSet,
+	snsClient SNSClient, httpClient HTTPClient) map[string][]Notifier {
+
+	notifiers := make(map[string]Notifier)
+	routes := make(map[string][]Notifier)
+	for owner, destination := range routing.Owners {
+		key := destination.TopicArn
+		if key == "" {
+			key = destination.SlackWebhookURL
+		}
+		if _, ok := notifiers[key]; !ok {
+			if destination.TopicArn != "" {
+				notifiers[key] = NewSNSNotifier(destination.TopicArn, snsClient, templates, appConfig)
+			} else {
+				notifiers[key] = NewSlackNotifier(destination.SlackWebhookURL, httpClient, templates, appConfig)
+			}
+		}
+		routes[owner] = []Notifier{notifiers[key]}
+	}
+	return routes
+}
+
+// AssignOwners sets the owner of every change in result from the tags of its
+// source database. Snapshot tags are used when the database no longer exists,
+// since snapshots usually inherit the tags of their source.
+func AssignOwners(result RegionResult, databases []backups.Database, tagKeys []string) RegionResult {
+	if len(tagKeys) == 0 {
+		tagKeys = DefaultOwnerTagKeys
+	}
+
+	databaseTags := make(map[string]map[string]string, len(databases))
+	for _, database := range databases {
+		databaseTags[database.Type+"/"+database.Identifier] = database.Tags
+	}
+
+	changes := make([]SnapshotStatusChange, len(result.Changes))
+	for i, change := range result.Changes {
+		tags, ok := databaseTags[change.SnapshotType+"/"+change.DBInstance]
+		if !ok {
+			tags = change.Tags
+		}
+		change.Owner = ownerFromTags(tags, tagKeys)
+		changes[i] = change
+	}
+	result.Changes = changes
+	return result
+}
+
+// ownerFromTags returns the value of the first of keys found in tags.
+func ownerFromTags(tags map[string]string, keys []string) string {
+	for _, key := range keys {
+		for tagKey, value := range tags {
+			if strings.EqualFold(tagKey, key) && value != "" {
+				return value
+			}
+		}
+	}
+	return ""
+}
@@ -0,0 +1,109 @@
+package notifications
+
+import (
+	"net/http"
+	"testing"
+
+	"rds-backup-monitor/lambda/backups"
+	"rds-backup-monitor/lambda/types"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidateOwnerRouting(t *testing.T) {
+	tests := []struct {
+		name    string
+		owners  map[string]types.OwnerDestination
+		wantErr string
+	}{
+		{
+			name: "valid destinations",
+			owners: map[string]types.OwnerDestination{
+				"payments": {TopicArn: "arn:aws:sns:us-east-1:123456789012:payments"},
+				"search":   {SlackWebhookURL: "https://hooks.slack.com/services/T0/B0/x"},
+				"data":     {Email: "data@example.com", TopicArn: "arn:aws:sns:us-east-1:123456789012:data"},
+			},
+		},
+		{
+			name:    "no destination",
+			owners:  map[string]types.OwnerDestination{"payments": {}},
+			wantErr: "owner payments: no destination",
+		},
+		{
+			name:    "email without topic",
+			owners:  map[string]types.OwnerDestination{"payments": {Email: "payments@example.com"}},
+			wantErr: "owner payments: email destinations need the topic created by the stack",
+		},
+		{
+			name: "two destinations",
+			owners: map[string]types.OwnerDestination{"payments": {
+				TopicArn:        "arn:aws:sns:us-east-1:123456789012:payments",
+				SlackWebhookURL: "https://hooks.slack.com/services/T0/B0/x",
+			}},
+			wantErr: "owner payments: only one of topicArn and slackWebhookUrl may be set",
+		},
+		{
+			name:    "plain http webhook",
+			owners:  map[string]types.OwnerDestination{"payments": {SlackWebhookURL: "http://hooks.slack.com/x"}},
+			wantErr: "owner payments: slackWebhookUrl must be an https URL",
+		},
+		{
+			name:    "empty owner",
+			owners:  map[string]types.OwnerDestination{"": {TopicArn: "arn:aws:sns:us-east-1:123456789012:x"}},
+			wantErr: "owner routing: empty owner name",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateOwnerRouting(types.OwnerRouting{Owners: tt.owners})
+			if tt.wantErr == "" {
+				assert.NoError(t, err)
+			} else {
+				assert.EqualError(t, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestNewOwnerRoutes(t *testing.T) {
+	routing := types.OwnerRouting{Owners: map[string]types.OwnerDestination{
+		"payments": {TopicArn: "arn:aws:sns:us-east-1:123456789012:shared"},
+		"billing":  {TopicArn: "arn:aws:sns:us-east-1:123456789012:shared"},
+		"search":   {SlackWebhookURL: "https://hooks.slack.com/services/T0/B0/x"},
+	}}
+
+	routes := NewOwnerRoutes(routing, types.Configuration{}, DefaultTemplates(), &mockSNSClient{}, http.DefaultClient)
+
+	assert.Len(t, routes, 3)
+	assert.Same(t, routes["payments"][0], routes["billing"][0])
+	assert.Equal(t, "arn:aws:sns:us-east-1:123456789012:shared", routes["payments"][0].Destination())
+	assert.IsType(t, &SlackNotifier{}, routes["search"][0])
+}
+
+func TestAssignOwners(t *testing.T) {
+	databases := []backups.Database{
+		{Identifier: "orders", Type: "instance", Tags: map[string]string{"Owner": "payments"}},
+		{Identifier: "catalog", Type: "cluster", Tags: map[string]string{"team": "search", "owner": ""}},
+		{Identifier: "orders", Type: "cluster", Tags: map[string]string{"owner": "analytics"}},
+	}
+	result := RegionResult{Region: "us-east-1", Changes: []SnapshotStatusChange{
+		{SnapshotID: "snap-1", SnapshotType: "instance", DBInstance: "orders"},
+		{SnapshotID: "snap-2", SnapshotType: "cluster", DBInstance: "catalog"},
+		{SnapshotID: "snap-3", SnapshotType: "instance", DBInstance: "deleted", Tags: map[string]string{"team": "legacy"}},
+		{SnapshotID: "snap-4", SnapshotType: "instance", DBInstance: "untagged"},
+	}}
+
+	got := AssignOwners(result, databases, nil)
+
+	var owners []string
+	for _, change := range got.Changes {
+		owners = append(owners, change.Owner)
+	}
+	assert.Equal(t, []string{"payments", "search", "legacy", ""}, owners)
+	assert.Empty(t, result.Changes[0].Owner, "input result must not be modified")
+
+	got = AssignOwners(result, databases, []string{"team"})
+	assert.Equal(t, "", got.Changes[0].Owner)
+	assert.Equal(t, "search", got.Changes[1].Owner)
+}
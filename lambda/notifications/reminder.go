@@ -0,0 +1,88 @@
+package notifications
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"rds-backup-monitor/lambda/escalation"
+)
+
+// ReminderData is the value passed to the reminder templates.
+type ReminderData struct {
+	Account     string
+	GeneratedAt time.Time
+	Reminders   []escalation.Reminder
+	// Escalated is set for the message sent to the escalation notifiers, which
+	// only contains the escalated reminders.
+	Escalated bool
+}
+
+// SendReminders sends every reminder to the default notifiers of router, and
+// the escalated reminders to escalationNotifiers as well.
+func SendReminders(ctx context.Context, reminders []escalation.Reminder, account string,
+	templates *TemplateSet, router *Router, escalationNotifiers []Notifier) error {
+
+	if len(reminders) == 0 {
+		return nil
+	}
+
+	now := time.Now()
+	rendered, err := templates.Render(ChannelReminder, ReminderData{
+		Account:     account,
+		GeneratedAt: now,
+		Reminders:   reminders,
+	})
+	if err != nil {
+		return err
+	}
+
+	sent := make(map[string]bool)
+	for _, notifier := range router.DefaultNotifiers() {
+		fmt.Printf("Sending %d reminders to %s\n", len(reminders), notifier.Destination())
+		if err := notifier.SendMessage(ctx, messageTypeReminder, rendered); err != nil {
+			return err
+		}
+		sent[notifier.Destination()] = true
+	}
+
+	var escalated []escalation.Reminder
+	for _, reminder := range reminders {
+		if reminder.Escalated {
+			escalated = append(escalated, reminder)
+		}
+	}
+	if len(escalated) == 0 {
+		return nil
+	}
+
+	rendered, err = templates.Render(ChannelReminder, ReminderData{
+		Account:     account,
+		GeneratedAt: now,
+		Reminders:   escalated,
+		Escalated:   true,
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, notifier := range escalationNotifiers {
+		if sent[notifier.Destination()] {
+			continue
+		}
+		fmt.Printf("Escalating %d reminders to %s\n", len(escalated), notifier.Destination())
+		if err := notifier.SendMessage(ctx, messageTypeReminder, rendered); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func sampleReminderData() ReminderData {
+	return ReminderData{
+		Account:     "123456789012",
+		GeneratedAt: time.Now(),
+		Reminders:   escalation.SampleReminders(),
+		Escalated:   true,
+	}
+}
@@ -0,0 +1,70 @@
+package notifications
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"rds-backup-monitor/lambda/escalation"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSendReminders(t *testing.T) {
+	since := time.Date(2024, 11, 20, 0, 0, 0, 0, time.UTC)
+	reminders := []escalation.Reminder{
+		{
+			Problem: escalation.Problem{Region: "us-east-1", DatabaseType: "instance", DatabaseID: "db-1",
+				Kind: escalation.ProblemFailed, SnapshotID: "snap-1", SnapshotStatus: "failed"},
+			Since:     since,
+			Count:     3,
+			Escalated: true,
+		},
+		{
+			Problem: escalation.Problem{Region: "us-east-1", DatabaseType: "cluster", DatabaseID: "aurora-1",
+				Kind: escalation.ProblemMissing},
+			Since: since,
+		},
+	}
+
+	t.Run("sends all reminders to defaults and escalated ones to escalation notifiers", func(t *testing.T) {
+		email := &mockNotifier{destination: "email"}
+		oncall := &mockNotifier{destination: "oncall"}
+		router := NewRouter([]Notifier{email}, nil)
+
+		err := SendReminders(context.Background(), reminders, "123456789012", DefaultTemplates(), router, []Notifier{oncall})
+		assert.NoError(t, err)
+
+		assert.Len(t, email.messages, 1)
+		assert.Equal(t, []string{"reminder"}, email.types)
+		assert.Equal(t, "RDS Backup reminder: 2 unhealthy databases", email.messages[0].Subject)
+		assert.Contains(t, email.messages[0].Text, "us-east-1 instance db-1: latest snapshot snap-1 is failed")
+		assert.Contains(t, email.messages[0].Text, "Unhealthy since 2024-11-20T00:00:00Z, reminder 3")
+		assert.Contains(t, email.messages[0].Text, "us-east-1 cluster aurora-1: no available snapshot since monitoring began")
+		assert.Contains(t, email.messages[0].Text, "first alert")
+
+		assert.Len(t, oncall.messages, 1)
+		assert.Equal(t, "ESCALATION: RDS Backup reminder: 1 unhealthy databases", oncall.messages[0].Subject)
+		assert.NotContains(t, oncall.messages[0].Text, "aurora-1")
+	})
+
+	t.Run("does not escalate without escalated reminders", func(t *testing.T) {
+		email := &mockNotifier{destination: "email"}
+		oncall := &mockNotifier{destination: "oncall"}
+		router := NewRouter([]Notifier{email}, nil)
+
+		err := SendReminders(context.Background(), reminders[1:], "123456789012", DefaultTemplates(), router, []Notifier{oncall})
+		assert.NoError(t, err)
+		assert.Len(t, email.messages, 1)
+		assert.Empty(t, oncall.messages)
+	})
+
+	t.Run("handles notifier error", func(t *testing.T) {
+		email := &mockNotifier{destination: "email", err: fmt.Errorf("notifier error")}
+		router := NewRouter([]Notifier{email}, nil)
+
+		err := SendReminders(context.Background(), reminders, "123456789012", DefaultTemplates(), router, nil)
+		assert.Error(t, err)
+	})
+}
@@ -0,0 +1,25 @@
+package notifications
+
+import (
+	"context"
+	"fmt"
+
+	"rds-backup-monitor/lambda/reports"
+)
+
+// SendReport renders report with the report templates and sends it to every
+// default notifier.
+func SendReport(ctx context.Context, report reports.Report, templates *TemplateSet, router *Router) error {
+	rendered, err := templates.Render(ChannelReport, report)
+	if err != nil {
+		return err
+	}
+
+	for _, notifier := range router.DefaultNotifiers() {
+		fmt.Printf("Sending %s report to %s\n", report.Period, notifier.Destination())
+		if err := notifier.SendMessage(ctx, messageTypeReport, rendered); err != nil {
+			return err
+		}
+	}
+	return nil
+}
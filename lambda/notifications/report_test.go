@@ -0,0 +1,60 @@
+package notifications
+
+import (
+	"context"
+	"fmt"
+	"rds-backup-monitor/lambda/reports"
+	"rds-backup-monitor/lambda/types"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sns"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSendReport(t *testing.T) {
+	tests := []struct {
+		name    string
+		err     error
+		wantErr bool
+	}{
+		{name: "sends report to default notifiers"},
+		{name: "handles notifier error", err: fmt.Errorf("notifier error"), wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			email := &mockNotifier{destination: "email", err: tt.err}
+			pager := &mockNotifier{destination: "pager"}
+			router := NewRouter([]Notifier{email}, map[string][]Notifier{SeverityCritical: {pager}})
+
+			err := SendReport(context.Background(), reports.SampleReport(), DefaultTemplates(), router)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Len(t, email.messages, 1)
+			assert.Equal(t, []string{"report"}, email.types)
+			assert.Empty(t, pager.messages)
+
+			report := email.messages[0]
+			assert.Equal(t, "RDS Backup daily report: 1 failures, 1 coverage gaps", report.Subject)
+			assert.Contains(t, report.Text, "Snapshots taken: 1")
+			assert.Contains(t, report.Text, "Snapshots taken: 1 (-2)")
+			assert.Contains(t, report.Text, "us-east-1 instance sample-unprotected-db: last successful never (automated backups disabled)")
+			assert.Contains(t, report.HTML, "<h2>Coverage gaps</h2>")
+		})
+	}
+}
+
+func TestSNSNotifierSendMessage(t *testing.T) {
+	client := &mockSNSClient{publishOutput: &sns.PublishOutput{}}
+	notifier := NewSNSNotifier("arn:aws:sns:us-west-2:123456789012:topic", client, DefaultTemplates(), types.Configuration{})
+
+	err := notifier.SendMessage(context.Background(), messageTypeReport, RenderedMessage{Subject: "Report", Text: "body", HTML: "<p>body</p>"})
+	assert.NoError(t, err)
+	assert.Equal(t, "Report", aws.ToString(client.lastInput.Subject))
+	assert.Equal(t, "body", aws.ToString(client.lastInput.Message))
+	assert.Equal(t, "report", aws.ToString(client.lastInput.MessageAttributes["messageType"].StringValue))
+}
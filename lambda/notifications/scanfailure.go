@@ -0,0 +1,68 @@
+package notifications
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"rds-backup-monitor/lambda/storage"
+)
+
+// ScanFailureData is the value passed to the scan-failure templates.
+type ScanFailureData struct {
+	Account     string
+	GeneratedAt time.Time
+	// Failures are the stages that started failing in this run.
+	Failures []storage.ScanFailure
+	// Resolved are the stages that completed again after failing.
+	Resolved []storage.ScanFailure
+}
+
+// SendScanFailures tells the default notifiers of router about regions that
+// could not be monitored and about regions that are monitored again.
+func SendScanFailures(ctx context.Context, failures, resolved []storage.ScanFailure, account string,
+	templates *TemplateSet, router *Router) error {
+
+	if len(failures) == 0 && len(resolved) == 0 {
+		return nil
+	}
+
+	rendered, err := templates.Render(ChannelScanFailure, ScanFailureData{
+		Account:     account,
+		GeneratedAt: time.Now(),
+		Failures:    failures,
+		Resolved:    resolved,
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, notifier := range router.DefaultNotifiers() {
+		fmt.Printf("Sending %d scan failures and %d resolved failures to %s\n",
+			len(failures), len(resolved), notifier.Destination())
+		if err := notifier.SendMessage(ctx, messageTypeScanFailure, rendered); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func sampleScanFailureData() ScanFailureData {
+	now := time.Now()
+	return ScanFailureData{
+		Account:     "123456789012",
+		GeneratedAt: now,
+		Failures: []storage.ScanFailure{{
+			Region: "ap-south-1",
+			Stage:  "scan",
+			Error:  "unable to describe DB snapshots in region ap-south-1: AccessDenied",
+			Since:  now,
+		}},
+		Resolved: []storage.ScanFailure{{
+			Region: "eu-west-1",
+			Stage:  "ops-items",
+			Error:  "ThrottlingException",
+			Since:  now.Add(-time.Hour),
+		}},
+	}
+}
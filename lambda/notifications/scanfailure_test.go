@@ -0,0 +1,52 @@
+package notifications
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"rds-backup-monitor/lambda/storage"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSendScanFailures(t *testing.T) {
+	since := time.Date(2024, 11, 20, 0, 0, 0, 0, time.UTC)
+	failures := []storage.ScanFailure{{Region: "ap-south-1", Stage: "scan", Error: "AccessDenied", Since: since}}
+	resolved := []storage.ScanFailure{{Region: "eu-west-1", Stage: "ops-items", Error: "throttled", Since: since}}
+
+	t.Run("sends failures and resolved failures to the default notifiers", func(t *testing.T) {
+		email := &mockNotifier{destination: "email"}
+		router := NewRouter([]Notifier{email}, nil)
+
+		err := SendScanFailures(context.Background(), failures, resolved, "123456789012", DefaultTemplates(), router)
+		require.NoError(t, err)
+
+		require.Len(t, email.messages, 1)
+		assert.Equal(t, []string{"scan-failure"}, email.types)
+		assert.Equal(t, "RDS Snapshot Monitor: 1 region failures, 1 resolved", email.messages[0].Subject)
+		assert.Contains(t, email.messages[0].Text, "ap-south-1 (scan): AccessDenied\nFailing since 2024-11-20T00:00:00Z")
+		assert.Contains(t, email.messages[0].Text, "eu-west-1 (ops-items), failed since 2024-11-20T00:00:00Z")
+	})
+
+	t.Run("sends only resolved failures", func(t *testing.T) {
+		email := &mockNotifier{destination: "email"}
+		router := NewRouter([]Notifier{email}, nil)
+
+		err := SendScanFailures(context.Background(), nil, resolved, "123456789012", DefaultTemplates(), router)
+		require.NoError(t, err)
+		require.Len(t, email.messages, 1)
+		assert.Equal(t, "RDS Snapshot Monitor: 1 resolved", email.messages[0].Subject)
+		assert.NotContains(t, email.messages[0].Text, "could not complete")
+	})
+
+	t.Run("sends nothing without failures", func(t *testing.T) {
+		email := &mockNotifier{destination: "email"}
+		router := NewRouter([]Notifier{email}, nil)
+
+		err := SendScanFailures(context.Background(), nil, nil, "123456789012", DefaultTemplates(), router)
+		require.NoError(t, err)
+		assert.Empty(t, email.messages)
+	})
+}
@@ -2,16 +2,46 @@ package notifications
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
-	"os"
+	"slices"
+	"sort"
+	"time"
 
 	"rds-backup-monitor/lambda/storage"
+	"rds-backup-monitor/lambda/suppression"
 	"rds-backup-monitor/lambda/types"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/service/sns"
+	snsTypes "github.com/aws/aws-sdk-go-v2/service/sns/types"
 )
 
+const (
+	// MessageFormatText publishes the human-readable summary only.
+	MessageFormatText = "text"
+	// MessageFormatJSON publishes a ChangeEventBatch document as the message body.
+	MessageFormatJSON = "json"
+	// MessageFormatSNSJSON publishes with MessageStructure=json so that email
+	// subscribers receive the summary and sqs, lambda and http(s) subscribers
+	// receive the ChangeEventBatch document.
+	MessageFormatSNSJSON = "sns-json"
+)
+
+// Values of the messageType message attribute.
+const (
+	messageTypeChange      = "change"
+	messageTypeReport      = "report"
+	messageTypeReminder    = "reminder"
+	messageTypeScanFailure = "scan-failure"
+)
+
+// ValidMessageFormat reports whether format is one of the supported message formats.
+func ValidMessageFormat(format string) bool {
+	return format == MessageFormatText || format == MessageFormatJSON || format == MessageFormatSNSJSON
+}
+
 type SNSClient interface {
 	Publish(ctx context.Context, params *sns.PublishInput, optFns ...func(*sns.Options)) (*sns.PublishOutput, error)
 }
@@ -25,51 +55,419 @@ func contains(slice []string, str string) bool {
 	return false
 }
 
-func ProcessSnapshotChanges(ctx context.Context, filteredSnapshots []storage.SnapshotInfo,
-	processedSnapshots map[string]string, appConfig types.Configuration,
-	region string, snsClient SNSClient, ddbClient storage.DDBClient) error {
+// DetectSnapshotChanges compares the snapshots found in region with their
+// recorded state and returns the monitored status changes along with the
+// snapshots whose state needs to be persisted.
+func DetectSnapshotChanges(filteredSnapshots []storage.SnapshotInfo,
+	processedSnapshots map[string]string, appConfig types.Configuration, region string) RegionResult {
 
-	var statusChanges []SnapshotStatusChange
-	var snapshotsToUpdate []storage.SnapshotInfo
+	result := RegionResult{Region: region}
 
 	for _, snapshot := range filteredSnapshots {
 		currentStatus := snapshot.Status
-		previousStatus, exists := processedSnapshots[snapshot.SnapshotID]
+		previousStatus := processedSnapshots[snapshot.Key()]
 
 		if contains(appConfig.StatusesToMonitor, currentStatus) {
 			fmt.Printf("Checking snapshot %s in region %s\n", snapshot.SnapshotID, region)
 
-			if !exists || previousStatus != string(currentStatus) {
-				statusChanges = append(statusChanges, SnapshotStatusChange{
+			if statusChanged(snapshot, processedSnapshots) {
+				change := SnapshotStatusChange{
 					SnapshotID:     snapshot.SnapshotID,
+					SnapshotArn:    snapshot.SnapshotArn,
+					SnapshotType:   snapshot.SnapshotType,
+					CreationType:   snapshot.CreationType,
 					CurrentStatus:  string(currentStatus),
 					PreviousStatus: previousStatus,
-					DBInstance:     snapshot.SnapshotID,
+					DBInstance:     snapshot.SourceID,
 					Region:         region,
-				})
-				snapshotsToUpdate = append(snapshotsToUpdate, snapshot)
+					CreateTime:     snapshot.CreateTime,
+					Tags:           snapshot.Tags,
+				}
+				change.Severity = assignSeverity(change, appConfig.SeverityRules)
+				result.Changes = append(result.Changes, change)
+				result.SnapshotsToUpdate = append(result.SnapshotsToUpdate, snapshot)
 			}
 		}
 	}
 
-	if len(statusChanges) > 0 {
-		message := formatAggregatedMessage(statusChanges)
+	return result
+}
+
+// RecordTransitions adds the transitions of the snapshots whose state result
+// updates, from their recorded status, as observed at now by the run runID.
+// Ignored and muted changes are recorded as well.
+func RecordTransitions(result RegionResult, processedSnapshots map[string]string, now time.Time, runID string) RegionResult {
+	result.Transitions = make([]storage.Transition, len(result.SnapshotsToUpdate))
+	for i, snapshot := range result.SnapshotsToUpdate {
+		result.Transitions[i] = storage.Transition{
+			SnapshotKey: snapshot.Key(),
+			SnapshotID:  snapshot.SnapshotID,
+			SourceType:  snapshot.SnapshotType,
+			SourceID:    snapshot.SourceID,
+			From:        processedSnapshots[snapshot.Key()],
+			To:          snapshot.Status,
+			ObservedAt:  now,
+			RunID:       runID,
+		}
+	}
+	return result
+}
+
+// ChangedSnapshots returns the snapshots that DetectSnapshotChanges reports
+// as changed, without logging them. It lets a scan diff every page as it
+// arrives and keep only the snapshots that matter for the run.
+func ChangedSnapshots(snapshots []storage.SnapshotInfo, processedSnapshots map[string]string,
+	appConfig types.Configuration) []storage.SnapshotInfo {
 
-		_, err := snsClient.Publish(ctx, &sns.PublishInput{
-			TopicArn: aws.String(os.Getenv("SNS_TOPIC_ARN")),
-			Message:  aws.String(message),
-		})
+	var changed []storage.SnapshotInfo
+	for _, snapshot := range snapshots {
+		if contains(appConfig.StatusesToMonitor, snapshot.Status) && statusChanged(snapshot, processedSnapshots) {
+			changed = append(changed, snapshot)
+		}
+	}
+	return changed
+}
+
+// ExpiringSnapshots returns the snapshots, listed at now, whose recorded
+// state needs renewal to outlive them, with their recorded status. Snapshots
+// that ChangedSnapshots reports are left out, since their new state is
+// stored anyway.
+func ExpiringSnapshots(snapshots []storage.SnapshotInfo, states map[string]storage.SnapshotState,
+	appConfig types.Configuration, now time.Time) []storage.SnapshotInfo {
+
+	retention := StateRetention(appConfig)
+	var expiring []storage.SnapshotInfo
+	for _, snapshot := range snapshots {
+		state, ok := states[snapshot.Key()]
+		if !ok || !retention.NeedsRenewal(state, now) {
+			continue
+		}
+		if contains(appConfig.StatusesToMonitor, snapshot.Status) && snapshot.Status != state.Status {
+			continue
+		}
+		snapshot.Status = state.Status
+		expiring = append(expiring, snapshot)
+	}
+	return expiring
+}
+
+// KeepsAllSnapshots reports whether region scans keep every snapshot they
+// list instead of only those ScannedSnapshots returns. Escalation reminders,
+// OpsItems and compliance checks look at every snapshot of a database, so with
+// any of them memory and checkpoints grow with the snapshots listed in a
+// region: all of them with Security Hub findings, which lists snapshots of any
+// age.
+func KeepsAllSnapshots(appConfig types.Configuration) bool {
+	return appConfig.Escalation != nil || appConfig.OpsItems || appConfig.SecurityHubFindings
+}
+
+// ScannedSnapshots returns the snapshots of a page, listed at now, that a
+// region scan keeps: every snapshot when KeepsAllSnapshots, otherwise only the
+// changed snapshots and those whose state needs renewal.
+func ScannedSnapshots(page []storage.SnapshotInfo, processedSnapshots map[string]string,
+	states map[string]storage.SnapshotState, appConfig types.Configuration, now time.Time) []storage.SnapshotInfo {
+
+	if KeepsAllSnapshots(appConfig) {
+		return page
+	}
+	return append(ChangedSnapshots(page, processedSnapshots, appConfig),
+		ExpiringSnapshots(page, states, appConfig, now)...)
+}
+
+// RenewStates adds the snapshots of region whose recorded state needs
+// renewal to the states that result stores.
+func RenewStates(result RegionResult, snapshots []storage.SnapshotInfo, states map[string]storage.SnapshotState,
+	appConfig types.Configuration, now time.Time) RegionResult {
+
+	result.SnapshotsToRenew = ExpiringSnapshots(snapshots, states, appConfig, now)
+	if len(result.SnapshotsToRenew) > 0 {
+		fmt.Printf("Renewing the states of %d snapshots in region %s\n", len(result.SnapshotsToRenew), result.Region)
+	}
+	return result
+}
+
+// StateRetention is how long snapshot states are kept after a scan last
+// listed their snapshot.
+func StateRetention(appConfig types.Configuration) storage.Retention {
+	return storage.Retention{Days: appConfig.SnapshotAgeDays, StatusDays: appConfig.StatusRetentionDays}
+}
+
+func statusChanged(snapshot storage.SnapshotInfo, processedSnapshots map[string]string) bool {
+	previousStatus, exists := processedSnapshots[snapshot.Key()]
+	return !exists || previousStatus != snapshot.Status
+}
+
+// ProcessSnapshotChanges sends the changes of every region as a single digest
+// per notifier and persists the new snapshot states. The digest is recorded in
+// the outbox first, so a run that stops between sending and storing leaves an
+// entry that RelayOutbox completes, and the changes are neither lost nor
+// detected again. Changes in the scope of an open suppression window are
+// stored instead of sent, and sent as a catch-up digest by the first run after
+// the window closes. Digests are sent within budget, the message budget of the
+// run.
+func ProcessSnapshotChanges(ctx context.Context, results []RegionResult, appConfig types.Configuration,
+	router *Router, budget *MessageBudget, windows []suppression.Window, states storage.StateStore) error {
+
+	now := time.Now()
+
+	var statusChanges, ignoredChanges []SnapshotStatusChange
+	for _, result := range results {
+		statusChanges = append(statusChanges, result.Changes...)
+		ignoredChanges = append(ignoredChanges, result.Ignored...)
+	}
+
+	statusChanges, held, err := holdChanges(statusChanges, windows, now)
+	if err != nil {
+		return err
+	}
+	// Ignored changes are held as well, so the catch-up digest counts them
+	ignoredChanges, heldIgnored, err := holdChanges(ignoredChanges, windows, now)
+	if err != nil {
+		return err
+	}
+	for _, change := range heldIgnored {
+		change.ID = heldIgnoredPrefix + change.ID
+		held = append(held, change)
+	}
+	if len(ignoredChanges) > 0 {
+		fmt.Printf("Ignored %d changes matching ignore rules\n", len(ignoredChanges))
+	}
+	if len(held) > 0 {
+		fmt.Printf("Holding back %d changes during suppression windows\n", len(held))
+		if err := states.PutHeldChanges(ctx, held); err != nil {
+			return err
+		}
+	}
+
+	limits := digestLimits{maxListed: appConfig.MaxListedChanges, budget: budget}
+
+	// Without a digest there is nothing that could be lost or sent twice. A
+	// run whose changes were all ignored still sends their count
+	var errs []error
+	if len(statusChanges) == 0 && len(ignoredChanges) == 0 {
+		errs = append(errs, persistRegionResults(ctx, states, results, appConfig))
+	} else {
+		entry, err := putOutboxRecord(ctx, states, outboxRecord{
+			Digest:  Digest{Changes: statusChanges, IgnoredCounts: countIgnored(ignoredChanges)},
+			Results: results,
+		}, now)
+		if err != nil {
+			return err
+		}
+		errs = append(errs, completeOutboxEntry(ctx, router, entry, appConfig, states, limits))
+	}
+
+	errs = append(errs, sendCatchUpDigests(ctx, router, windows, now, appConfig, states, limits))
+	return errors.Join(errs...)
+}
 
+// persistRegionResults updates all snapshot states of a region in a single
+// batch operation. A region that fails to store its states does not keep the
+// others from storing theirs.
+func persistRegionResults(ctx context.Context, states storage.StateStore, results []RegionResult, appConfig types.Configuration) error {
+	var errs []error
+	for _, result := range results {
+		if err := persistRegionResult(ctx, states, result, appConfig); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func persistRegionResult(ctx context.Context, states storage.StateStore, result RegionResult, appConfig types.Configuration) error {
+	// The history comes first: a run that stops in between detects the
+	// change again and records it twice rather than never
+	if err := states.AppendHistory(ctx, result.Region, result.Transitions, historyRetentionDays(appConfig)); err != nil {
+		return err
+	}
+	snapshots := slices.Concat(result.SnapshotsToUpdate, result.SnapshotsToRenew)
+	err := states.BatchUpdateSnapshotStates(ctx, result.Region, snapshots, StateRetention(appConfig))
+	if err != nil {
+		return fmt.Errorf("failed to batch update snapshot states in region %s: %v", result.Region, err)
+	}
+	if err := states.DeleteAcknowledgements(ctx, result.RecoveredAcknowledgements); err != nil {
+		return err
+	}
+	if err := states.PutDatabaseHealth(ctx, result.HealthUpdates); err != nil {
+		return err
+	}
+	return states.DeleteDatabaseHealth(ctx, result.RecoveredHealth)
+}
+
+func historyRetentionDays(appConfig types.Configuration) int {
+	if appConfig.HistoryRetentionDays > 0 {
+		return appConfig.HistoryRetentionDays
+	}
+	return storage.DefaultHistoryRetentionDays
+}
+
+// digestLimits are the limits shared by the digests sent in a run.
+type digestLimits struct {
+	maxListed int
+	budget    *MessageBudget
+}
+
+// sendDigest routes digest and sends each part to its notifier, within the
+// limits of the run. Sinks receive their part in full. With outbox set,
+// deliveries made before are skipped and every delivery is recorded once its
+// parts were sent. A delivery to a destination whose message limit was
+// reached is deferred: it is not sent nor recorded, and deferred is true so the
+// caller keeps the digest for the next run.
+func sendDigest(ctx context.Context, router *Router, digest Digest, limits digestLimits, outbox *outboxDelivery) (deferred bool, err error) {
+	if len(digest.Changes) == 0 && len(digest.IgnoredCounts) == 0 {
+		return false, nil
+	}
+
+	digest.Changes = sortChanges(digest.Changes)
+	for _, delivery := range router.Route(digest) {
+		destination, key := delivery.Notifier.Destination(), delivery.key()
+		if outbox.delivered(key) {
+			fmt.Printf("Digest %s was sent to %s before, skipping\n", digest.ID, key)
+			continue
+		}
+
+		if delivery.Sink {
+			fmt.Printf("Sending %d changes to %s\n", len(delivery.Digest.Changes), destination)
+			if err := delivery.Notifier.Notify(ctx, delivery.Digest); err != nil {
+				return false, err
+			}
+			if err := outbox.markDelivered(ctx, key); err != nil {
+				return false, err
+			}
+			continue
+		}
+
+		parts, err := limitDigest(delivery.Digest, delivery.Notifier, limits.maxListed, limits.budget.remaining(destination))
 		if err != nil {
-			return fmt.Errorf("unable to publish SNS message: %v", err)
+			return false, err
+		}
+		if len(parts) == 0 {
+			fmt.Printf("Message limit of %s reached, deferring %d changes to the next run\n", destination, len(delivery.Digest.Changes))
+			deferred = true
+			continue
+		}
+
+		for _, part := range parts {
+			fmt.Printf("Sending %d changes to %s, %d summarized\n", len(part.Changes), destination, len(part.Summarized))
+			if err := delivery.Notifier.Notify(ctx, part); err != nil {
+				return false, err
+			}
+			limits.budget.spend(destination)
 		}
+		if err := outbox.markDelivered(ctx, key); err != nil {
+			return false, err
+		}
+	}
+	return deferred, nil
+}
+
+// buildPublishInput renders a digest with the SNS channel templates in the
+// configured message format and attaches message attributes that subscribers
+// can match in filter policies.
+func buildPublishInput(topicArn string, digest Digest,
+	appConfig types.Configuration, templates *TemplateSet, observedAt time.Time) (*sns.PublishInput, error) {
+
+	rendered, err := templates.Render(ChannelSNS, newDigestTemplateData(digest, appConfig.AccountID, observedAt))
+	if err != nil {
+		return nil, err
+	}
+
+	input := &sns.PublishInput{
+		TopicArn:          aws.String(topicArn),
+		Subject:           aws.String(rendered.Subject),
+		MessageAttributes: buildMessageAttributes(digest.allChanges()),
+	}
+	if id := digestID(digest); id != "" {
+		input.MessageAttributes["digestId"] = snsTypes.MessageAttributeValue{
+			DataType:    aws.String("String"),
+			StringValue: aws.String(id),
+		}
+	}
 
-		// Update all snapshot states in a single batch operation
-		err = storage.BatchUpdateSnapshotStates(ctx, ddbClient, region, snapshotsToUpdate, appConfig.SnapshotAgeDays)
+	switch appConfig.MessageFormat {
+	case MessageFormatJSON:
+		message, err := formatJSONMessage(digest, appConfig.AccountID, observedAt)
 		if err != nil {
-			return fmt.Errorf("failed to batch update snapshot states: %v", err)
+			return nil, err
 		}
+		input.Message = aws.String(message)
+	case MessageFormatSNSJSON:
+		jsonMessage, err := formatJSONMessage(digest, appConfig.AccountID, observedAt)
+		if err != nil {
+			return nil, err
+		}
+		structured, err := json.Marshal(map[string]string{
+			"default":    rendered.Text,
+			"email":      rendered.Text,
+			"email-json": jsonMessage,
+			"sqs":        jsonMessage,
+			"lambda":     jsonMessage,
+			"http":       jsonMessage,
+			"https":      jsonMessage,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("unable to marshal SNS message structure: %v", err)
+		}
+		input.Message = aws.String(string(structured))
+		input.MessageStructure = aws.String("json")
+	default:
+		input.Message = aws.String(rendered.Text)
+	}
+
+	return input, nil
+}
+
+// digestID identifies a message of digest across retries. The parts of a
+// split digest are told apart by their number.
+func digestID(digest Digest) string {
+	if digest.ID == "" || digest.Parts == 0 {
+		return digest.ID
+	}
+	return fmt.Sprintf("%s/%d", digest.ID, digest.Part)
+}
+
+// buildMessageAttributes summarizes changes into SNS message attributes. Region
+// and status are published as String.Array so a filter policy matches when any
+// change in the message carries the value.
+func buildMessageAttributes(changes []SnapshotStatusChange) map[string]snsTypes.MessageAttributeValue {
+	regions := make(map[string]bool)
+	statuses := make(map[string]bool)
+	for _, change := range changes {
+		regions[change.Region] = true
+		statuses[change.CurrentStatus] = true
+	}
+
+	return map[string]snsTypes.MessageAttributeValue{
+		"messageType": {
+			DataType:    aws.String("String"),
+			StringValue: aws.String(messageTypeChange),
+		},
+		"severity": {
+			DataType:    aws.String("String"),
+			StringValue: aws.String(highestSeverity(changes)),
+		},
+		"region": {
+			DataType:    aws.String("String.Array"),
+			StringValue: aws.String(stringArrayAttribute(regions)),
+		},
+		"status": {
+			DataType:    aws.String("String.Array"),
+			StringValue: aws.String(stringArrayAttribute(statuses)),
+		},
+		"schemaVersion": {
+			DataType:    aws.String("String"),
+			StringValue: aws.String(EventSchemaVersion),
+		},
+	}
+}
+
+func stringArrayAttribute(values map[string]bool) string {
+	sorted := make([]string, 0, len(values))
+	for value := range values {
+		sorted = append(sorted, value)
 	}
+	sort.Strings(sorted)
 
-	return nil
+	encoded, _ := json.Marshal(sorted)
+	return string(encoded)
 }
@@ -2,35 +2,44 @@ package notifications
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
+	"rds-backup-monitor/lambda/backups"
 	"rds-backup-monitor/lambda/storage"
 	"rds-backup-monitor/lambda/types"
+	"strconv"
+	"strings"
 	"testing"
+	"time"
 
-	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/rds"
+	rdsTypes "github.com/aws/aws-sdk-go-v2/service/rds/types"
 	"github.com/aws/aws-sdk-go-v2/service/sns"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 type mockSNSClient struct {
 	publishOutput *sns.PublishOutput
 	err           error
+	publishCount  int
+	lastInput     *sns.PublishInput
 }
 
 func (m *mockSNSClient) Publish(ctx context.Context, params *sns.PublishInput, optFns ...func(*sns.Options)) (*sns.PublishOutput, error) {
+	m.publishCount++
+	m.lastInput = params
 	return m.publishOutput, m.err
 }
 
-type mockDynamoDBClient struct {
-	err error
+// failingOutboxStore fails to store outbox entries.
+type failingOutboxStore struct {
+	*storage.MemoryStore
 }
 
-func (m *mockDynamoDBClient) Query(ctx context.Context, params *dynamodb.QueryInput, optFns ...func(*dynamodb.Options)) (*dynamodb.QueryOutput, error) {
-	return &dynamodb.QueryOutput{}, m.err
-}
-
-func (m *mockDynamoDBClient) BatchWriteItem(ctx context.Context, params *dynamodb.BatchWriteItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.BatchWriteItemOutput, error) {
-	return &dynamodb.BatchWriteItemOutput{}, m.err
+func (s failingOutboxStore) PutOutboxEntry(ctx context.Context, entry *storage.OutboxEntry) error {
+	return fmt.Errorf("store error")
 }
 
 func TestContains(t *testing.T) {
@@ -68,77 +77,317 @@ func TestContains(t *testing.T) {
 	}
 }
 
-func TestProcessSnapshotChanges(t *testing.T) {
-	ctx := context.Background()
-	region := []string{"us-west-2"}
-	statusesToMonitor := []string{"available", "error"}
+func TestDetectSnapshotChanges(t *testing.T) {
 	appConfig := types.Configuration{
-		Regions:           region,
-		StatusesToMonitor: statusesToMonitor,
+		Regions:           []string{"us-west-2"},
+		StatusesToMonitor: []string{"available", "error"},
 		SnapshotAgeDays:   7,
+		SeverityRules: []types.SeverityRule{
+			{Severity: SeverityCritical, ToStatus: []string{"error"}, Tags: map[string]string{"env": "prod"}},
+		},
 	}
 
 	tests := []struct {
 		name               string
 		filteredSnapshots  []storage.SnapshotInfo
 		processedSnapshots map[string]string
-		snsErr             error
-		ddbErr             error
-		wantErr            bool
+		wantChanges        []SnapshotStatusChange
 	}{
 		{
-			name: "successfully processes new snapshots",
+			name: "detects new snapshots",
 			filteredSnapshots: []storage.SnapshotInfo{
-				{
-					SnapshotID: "snap-1",
-					Status:     "available",
-				},
+				{SnapshotID: "snap-1", SourceID: "db-1", SnapshotType: "instance", Status: "available"},
 			},
 			processedSnapshots: map[string]string{},
-			snsErr:             nil,
-			ddbErr:             nil,
-			wantErr:            false,
+			wantChanges: []SnapshotStatusChange{
+				{SnapshotID: "snap-1", SnapshotType: "instance", CurrentStatus: "available",
+					DBInstance: "db-1", Region: "us-west-2", Severity: SeverityInfo},
+			},
 		},
 		{
-			name: "successfully processes status changes",
+			name: "detects status changes",
 			filteredSnapshots: []storage.SnapshotInfo{
-				{
-					SnapshotID: "snap-1",
-					Status:     "error",
-				},
+				{SnapshotID: "snap-1", SourceID: "db-1", Status: "error"},
 			},
-			processedSnapshots: map[string]string{
-				"snap-1": "available",
+			processedSnapshots: map[string]string{"snap-1": "available"},
+			wantChanges: []SnapshotStatusChange{
+				{SnapshotID: "snap-1", CurrentStatus: "error", PreviousStatus: "available",
+					DBInstance: "db-1", Region: "us-west-2", Severity: SeverityCritical},
 			},
-			snsErr:  nil,
-			ddbErr:  nil,
-			wantErr: false,
 		},
 		{
-			name: "handles SNS error",
+			name: "applies severity rules",
 			filteredSnapshots: []storage.SnapshotInfo{
-				{
-					SnapshotID: "snap-1",
-					Status:     "available",
-				},
+				{SnapshotID: "snap-1", SourceID: "db-1", Status: "error", Tags: map[string]string{"env": "prod"}},
 			},
 			processedSnapshots: map[string]string{},
-			snsErr:             fmt.Errorf("SNS error"),
-			ddbErr:             nil,
-			wantErr:            true,
+			wantChanges: []SnapshotStatusChange{
+				{SnapshotID: "snap-1", CurrentStatus: "error", DBInstance: "db-1", Region: "us-west-2",
+					Severity: SeverityCritical, Tags: map[string]string{"env": "prod"}},
+			},
 		},
 		{
-			name: "handles DynamoDB error",
+			name: "ignores unchanged and unmonitored snapshots",
 			filteredSnapshots: []storage.SnapshotInfo{
-				{
-					SnapshotID: "snap-1",
-					Status:     "available",
-				},
+				{SnapshotID: "snap-1", Status: "available"},
+				{SnapshotID: "snap-2", Status: "creating"},
 			},
-			processedSnapshots: map[string]string{},
-			snsErr:             nil,
-			ddbErr:             fmt.Errorf("DynamoDB error"),
-			wantErr:            true,
+			processedSnapshots: map[string]string{"snap-1": "available"},
+			wantChanges:        nil,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := DetectSnapshotChanges(tt.filteredSnapshots, tt.processedSnapshots, appConfig, "us-west-2")
+			assert.Equal(t, "us-west-2", result.Region)
+			assert.Equal(t, tt.wantChanges, result.Changes)
+			assert.Len(t, result.SnapshotsToUpdate, len(tt.wantChanges))
+
+			// Diffing page by page keeps the same snapshots
+			assert.Equal(t, result.SnapshotsToUpdate, ChangedSnapshots(tt.filteredSnapshots, tt.processedSnapshots, appConfig))
+		})
+	}
+}
+
+func TestRecordTransitions(t *testing.T) {
+	now := time.Date(2024, 11, 20, 10, 0, 0, 0, time.UTC)
+	result := RegionResult{
+		Region: "us-west-2",
+		SnapshotsToUpdate: []storage.SnapshotInfo{
+			{SnapshotID: "nightly", SnapshotArn: "arn:aws:rds:us-west-2:123456789012:snapshot:nightly",
+				SnapshotType: "instance", SourceID: "orders", Status: "failed"},
+			{SnapshotID: "manual", SnapshotType: "cluster", SourceID: "catalog", Status: "available"},
+		},
+	}
+	processed := map[string]string{"arn:aws:rds:us-west-2:123456789012:snapshot:nightly": "creating"}
+
+	result = RecordTransitions(result, processed, now, "run-1")
+	assert.Equal(t, []storage.Transition{
+		{
+			SnapshotKey: "arn:aws:rds:us-west-2:123456789012:snapshot:nightly", SnapshotID: "nightly",
+			SourceType: "instance", SourceID: "orders", From: "creating", To: "failed", ObservedAt: now, RunID: "run-1",
+		},
+		{
+			SnapshotKey: "manual", SnapshotID: "manual",
+			SourceType: "cluster", SourceID: "catalog", To: "available", ObservedAt: now, RunID: "run-1",
+		},
+	}, result.Transitions)
+}
+
+func TestExpiringSnapshots(t *testing.T) {
+	now := time.Date(2024, 11, 20, 10, 0, 0, 0, time.UTC)
+	appConfig := types.Configuration{
+		StatusesToMonitor:   []string{"failed", "available"},
+		SnapshotAgeDays:     7,
+		StatusRetentionDays: map[string]int{"failed": 90},
+	}
+	snapshots := []storage.SnapshotInfo{
+		{SnapshotID: "fresh", Status: "available"},
+		{SnapshotID: "expiring", Status: "available"},
+		{SnapshotID: "failed", Status: "failed"},
+		{SnapshotID: "changed", Status: "failed"},
+		{SnapshotID: "unmonitored", Status: "copying"},
+		{SnapshotID: "new", Status: "available"},
+	}
+	states := map[string]storage.SnapshotState{
+		"fresh":       {Status: "available", ExpiresAt: now.AddDate(0, 0, 6)},
+		"expiring":    {Status: "available", ExpiresAt: now.AddDate(0, 0, 2)},
+		"failed":      {Status: "failed", ExpiresAt: now.AddDate(0, 0, 30)},
+		"changed":     {Status: "available", ExpiresAt: now.AddDate(0, 0, 1)},
+		"unmonitored": {Status: "available", ExpiresAt: now.AddDate(0, 0, 1)},
+	}
+
+	// Changed snapshots are stored with their new state; the others keep
+	// their recorded status
+	result := RenewStates(RegionResult{Region: "us-west-2"}, snapshots, states, appConfig, now)
+	assert.Equal(t, []storage.SnapshotInfo{
+		{SnapshotID: "expiring", Status: "available"},
+		{SnapshotID: "failed", Status: "failed"},
+		{SnapshotID: "unmonitored", Status: "available"},
+	}, result.SnapshotsToRenew)
+}
+
+func TestScannedSnapshots(t *testing.T) {
+	now := time.Date(2024, 11, 20, 10, 0, 0, 0, time.UTC)
+	page := []storage.SnapshotInfo{
+		{SnapshotID: "unchanged", Status: "available"},
+		{SnapshotID: "changed", Status: "failed"},
+	}
+	processed := map[string]string{"unchanged": "available", "changed": "available"}
+	states := map[string]storage.SnapshotState{
+		"unchanged": {Status: "available", ExpiresAt: now.AddDate(0, 0, 6)},
+		"changed":   {Status: "available", ExpiresAt: now.AddDate(0, 0, 6)},
+	}
+	base := types.Configuration{StatusesToMonitor: []string{"failed", "available"}, SnapshotAgeDays: 7}
+
+	t.Run("keeps the changed snapshots", func(t *testing.T) {
+		assert.False(t, KeepsAllSnapshots(base))
+		assert.Equal(t, page[1:], ScannedSnapshots(page, processed, states, base, now))
+	})
+
+	keepAll := map[string]func(*types.Configuration){
+		"escalation":   func(c *types.Configuration) { c.Escalation = &types.EscalationPolicy{} },
+		"OpsItems":     func(c *types.Configuration) { c.OpsItems = true },
+		"Security Hub": func(c *types.Configuration) { c.SecurityHubFindings = true },
+	}
+	for name, enable := range keepAll {
+		t.Run("keeps every snapshot with "+name, func(t *testing.T) {
+			appConfig := base
+			enable(&appConfig)
+			assert.True(t, KeepsAllSnapshots(appConfig))
+			assert.Equal(t, page, ScannedSnapshots(page, processed, states, appConfig, now))
+		})
+	}
+}
+
+// pagedSnapshotsClient lists its instance snapshots in pages of 100, using
+// the index of the next snapshot as marker.
+type pagedSnapshotsClient struct {
+	backups.RDSClient
+	snapshots []rdsTypes.DBSnapshot
+}
+
+func (c *pagedSnapshotsClient) DescribeDBSnapshots(ctx context.Context, params *rds.DescribeDBSnapshotsInput, optFns ...func(*rds.Options)) (*rds.DescribeDBSnapshotsOutput, error) {
+	start, _ := strconv.Atoi(aws.ToString(params.Marker))
+	end := min(start+100, len(c.snapshots))
+	output := &rds.DescribeDBSnapshotsOutput{DBSnapshots: c.snapshots[start:end]}
+	if end < len(c.snapshots) {
+		output.Marker = aws.String(strconv.Itoa(end))
+	}
+	return output, nil
+}
+
+func (c *pagedSnapshotsClient) DescribeDBClusterSnapshots(ctx context.Context, params *rds.DescribeDBClusterSnapshotsInput, optFns ...func(*rds.Options)) (*rds.DescribeDBClusterSnapshotsOutput, error) {
+	return &rds.DescribeDBClusterSnapshotsOutput{}, nil
+}
+
+// BenchmarkScannedSnapshots scans 100,000 recent snapshots page by page and
+// keeps those ScannedSnapshots returns, as a region scan without inventories
+// does. Every snapshot was recorded, one in a thousand with another status.
+func BenchmarkScannedSnapshots(b *testing.B) {
+	const count = 100_000
+	ctx := context.Background()
+	now := time.Now()
+	appConfig := types.Configuration{StatusesToMonitor: []string{"available", "failed"}, SnapshotAgeDays: 7}
+	cutoff := now.AddDate(0, 0, -appConfig.SnapshotAgeDays)
+
+	client := &pagedSnapshotsClient{}
+	processed := make(map[string]string, count)
+	states := make(map[string]storage.SnapshotState, count)
+	for i := 0; i < count; i++ {
+		arn := fmt.Sprintf("arn:aws:rds:us-west-2:123456789012:snapshot:instance-%d", i)
+		client.snapshots = append(client.snapshots, rdsTypes.DBSnapshot{
+			DBSnapshotIdentifier: aws.String(fmt.Sprintf("instance-%d", i)),
+			DBSnapshotArn:        aws.String(arn),
+			DBInstanceIdentifier: aws.String("orders"),
+			SnapshotCreateTime:   aws.Time(now.Add(-time.Hour)),
+			Status:               aws.String("available"),
+		})
+		status := "available"
+		if i%1000 == 0 {
+			status = "creating"
+		}
+		processed[arn] = status
+		states[arn] = storage.SnapshotState{Status: status, ExpiresAt: now.AddDate(0, 0, appConfig.SnapshotAgeDays)}
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		var kept []storage.SnapshotInfo
+		_, done, err := backups.ScanSnapshots(ctx, client, backups.Position{}, cutoff, func() bool { return false },
+			func(page []storage.SnapshotInfo) error {
+				kept = append(kept, ScannedSnapshots(page, processed, states, appConfig, now)...)
+				return nil
+			})
+		if err != nil || !done {
+			b.Fatalf("scan did not complete: %v", err)
+		}
+		if len(kept) != count/1000 {
+			b.Fatalf("kept %d snapshots", len(kept))
+		}
+	}
+}
+
+func TestProcessSnapshotChanges_RenewsStates(t *testing.T) {
+	ctx := context.Background()
+	appConfig := types.Configuration{
+		StatusesToMonitor:   []string{"failed"},
+		SnapshotAgeDays:     7,
+		StatusRetentionDays: map[string]int{"failed": 90},
+	}
+	states := storage.NewMemoryStore()
+	results := []RegionResult{{
+		Region:           "us-west-2",
+		SnapshotsToRenew: []storage.SnapshotInfo{{SnapshotID: "snap-1", Status: "failed"}},
+	}}
+
+	assert.NoError(t, ProcessSnapshotChanges(ctx, results, appConfig, nil, NewMessageBudget(0), nil, states))
+
+	processed, err := states.GetProcessedSnapshots(ctx, "us-west-2")
+	assert.NoError(t, err)
+	assert.Equal(t, "failed", processed["snap-1"].Status)
+	assert.WithinDuration(t, time.Now().AddDate(0, 0, 90), processed["snap-1"].ExpiresAt, time.Minute)
+}
+
+func TestProcessSnapshotChanges(t *testing.T) {
+	ctx := context.Background()
+	appConfig := types.Configuration{
+		Regions:           []string{"us-west-2", "eu-west-1"},
+		StatusesToMonitor: []string{"available", "error"},
+		SnapshotAgeDays:   7,
+		SNSTopicArn:       "arn:aws:sns:us-west-2:123456789012:topic",
+	}
+	results := []RegionResult{
+		{
+			Region:            "us-west-2",
+			Changes:           []SnapshotStatusChange{{SnapshotID: "snap-1", CurrentStatus: "available", Region: "us-west-2"}},
+			SnapshotsToUpdate: []storage.SnapshotInfo{{SnapshotID: "snap-1", Status: "available"}},
+		},
+		{
+			Region:            "eu-west-1",
+			Changes:           []SnapshotStatusChange{{SnapshotID: "snap-2", CurrentStatus: "error", Region: "eu-west-1"}},
+			SnapshotsToUpdate: []storage.SnapshotInfo{{SnapshotID: "snap-2", Status: "error"}},
+		},
+	}
+
+	tests := []struct {
+		name          string
+		results       []RegionResult
+		snsErr        error
+		outboxErr     bool
+		wantErr       bool
+		wantPublishes int
+		wantOutbox    int
+		wantStored    bool
+	}{
+		{
+			name:          "publishes one digest for all regions",
+			results:       results,
+			wantPublishes: 1,
+			wantStored:    true,
+		},
+		{
+			name:          "skips publish without changes",
+			results:       []RegionResult{{Region: "us-west-2"}, {Region: "eu-west-1"}},
+			wantPublishes: 0,
+		},
+		{
+			name:          "keeps the outbox entry when SNS fails",
+			results:       results,
+			snsErr:        fmt.Errorf("SNS error"),
+			wantErr:       true,
+			wantPublishes: 1,
+			wantOutbox:    1,
+			wantStored:    true,
+		},
+		{
+			name:          "sends nothing when the outbox entry cannot be stored",
+			results:       results,
+			outboxErr:     true,
+			wantErr:       true,
+			wantPublishes: 0,
 		},
 	}
 
@@ -148,18 +397,107 @@ func TestProcessSnapshotChanges(t *testing.T) {
 				publishOutput: &sns.PublishOutput{},
 				err:           tt.snsErr,
 			}
-			ddbClient := &mockDynamoDBClient{
-				err: tt.ddbErr,
+			memory := storage.NewMemoryStore()
+			var states storage.StateStore = memory
+			if tt.outboxErr {
+				states = failingOutboxStore{memory}
 			}
 
-			err := ProcessSnapshotChanges(ctx, tt.filteredSnapshots, tt.processedSnapshots,
-				appConfig, region[0], snsClient, ddbClient)
+			router := NewSNSRouter(appConfig, DefaultTemplates(), snsClient)
+			err := ProcessSnapshotChanges(ctx, tt.results, appConfig, router, NewMessageBudget(0), nil, states)
 
 			if tt.wantErr {
 				assert.Error(t, err)
 			} else {
 				assert.NoError(t, err)
 			}
+			assert.Equal(t, tt.wantPublishes, snsClient.publishCount)
+			entries, err := states.GetOutboxEntries(ctx)
+			require.NoError(t, err)
+			assert.Len(t, entries, tt.wantOutbox)
+
+			processed, err := states.GetProcessedSnapshots(ctx, "eu-west-1")
+			assert.NoError(t, err)
+			if tt.wantStored {
+				assert.Equal(t, map[string]string{"snap-2": "error"}, storage.Statuses(processed))
+			} else {
+				assert.Empty(t, processed)
+			}
+
+			if tt.wantPublishes > 0 {
+				message := aws.ToString(snsClient.lastInput.Message)
+				assert.Less(t, strings.Index(message, "Region: eu-west-1"), strings.Index(message, "Region: us-west-2"))
+			}
+		})
+	}
+}
+
+func TestBuildPublishInput(t *testing.T) {
+	observedAt := time.Date(2024, 11, 20, 10, 0, 0, 0, time.UTC)
+	changes := []SnapshotStatusChange{
+		{
+			SnapshotID:    "snap-1",
+			CurrentStatus: "failed",
+			DBInstance:    "db-1",
+			Region:        "us-west-2",
+			Severity:      SeverityCritical,
+		},
+		{
+			SnapshotID:    "snap-2",
+			CurrentStatus: "available",
+			DBInstance:    "db-2",
+			Region:        "us-east-1",
+			Severity:      SeverityInfo,
+		},
+	}
+
+	tests := []struct {
+		name          string
+		format        string
+		wantStructure bool
+		wantJSONBody  bool
+	}{
+		{name: "text format", format: MessageFormatText},
+		{name: "json format", format: MessageFormatJSON, wantJSONBody: true},
+		{name: "sns-json format", format: MessageFormatSNSJSON, wantStructure: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			appConfig := types.Configuration{AccountID: "123456789012", MessageFormat: tt.format}
+
+			input, err := buildPublishInput("arn:aws:sns:us-west-2:123456789012:topic", Digest{Changes: changes}, appConfig, DefaultTemplates(), observedAt)
+			assert.NoError(t, err)
+			assert.Equal(t, "arn:aws:sns:us-west-2:123456789012:topic", aws.ToString(input.TopicArn))
+			assert.Equal(t, "RDS Snapshot Status Update (2 changes)", aws.ToString(input.Subject))
+
+			assert.Equal(t, "critical", aws.ToString(input.MessageAttributes["severity"].StringValue))
+			assert.Equal(t, "String.Array", aws.ToString(input.MessageAttributes["region"].DataType))
+			assert.Equal(t, `["us-east-1","us-west-2"]`, aws.ToString(input.MessageAttributes["region"].StringValue))
+			assert.Equal(t, `["available","failed"]`, aws.ToString(input.MessageAttributes["status"].StringValue))
+
+			switch {
+			case tt.wantStructure:
+				assert.Equal(t, "json", aws.ToString(input.MessageStructure))
+				var structure map[string]string
+				assert.NoError(t, json.Unmarshal([]byte(aws.ToString(input.Message)), &structure))
+				assert.Contains(t, structure["default"], "RDS Snapshot Status Update Summary (2 changes)")
+				assert.Equal(t, structure["default"], structure["email"])
+
+				var batch ChangeEventBatch
+				assert.NoError(t, json.Unmarshal([]byte(structure["sqs"]), &batch))
+				assert.Equal(t, 2, batch.ChangeCount)
+				assert.Equal(t, structure["sqs"], structure["lambda"])
+			case tt.wantJSONBody:
+				assert.Nil(t, input.MessageStructure)
+				var batch ChangeEventBatch
+				assert.NoError(t, json.Unmarshal([]byte(aws.ToString(input.Message)), &batch))
+				assert.Equal(t, "123456789012", batch.Account)
+				assert.Len(t, batch.Events, 2)
+			default:
+				assert.Nil(t, input.MessageStructure)
+				assert.Contains(t, aws.ToString(input.Message), "RDS Snapshot Status Update Summary (2 changes)")
+			}
 		})
 	}
 }
@@ -0,0 +1,122 @@
+package notifications
+
+import (
+	"fmt"
+	"path"
+
+	"rds-backup-monitor/lambda/storage"
+	"rds-backup-monitor/lambda/types"
+)
+
+const (
+	SeverityInfo     = "info"
+	SeverityWarning  = "warning"
+	SeverityCritical = "critical"
+)
+
+// statusNew stands in for the previous status of a snapshot seen for the first
+// time when matching SeverityRule.FromStatus.
+const statusNew = "new"
+
+var severityRank = map[string]int{
+	SeverityInfo:     0,
+	SeverityWarning:  1,
+	SeverityCritical: 2,
+}
+
+// ValidSeverity reports whether severity is one of the known severity levels.
+func ValidSeverity(severity string) bool {
+	_, ok := severityRank[severity]
+	return ok
+}
+
+// ValidateSeverityRules checks that every rule names a known severity and that
+// identifier and tag patterns are valid globs.
+func ValidateSeverityRules(rules []types.SeverityRule) error {
+	for i, rule := range rules {
+		if !ValidSeverity(rule.Severity) {
+			return fmt.Errorf("severity rule %d: unknown severity %q", i, rule.Severity)
+		}
+		if _, err := path.Match(rule.Identifier, ""); err != nil {
+			return fmt.Errorf("severity rule %d: invalid identifier pattern %q: %v", i, rule.Identifier, err)
+		}
+		for key, value := range rule.Tags {
+			if _, err := path.Match(value, ""); err != nil {
+				return fmt.Errorf("severity rule %d: invalid pattern %q for tag %s: %v", i, value, key, err)
+			}
+		}
+	}
+	return nil
+}
+
+// assignSeverity returns the severity of the first rule matching change, or the
+// default status based severity when no rule matches.
+func assignSeverity(change SnapshotStatusChange, rules []types.SeverityRule) string {
+	for _, rule := range rules {
+		if ruleMatches(rule, change) {
+			return rule.Severity
+		}
+	}
+	return classifySeverity(change.CurrentStatus)
+}
+
+func ruleMatches(rule types.SeverityRule, change SnapshotStatusChange) bool {
+	previousStatus := change.PreviousStatus
+	if previousStatus == "" {
+		previousStatus = statusNew
+	}
+
+	if len(rule.FromStatus) > 0 && !contains(rule.FromStatus, previousStatus) {
+		return false
+	}
+	if len(rule.ToStatus) > 0 && !contains(rule.ToStatus, change.CurrentStatus) {
+		return false
+	}
+	if len(rule.SnapshotType) > 0 && !contains(rule.SnapshotType, change.SnapshotType) {
+		return false
+	}
+	if len(rule.CreationType) > 0 && !contains(rule.CreationType, change.CreationType) {
+		return false
+	}
+	if len(rule.Regions) > 0 && !contains(rule.Regions, change.Region) {
+		return false
+	}
+	if rule.Identifier != "" && !globMatch(rule.Identifier, change.DBInstance) && !globMatch(rule.Identifier, change.SnapshotID) {
+		return false
+	}
+	for key, pattern := range rule.Tags {
+		value, ok := change.Tags[key]
+		if !ok || !globMatch(pattern, value) {
+			return false
+		}
+	}
+	return true
+}
+
+func globMatch(pattern, value string) bool {
+	matched, err := path.Match(pattern, value)
+	return err == nil && matched
+}
+
+// classifySeverity assigns a default severity based on the snapshot status alone.
+func classifySeverity(status string) string {
+	switch {
+	case storage.IsFailedStatus(status):
+		return SeverityCritical
+	case status == "deleting" || status == "deleted":
+		return SeverityWarning
+	default:
+		return SeverityInfo
+	}
+}
+
+// highestSeverity returns the most severe level found in changes.
+func highestSeverity(changes []SnapshotStatusChange) string {
+	highest := SeverityInfo
+	for _, change := range changes {
+		if severityRank[change.Severity] > severityRank[highest] {
+			highest = change.Severity
+		}
+	}
+	return highest
+}
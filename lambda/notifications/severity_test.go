@@ -0,0 +1,148 @@
+package notifications
+
+import (
+	"rds-backup-monitor/lambda/types"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestClassifySeverity(t *testing.T) {
+	tests := []struct {
+		status string
+		want   string
+	}{
+		{status: "failed", want: SeverityCritical},
+		{status: "error", want: SeverityCritical},
+		{status: "incompatible-restore", want: SeverityCritical},
+		{status: "deleting", want: SeverityWarning},
+		{status: "available", want: SeverityInfo},
+		{status: "creating", want: SeverityInfo},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.status, func(t *testing.T) {
+			assert.Equal(t, tt.want, classifySeverity(tt.status))
+		})
+	}
+}
+
+func TestHighestSeverity(t *testing.T) {
+	tests := []struct {
+		name    string
+		changes []SnapshotStatusChange
+		want    string
+	}{
+		{
+			name:    "defaults to info",
+			changes: []SnapshotStatusChange{},
+			want:    SeverityInfo,
+		},
+		{
+			name: "picks most severe",
+			changes: []SnapshotStatusChange{
+				{Severity: SeverityInfo},
+				{Severity: SeverityCritical},
+				{Severity: SeverityWarning},
+			},
+			want: SeverityCritical,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, highestSeverity(tt.changes))
+		})
+	}
+}
+
+func TestAssignSeverity(t *testing.T) {
+	rules := []types.SeverityRule{
+		{
+			Severity:     SeverityCritical,
+			ToStatus:     []string{"failed"},
+			CreationType: []string{"automated"},
+			Tags:         map[string]string{"env": "prod*"},
+		},
+		{
+			Severity:   SeverityInfo,
+			FromStatus: []string{"new"},
+			ToStatus:   []string{"available"},
+		},
+		{
+			Severity:   SeverityWarning,
+			Regions:    []string{"eu-west-1"},
+			Identifier: "reporting-*",
+		},
+	}
+
+	tests := []struct {
+		name   string
+		change SnapshotStatusChange
+		want   string
+	}{
+		{
+			name: "matches failed automated prod snapshot",
+			change: SnapshotStatusChange{CurrentStatus: "failed", CreationType: "automated",
+				Tags: map[string]string{"env": "production"}},
+			want: SeverityCritical,
+		},
+		{
+			name: "matches new available snapshot",
+			change: SnapshotStatusChange{CurrentStatus: "available", CreationType: "manual",
+				SnapshotType: "cluster"},
+			want: SeverityInfo,
+		},
+		{
+			name:   "matches identifier pattern in region",
+			change: SnapshotStatusChange{CurrentStatus: "failed", DBInstance: "reporting-db", Region: "eu-west-1"},
+			want:   SeverityWarning,
+		},
+		{
+			name:   "requires every field to match",
+			change: SnapshotStatusChange{CurrentStatus: "available", DBInstance: "reporting-db", Region: "us-east-1", PreviousStatus: "creating"},
+			want:   SeverityInfo,
+		},
+		{
+			name: "falls back to status based severity",
+			change: SnapshotStatusChange{CurrentStatus: "failed", CreationType: "automated",
+				Tags: map[string]string{"env": "dev"}},
+			want: SeverityCritical,
+		},
+		{
+			name:   "falls back when tag is missing",
+			change: SnapshotStatusChange{CurrentStatus: "deleting", CreationType: "automated"},
+			want:   SeverityWarning,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, assignSeverity(tt.change, rules))
+		})
+	}
+}
+
+func TestValidateSeverityRules(t *testing.T) {
+	tests := []struct {
+		name    string
+		rules   []types.SeverityRule
+		wantErr bool
+	}{
+		{name: "accepts valid rules", rules: []types.SeverityRule{{Severity: SeverityWarning, Identifier: "db-*"}}},
+		{name: "rejects unknown severity", rules: []types.SeverityRule{{Severity: "urgent"}}, wantErr: true},
+		{name: "rejects bad identifier glob", rules: []types.SeverityRule{{Severity: SeverityInfo, Identifier: "db-["}}, wantErr: true},
+		{name: "rejects bad tag glob", rules: []types.SeverityRule{{Severity: SeverityInfo, Tags: map[string]string{"env": "["}}}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateSeverityRules(tt.rules)
+			if tt.wantErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
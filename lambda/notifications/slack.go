@@ -0,0 +1,92 @@
+package notifications
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"rds-backup-monitor/lambda/types"
+)
+
+// HTTPClient sends the requests of webhook notifiers.
+type HTTPClient interface {
+	Do(req *http.Request) (*http.Response, error)
+}
+
+// SlackNotifier posts digests to a Slack incoming webhook. Messages use the SNS
+// channel templates, with the subject as the first line.
+type SlackNotifier struct {
+	webhookURL string
+	client     HTTPClient
+	templates  *TemplateSet
+	appConfig  types.Configuration
+}
+
+func NewSlackNotifier(webhookURL string, client HTTPClient, templates *TemplateSet, appConfig types.Configuration) *SlackNotifier {
+	return &SlackNotifier{
+		webhookURL: webhookURL,
+		client:     client,
+		templates:  templates,
+		appConfig:  appConfig,
+	}
+}
+
+// Destination identifies the webhook by a hash, the URL itself is a secret and
+// must not end up in logs.
+func (n *SlackNotifier) Destination() string {
+	sum := sha256.Sum256([]byte(n.webhookURL))
+	return "slack:" + hex.EncodeToString(sum[:6])
+}
+
+func (n *SlackNotifier) Notify(ctx context.Context, digest Digest) error {
+	rendered, err := n.templates.Render(ChannelSNS, newDigestTemplateData(digest, n.appConfig.AccountID, time.Now()))
+	if err != nil {
+		return err
+	}
+	return n.SendMessage(ctx, messageTypeChange, rendered)
+}
+
+func (n *SlackNotifier) messageSize(digest Digest) (int, error) {
+	rendered, err := n.templates.Render(ChannelSNS, newDigestTemplateData(digest, n.appConfig.AccountID, time.Now()))
+	if err != nil {
+		return 0, err
+	}
+	return len(rendered.Subject) + len(rendered.Text), nil
+}
+
+func (n *SlackNotifier) maxMessageSize() int {
+	return maxSlackMessageBytes
+}
+
+// SendMessage posts the plain-text rendering of a message.
+func (n *SlackNotifier) SendMessage(ctx context.Context, messageType string, message RenderedMessage) error {
+	payload, err := json.Marshal(map[string]string{
+		"text": "*" + message.Subject + "*\n" + message.Text,
+	})
+	if err != nil {
+		return fmt.Errorf("unable to marshal Slack message: %v", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, n.webhookURL, bytes.NewReader(payload))
+	if err != nil {
+		return fmt.Errorf("unable to create Slack request for %s: %v", n.Destination(), err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := n.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("unable to post %s to %s: %v", messageType, n.Destination(), err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("unable to post %s to %s: status %d: %s", messageType, n.Destination(), resp.StatusCode, body)
+	}
+	return nil
+}
@@ -0,0 +1,81 @@
+package notifications
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	"rds-backup-monitor/lambda/types"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type mockHTTPClient struct {
+	status   int
+	err      error
+	requests []*http.Request
+	bodies   []string
+}
+
+func (m *mockHTTPClient) Do(req *http.Request) (*http.Response, error) {
+	body, _ := io.ReadAll(req.Body)
+	m.requests = append(m.requests, req)
+	m.bodies = append(m.bodies, string(body))
+	if m.err != nil {
+		return nil, m.err
+	}
+	return &http.Response{
+		StatusCode: m.status,
+		Body:       io.NopCloser(strings.NewReader("invalid_payload")),
+	}, nil
+}
+
+func TestSlackNotifierNotify(t *testing.T) {
+	const webhookURL = "https://hooks.slack.com/services/T0/B0/secret"
+
+	tests := []struct {
+		name    string
+		client  *mockHTTPClient
+		wantErr bool
+	}{
+		{name: "posted", client: &mockHTTPClient{status: http.StatusOK}},
+		{name: "rejected", client: &mockHTTPClient{status: http.StatusBadRequest}, wantErr: true},
+		{name: "transport error", client: &mockHTTPClient{err: errors.New("timeout")}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			notifier := NewSlackNotifier(webhookURL, tt.client, DefaultTemplates(), types.Configuration{AccountID: "123456789012"})
+
+			err := notifier.Notify(context.Background(), Digest{Owner: "payments", Changes: []SnapshotStatusChange{
+				{SnapshotID: "snap-1", DBInstance: "orders", Region: "us-east-1", CurrentStatus: "failed", Owner: "payments"},
+			}})
+			if tt.wantErr {
+				assert.Error(t, err)
+				assert.NotContains(t, err.Error(), "secret", "webhook URL must not leak into errors")
+				return
+			}
+			require.NoError(t, err)
+
+			require.Len(t, tt.client.requests, 1)
+			assert.Equal(t, webhookURL, tt.client.requests[0].URL.String())
+			assert.Equal(t, "application/json", tt.client.requests[0].Header.Get("Content-Type"))
+
+			var payload map[string]string
+			require.NoError(t, json.Unmarshal([]byte(tt.client.bodies[0]), &payload))
+			assert.True(t, strings.HasPrefix(payload["text"], "*[payments] RDS Snapshot Status Update (1 changes)*\n"))
+			assert.Contains(t, payload["text"], "Databases owned by payments")
+			assert.Contains(t, payload["text"], "Snapshot: snap-1")
+		})
+	}
+}
+
+func TestSlackNotifierDestination(t *testing.T) {
+	notifier := NewSlackNotifier("https://hooks.slack.com/services/T0/B0/secret", nil, nil, types.Configuration{})
+	assert.Regexp(t, `^slack:[0-9a-f]{12}$`, notifier.Destination())
+}
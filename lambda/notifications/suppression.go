@@ -0,0 +1,153 @@
+package notifications
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"rds-backup-monitor/lambda/storage"
+	"rds-backup-monitor/lambda/suppression"
+	"rds-backup-monitor/lambda/types"
+)
+
+// heldIgnoredPrefix starts the IDs of held changes that matched an ignore
+// rule, which catch-up digests only count.
+const heldIgnoredPrefix = "ignored#"
+
+// holdChanges separates the changes covered by an open suppression window from
+// those to send now. A change covered by several windows is held by the first.
+func holdChanges(changes []SnapshotStatusChange, windows []suppression.Window, now time.Time) ([]SnapshotStatusChange, []storage.HeldChange, error) {
+	var active []suppression.Window
+	for _, window := range windows {
+		if window.Active(now) {
+			active = append(active, window)
+		}
+	}
+	if len(active) == 0 {
+		return changes, nil, nil
+	}
+
+	var send []SnapshotStatusChange
+	var held []storage.HeldChange
+
+	for _, change := range changes {
+		window, ok := coveringWindow(change, active)
+		if !ok {
+			send = append(send, change)
+			continue
+		}
+
+		payload, err := json.Marshal(change)
+		if err != nil {
+			return nil, nil, fmt.Errorf("unable to marshal held change of snapshot %s: %v", change.SnapshotID, err)
+		}
+		// Snapshots are identified as in the recorded states, so instance
+		// and cluster snapshots of the same name are held apart
+		snapshot := storage.SnapshotInfo{SnapshotID: change.SnapshotID, SnapshotArn: change.SnapshotArn}
+		held = append(held, storage.HeldChange{
+			Window: window.Name(),
+			// Every transition is kept, so a snapshot that changes several
+			// times during the window is reported with each of its statuses
+			ID:      change.Region + "#" + snapshot.Key() + "#" + change.CurrentStatus,
+			Payload: string(payload),
+		})
+	}
+
+	return send, held, nil
+}
+
+func coveringWindow(change SnapshotStatusChange, windows []suppression.Window) (suppression.Window, bool) {
+	identifiers := []string{change.DBInstance, change.SnapshotID}
+	for _, window := range windows {
+		if window.Covers(change.Region, identifiers, change.Tags) {
+			return window, true
+		}
+	}
+	return suppression.Window{}, false
+}
+
+// sendCatchUpDigests sends the changes held by every closed window as one
+// digest per window. The digest is recorded in the outbox like the digest of a
+// run, so every destination receives it once, and the held changes are
+// deleted once the entry is complete. A window whose catch-up digest is still
+// in the outbox, for example after a destination reached its message limit,
+// waits for that entry, so its changes are not sent twice.
+func sendCatchUpDigests(ctx context.Context, router *Router, windows []suppression.Window, now time.Time,
+	appConfig types.Configuration, states storage.StateStore, limits digestLimits) error {
+
+	var pending map[string]bool
+	for _, window := range windows {
+		if window.Active(now) {
+			continue
+		}
+
+		held, err := states.GetHeldChanges(ctx, window.Name())
+		if err != nil {
+			return err
+		}
+		if len(held) == 0 {
+			continue
+		}
+
+		if pending == nil {
+			if pending, err = pendingCatchUps(ctx, states); err != nil {
+				return err
+			}
+		}
+		if pending[window.Name()] {
+			fmt.Printf("The catch-up digest of window %s is still in the outbox, holding %d changes until it was sent\n",
+				window.Name(), len(held))
+			continue
+		}
+
+		record := outboxRecord{Digest: Digest{HeldBy: window.Name()}}
+		var ignored []SnapshotStatusChange
+		for _, item := range held {
+			var change SnapshotStatusChange
+			if err := json.Unmarshal([]byte(item.Payload), &change); err != nil {
+				return fmt.Errorf("unable to unmarshal change %s held by window %s: %v", item.ID, window.Name(), err)
+			}
+			if strings.HasPrefix(item.ID, heldIgnoredPrefix) {
+				ignored = append(ignored, change)
+			} else {
+				record.Digest.Changes = append(record.Digest.Changes, change)
+			}
+			// The record carries the changes, so only their keys are kept
+			record.Held = append(record.Held, storage.HeldChange{Window: item.Window, ID: item.ID})
+		}
+		record.Digest.IgnoredCounts = countIgnored(ignored)
+
+		fmt.Printf("Suppression window %s closed, sending %d held changes and %d ignored\n",
+			window.Name(), len(record.Digest.Changes), len(ignored))
+		entry, err := putOutboxRecord(ctx, states, record, now)
+		if err != nil {
+			return err
+		}
+		if err := completeOutboxEntry(ctx, router, entry, appConfig, states, limits); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// pendingCatchUps returns the windows whose catch-up digest is in the outbox.
+func pendingCatchUps(ctx context.Context, states storage.StateStore) (map[string]bool, error) {
+	entries, err := states.GetOutboxEntries(ctx)
+	if err != nil {
+		return nil, err
+	}
+	pending := make(map[string]bool)
+	for _, entry := range entries {
+		var record outboxRecord
+		if err := json.Unmarshal(entry.Payload, &record); err != nil {
+			return nil, fmt.Errorf("invalid outbox entry %s: %v", entry.ID, err)
+		}
+		if record.Digest.HeldBy != "" {
+			pending[record.Digest.HeldBy] = true
+		}
+	}
+	return pending, nil
+}
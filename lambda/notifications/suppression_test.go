@@ -0,0 +1,259 @@
+package notifications
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"rds-backup-monitor/lambda/storage"
+	"rds-backup-monitor/lambda/suppression"
+	"rds-backup-monitor/lambda/types"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sns"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Start expressions that always or never have fired, so tests do not depend
+// on the time they run at
+const (
+	cronEveryMinute = "* * * * *"
+	cronNever       = "0 0 31 2 *"
+)
+
+func mustWindows(t *testing.T, configs ...types.SuppressionWindow) []suppression.Window {
+	t.Helper()
+	windows, err := suppression.NewWindows(configs)
+	assert.NoError(t, err)
+	return windows
+}
+
+func TestHoldChanges(t *testing.T) {
+	changes := []SnapshotStatusChange{
+		{SnapshotID: "snap-1", DBInstance: "analytics-1", CurrentStatus: "failed", Region: "us-west-2"},
+		{SnapshotID: "snap-2", DBInstance: "orders", CurrentStatus: "failed", Region: "us-west-2"},
+	}
+
+	t.Run("holds changes in scope of an open window", func(t *testing.T) {
+		windows := mustWindows(t,
+			types.SuppressionWindow{Name: "closed", Start: cronNever, Stop: cronEveryMinute},
+			types.SuppressionWindow{Name: "analytics", Start: cronEveryMinute, Stop: cronNever, Identifiers: []string{"analytics-*"}},
+		)
+
+		send, held, err := holdChanges(changes, windows, time.Now())
+		assert.NoError(t, err)
+		assert.Equal(t, []SnapshotStatusChange{changes[1]}, send)
+		assert.Len(t, held, 1)
+		assert.Equal(t, "analytics", held[0].Window)
+		assert.Equal(t, "us-west-2#snap-1#failed", held[0].ID)
+
+		var payload SnapshotStatusChange
+		assert.NoError(t, json.Unmarshal([]byte(held[0].Payload), &payload))
+		assert.Equal(t, changes[0], payload)
+	})
+
+	t.Run("holds instance and cluster snapshots of the same name apart", func(t *testing.T) {
+		windows := mustWindows(t, types.SuppressionWindow{Name: "all", Start: cronEveryMinute, Stop: cronNever})
+		sameName := []SnapshotStatusChange{
+			{SnapshotID: "nightly", SnapshotArn: "arn:aws:rds:us-west-2:123456789012:snapshot:nightly",
+				DBInstance: "orders", CurrentStatus: "failed", Region: "us-west-2"},
+			{SnapshotID: "nightly", SnapshotArn: "arn:aws:rds:us-west-2:123456789012:cluster-snapshot:nightly",
+				DBInstance: "billing", CurrentStatus: "failed", Region: "us-west-2"},
+		}
+
+		_, held, err := holdChanges(sameName, windows, time.Now())
+		assert.NoError(t, err)
+		assert.Len(t, held, 2)
+		assert.Equal(t, "us-west-2#arn:aws:rds:us-west-2:123456789012:snapshot:nightly#failed", held[0].ID)
+		assert.Equal(t, "us-west-2#arn:aws:rds:us-west-2:123456789012:cluster-snapshot:nightly#failed", held[1].ID)
+	})
+
+	t.Run("sends everything without open windows", func(t *testing.T) {
+		windows := mustWindows(t, types.SuppressionWindow{Name: "closed", Start: cronNever, Stop: cronEveryMinute})
+
+		send, held, err := holdChanges(changes, windows, time.Now())
+		assert.NoError(t, err)
+		assert.Equal(t, changes, send)
+		assert.Empty(t, held)
+	})
+}
+
+func TestProcessSnapshotChanges_HoldsChangesDuringWindow(t *testing.T) {
+	appConfig := types.Configuration{
+		StatusesToMonitor: []string{"failed"},
+		SnapshotAgeDays:   7,
+		SNSTopicArn:       "arn:aws:sns:us-west-2:123456789012:topic",
+	}
+	results := []RegionResult{
+		{
+			Region:            "us-west-2",
+			Changes:           []SnapshotStatusChange{{SnapshotID: "snap-1", CurrentStatus: "failed", Region: "us-west-2"}},
+			SnapshotsToUpdate: []storage.SnapshotInfo{{SnapshotID: "snap-1", Status: "failed"}},
+			Ignored:           []SnapshotStatusChange{{SnapshotID: "snap-temp", CurrentStatus: "failed", Region: "us-west-2"}},
+		},
+		{
+			Region:            "eu-west-1",
+			Changes:           []SnapshotStatusChange{{SnapshotID: "snap-2", CurrentStatus: "failed", Region: "eu-west-1"}},
+			SnapshotsToUpdate: []storage.SnapshotInfo{{SnapshotID: "snap-2", Status: "failed"}},
+		},
+	}
+	windows := mustWindows(t, types.SuppressionWindow{
+		Name: "maintenance", Start: cronEveryMinute, Stop: cronNever, Regions: []string{"us-west-2"},
+	})
+
+	snsClient := &mockSNSClient{publishOutput: &sns.PublishOutput{}}
+	states := storage.NewMemoryStore()
+	router := NewSNSRouter(appConfig, DefaultTemplates(), snsClient)
+
+	err := ProcessSnapshotChanges(context.Background(), results, appConfig, router, NewMessageBudget(0), windows, states)
+	assert.NoError(t, err)
+
+	// Only the change outside the window is sent, but both states are recorded
+	assert.Equal(t, 1, snsClient.publishCount)
+	assert.Contains(t, aws.ToString(snsClient.lastInput.Message), "snap-2")
+	assert.NotContains(t, aws.ToString(snsClient.lastInput.Message), "snap-1")
+	assert.NotContains(t, aws.ToString(snsClient.lastInput.Message), "ignore rules", "the ignored change is held with snap-1")
+	for _, region := range []string{"us-west-2", "eu-west-1"} {
+		processed, err := states.GetProcessedSnapshots(context.Background(), region)
+		assert.NoError(t, err)
+		assert.Len(t, processed, 1)
+	}
+	// The changes in the window are held, and the sent digest left the outbox
+	held, err := states.GetHeldChanges(context.Background(), "maintenance")
+	assert.NoError(t, err)
+	assert.Len(t, held, 2)
+	entries, err := states.GetOutboxEntries(context.Background())
+	assert.NoError(t, err)
+	assert.Empty(t, entries)
+}
+
+// holdTestChanges stores critical changes of the snapshots ids as held by
+// the maintenance window, under their snapshot ID.
+func holdTestChanges(t *testing.T, states storage.StateStore, ids ...string) {
+	t.Helper()
+	var held []storage.HeldChange
+	for _, id := range ids {
+		payload, err := json.Marshal(SnapshotStatusChange{
+			SnapshotID: strings.TrimPrefix(id, heldIgnoredPrefix), DBInstance: "db-1",
+			CurrentStatus: "failed", Region: "us-west-2", Severity: SeverityCritical,
+		})
+		require.NoError(t, err)
+		held = append(held, storage.HeldChange{Window: "maintenance", ID: id, Payload: string(payload)})
+	}
+	require.NoError(t, states.PutHeldChanges(context.Background(), held))
+}
+
+func TestProcessSnapshotChanges_SendsCatchUpDigest(t *testing.T) {
+	ctx := context.Background()
+	appConfig := types.Configuration{
+		StatusesToMonitor: []string{"failed"},
+		SNSTopicArn:       "arn:aws:sns:us-west-2:123456789012:topic",
+	}
+	windows := mustWindows(t, types.SuppressionWindow{Name: "maintenance", Start: cronNever, Stop: cronEveryMinute})
+	states := storage.NewMemoryStore()
+	holdTestChanges(t, states, "snap-1")
+	snsClient := &mockSNSClient{publishOutput: &sns.PublishOutput{}}
+	router := NewSNSRouter(appConfig, DefaultTemplates(), snsClient)
+
+	err := ProcessSnapshotChanges(ctx, []RegionResult{{Region: "us-west-2"}}, appConfig, router, NewMessageBudget(0), windows, states)
+	assert.NoError(t, err)
+
+	assert.Equal(t, 1, snsClient.publishCount)
+	assert.Equal(t, "Catch-up: RDS Snapshot Status Update (1 changes)", aws.ToString(snsClient.lastInput.Subject))
+	assert.Contains(t, aws.ToString(snsClient.lastInput.Message), "Changes held back during suppression window maintenance")
+	assert.Contains(t, aws.ToString(snsClient.lastInput.Message), "Snapshot: snap-1")
+	assert.Equal(t, "critical", aws.ToString(snsClient.lastInput.MessageAttributes["severity"].StringValue))
+	assert.NotEmpty(t, aws.ToString(snsClient.lastInput.MessageAttributes["digestId"].StringValue))
+
+	// The held changes and the outbox entry are deleted once sent
+	held, err := states.GetHeldChanges(ctx, "maintenance")
+	require.NoError(t, err)
+	assert.Empty(t, held)
+	entries, err := states.GetOutboxEntries(ctx)
+	require.NoError(t, err)
+	assert.Empty(t, entries)
+}
+
+func TestProcessSnapshotChanges_CountsIgnoredInCatchUpDigest(t *testing.T) {
+	appConfig := types.Configuration{
+		StatusesToMonitor: []string{"failed"},
+		SNSTopicArn:       "arn:aws:sns:us-west-2:123456789012:topic",
+	}
+	windows := mustWindows(t, types.SuppressionWindow{Name: "maintenance", Start: cronNever, Stop: cronEveryMinute})
+	states := storage.NewMemoryStore()
+	holdTestChanges(t, states, "snap-1", heldIgnoredPrefix+"snap-temp")
+	snsClient := &mockSNSClient{publishOutput: &sns.PublishOutput{}}
+	router := NewSNSRouter(appConfig, DefaultTemplates(), snsClient)
+
+	err := ProcessSnapshotChanges(context.Background(), []RegionResult{{Region: "us-west-2"}}, appConfig, router, NewMessageBudget(0), windows, states)
+	assert.NoError(t, err)
+
+	assert.Equal(t, 1, snsClient.publishCount)
+	assert.Equal(t, "Catch-up: RDS Snapshot Status Update (1 changes, 1 ignored)", aws.ToString(snsClient.lastInput.Subject))
+	assert.Contains(t, aws.ToString(snsClient.lastInput.Message), "1 changes matched ignore rules and are not listed")
+	assert.NotContains(t, aws.ToString(snsClient.lastInput.Message), "snap-temp")
+}
+
+func TestSendCatchUpDigests(t *testing.T) {
+	ctx := context.Background()
+	appConfig := types.Configuration{StatusesToMonitor: []string{"failed"}}
+	windows := mustWindows(t, types.SuppressionWindow{Name: "maintenance", Start: cronNever, Stop: cronEveryMinute})
+	limitsOf := func(budget int) digestLimits {
+		return digestLimits{maxListed: DefaultMaxListedChanges, budget: NewMessageBudget(budget)}
+	}
+	assertHeld := func(t *testing.T, states storage.StateStore, changes, entries int) {
+		t.Helper()
+		held, err := states.GetHeldChanges(ctx, "maintenance")
+		require.NoError(t, err)
+		assert.Len(t, held, changes)
+		pending, err := states.GetOutboxEntries(ctx)
+		require.NoError(t, err)
+		assert.Len(t, pending, entries)
+	}
+
+	t.Run("sends the digest to each destination once", func(t *testing.T) {
+		states := storage.NewMemoryStore()
+		holdTestChanges(t, states, "snap-1")
+		email := &mockNotifier{destination: "email"}
+		pager := &mockNotifier{destination: "pager", err: fmt.Errorf("pager error")}
+		router := NewRouter([]Notifier{email}, map[string][]Notifier{SeverityCritical: {email, pager}})
+
+		assert.Error(t, sendCatchUpDigests(ctx, router, windows, time.Now(), appConfig, states, limitsOf(0)))
+		assert.Len(t, email.notified, 1)
+		assertHeld(t, states, 1, 1)
+
+		// The next run completes the entry, and the window waits for it
+		pager.err = nil
+		require.NoError(t, sendCatchUpDigests(ctx, router, windows, time.Now(), appConfig, states, limitsOf(0)))
+		assert.Len(t, email.notified, 1)
+		assert.Len(t, pager.notified, 1)
+		_, err := RelayOutbox(ctx, router, NewMessageBudget(0), appConfig, states, nil)
+		require.NoError(t, err)
+		assert.Len(t, email.notified, 1, "email received the digest before")
+		assert.Len(t, pager.notified, 2)
+		assertHeld(t, states, 0, 0)
+	})
+
+	t.Run("keeps the changes over the message limit", func(t *testing.T) {
+		states := storage.NewMemoryStore()
+		holdTestChanges(t, states, "snap-1")
+		topic := &mockNotifier{destination: "topic"}
+		router := NewRouter([]Notifier{topic}, nil)
+
+		// The run already sent its only message to the topic
+		limits := limitsOf(1)
+		limits.budget.spend("topic")
+		require.NoError(t, sendCatchUpDigests(ctx, router, windows, time.Now(), appConfig, states, limits))
+		assert.Empty(t, topic.notified)
+		assertHeld(t, states, 1, 1)
+
+		_, err := RelayOutbox(ctx, router, NewMessageBudget(1), appConfig, states, nil)
+		require.NoError(t, err)
+		assert.Len(t, topic.notified, 1)
+		assertHeld(t, states, 0, 0)
+	})
+}
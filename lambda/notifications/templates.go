@@ -0,0 +1,405 @@
+package notifications
+
+import (
+	"bytes"
+	"embed"
+	"errors"
+	"fmt"
+	htmltemplate "html/template"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	texttemplate "text/template"
+	"time"
+	"unicode"
+
+	"rds-backup-monitor/lambda/reports"
+)
+
+const (
+	// ChannelSNS is the template channel used for SNS publishes.
+	ChannelSNS = "sns"
+	// ChannelReport is the template channel used for summary reports. Its
+	// templates receive a reports.Report instead of TemplateData.
+	ChannelReport = "report"
+	// ChannelReminder is the template channel used for escalation reminders.
+	// Its templates receive ReminderData.
+	ChannelReminder = "reminder"
+	// ChannelScanFailure is the template channel used for regions that could
+	// not be monitored. Its templates receive ScanFailureData.
+	ChannelScanFailure = "scan-failure"
+)
+
+// maxSubjectLength keeps subjects below the SNS limit of 100 characters.
+const maxSubjectLength = 99
+
+// templateChannels lists every channel that needs a template set, with the
+// sample data used to validate it.
+var templateChannels = map[string]func() any{
+	ChannelSNS:         func() any { return sampleTemplateData() },
+	ChannelReport:      func() any { return reports.SampleReport() },
+	ChannelReminder:    func() any { return sampleReminderData() },
+	ChannelScanFailure: func() any { return sampleScanFailureData() },
+}
+
+//go:embed templates/*.tmpl
+var defaultTemplateFS embed.FS
+
+// TemplateData is the value passed to every notification template.
+type TemplateData struct {
+	Run     RunMetadata
+	Changes []SnapshotStatusChange
+	Regions []RegionChanges
+	// Recoveries are the changes that ended a backup outage.
+	Recoveries []SnapshotStatusChange
+	// Summary counts the changes that are not listed.
+	Summary []ChangeGroup
+}
+
+// RunMetadata describes the monitor run that produced the changes.
+type RunMetadata struct {
+	Account        string
+	ObservedAt     time.Time
+	ChangeCount    int
+	RecoveredCount int
+	// SummarizedCount is the number of changes in Summary; ChangeCount
+	// includes them.
+	SummarizedCount int
+	// Part and Parts number the messages of a split digest.
+	Part  int
+	Parts int
+	// IgnoredCount is the number of changes that matched an ignore rule and
+	// would have been sent with the digest.
+	IgnoredCount int
+	// HeldBy names the suppression window of a catch-up digest.
+	HeldBy string
+	// Owner names the owner of an owner-routed digest.
+	Owner string
+}
+
+type RegionChanges struct {
+	Region  string
+	Changes []SnapshotStatusChange
+}
+
+// RenderedMessage holds the output of a channel's templates. HTML is empty when
+// the channel has no HTML body template.
+type RenderedMessage struct {
+	Subject string
+	Text    string
+	HTML    string
+}
+
+type channelTemplates struct {
+	subject *texttemplate.Template
+	text    *texttemplate.Template
+	html    *htmltemplate.Template
+}
+
+// TemplateSet holds the subject and body templates for every channel.
+type TemplateSet struct {
+	channels   map[string]*channelTemplates
+	linkSigner LinkSigner
+}
+
+// ActionLinks are signed links that acknowledge or snooze notifications about
+// a database. Both are empty when no link signer is configured.
+type ActionLinks struct {
+	Ack    string
+	Snooze string
+}
+
+// LinkSigner creates the action links of a database.
+type LinkSigner interface {
+	Links(region, databaseType, databaseID string) ActionLinks
+}
+
+// SetLinkSigner makes the actionLinks template function return links signed
+// by signer.
+func (s *TemplateSet) SetLinkSigner(signer LinkSigner) {
+	s.linkSigner = signer
+}
+
+// funcs returns the template functions of the set, which add the set-specific
+// actionLinks to templateFuncs.
+func (s *TemplateSet) funcs() map[string]any {
+	funcs := map[string]any{
+		"actionLinks": func(region, databaseType, databaseID string) ActionLinks {
+			if s.linkSigner == nil {
+				return ActionLinks{}
+			}
+			return s.linkSigner.Links(region, databaseType, databaseID)
+		},
+	}
+	for name, fn := range templateFuncs {
+		funcs[name] = fn
+	}
+	return funcs
+}
+
+var templateFuncs = map[string]any{
+	"statusTransition": statusTransition,
+	"formatTime": func(t time.Time) string {
+		return t.UTC().Format(time.RFC3339)
+	},
+	"formatDuration": formatDuration,
+	"upper":          strings.ToUpper,
+	"signed": func(n int64) string {
+		return fmt.Sprintf("%+d", n)
+	},
+}
+
+// LoadTemplates parses the templates for every channel. Files in dir named
+// <channel>.subject.tmpl, <channel>.body.tmpl and <channel>.body.html.tmpl
+// replace the built-in defaults; an empty dir uses the defaults only. Every
+// channel is rendered against sample data so broken templates fail at startup.
+func LoadTemplates(dir string) (*TemplateSet, error) {
+	set := &TemplateSet{channels: make(map[string]*channelTemplates)}
+	funcs := set.funcs()
+
+	for channel := range templateChannels {
+		templates := &channelTemplates{}
+
+		subject, err := readTemplate(dir, channel+".subject.tmpl")
+		if err != nil {
+			return nil, err
+		}
+		templates.subject, err = texttemplate.New(channel + ".subject").Funcs(funcs).Parse(subject)
+		if err != nil {
+			return nil, fmt.Errorf("unable to parse subject template for channel %s: %v", channel, err)
+		}
+
+		body, err := readTemplate(dir, channel+".body.tmpl")
+		if err != nil {
+			return nil, err
+		}
+		templates.text, err = texttemplate.New(channel + ".body").Funcs(funcs).Parse(body)
+		if err != nil {
+			return nil, fmt.Errorf("unable to parse body template for channel %s: %v", channel, err)
+		}
+
+		htmlBody, err := readTemplate(dir, channel+".body.html.tmpl")
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return nil, err
+		}
+		if err == nil {
+			templates.html, err = htmltemplate.New(channel + ".body.html").Funcs(funcs).Parse(htmlBody)
+			if err != nil {
+				return nil, fmt.Errorf("unable to parse HTML body template for channel %s: %v", channel, err)
+			}
+		}
+
+		set.channels[channel] = templates
+	}
+
+	for channel, sample := range templateChannels {
+		if _, err := set.Render(channel, sample()); err != nil {
+			return nil, fmt.Errorf("template validation failed: %v", err)
+		}
+	}
+
+	return set, nil
+}
+
+// DefaultTemplates returns the built-in templates.
+func DefaultTemplates() *TemplateSet {
+	set, err := LoadTemplates("")
+	if err != nil {
+		panic(fmt.Sprintf("invalid built-in templates: %v", err))
+	}
+	return set
+}
+
+// readTemplate returns the operator supplied template from dir, falling back to
+// the embedded default when dir does not contain it.
+func readTemplate(dir, name string) (string, error) {
+	if dir != "" {
+		content, err := os.ReadFile(filepath.Join(dir, name))
+		if err == nil {
+			return string(content), nil
+		}
+		if !errors.Is(err, fs.ErrNotExist) {
+			return "", fmt.Errorf("unable to read template %s: %v", name, err)
+		}
+	}
+
+	content, err := defaultTemplateFS.ReadFile("templates/" + name)
+	if err != nil {
+		return "", err
+	}
+	return string(content), nil
+}
+
+// Render executes the templates of channel against data.
+func (s *TemplateSet) Render(channel string, data any) (RenderedMessage, error) {
+	templates, ok := s.channels[channel]
+	if !ok {
+		return RenderedMessage{}, fmt.Errorf("no templates for channel %s", channel)
+	}
+
+	var rendered RenderedMessage
+	var buf bytes.Buffer
+
+	if err := templates.subject.Execute(&buf, data); err != nil {
+		return RenderedMessage{}, fmt.Errorf("unable to render subject for channel %s: %v", channel, err)
+	}
+	rendered.Subject = sanitizeSubject(buf.String())
+
+	buf.Reset()
+	if err := templates.text.Execute(&buf, data); err != nil {
+		return RenderedMessage{}, fmt.Errorf("unable to render body for channel %s: %v", channel, err)
+	}
+	rendered.Text = buf.String()
+
+	if templates.html != nil {
+		buf.Reset()
+		if err := templates.html.Execute(&buf, data); err != nil {
+			return RenderedMessage{}, fmt.Errorf("unable to render HTML body for channel %s: %v", channel, err)
+		}
+		rendered.HTML = buf.String()
+	}
+
+	return rendered, nil
+}
+
+// newDigestTemplateData returns the template data of digest.
+func newDigestTemplateData(digest Digest, account string, observedAt time.Time) TemplateData {
+	data := newTemplateData(digest.Changes, RunMetadata{
+		Account:      account,
+		ObservedAt:   observedAt,
+		HeldBy:       digest.HeldBy,
+		Owner:        digest.Owner,
+		Part:         digest.Part,
+		Parts:        digest.Parts,
+		IgnoredCount: digest.Ignored,
+	})
+	if len(digest.Summarized) > 0 {
+		data.Summary = summarize(digest.Summarized)
+		data.Run.SummarizedCount = len(digest.Summarized)
+		data.Run.ChangeCount += len(digest.Summarized)
+	}
+	return data
+}
+
+// newTemplateData sorts changes and groups them into per-region sections.
+func newTemplateData(changes []SnapshotStatusChange, run RunMetadata) TemplateData {
+	changes = sortChanges(changes)
+
+	var regions []RegionChanges
+	regionIndex := make(map[string]int)
+	for _, change := range changes {
+		i, ok := regionIndex[change.Region]
+		if !ok {
+			i = len(regions)
+			regionIndex[change.Region] = i
+			regions = append(regions, RegionChanges{Region: change.Region})
+		}
+		regions[i].Changes = append(regions[i].Changes, change)
+	}
+
+	recovered := recoveries(changes)
+	run.ChangeCount = len(changes)
+	run.RecoveredCount = len(recovered)
+	return TemplateData{
+		Run:        run,
+		Changes:    changes,
+		Regions:    regions,
+		Recoveries: recovered,
+	}
+}
+
+func sampleTemplateData() TemplateData {
+	now := time.Now()
+	changes := []SnapshotStatusChange{
+		{
+			SnapshotID:     "rds:sample-db-2024-01-01-00-00",
+			SnapshotArn:    "arn:aws:rds:us-east-1:123456789012:snapshot:rds:sample-db-2024-01-01-00-00",
+			SnapshotType:   "instance",
+			CreationType:   "automated",
+			CurrentStatus:  "failed",
+			PreviousStatus: "creating",
+			DBInstance:     "sample-db",
+			Region:         "us-east-1",
+			Severity:       SeverityCritical,
+			CreateTime:     now,
+		},
+		{
+			SnapshotID:    "sample-cluster-manual",
+			SnapshotType:  "cluster",
+			CreationType:  "manual",
+			CurrentStatus: "available",
+			DBInstance:    "sample-cluster",
+			Region:        "us-west-2",
+			Severity:      SeverityInfo,
+			CreateTime:    now,
+			Recovery: &Recovery{
+				FailedSnapshotID: "rds:sample-cluster-2024-01-01-00-00",
+				Since:            now.Add(-26 * time.Hour),
+				Duration:         26 * time.Hour,
+			},
+		},
+	}
+	summarized := []SnapshotStatusChange{
+		{
+			SnapshotID:    "rds:sample-db-2023-12-31-00-00",
+			SnapshotType:  "instance",
+			CreationType:  "automated",
+			CurrentStatus: "available",
+			DBInstance:    "sample-db",
+			Region:        "us-east-1",
+			Severity:      SeverityInfo,
+			CreateTime:    now.Add(-24 * time.Hour),
+		},
+	}
+	return newDigestTemplateData(Digest{Changes: changes, Summarized: summarized, Part: 1, Parts: 2, Ignored: 3}, "123456789012", now)
+}
+
+// sortChanges returns a copy of changes ordered by region, DB identifier and
+// snapshot identifier so that rendered messages are deterministic.
+func sortChanges(changes []SnapshotStatusChange) []SnapshotStatusChange {
+	sorted := make([]SnapshotStatusChange, len(changes))
+	copy(sorted, changes)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		if sorted[i].Region != sorted[j].Region {
+			return sorted[i].Region < sorted[j].Region
+		}
+		if sorted[i].DBInstance != sorted[j].DBInstance {
+			return sorted[i].DBInstance < sorted[j].DBInstance
+		}
+		return sorted[i].SnapshotID < sorted[j].SnapshotID
+	})
+	return sorted
+}
+
+func statusTransition(change SnapshotStatusChange) string {
+	if change.PreviousStatus == "" {
+		return fmt.Sprintf("New snapshot - Status: %s", change.CurrentStatus)
+	}
+	return fmt.Sprintf("Status changed from %s to %s", change.PreviousStatus, change.CurrentStatus)
+}
+
+// formatDuration renders d rounded to the minute, e.g. 26h5m.
+func formatDuration(d time.Duration) string {
+	d = d.Round(time.Minute)
+	if d < time.Minute {
+		return "less than a minute"
+	}
+	return strings.TrimSuffix(d.String(), "0s")
+}
+
+// sanitizeSubject makes a rendered subject acceptable to SNS: a single line of
+// printable ASCII shorter than 100 characters.
+func sanitizeSubject(subject string) string {
+	subject = strings.Map(func(r rune) rune {
+		if r > unicode.MaxASCII {
+			return '?'
+		}
+		return r
+	}, strings.Join(strings.Fields(subject), " "))
+	if len(subject) > maxSubjectLength {
+		subject = subject[:maxSubjectLength-3] + "..."
+	}
+	return subject
+}
@@ -0,0 +1,254 @@
+package notifications
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLoadTemplates(t *testing.T) {
+	tests := []struct {
+		name        string
+		files       map[string]string
+		wantErr     bool
+		wantSubject string
+		wantText    string
+		wantHTML    string
+	}{
+		{
+			name:        "falls back to defaults",
+			files:       map[string]string{},
+			wantSubject: "RDS Snapshot Status Update (1 changes)",
+			wantText:    "RDS Snapshot Status Update Summary (1 changes)\n\n",
+		},
+		{
+			name: "overrides subject and body",
+			files: map[string]string{
+				"sns.subject.tmpl": "[{{.Run.Account}}] {{len .Changes}} snapshot changes",
+				"sns.body.tmpl":    "{{range .Changes}}{{.SnapshotID}} {{upper .CurrentStatus}}\n{{end}}",
+			},
+			wantSubject: "[123456789012] 1 snapshot changes",
+			wantText:    "snap-1 FAILED\n",
+		},
+		{
+			name: "renders HTML body with escaping",
+			files: map[string]string{
+				"sns.body.html.tmpl": "<ul>{{range .Changes}}<li>{{.DBInstance}}</li>{{end}}</ul>",
+			},
+			wantSubject: "RDS Snapshot Status Update (1 changes)",
+			wantText:    "RDS Snapshot Status Update Summary (1 changes)\n\n",
+			wantHTML:    "<ul><li>db-1&lt;prod&gt;</li></ul>",
+		},
+		{
+			name: "rejects unparsable template",
+			files: map[string]string{
+				"sns.body.tmpl": "{{range .Changes}",
+			},
+			wantErr: true,
+		},
+		{
+			name: "rejects template that fails against sample data",
+			files: map[string]string{
+				"sns.subject.tmpl": "{{.Run.Missing}}",
+			},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			for name, content := range tt.files {
+				assert.NoError(t, os.WriteFile(filepath.Join(dir, name), []byte(content), 0o600))
+			}
+
+			set, err := LoadTemplates(dir)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+
+			rendered, err := set.Render(ChannelSNS, newTemplateData([]SnapshotStatusChange{
+				{SnapshotID: "snap-1", CurrentStatus: "failed", DBInstance: "db-1<prod>", Region: "us-west-2"},
+			}, RunMetadata{Account: "123456789012", ObservedAt: time.Now()}))
+			assert.NoError(t, err)
+			assert.Equal(t, tt.wantSubject, rendered.Subject)
+			assert.True(t, strings.HasPrefix(rendered.Text, tt.wantText))
+			assert.Equal(t, tt.wantHTML, rendered.HTML)
+		})
+	}
+}
+
+func TestTemplateSetRender_UnknownChannel(t *testing.T) {
+	_, err := DefaultTemplates().Render("pager", sampleTemplateData())
+	assert.Error(t, err)
+}
+
+type staticLinkSigner struct{}
+
+func (staticLinkSigner) Links(region, databaseType, databaseID string) ActionLinks {
+	base := "https://example.com/%s?db=" + region + "/" + databaseType + "/" + databaseID
+	return ActionLinks{Ack: strings.Replace(base, "%s", "ack", 1), Snooze: strings.Replace(base, "%s", "snooze", 1)}
+}
+
+func TestTemplateSetRender_SNSText(t *testing.T) {
+	tests := []struct {
+		name    string
+		changes []SnapshotStatusChange
+		want    string
+	}{
+		{
+			name: "formats single status change",
+			changes: []SnapshotStatusChange{
+				{
+					SnapshotID:     "snap-1",
+					CurrentStatus:  "available",
+					PreviousStatus: "creating",
+					DBInstance:     "db-1",
+					Region:         "us-west-2",
+				},
+			},
+			want: "RDS Snapshot Status Update Summary (1 changes)\n\n" +
+				"Region: us-west-2\n" +
+				"----------------------------------------\n" +
+				"Snapshot: snap-1\n" +
+				"DB Instance: db-1\n" +
+				"Status: Status changed from creating to available\n\n",
+		},
+		{
+			name: "formats multiple status changes",
+			changes: []SnapshotStatusChange{
+				{
+					SnapshotID:     "snap-1",
+					CurrentStatus:  "available",
+					PreviousStatus: "creating",
+					DBInstance:     "db-1",
+					Region:         "us-west-2",
+				},
+				{
+					SnapshotID:     "snap-2",
+					CurrentStatus:  "error",
+					PreviousStatus: "available",
+					DBInstance:     "db-2",
+					Region:         "us-west-2",
+				},
+			},
+			want: "RDS Snapshot Status Update Summary (2 changes)\n\n" +
+				"Region: us-west-2\n" +
+				"----------------------------------------\n" +
+				"Snapshot: snap-1\n" +
+				"DB Instance: db-1\n" +
+				"Status: Status changed from creating to available\n\n" +
+				"Snapshot: snap-2\n" +
+				"DB Instance: db-2\n" +
+				"Status: Status changed from available to error\n\n",
+		},
+		{
+			name: "sorts regions and snapshots",
+			changes: []SnapshotStatusChange{
+				{
+					SnapshotID:    "snap-2",
+					CurrentStatus: "available",
+					DBInstance:    "db-2",
+					Region:        "us-west-2",
+				},
+				{
+					SnapshotID:    "snap-3",
+					CurrentStatus: "failed",
+					DBInstance:    "db-3",
+					Region:        "eu-west-1",
+				},
+				{
+					SnapshotID:    "snap-1",
+					CurrentStatus: "available",
+					DBInstance:    "db-1",
+					Region:        "us-west-2",
+				},
+			},
+			want: "RDS Snapshot Status Update Summary (3 changes)\n\n" +
+				"Region: eu-west-1\n" +
+				"----------------------------------------\n" +
+				"Snapshot: snap-3\n" +
+				"DB Instance: db-3\n" +
+				"Status: New snapshot - Status: failed\n\n" +
+				"Region: us-west-2\n" +
+				"----------------------------------------\n" +
+				"Snapshot: snap-1\n" +
+				"DB Instance: db-1\n" +
+				"Status: New snapshot - Status: available\n\n" +
+				"Snapshot: snap-2\n" +
+				"DB Instance: db-2\n" +
+				"Status: New snapshot - Status: available\n\n",
+		},
+		{
+			name:    "handles empty changes",
+			changes: []SnapshotStatusChange{},
+			want:    "RDS Snapshot Status Update Summary (0 changes)\n\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rendered, err := DefaultTemplates().Render(ChannelSNS, newDigestTemplateData(Digest{Changes: tt.changes}, "", time.Time{}))
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, rendered.Text)
+		})
+	}
+}
+
+func TestTemplateSetRender_ActionLinks(t *testing.T) {
+	changes := []SnapshotStatusChange{
+		{SnapshotID: "snap-1", SnapshotType: "instance", DBInstance: "db-1", CurrentStatus: "failed", Region: "us-east-1"},
+	}
+
+	withoutLinks, err := DefaultTemplates().Render(ChannelSNS, newTemplateData(changes, RunMetadata{}))
+	assert.NoError(t, err)
+	assert.NotContains(t, withoutLinks.Text, "Acknowledge")
+
+	set := DefaultTemplates()
+	set.SetLinkSigner(staticLinkSigner{})
+	rendered, err := set.Render(ChannelSNS, newTemplateData(changes, RunMetadata{}))
+	assert.NoError(t, err)
+	assert.Contains(t, rendered.Text, "Status: failed\nAcknowledge: https://example.com/ack?db=us-east-1/instance/db-1\n"+
+		"Snooze: https://example.com/snooze?db=us-east-1/instance/db-1\n\n")
+}
+
+func TestTemplateSetRender_Recovery(t *testing.T) {
+	since := time.Date(2024, 11, 19, 6, 0, 0, 0, time.UTC)
+	changes := []SnapshotStatusChange{
+		{SnapshotID: "snap-1", SnapshotType: "instance", DBInstance: "db-1", CurrentStatus: "failed", Region: "us-east-1"},
+		{SnapshotID: "snap-2", SnapshotType: "cluster", DBInstance: "db-2", PreviousStatus: "creating", CurrentStatus: "available",
+			Region: "us-east-1", Recovery: &Recovery{FailedSnapshotID: "snap-0", Since: since, Duration: 26*time.Hour + 30*time.Minute}},
+	}
+
+	rendered, err := DefaultTemplates().Render(ChannelSNS, newTemplateData(changes, RunMetadata{}))
+	assert.NoError(t, err)
+	assert.Equal(t, "RDS Snapshot Status Update (2 changes, 1 recovered)", rendered.Subject)
+	assert.Contains(t, rendered.Text, "Recovered databases\n----------------------------------------\n"+
+		"us-east-1 cluster db-2: backups recovered after 26h30m\n\n")
+	assert.Contains(t, rendered.Text, "Status: Status changed from creating to available\n"+
+		"Recovered: backups failed since 2024-11-19T06:00:00Z (snapshot snap-0), outage 26h30m\n")
+}
+
+func TestSanitizeSubject(t *testing.T) {
+	tests := []struct {
+		name    string
+		subject string
+		want    string
+	}{
+		{name: "collapses line breaks", subject: "RDS\nsnapshot\t update ", want: "RDS snapshot update"},
+		{name: "replaces non-ASCII", subject: "Backup ✓", want: "Backup ?"},
+		{name: "truncates long subjects", subject: strings.Repeat("a", 150), want: strings.Repeat("a", 96) + "..."},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, sanitizeSubject(tt.subject))
+		})
+	}
+}
@@ -1,9 +1,105 @@
 package notifications
 
+import (
+	"time"
+
+	"rds-backup-monitor/lambda/storage"
+)
+
 type SnapshotStatusChange struct {
 	SnapshotID     string
+	SnapshotArn    string
+	SnapshotType   string
+	CreationType   string
 	CurrentStatus  string
 	PreviousStatus string
 	DBInstance     string
 	Region         string
+	Severity       string
+	CreateTime     time.Time
+	Tags           map[string]string
+	// Owner is the owner tag of the source database, empty when it has none.
+	Owner string
+	// Recovery is set on the change that ended a backup outage of the source
+	// database.
+	Recovery *Recovery
+}
+
+// Recovery describes a backup outage of a database that ended with an
+// available snapshot.
+type Recovery struct {
+	// FailedSnapshotID is the first failed snapshot of the outage.
+	FailedSnapshotID string
+	// Since is the creation time of FailedSnapshotID.
+	Since time.Time
+	// Duration runs until the creation of the available snapshot.
+	Duration time.Duration
+}
+
+// RegionResult holds the changes detected while scanning a single region.
+type RegionResult struct {
+	Region            string
+	Changes           []SnapshotStatusChange
+	SnapshotsToUpdate []storage.SnapshotInfo
+	// SnapshotsToRenew are stored with their recorded status, to keep their
+	// state while they are listed.
+	SnapshotsToRenew []storage.SnapshotInfo
+	// RecoveredAcknowledgements are deleted once the changes were sent.
+	RecoveredAcknowledgements []storage.Acknowledgement
+	// HealthUpdates and RecoveredHealth are the database health records to
+	// store and delete once the changes were sent.
+	HealthUpdates   []storage.DatabaseHealth
+	RecoveredHealth []storage.DatabaseHealth
+	// Ignored are the changes dropped by ignore rules. Only their number is
+	// sent, so they are left out of the results recorded in the outbox.
+	Ignored []SnapshotStatusChange `json:"-"`
+	// Transitions are appended to the history with the snapshot states. They
+	// are stamped when detected, so storing them again writes the same
+	// records.
+	Transitions []storage.Transition
+}
+
+// Digest is the set of changes sent to a notifier in a single message.
+type Digest struct {
+	Changes []SnapshotStatusChange
+	// HeldBy names the suppression window that held the changes back. It is
+	// empty for regular digests and set for catch-up digests.
+	HeldBy string
+	// Owner names the owner whose routing table entry the digest is sent to.
+	// It is empty for digests sent to the default routes.
+	Owner string
+	// Summarized are changes that are only counted, not listed, because the
+	// digest lists too many changes already.
+	Summarized []SnapshotStatusChange
+	// Part and Parts number the messages of a digest that was split; both are
+	// zero for a digest sent as a single message.
+	Part  int
+	Parts int
+	// IgnoredCounts count the changes that matched an ignore rule by owner and
+	// severity. Route counts each delivery the ignored changes that would
+	// have been routed to it in Ignored, so recipients know that changes were
+	// left out.
+	IgnoredCounts []IgnoredCount
+	Ignored       int
+	// ID identifies the digest across retries, so subscribers can drop a
+	// digest they received before.
+	ID string
+}
+
+// IgnoredCount is the number of ignored changes of an owner and severity,
+// which decide where the changes would have been routed.
+type IgnoredCount struct {
+	Owner    string
+	Severity string
+	Count    int
+}
+
+// allChanges returns the listed and the summarized changes of the digest.
+func (d Digest) allChanges() []SnapshotStatusChange {
+	if len(d.Summarized) == 0 {
+		return d.Changes
+	}
+	changes := make([]SnapshotStatusChange, 0, len(d.Changes)+len(d.Summarized))
+	changes = append(changes, d.Changes...)
+	return append(changes, d.Summarized...)
 }
@@ -0,0 +1,218 @@
+package opsitems
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"rds-backup-monitor/lambda/escalation"
+	"rds-backup-monitor/lambda/storage"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ssm"
+	ssmTypes "github.com/aws/aws-sdk-go-v2/service/ssm/types"
+)
+
+type SSMClient interface {
+	CreateOpsItem(ctx context.Context, params *ssm.CreateOpsItemInput, optFns ...func(*ssm.Options)) (*ssm.CreateOpsItemOutput, error)
+	UpdateOpsItem(ctx context.Context, params *ssm.UpdateOpsItemInput, optFns ...func(*ssm.Options)) (*ssm.UpdateOpsItemOutput, error)
+}
+
+const (
+	// source is the OpsItem source of the monitor.
+	source = "rds-backup-monitor"
+	// category and severity of every OpsItem; severity 2 is High.
+	category = "Recovery"
+	severity = "2"
+	// maxRelatedSnapshots limits the snapshots attached to an OpsItem, the
+	// value of an operational data key may not exceed 20 KB.
+	maxRelatedSnapshots = 10
+)
+
+// relatedSnapshot is a snapshot attached to an OpsItem.
+type relatedSnapshot struct {
+	SnapshotID string `json:"snapshotId"`
+	Arn        string `json:"arn"`
+	Status     string `json:"status"`
+	CreatedAt  string `json:"createdAt"`
+}
+
+// Sync opens one OpsItem per database of problems and resolves the OpsItems
+// of databases that recovered. OpsItems are deduplicated by the ARN of the
+// database, both by the stored records and by the OpsCenter dedup string.
+// The operational data of an open OpsItem is updated when a newer snapshot of
+// the database is found. The stored OpsItem records are only updated once
+// OpsCenter accepted the change.
+func Sync(ctx context.Context, client SSMClient, store storage.OpsItemStore, region string,
+	problems []escalation.Problem, snapshots []storage.SnapshotInfo, now time.Time) error {
+
+	records, err := store.GetOpsItemRecords(ctx, region)
+	if err != nil {
+		return err
+	}
+
+	var updates []storage.OpsItemRecord
+	current := make(map[string]bool)
+
+	for _, problem := range problems {
+		if problem.DatabaseArn == "" {
+			continue
+		}
+		current[problem.DatabaseArn] = true
+
+		record, ok := records[problem.DatabaseArn]
+		if ok && record.Problem == problem.Kind && record.SnapshotID == problem.SnapshotID {
+			continue
+		}
+
+		operationalData, err := newOperationalData(problem, snapshots)
+		if err != nil {
+			return err
+		}
+
+		if !ok {
+			output, err := client.CreateOpsItem(ctx, &ssm.CreateOpsItemInput{
+				Source:          aws.String(source),
+				Category:        aws.String(category),
+				Severity:        aws.String(severity),
+				Title:           aws.String(title(problem)),
+				Description:     aws.String(description(problem)),
+				OperationalData: operationalData,
+			})
+			opsItemID, err := createdOpsItemID(output, err)
+			if err != nil {
+				return fmt.Errorf("unable to create OpsItem for %s: %v", problem.DatabaseArn, err)
+			}
+			fmt.Printf("Created OpsItem %s for DB %s %s in region %s\n",
+				opsItemID, problem.DatabaseType, problem.DatabaseID, region)
+
+			record = storage.OpsItemRecord{
+				Region:      region,
+				ResourceArn: problem.DatabaseArn,
+				OpsItemID:   opsItemID,
+				CreatedAt:   now,
+			}
+		} else {
+			_, err := client.UpdateOpsItem(ctx, &ssm.UpdateOpsItemInput{
+				OpsItemId:       aws.String(record.OpsItemID),
+				Title:           aws.String(title(problem)),
+				Description:     aws.String(description(problem)),
+				OperationalData: operationalData,
+			})
+			if err != nil {
+				return fmt.Errorf("unable to update OpsItem %s: %v", record.OpsItemID, err)
+			}
+		}
+
+		record.Problem = problem.Kind
+		record.SnapshotID = problem.SnapshotID
+		updates = append(updates, record)
+	}
+
+	var resolved []storage.OpsItemRecord
+	for arn, record := range records {
+		if current[arn] {
+			continue
+		}
+		_, err := client.UpdateOpsItem(ctx, &ssm.UpdateOpsItemInput{
+			OpsItemId: aws.String(record.OpsItemID),
+			Status:    ssmTypes.OpsItemStatusResolved,
+		})
+		if err != nil {
+			return fmt.Errorf("unable to resolve OpsItem %s: %v", record.OpsItemID, err)
+		}
+		fmt.Printf("Resolved OpsItem %s of %s\n", record.OpsItemID, arn)
+		resolved = append(resolved, record)
+	}
+
+	if err := store.PutOpsItemRecords(ctx, updates); err != nil {
+		return err
+	}
+	return store.DeleteOpsItemRecords(ctx, resolved)
+}
+
+// createdOpsItemID returns the ID of the OpsItem created by CreateOpsItem. An
+// open OpsItem with the same dedup string, left behind when its record could
+// not be stored, is adopted instead of failing.
+func createdOpsItemID(output *ssm.CreateOpsItemOutput, err error) (string, error) {
+	var exists *ssmTypes.OpsItemAlreadyExistsException
+	if errors.As(err, &exists) && aws.ToString(exists.OpsItemId) != "" {
+		return aws.ToString(exists.OpsItemId), nil
+	}
+	if err != nil {
+		return "", err
+	}
+	return aws.ToString(output.OpsItemId), nil
+}
+
+// newOperationalData returns the operational data of the OpsItem of problem.
+// The resource and dedup keys are the ones OpsCenter reserves for them.
+func newOperationalData(problem escalation.Problem, snapshots []storage.SnapshotInfo) (map[string]ssmTypes.OpsItemDataValue, error) {
+	resources, err := json.Marshal([]map[string]string{{"arn": problem.DatabaseArn}})
+	if err != nil {
+		return nil, fmt.Errorf("unable to marshal OpsItem resources: %v", err)
+	}
+	dedup, err := json.Marshal(map[string]string{"dedupString": source + "/" + problem.DatabaseArn})
+	if err != nil {
+		return nil, fmt.Errorf("unable to marshal OpsItem dedup string: %v", err)
+	}
+	related, err := json.Marshal(relatedSnapshots(problem, snapshots))
+	if err != nil {
+		return nil, fmt.Errorf("unable to marshal related snapshots: %v", err)
+	}
+
+	return map[string]ssmTypes.OpsItemDataValue{
+		"/aws/resources":   {Type: ssmTypes.OpsItemDataTypeSearchableString, Value: aws.String(string(resources))},
+		"/aws/dedup":       {Type: ssmTypes.OpsItemDataTypeSearchableString, Value: aws.String(string(dedup))},
+		"problem":          {Type: ssmTypes.OpsItemDataTypeSearchableString, Value: aws.String(problem.Kind)},
+		"relatedSnapshots": {Type: ssmTypes.OpsItemDataTypeString, Value: aws.String(string(related))},
+	}, nil
+}
+
+// relatedSnapshots returns the newest snapshots of the database of problem.
+func relatedSnapshots(problem escalation.Problem, snapshots []storage.SnapshotInfo) []relatedSnapshot {
+	var matching []storage.SnapshotInfo
+	for _, snapshot := range snapshots {
+		if snapshot.SnapshotType == problem.DatabaseType && snapshot.SourceID == problem.DatabaseID {
+			matching = append(matching, snapshot)
+		}
+	}
+	sort.Slice(matching, func(i, j int) bool {
+		return matching[i].CreateTime.After(matching[j].CreateTime)
+	})
+
+	related := []relatedSnapshot{}
+	for _, snapshot := range matching[:min(len(matching), maxRelatedSnapshots)] {
+		related = append(related, relatedSnapshot{
+			SnapshotID: snapshot.SnapshotID,
+			Arn:        snapshot.SnapshotArn,
+			Status:     snapshot.Status,
+			CreatedAt:  snapshot.CreateTime.UTC().Format(time.RFC3339),
+		})
+	}
+	return related
+}
+
+func title(problem escalation.Problem) string {
+	if problem.Kind == escalation.ProblemFailed {
+		return fmt.Sprintf("RDS backup failed for DB %s %s", problem.DatabaseType, problem.DatabaseID)
+	}
+	return fmt.Sprintf("RDS DB %s %s has no recent backup", problem.DatabaseType, problem.DatabaseID)
+}
+
+func description(problem escalation.Problem) string {
+	lastSuccessful := "No available snapshot was found."
+	if !problem.LastSuccessful.IsZero() {
+		lastSuccessful = fmt.Sprintf("The last available snapshot was created at %s.",
+			problem.LastSuccessful.UTC().Format(time.RFC3339))
+	}
+	if problem.Kind == escalation.ProblemFailed {
+		return fmt.Sprintf("Snapshot %s of DB %s %s in region %s is %s. %s",
+			problem.SnapshotID, problem.DatabaseType, problem.DatabaseID, problem.Region, problem.SnapshotStatus, lastSuccessful)
+	}
+	return fmt.Sprintf("DB %s %s in region %s has no available snapshot within the coverage window. %s",
+		problem.DatabaseType, problem.DatabaseID, problem.Region, lastSuccessful)
+}
@@ -0,0 +1,178 @@
+package opsitems
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"testing"
+	"time"
+
+	"rds-backup-monitor/lambda/escalation"
+	"rds-backup-monitor/lambda/storage"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ssm"
+	ssmTypes "github.com/aws/aws-sdk-go-v2/service/ssm/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeSSMClient struct {
+	created   []*ssm.CreateOpsItemInput
+	updated   []*ssm.UpdateOpsItemInput
+	createErr error
+}
+
+func (f *fakeSSMClient) CreateOpsItem(ctx context.Context, params *ssm.CreateOpsItemInput, optFns ...func(*ssm.Options)) (*ssm.CreateOpsItemOutput, error) {
+	f.created = append(f.created, params)
+	if f.createErr != nil {
+		return nil, f.createErr
+	}
+	return &ssm.CreateOpsItemOutput{OpsItemId: aws.String(fmt.Sprintf("oi-%012d", len(f.created)))}, nil
+}
+
+func (f *fakeSSMClient) UpdateOpsItem(ctx context.Context, params *ssm.UpdateOpsItemInput, optFns ...func(*ssm.Options)) (*ssm.UpdateOpsItemOutput, error) {
+	f.updated = append(f.updated, params)
+	return &ssm.UpdateOpsItemOutput{}, nil
+}
+
+func databaseArn(id string) string {
+	return "arn:aws:rds:us-east-1:123456789012:db:" + id
+}
+
+// opsItemRecord returns the stored record of the OpsItem of database id.
+func opsItemRecord(id, opsItemID, problem, snapshotID string) storage.OpsItemRecord {
+	return storage.OpsItemRecord{
+		Region:      "us-east-1",
+		ResourceArn: databaseArn(id),
+		OpsItemID:   opsItemID,
+		Problem:     problem,
+		SnapshotID:  snapshotID,
+		CreatedAt:   time.Now(),
+	}
+}
+
+// opsItemIDs returns the stored OpsItem IDs keyed by resource ARN.
+func opsItemIDs(t *testing.T, store storage.OpsItemStore) map[string]string {
+	t.Helper()
+	records, err := store.GetOpsItemRecords(context.Background(), "us-east-1")
+	require.NoError(t, err)
+	ids := make(map[string]string)
+	for arn, record := range records {
+		ids[arn] = record.OpsItemID
+	}
+	return ids
+}
+
+func problem(id, kind, snapshotID string) escalation.Problem {
+	return escalation.Problem{
+		Region:         "us-east-1",
+		DatabaseType:   "instance",
+		DatabaseID:     id,
+		DatabaseArn:    databaseArn(id),
+		Kind:           kind,
+		SnapshotID:     snapshotID,
+		SnapshotStatus: "failed",
+	}
+}
+
+func TestSync(t *testing.T) {
+	now := time.Date(2024, 11, 20, 12, 0, 0, 0, time.UTC)
+
+	store := storage.NewMemoryStore()
+	require.NoError(t, store.PutOpsItemRecords(context.Background(), []storage.OpsItemRecord{
+		opsItemRecord("unchanged", "oi-unchanged", escalation.ProblemFailed, "rds:unchanged-2"),
+		opsItemRecord("newer", "oi-newer", escalation.ProblemFailed, "rds:newer-1"),
+		opsItemRecord("recovered", "oi-recovered", escalation.ProblemFailed, "rds:recovered-1"),
+	}))
+	client := &fakeSSMClient{}
+
+	var snapshots []storage.SnapshotInfo
+	for i := 0; i < 12; i++ {
+		snapshots = append(snapshots, storage.SnapshotInfo{
+			SnapshotID:   fmt.Sprintf("rds:added-%02d", i),
+			SnapshotArn:  fmt.Sprintf("arn:aws:rds:us-east-1:123456789012:snapshot:rds:added-%02d", i),
+			SourceID:     "added",
+			SnapshotType: "instance",
+			Status:       "available",
+			CreateTime:   now.Add(time.Duration(i-12) * time.Hour),
+		})
+	}
+	snapshots = append(snapshots, storage.SnapshotInfo{
+		SnapshotID: "rds:other-1", SourceID: "other", SnapshotType: "instance", Status: "available", CreateTime: now,
+	})
+
+	problems := []escalation.Problem{
+		problem("added", escalation.ProblemFailed, "rds:added-11"),
+		problem("newer", escalation.ProblemFailed, "rds:newer-2"),
+		problem("unchanged", escalation.ProblemFailed, "rds:unchanged-2"),
+	}
+
+	err := Sync(context.Background(), client, store, "us-east-1", problems, snapshots, now)
+	require.NoError(t, err)
+
+	require.Len(t, client.created, 1)
+	created := client.created[0]
+	assert.Equal(t, "rds-backup-monitor", aws.ToString(created.Source))
+	assert.Equal(t, "RDS backup failed for DB instance added", aws.ToString(created.Title))
+	assert.JSONEq(t, `[{"arn":"`+databaseArn("added")+`"}]`, aws.ToString(created.OperationalData["/aws/resources"].Value))
+	assert.JSONEq(t, `{"dedupString":"rds-backup-monitor/`+databaseArn("added")+`"}`,
+		aws.ToString(created.OperationalData["/aws/dedup"].Value))
+	assert.Equal(t, ssmTypes.OpsItemDataTypeSearchableString, created.OperationalData["/aws/resources"].Type)
+
+	var related []relatedSnapshot
+	require.NoError(t, json.Unmarshal([]byte(aws.ToString(created.OperationalData["relatedSnapshots"].Value)), &related))
+	require.Len(t, related, maxRelatedSnapshots)
+	assert.Equal(t, "rds:added-11", related[0].SnapshotID, "newest snapshot first")
+	assert.Equal(t, "rds:added-02", related[9].SnapshotID)
+
+	updatedIDs := make(map[string]ssmTypes.OpsItemStatus)
+	for _, update := range client.updated {
+		updatedIDs[aws.ToString(update.OpsItemId)] = update.Status
+	}
+	assert.Equal(t, map[string]ssmTypes.OpsItemStatus{
+		"oi-newer":     "",
+		"oi-recovered": ssmTypes.OpsItemStatusResolved,
+	}, updatedIDs)
+
+	assert.Equal(t, map[string]string{
+		databaseArn("added"):     "oi-000000000001",
+		databaseArn("newer"):     "oi-newer",
+		databaseArn("unchanged"): "oi-unchanged",
+	}, opsItemIDs(t, store))
+	records, err := store.GetOpsItemRecords(context.Background(), "us-east-1")
+	require.NoError(t, err)
+	assert.Equal(t, "rds:newer-2", records[databaseArn("newer")].SnapshotID)
+}
+
+func TestSync_CreateErrors(t *testing.T) {
+	problems := []escalation.Problem{problem("orders", escalation.ProblemMissing, "")}
+
+	t.Run("API error", func(t *testing.T) {
+		store := storage.NewMemoryStore()
+		client := &fakeSSMClient{createErr: fmt.Errorf("AccessDenied")}
+		err := Sync(context.Background(), client, store, "us-east-1", problems, nil, time.Now())
+		assert.Error(t, err)
+		assert.Empty(t, opsItemIDs(t, store), "records must not be stored when OpsCenter fails")
+	})
+
+	t.Run("adopts the existing OpsItem", func(t *testing.T) {
+		store := storage.NewMemoryStore()
+		client := &fakeSSMClient{createErr: &ssmTypes.OpsItemAlreadyExistsException{OpsItemId: aws.String("oi-existing")}}
+		err := Sync(context.Background(), client, store, "us-east-1", problems, nil, time.Now())
+		require.NoError(t, err)
+		assert.Equal(t, map[string]string{databaseArn("orders"): "oi-existing"}, opsItemIDs(t, store))
+	})
+}
+
+func TestDescription(t *testing.T) {
+	missing := problem("orders", escalation.ProblemMissing, "")
+	assert.Equal(t, "RDS DB instance orders has no recent backup", title(missing))
+	assert.Equal(t, "DB instance orders in region us-east-1 has no available snapshot within the coverage window. "+
+		"No available snapshot was found.", description(missing))
+
+	failed := problem("orders", escalation.ProblemFailed, "rds:orders-2")
+	failed.LastSuccessful = time.Date(2024, 11, 19, 3, 0, 0, 0, time.UTC)
+	assert.Equal(t, "Snapshot rds:orders-2 of DB instance orders in region us-east-1 is failed. "+
+		"The last available snapshot was created at 2024-11-19T03:00:00Z.", description(failed))
+}
@@ -0,0 +1,169 @@
+package regions
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"rds-backup-monitor/lambda/storage"
+)
+
+// DefaultLeaseDuration is how long the lock of a region lasts without being
+// renewed. A run that stops without releasing its locks, for example when the
+// function times out, holds back the next runs for at most this long.
+const DefaultLeaseDuration = 2 * time.Minute
+
+// Locker takes and gives up named locks; every storage.StateStore is one.
+type Locker interface {
+	AcquireLock(ctx context.Context, name, owner string, expiresAt, now time.Time) (storage.Lock, bool, error)
+	ReleaseLock(ctx context.Context, name, owner string) error
+}
+
+// lockName is the name of the lock of region. Locks are kept per account, so
+// the lock covers the account and region.
+func lockName(region string) string {
+	return "region#" + region
+}
+
+// Lease is the lock of a region held by a run while it scans the region and
+// sends its changes, so that overlapping runs do not send them twice. A
+// heartbeat renews the lock every third of its duration until the lease is
+// released, however long the run takes.
+type Lease struct {
+	region   string
+	owner    string
+	duration time.Duration
+	locker   Locker
+	stop     context.CancelFunc
+	done     chan struct{}
+
+	mu        sync.Mutex
+	expiresAt time.Time
+	lost      bool
+}
+
+// Held reports whether the lease still holds the lock at now. It stops
+// holding it when the lock expired before a renewal succeeded, or when
+// another run took the lock over.
+func (l *Lease) Held(now time.Time) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return !l.lost && now.Before(l.expiresAt)
+}
+
+func (l *Lease) heartbeat(ctx context.Context) {
+	defer close(l.done)
+	ticker := time.NewTicker(l.duration / 3)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		if !l.renew(ctx, time.Now()) {
+			return
+		}
+	}
+}
+
+// renew extends the lock, and returns false once the lock is lost. A failed
+// renewal is retried by the next heartbeat, while the lock has not expired.
+func (l *Lease) renew(ctx context.Context, now time.Time) bool {
+	holder, acquired, err := l.locker.AcquireLock(ctx, lockName(l.region), l.owner, now.Add(l.duration), now)
+	if ctx.Err() != nil {
+		return false
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	switch {
+	case err != nil:
+		fmt.Printf("Error: unable to renew the lock of region %s, retrying: %v\n", l.region, err)
+		return true
+	case !acquired:
+		fmt.Printf("Error: lost the lock of region %s to run %s\n", l.region, holder.Owner)
+		l.lost = true
+		return false
+	}
+	l.expiresAt = now.Add(l.duration)
+	return true
+}
+
+// release stops the heartbeat and gives up the lock.
+func (l *Lease) release(ctx context.Context) error {
+	l.stop()
+	<-l.done
+	return l.locker.ReleaseLock(ctx, lockName(l.region), l.owner)
+}
+
+// Leases are the leases a run holds, by region.
+type Leases map[string]*Lease
+
+// AcquireLeases takes the lock of each region for the run owner and starts
+// renewing it. Regions locked by another run are logged and left out, to be
+// scanned by that run. A region whose lock cannot be taken fails.
+func AcquireLeases(ctx context.Context, locker Locker, regions []string, owner string,
+	duration time.Duration) (Leases, []Failure) {
+
+	leases := make(Leases)
+	var failures []Failure
+	for _, region := range regions {
+		now := time.Now()
+		holder, acquired, err := locker.AcquireLock(ctx, lockName(region), owner, now.Add(duration), now)
+		if err != nil {
+			failures = append(failures, Failure{Region: region, Stage: StageScan, Err: err})
+			continue
+		}
+		if !acquired {
+			fmt.Printf("Skipping region %s, it is locked by run %s until %s\n",
+				region, holder.Owner, holder.ExpiresAt.UTC().Format(time.RFC3339))
+			continue
+		}
+
+		// The heartbeat outlives the deadline of the scans, and stops on release
+		heartbeatCtx, stop := context.WithCancel(context.WithoutCancel(ctx))
+		lease := &Lease{
+			region:    region,
+			owner:     owner,
+			duration:  duration,
+			locker:    locker,
+			stop:      stop,
+			done:      make(chan struct{}),
+			expiresAt: now.Add(duration),
+		}
+		go lease.heartbeat(heartbeatCtx)
+		leases[region] = lease
+	}
+	return leases, failures
+}
+
+// Regions returns the regions of regions that have a lease, in their order.
+func (l Leases) Regions(regions []string) []string {
+	var held []string
+	for _, region := range regions {
+		if _, ok := l[region]; ok {
+			held = append(held, region)
+		}
+	}
+	return held
+}
+
+// Held reports whether the lease of region still holds its lock at now.
+func (l Leases) Held(region string, now time.Time) bool {
+	lease, ok := l[region]
+	return ok && lease.Held(now)
+}
+
+// Release gives up every lock. A lock that cannot be released is logged; it
+// expires by itself.
+func (l Leases) Release(ctx context.Context) {
+	for region, lease := range l {
+		if err := lease.release(ctx); err != nil {
+			fmt.Printf("Error: %v, it expires by itself\n", err)
+		}
+		delete(l, region)
+	}
+}
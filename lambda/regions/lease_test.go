@@ -0,0 +1,92 @@
+package regions
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"rds-backup-monitor/lambda/storage"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// failingLocker fails to take the lock of failRegion.
+type failingLocker struct {
+	*storage.MemoryStore
+	failRegion string
+}
+
+func (l failingLocker) AcquireLock(ctx context.Context, name, owner string, expiresAt, now time.Time) (storage.Lock, bool, error) {
+	if name == lockName(l.failRegion) {
+		return storage.Lock{}, false, errors.New("throttled")
+	}
+	return l.MemoryStore.AcquireLock(ctx, name, owner, expiresAt, now)
+}
+
+func TestAcquireLeases(t *testing.T) {
+	ctx := context.Background()
+	store := storage.NewMemoryStore()
+	now := time.Now()
+	_, acquired, err := store.AcquireLock(ctx, lockName("eu-west-1"), "run-0", now.Add(time.Minute), now)
+	require.NoError(t, err)
+	require.True(t, acquired)
+
+	locker := failingLocker{MemoryStore: store, failRegion: "ap-south-1"}
+	leases, failures := AcquireLeases(ctx, locker, []string{"us-east-1", "eu-west-1", "ap-south-1", "us-west-2"}, "run-1", time.Minute)
+	defer leases.Release(ctx)
+
+	assert.Equal(t, []string{"us-east-1", "us-west-2"}, leases.Regions([]string{"us-east-1", "eu-west-1", "ap-south-1", "us-west-2"}))
+	assert.True(t, leases.Held("us-east-1", now))
+	assert.False(t, leases.Held("eu-west-1", now))
+	assert.False(t, leases.Held("us-east-1", now.Add(2*time.Minute)))
+	require.Len(t, failures, 1)
+	assert.Equal(t, "ap-south-1", failures[0].Region)
+	assert.Equal(t, StageScan, failures[0].Stage)
+
+	// An overlapping run skips the regions of the first
+	overlapping, failures := AcquireLeases(ctx, store, []string{"us-east-1", "us-west-2"}, "run-2", time.Minute)
+	assert.Empty(t, overlapping)
+	assert.Empty(t, failures)
+}
+
+func TestLeaseHeartbeat(t *testing.T) {
+	ctx := context.Background()
+	store := storage.NewMemoryStore()
+	duration := 60 * time.Millisecond
+
+	leases, failures := AcquireLeases(ctx, store, []string{"us-east-1"}, "run-1", duration)
+	require.Empty(t, failures)
+
+	// The heartbeat keeps the lock past its first expiry
+	time.Sleep(3 * duration)
+	assert.True(t, leases.Held("us-east-1", time.Now()))
+	now := time.Now()
+	_, acquired, err := store.AcquireLock(ctx, lockName("us-east-1"), "run-2", now.Add(duration), now)
+	require.NoError(t, err)
+	assert.False(t, acquired)
+
+	// Released locks are free for the next run right away
+	leases.Release(ctx)
+	assert.Empty(t, leases)
+	now = time.Now()
+	_, acquired, err = store.AcquireLock(ctx, lockName("us-east-1"), "run-2", now.Add(duration), now)
+	require.NoError(t, err)
+	assert.True(t, acquired)
+}
+
+func TestLeaseLost(t *testing.T) {
+	ctx := context.Background()
+	store := storage.NewMemoryStore()
+	now := time.Now()
+	lease := &Lease{region: "us-east-1", owner: "run-1", duration: time.Minute, locker: store, expiresAt: now.Add(time.Minute)}
+
+	// Another run took the lock over once it expired
+	_, acquired, err := store.AcquireLock(ctx, lockName("us-east-1"), "run-2", now.Add(time.Hour), now)
+	require.NoError(t, err)
+	require.True(t, acquired)
+
+	assert.False(t, lease.renew(ctx, now.Add(30*time.Second)))
+	assert.False(t, lease.Held(now.Add(30*time.Second)))
+}
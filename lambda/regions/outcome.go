@@ -0,0 +1,88 @@
+package regions
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// Stages of a run that each region goes through independently. A region that
+// fails a stage is skipped by the later stages that need its scan.
+const (
+	StageScan        = "scan"
+	StageSecurityHub = "security-hub"
+	StageOpsItems    = "ops-items"
+)
+
+// Failure is a stage that failed for a region.
+type Failure struct {
+	Region string
+	Stage  string
+	Err    error
+}
+
+func (f Failure) Error() string {
+	return fmt.Sprintf("%s failed in region %s: %v", f.Stage, f.Region, f.Err)
+}
+
+func (f Failure) Unwrap() error {
+	return f.Err
+}
+
+// Outcome records the stages each region completed or failed during a run.
+// It is safe for concurrent use.
+type Outcome struct {
+	mu        sync.Mutex
+	failures  []Failure
+	completed map[string]bool
+}
+
+func NewOutcome() *Outcome {
+	return &Outcome{completed: make(map[string]bool)}
+}
+
+func stageKey(region, stage string) string {
+	return region + "/" + stage
+}
+
+// Complete records that region completed stage.
+func (o *Outcome) Complete(region, stage string) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.completed[stageKey(region, stage)] = true
+}
+
+// Fail records failures and logs them.
+func (o *Outcome) Fail(failures ...Failure) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	for _, failure := range failures {
+		fmt.Printf("Error: %v\n", failure)
+		o.failures = append(o.failures, failure)
+	}
+}
+
+// Completed reports whether region completed stage.
+func (o *Outcome) Completed(region, stage string) bool {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return o.completed[stageKey(region, stage)]
+}
+
+// Failures returns the failures in the order they were recorded.
+func (o *Outcome) Failures() []Failure {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return append([]Failure(nil), o.failures...)
+}
+
+// Err joins every failure into one error, or returns nil when no stage failed.
+func (o *Outcome) Err() error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	errs := make([]error, len(o.failures))
+	for i, failure := range o.failures {
+		errs[i] = failure
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,27 @@
+package regions
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOutcome(t *testing.T) {
+	outcome := NewOutcome()
+	assert.NoError(t, outcome.Err())
+
+	outcome.Complete("us-east-1", StageScan)
+	outcome.Fail(
+		Failure{Region: "ap-south-1", Stage: StageScan, Err: errors.New("access denied")},
+		Failure{Region: "us-east-1", Stage: StageOpsItems, Err: errors.New("throttled")},
+	)
+
+	assert.True(t, outcome.Completed("us-east-1", StageScan))
+	assert.False(t, outcome.Completed("us-east-1", StageOpsItems))
+	assert.False(t, outcome.Completed("ap-south-1", StageScan))
+
+	assert.Len(t, outcome.Failures(), 2)
+	assert.EqualError(t, outcome.Err(),
+		"scan failed in region ap-south-1: access denied\nops-items failed in region us-east-1: throttled")
+}
@@ -0,0 +1,123 @@
+package regions
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/rds"
+	"github.com/aws/aws-sdk-go-v2/service/securityhub"
+	"github.com/aws/aws-sdk-go-v2/service/ssm"
+)
+
+// DefaultParallelism is the number of regions scanned at the same time when no
+// limit is configured.
+const DefaultParallelism = 4
+
+// Clients are the SDK clients of a single region.
+type Clients struct {
+	Region      string
+	RDS         *rds.Client
+	SecurityHub *securityhub.Client
+	SSM         *ssm.Client
+}
+
+// ConfigLoader loads the SDK config of a region.
+type ConfigLoader func(ctx context.Context, region string) (aws.Config, error)
+
+// LoadDefaultConfig loads the default SDK config for region.
+func LoadDefaultConfig(ctx context.Context, region string) (aws.Config, error) {
+	return config.LoadDefaultConfig(ctx, config.WithRegion(region))
+}
+
+// Cache creates the clients of each region once and keeps them for later
+// invocations of a warm Lambda environment. It is safe for concurrent use.
+type Cache struct {
+	load    ConfigLoader
+	mu      sync.Mutex
+	clients map[string]*Clients
+}
+
+func NewCache(load ConfigLoader) *Cache {
+	return &Cache{
+		load:    load,
+		clients: make(map[string]*Clients),
+	}
+}
+
+// Get returns the clients of region. A config that fails to load is not
+// cached, so the next call tries again.
+func (c *Cache) Get(ctx context.Context, region string) (*Clients, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if clients, ok := c.clients[region]; ok {
+		return clients, nil
+	}
+
+	cfg, err := c.load(ctx, region)
+	if err != nil {
+		return nil, fmt.Errorf("unable to load SDK config for region %s: %v", region, err)
+	}
+	clients := &Clients{
+		Region:      region,
+		RDS:         rds.NewFromConfig(cfg),
+		SecurityHub: securityhub.NewFromConfig(cfg),
+		SSM:         ssm.NewFromConfig(cfg),
+	}
+	c.clients[region] = clients
+	return clients, nil
+}
+
+// Scan calls scan for every region, at most parallelism at the same time. It
+// returns the results of the regions that were scanned, in the order of
+// regions, and a failure for every other region. Regions that have not
+// started when ctx is done fail without being scanned.
+func Scan[T any](ctx context.Context, regions []string, parallelism int,
+	scan func(ctx context.Context, region string) (T, error)) ([]T, []Failure) {
+
+	if parallelism <= 0 {
+		parallelism = DefaultParallelism
+	}
+
+	results := make([]T, len(regions))
+	errs := make([]error, len(regions))
+	slots := make(chan struct{}, parallelism)
+	var wg sync.WaitGroup
+
+	for i, region := range regions {
+		select {
+		case slots <- struct{}{}:
+		case <-ctx.Done():
+			errs[i] = fmt.Errorf("not scanned: %w", ctx.Err())
+			continue
+		}
+		// A slot may be free while ctx is already done
+		if err := ctx.Err(); err != nil {
+			<-slots
+			errs[i] = fmt.Errorf("not scanned: %w", err)
+			continue
+		}
+
+		wg.Add(1)
+		go func(i int, region string) {
+			defer wg.Done()
+			defer func() { <-slots }()
+			results[i], errs[i] = scan(ctx, region)
+		}(i, region)
+	}
+	wg.Wait()
+
+	scanned := make([]T, 0, len(regions))
+	var failures []Failure
+	for i, region := range regions {
+		if errs[i] != nil {
+			failures = append(failures, Failure{Region: region, Stage: StageScan, Err: errs[i]})
+			continue
+		}
+		scanned = append(scanned, results[i])
+	}
+	return scanned, failures
+}
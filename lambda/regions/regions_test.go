@@ -0,0 +1,122 @@
+package regions
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCacheGet(t *testing.T) {
+	var loads []string
+	failures := 1
+	cache := NewCache(func(ctx context.Context, region string) (aws.Config, error) {
+		loads = append(loads, region)
+		if region == "eu-west-1" && failures > 0 {
+			failures--
+			return aws.Config{}, errors.New("no credentials")
+		}
+		return aws.Config{Region: region}, nil
+	})
+
+	first, err := cache.Get(context.Background(), "us-east-1")
+	require.NoError(t, err)
+	assert.Equal(t, "us-east-1", first.Region)
+
+	second, err := cache.Get(context.Background(), "us-east-1")
+	require.NoError(t, err)
+	assert.Same(t, first, second, "clients are created once per region")
+
+	_, err = cache.Get(context.Background(), "eu-west-1")
+	assert.ErrorContains(t, err, "unable to load SDK config for region eu-west-1: no credentials")
+
+	_, err = cache.Get(context.Background(), "eu-west-1")
+	require.NoError(t, err, "failed loads are retried")
+
+	assert.Equal(t, []string{"us-east-1", "eu-west-1", "eu-west-1"}, loads)
+}
+
+func TestScan(t *testing.T) {
+	regions := []string{"us-east-1", "us-west-2", "eu-west-1", "eu-central-1", "ap-southeast-2"}
+	delays := map[string]time.Duration{
+		"us-east-1":      40 * time.Millisecond,
+		"us-west-2":      5 * time.Millisecond,
+		"eu-west-1":      20 * time.Millisecond,
+		"eu-central-1":   1 * time.Millisecond,
+		"ap-southeast-2": 10 * time.Millisecond,
+	}
+
+	var running, maxRunning int32
+	results, failures := Scan(context.Background(), regions, 2, func(ctx context.Context, region string) (string, error) {
+		current := atomic.AddInt32(&running, 1)
+		defer atomic.AddInt32(&running, -1)
+		for {
+			max := atomic.LoadInt32(&maxRunning)
+			if current <= max || atomic.CompareAndSwapInt32(&maxRunning, max, current) {
+				break
+			}
+		}
+		time.Sleep(delays[region])
+		return "scanned " + region, nil
+	})
+
+	assert.Empty(t, failures)
+	assert.Equal(t, []string{
+		"scanned us-east-1",
+		"scanned us-west-2",
+		"scanned eu-west-1",
+		"scanned eu-central-1",
+		"scanned ap-southeast-2",
+	}, results, "results keep the order of regions")
+	assert.LessOrEqual(t, maxRunning, int32(2))
+}
+
+func TestScan_ContinuesPastFailedRegions(t *testing.T) {
+	regions := []string{"us-east-1", "us-west-2", "eu-west-1"}
+	results, failures := Scan(context.Background(), regions, 3, func(ctx context.Context, region string) (string, error) {
+		switch region {
+		case "us-west-2":
+			time.Sleep(10 * time.Millisecond)
+			return "", errors.New("access denied")
+		case "eu-west-1":
+			return "", errors.New("throttled")
+		}
+		return region, nil
+	})
+
+	assert.Equal(t, []string{"us-east-1"}, results)
+	require.Len(t, failures, 2)
+	assert.Equal(t, "us-west-2", failures[0].Region, "failures keep the order of regions")
+	assert.Equal(t, StageScan, failures[0].Stage)
+	assert.EqualError(t, failures[0], "scan failed in region us-west-2: access denied")
+	assert.EqualError(t, failures[1], "scan failed in region eu-west-1: throttled")
+}
+
+func TestScan_StopsAtDeadline(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var mu sync.Mutex
+	var scanned []string
+	regions := []string{"us-east-1", "us-west-2", "eu-west-1"}
+	results, failures := Scan(ctx, regions, 1, func(ctx context.Context, region string) (string, error) {
+		mu.Lock()
+		scanned = append(scanned, region)
+		mu.Unlock()
+		// The deadline passes while the first region is scanned
+		cancel()
+		return region, nil
+	})
+
+	assert.Equal(t, []string{"us-east-1"}, scanned)
+	assert.Equal(t, []string{"us-east-1"}, results)
+	require.Len(t, failures, 2)
+	assert.EqualError(t, failures[0], "scan failed in region us-west-2: not scanned: context canceled")
+	assert.ErrorIs(t, failures[1], context.Canceled)
+}
@@ -0,0 +1,220 @@
+package reports
+
+import (
+	"sort"
+	"time"
+
+	"rds-backup-monitor/lambda/backups"
+	"rds-backup-monitor/lambda/storage"
+)
+
+const dateLayout = "2006-01-02"
+
+// ValidPeriod reports whether period is a supported report period.
+func ValidPeriod(period string) bool {
+	return period == PeriodDaily || period == PeriodWeekly
+}
+
+// PeriodWindow returns the duration covered by a report of period.
+func PeriodWindow(period string) time.Duration {
+	if period == PeriodWeekly {
+		return 7 * 24 * time.Hour
+	}
+	return 24 * time.Hour
+}
+
+// PreviousReportDate returns the date of the report that now is compared
+// against: the report of the same period one week earlier.
+func PreviousReportDate(now time.Time) string {
+	return now.UTC().AddDate(0, 0, -7).Format(dateLayout)
+}
+
+// BuildReport summarizes the inventories of all regions. Databases without an
+// available snapshot newer than coverageWindow are reported as coverage gaps.
+func BuildReport(period, account string, now time.Time, coverageWindow time.Duration,
+	inventories []RegionInventory, previous *storage.ReportMetrics) Report {
+
+	report := Report{
+		Period:      period,
+		Account:     account,
+		GeneratedAt: now.UTC(),
+		WindowStart: now.Add(-PeriodWindow(period)).UTC(),
+	}
+
+	sorted := make([]RegionInventory, len(inventories))
+	copy(sorted, inventories)
+	for i := range sorted {
+		if sorted[i].Account == "" {
+			sorted[i].Account = account
+		}
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		if sorted[i].Account != sorted[j].Account {
+			return sorted[i].Account < sorted[j].Account
+		}
+		return sorted[i].Region < sorted[j].Region
+	})
+
+	databaseCount := 0
+	for _, inventory := range sorted {
+		summaries, failures, regionStorage := summarizeRegion(inventory, report.WindowStart)
+		report.Databases = append(report.Databases, summaries...)
+		report.Failures = append(report.Failures, failures...)
+		report.Storage = append(report.Storage, regionStorage)
+		report.CoverageGaps = append(report.CoverageGaps,
+			findCoverageGaps(inventory, summaries, now.Add(-coverageWindow))...)
+		databaseCount += len(inventory.Databases)
+	}
+
+	report.Metrics = storage.ReportMetrics{
+		Period:       period,
+		Date:         now.UTC().Format(dateLayout),
+		Databases:    databaseCount,
+		Failures:     len(report.Failures),
+		CoverageGaps: len(report.CoverageGaps),
+	}
+	for _, summary := range report.Databases {
+		report.Metrics.SnapshotsTaken += summary.SnapshotsTaken
+	}
+	for _, regionStorage := range report.Storage {
+		report.Metrics.TotalStorageGiB += regionStorage.StorageGiB
+	}
+
+	if previous != nil {
+		report.Trend = []TrendLine{
+			{Metric: "Databases", Current: int64(report.Metrics.Databases), Previous: int64(previous.Databases)},
+			{Metric: "Snapshots taken", Current: int64(report.Metrics.SnapshotsTaken), Previous: int64(previous.SnapshotsTaken)},
+			{Metric: "Failures", Current: int64(report.Metrics.Failures), Previous: int64(previous.Failures)},
+			{Metric: "Coverage gaps", Current: int64(report.Metrics.CoverageGaps), Previous: int64(previous.CoverageGaps)},
+			{Metric: "Snapshot storage (GiB)", Current: report.Metrics.TotalStorageGiB, Previous: previous.TotalStorageGiB},
+		}
+	}
+
+	return report
+}
+
+// summarizeRegion counts snapshots per database within the window and totals
+// the storage of every available snapshot in the region.
+func summarizeRegion(inventory RegionInventory, windowStart time.Time) ([]DatabaseSummary, []FailedSnapshot, RegionStorage) {
+	summaries := make(map[string]*DatabaseSummary)
+	summaryFor := func(identifier, databaseType string) *DatabaseSummary {
+		key := databaseKey(databaseType, identifier)
+		if _, ok := summaries[key]; !ok {
+			summaries[key] = &DatabaseSummary{Region: inventory.Region, Identifier: identifier, Type: databaseType}
+		}
+		return summaries[key]
+	}
+
+	for _, database := range inventory.Databases {
+		summaryFor(database.Identifier, database.Type)
+	}
+
+	var failures []FailedSnapshot
+	regionStorage := RegionStorage{Account: inventory.Account, Region: inventory.Region}
+
+	for _, snapshot := range inventory.Snapshots {
+		available := snapshot.Status == "available"
+		inWindow := !snapshot.CreateTime.Before(windowStart)
+
+		if available {
+			regionStorage.Snapshots++
+			regionStorage.StorageGiB += int64(snapshot.StorageGiB)
+		}
+
+		// Databases that no longer exist are only listed while they still
+		// have snapshots in the window
+		if _, ok := summaries[databaseKey(snapshot.SnapshotType, snapshot.SourceID)]; !ok && !inWindow {
+			continue
+		}
+		summary := summaryFor(snapshot.SourceID, snapshot.SnapshotType)
+
+		if available && snapshot.CreateTime.After(summary.LastSuccessful) {
+			summary.LastSuccessful = snapshot.CreateTime
+		}
+		if !inWindow {
+			continue
+		}
+		if available {
+			summary.SnapshotsTaken++
+		}
+		if storage.IsFailedStatus(snapshot.Status) {
+			summary.Failures++
+			failures = append(failures, FailedSnapshot{
+				Region:     inventory.Region,
+				SnapshotID: snapshot.SnapshotID,
+				Identifier: snapshot.SourceID,
+				Status:     snapshot.Status,
+				CreateTime: snapshot.CreateTime,
+			})
+		}
+	}
+
+	result := make([]DatabaseSummary, 0, len(summaries))
+	for _, summary := range summaries {
+		result = append(result, *summary)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Identifier != result[j].Identifier {
+			return result[i].Identifier < result[j].Identifier
+		}
+		return result[i].Type < result[j].Type
+	})
+	sort.Slice(failures, func(i, j int) bool {
+		return failures[i].SnapshotID < failures[j].SnapshotID
+	})
+
+	return result, failures, regionStorage
+}
+
+func findCoverageGaps(inventory RegionInventory, summaries []DatabaseSummary, coverageStart time.Time) []CoverageGap {
+	lastSuccessful := make(map[string]time.Time)
+	for _, summary := range summaries {
+		lastSuccessful[databaseKey(summary.Type, summary.Identifier)] = summary.LastSuccessful
+	}
+
+	var gaps []CoverageGap
+	for _, database := range inventory.Databases {
+		last := lastSuccessful[databaseKey(database.Type, database.Identifier)]
+		if last.Before(coverageStart) {
+			gaps = append(gaps, CoverageGap{
+				Region:                inventory.Region,
+				Identifier:            database.Identifier,
+				Type:                  database.Type,
+				BackupRetentionPeriod: database.BackupRetentionPeriod,
+				LastSuccessful:        last,
+			})
+		}
+	}
+
+	sort.Slice(gaps, func(i, j int) bool {
+		return gaps[i].Identifier < gaps[j].Identifier
+	})
+	return gaps
+}
+
+func databaseKey(databaseType, identifier string) string {
+	return databaseType + "/" + identifier
+}
+
+// SampleReport returns a report with representative content, used to validate
+// report templates at startup.
+func SampleReport() Report {
+	now := time.Now()
+	inventories := []RegionInventory{
+		{
+			Region: "us-east-1",
+			Databases: []backups.Database{
+				{Identifier: "sample-db", Type: "instance", BackupRetentionPeriod: 7},
+				{Identifier: "sample-unprotected-db", Type: "instance"},
+			},
+			Snapshots: []storage.SnapshotInfo{
+				{SnapshotID: "rds:sample-db-1", SourceID: "sample-db", SnapshotType: "instance",
+					Status: "available", CreateTime: now.Add(-2 * time.Hour), StorageGiB: 100},
+				{SnapshotID: "rds:sample-db-2", SourceID: "sample-db", SnapshotType: "instance",
+					Status: "failed", CreateTime: now.Add(-1 * time.Hour)},
+			},
+		},
+	}
+	previous := &storage.ReportMetrics{Databases: 2, SnapshotsTaken: 3, TotalStorageGiB: 80}
+	return BuildReport(PeriodDaily, "123456789012", now, 24*time.Hour, inventories, previous)
+}
@@ -0,0 +1,122 @@
+package reports
+
+import (
+	"testing"
+	"time"
+
+	"rds-backup-monitor/lambda/backups"
+	"rds-backup-monitor/lambda/storage"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBuildReport(t *testing.T) {
+	now := time.Date(2024, 11, 20, 8, 0, 0, 0, time.UTC)
+	hoursAgo := func(hours int) time.Time {
+		return now.Add(-time.Duration(hours) * time.Hour)
+	}
+
+	inventories := []RegionInventory{
+		{
+			Region: "us-west-2",
+			Databases: []backups.Database{
+				{Identifier: "orders", Type: "instance", BackupRetentionPeriod: 7},
+			},
+			Snapshots: []storage.SnapshotInfo{
+				{SnapshotID: "rds:orders-1", SourceID: "orders", SnapshotType: "instance",
+					Status: "available", CreateTime: hoursAgo(3), StorageGiB: 50},
+				{SnapshotID: "rds:orders-0", SourceID: "orders", SnapshotType: "instance",
+					Status: "available", CreateTime: hoursAgo(27), StorageGiB: 50},
+			},
+		},
+		{
+			Region: "eu-west-1",
+			Databases: []backups.Database{
+				{Identifier: "billing", Type: "cluster", BackupRetentionPeriod: 1},
+				{Identifier: "scratch", Type: "instance"},
+			},
+			Snapshots: []storage.SnapshotInfo{
+				{SnapshotID: "rds:billing-1", SourceID: "billing", SnapshotType: "cluster",
+					Status: "failed", CreateTime: hoursAgo(2)},
+				{SnapshotID: "rds:billing-0", SourceID: "billing", SnapshotType: "cluster",
+					Status: "available", CreateTime: hoursAgo(30), StorageGiB: 200},
+				{SnapshotID: "legacy-final", SourceID: "legacy", SnapshotType: "instance",
+					Status: "available", CreateTime: hoursAgo(24 * 90), StorageGiB: 20},
+			},
+		},
+	}
+	previous := &storage.ReportMetrics{Databases: 3, SnapshotsTaken: 4, Failures: 0, CoverageGaps: 1, TotalStorageGiB: 250}
+
+	report := BuildReport(PeriodDaily, "123456789012", now, 26*time.Hour, inventories, previous)
+
+	assert.Equal(t, hoursAgo(24), report.WindowStart)
+	assert.Equal(t, []DatabaseSummary{
+		{Region: "eu-west-1", Identifier: "billing", Type: "cluster", Failures: 1, LastSuccessful: hoursAgo(30)},
+		{Region: "eu-west-1", Identifier: "scratch", Type: "instance"},
+		{Region: "us-west-2", Identifier: "orders", Type: "instance", SnapshotsTaken: 1, LastSuccessful: hoursAgo(3)},
+	}, report.Databases)
+	assert.Equal(t, []FailedSnapshot{
+		{Region: "eu-west-1", SnapshotID: "rds:billing-1", Identifier: "billing", Status: "failed", CreateTime: hoursAgo(2)},
+	}, report.Failures)
+	assert.Equal(t, []CoverageGap{
+		{Region: "eu-west-1", Identifier: "billing", Type: "cluster", BackupRetentionPeriod: 1, LastSuccessful: hoursAgo(30)},
+		{Region: "eu-west-1", Identifier: "scratch", Type: "instance"},
+	}, report.CoverageGaps)
+	assert.Equal(t, []RegionStorage{
+		{Account: "123456789012", Region: "eu-west-1", Snapshots: 2, StorageGiB: 220},
+		{Account: "123456789012", Region: "us-west-2", Snapshots: 2, StorageGiB: 100},
+	}, report.Storage)
+	assert.Equal(t, storage.ReportMetrics{
+		Period:          PeriodDaily,
+		Date:            "2024-11-20",
+		Databases:       3,
+		SnapshotsTaken:  1,
+		Failures:        1,
+		CoverageGaps:    2,
+		TotalStorageGiB: 320,
+	}, report.Metrics)
+
+	assert.Len(t, report.Trend, 5)
+	assert.Equal(t, TrendLine{Metric: "Snapshots taken", Current: 1, Previous: 4}, report.Trend[1])
+	assert.Equal(t, int64(-3), report.Trend[1].Delta())
+	assert.Equal(t, int64(70), report.Trend[4].Delta())
+}
+
+func TestBuildReport_StorageByAccount(t *testing.T) {
+	now := time.Date(2024, 11, 20, 8, 0, 0, 0, time.UTC)
+	snapshot := func(id string, gib int32) storage.SnapshotInfo {
+		return storage.SnapshotInfo{SnapshotID: id, SourceID: "orders", SnapshotType: "instance",
+			Status: "available", CreateTime: now.Add(-time.Hour), StorageGiB: gib}
+	}
+
+	report := BuildReport(PeriodDaily, "123456789012", now, 26*time.Hour, []RegionInventory{
+		{Account: "210987654321", Region: "us-west-2", Snapshots: []storage.SnapshotInfo{snapshot("b", 30)}},
+		{Region: "us-west-2", Snapshots: []storage.SnapshotInfo{snapshot("a", 10)}},
+		{Account: "210987654321", Region: "eu-west-1", Snapshots: []storage.SnapshotInfo{snapshot("c", 5)}},
+	}, nil)
+
+	assert.Equal(t, []RegionStorage{
+		{Account: "123456789012", Region: "us-west-2", Snapshots: 1, StorageGiB: 10},
+		{Account: "210987654321", Region: "eu-west-1", Snapshots: 1, StorageGiB: 5},
+		{Account: "210987654321", Region: "us-west-2", Snapshots: 1, StorageGiB: 30},
+	}, report.Storage)
+	assert.Equal(t, int64(45), report.Metrics.TotalStorageGiB)
+}
+
+func TestBuildReport_WithoutPreviousReport(t *testing.T) {
+	report := BuildReport(PeriodWeekly, "123456789012", time.Now(), 24*time.Hour, nil, nil)
+
+	assert.Empty(t, report.Trend)
+	assert.Equal(t, 0, report.Metrics.Databases)
+	assert.Equal(t, 7*24*time.Hour, report.GeneratedAt.Sub(report.WindowStart))
+}
+
+func TestPreviousReportDate(t *testing.T) {
+	assert.Equal(t, "2024-11-13", PreviousReportDate(time.Date(2024, 11, 20, 8, 0, 0, 0, time.UTC)))
+}
+
+func TestValidPeriod(t *testing.T) {
+	assert.True(t, ValidPeriod(PeriodDaily))
+	assert.True(t, ValidPeriod(PeriodWeekly))
+	assert.False(t, ValidPeriod("monthly"))
+}
@@ -0,0 +1,85 @@
+package reports
+
+import (
+	"time"
+
+	"rds-backup-monitor/lambda/backups"
+	"rds-backup-monitor/lambda/storage"
+)
+
+const (
+	PeriodDaily  = "daily"
+	PeriodWeekly = "weekly"
+)
+
+// RegionInventory is the result of a fresh scan of a single region. Account
+// is the account of the region, the account of the report when empty.
+type RegionInventory struct {
+	Account   string
+	Region    string
+	Snapshots []storage.SnapshotInfo
+	Databases []backups.Database
+}
+
+// Report is the backup health summary for a period.
+type Report struct {
+	Period       string
+	Account      string
+	GeneratedAt  time.Time
+	WindowStart  time.Time
+	Databases    []DatabaseSummary
+	Failures     []FailedSnapshot
+	CoverageGaps []CoverageGap
+	Storage      []RegionStorage
+	Metrics      storage.ReportMetrics
+	// Trend compares Metrics with the report of the same period one week
+	// earlier. It is empty when that report is not available.
+	Trend []TrendLine
+}
+
+// DatabaseSummary counts the snapshots of a database within the report window.
+type DatabaseSummary struct {
+	Region         string
+	Identifier     string
+	Type           string
+	SnapshotsTaken int
+	Failures       int
+	LastSuccessful time.Time
+}
+
+type FailedSnapshot struct {
+	Region     string
+	SnapshotID string
+	Identifier string
+	Status     string
+	CreateTime time.Time
+}
+
+// CoverageGap is a database without an available snapshot within the coverage window.
+type CoverageGap struct {
+	Region                string
+	Identifier            string
+	Type                  string
+	BackupRetentionPeriod int32
+	LastSuccessful        time.Time
+}
+
+// RegionStorage is the total size of the available snapshots in a region of
+// an account.
+type RegionStorage struct {
+	Account    string
+	Region     string
+	Snapshots  int
+	StorageGiB int64
+}
+
+type TrendLine struct {
+	Metric   string
+	Current  int64
+	Previous int64
+}
+
+// Delta returns the change from the previous to the current value.
+func (l TrendLine) Delta() int64 {
+	return l.Current - l.Previous
+}
@@ -0,0 +1,139 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	ddbTypes "github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// acknowledgementPrefix marks acknowledgement rows in the resource partition.
+const acknowledgementPrefix = "ack#"
+
+// Acknowledgement mutes notifications about a database until Until or until
+// the database recovers. Action is "ack" or "snooze".
+type Acknowledgement struct {
+	Region       string
+	DatabaseType string
+	DatabaseID   string
+	Action       string
+	CreatedAt    time.Time
+	Until        time.Time
+}
+
+// Key identifies the database of the acknowledgement within its region.
+func (a Acknowledgement) Key() string {
+	return a.DatabaseType + "/" + a.DatabaseID
+}
+
+// Active reports whether the acknowledgement still mutes notifications at now.
+func (a Acknowledgement) Active(now time.Time) bool {
+	return now.Before(a.Until)
+}
+
+// AcknowledgementStore keeps the acknowledgements and snoozes of databases.
+type AcknowledgementStore interface {
+	// PutAcknowledgement stores an acknowledgement, replacing an earlier one
+	// of the same database.
+	PutAcknowledgement(ctx context.Context, ack Acknowledgement) error
+	// GetAcknowledgements returns the acknowledgements of region keyed by
+	// Acknowledgement.Key. Expired acknowledgements may be included; use
+	// Active to check them.
+	GetAcknowledgements(ctx context.Context, region string) (map[string]Acknowledgement, error)
+	// DeleteAcknowledgements removes the acknowledgements of databases that
+	// recovered.
+	DeleteAcknowledgements(ctx context.Context, acks []Acknowledgement) error
+}
+
+// PutAcknowledgement stores an acknowledgement, replacing an earlier one of the
+// same database. DynamoDB removes it once it expires.
+func (s *DynamoDBStore) PutAcknowledgement(ctx context.Context, ack Acknowledgement) error {
+	_, err := s.table.Client.PutItem(ctx, &dynamodb.PutItemInput{
+		TableName: aws.String(s.table.Name),
+		Item: map[string]ddbTypes.AttributeValue{
+			"pk":        &ddbTypes.AttributeValueMemberS{Value: resourceKey(s.table.Account, ack.Region)},
+			"sk":        &ddbTypes.AttributeValueMemberS{Value: acknowledgementPrefix + ack.Key()},
+			"action":    &ddbTypes.AttributeValueMemberS{Value: ack.Action},
+			"createdAt": &ddbTypes.AttributeValueMemberN{Value: strconv.FormatInt(ack.CreatedAt.Unix(), 10)},
+			"until":     &ddbTypes.AttributeValueMemberN{Value: strconv.FormatInt(ack.Until.Unix(), 10)},
+			"ttl":       &ddbTypes.AttributeValueMemberN{Value: strconv.FormatInt(ack.Until.Unix(), 10)},
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("unable to store %s of %s in region %s: %v", ack.Action, ack.Key(), ack.Region, err)
+	}
+	return nil
+}
+
+// GetAcknowledgements returns the acknowledgements of region keyed by
+// Acknowledgement.Key. Expired acknowledgements that DynamoDB has not removed
+// yet are included; use Active to check them.
+func (s *DynamoDBStore) GetAcknowledgements(ctx context.Context, region string) (map[string]Acknowledgement, error) {
+	acks := make(map[string]Acknowledgement)
+	var lastEvaluatedKey map[string]ddbTypes.AttributeValue
+
+	for {
+		result, err := s.table.Client.Query(ctx, &dynamodb.QueryInput{
+			TableName:              aws.String(s.table.Name),
+			KeyConditionExpression: aws.String("pk = :pk AND begins_with(sk, :prefix)"),
+			ExpressionAttributeValues: map[string]ddbTypes.AttributeValue{
+				":pk":     &ddbTypes.AttributeValueMemberS{Value: resourceKey(s.table.Account, region)},
+				":prefix": &ddbTypes.AttributeValueMemberS{Value: acknowledgementPrefix},
+			},
+			ExclusiveStartKey: lastEvaluatedKey,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("unable to query acknowledgements in region %s: %v", region, err)
+		}
+
+		for _, item := range result.Items {
+			sk := item["sk"].(*ddbTypes.AttributeValueMemberS).Value
+			databaseType, databaseID, ok := strings.Cut(strings.TrimPrefix(sk, acknowledgementPrefix), "/")
+			if !ok {
+				return nil, fmt.Errorf("invalid acknowledgement key %q in region %s", sk, region)
+			}
+
+			ack := Acknowledgement{
+				Region:       region,
+				DatabaseType: databaseType,
+				DatabaseID:   databaseID,
+				Action:       item["action"].(*ddbTypes.AttributeValueMemberS).Value,
+				CreatedAt:    time.Unix(numberAttribute(item, "createdAt"), 0).UTC(),
+				Until:        time.Unix(numberAttribute(item, "until"), 0).UTC(),
+			}
+			acks[ack.Key()] = ack
+		}
+
+		lastEvaluatedKey = result.LastEvaluatedKey
+		if lastEvaluatedKey == nil {
+			break
+		}
+	}
+
+	return acks, nil
+}
+
+// DeleteAcknowledgements removes the acknowledgements of databases that recovered.
+func (s *DynamoDBStore) DeleteAcknowledgements(ctx context.Context, acks []Acknowledgement) error {
+	writeRequests := make([]ddbTypes.WriteRequest, len(acks))
+	for i, ack := range acks {
+		writeRequests[i] = ddbTypes.WriteRequest{
+			DeleteRequest: &ddbTypes.DeleteRequest{
+				Key: map[string]ddbTypes.AttributeValue{
+					"pk": &ddbTypes.AttributeValueMemberS{Value: resourceKey(s.table.Account, ack.Region)},
+					"sk": &ddbTypes.AttributeValueMemberS{Value: acknowledgementPrefix + ack.Key()},
+				},
+			},
+		}
+	}
+
+	if err := batchWrite(ctx, s.table, writeRequests); err != nil {
+		return fmt.Errorf("unable to delete acknowledgements: %v", err)
+	}
+	return nil
+}
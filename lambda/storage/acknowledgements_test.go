@@ -0,0 +1,30 @@
+package storage
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPutAcknowledgement(t *testing.T) {
+
+	client := &mockDynamoDBClient{}
+	err := testStore(client).PutAcknowledgement(context.Background(), Acknowledgement{
+		Region:       "us-east-1",
+		DatabaseType: "instance",
+		DatabaseID:   "db-1",
+		Action:       "snooze",
+		CreatedAt:    time.Unix(1732104000, 0),
+		Until:        time.Unix(1732118400, 0),
+	})
+	assert.NoError(t, err)
+
+	item := client.capturedPutItem.Item
+	assert.Equal(t, "resource#123456789012#us-east-1", item["pk"].(*types.AttributeValueMemberS).Value)
+	assert.Equal(t, "ack#instance/db-1", item["sk"].(*types.AttributeValueMemberS).Value)
+	assert.Equal(t, "1732118400", item["until"].(*types.AttributeValueMemberN).Value)
+	assert.Equal(t, "1732118400", item["ttl"].(*types.AttributeValueMemberN).Value)
+}
@@ -0,0 +1,214 @@
+package storage
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	ddbTypes "github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+const (
+	// checkpointTTL removes checkpoints that no run resumed, for example after
+	// the region was removed from the configuration.
+	checkpointTTL = 24 * time.Hour
+	// checkpointChunkSize is the number of snapshots stored per item, which
+	// keeps items well below the DynamoDB item size limit.
+	checkpointChunkSize = 100
+	// checkpointPositionKey is the sort key of the item holding the position.
+	checkpointPositionKey = "position"
+)
+
+func checkpointChunkKey(chunk int) string {
+	return fmt.Sprintf("chunk#%05d", chunk)
+}
+
+// Checkpoint is the progress of a snapshot scan of a region that stopped
+// before the Lambda deadline. Snapshots are the snapshots of the pages scanned
+// so far; Listing and Marker locate the next page.
+type Checkpoint struct {
+	Region    string
+	Listing   string
+	Marker    string
+	Pages     int
+	StartedAt time.Time
+	Snapshots []SnapshotInfo
+	// chunks is the number of snapshot items stored, so a later checkpoint only
+	// adds the snapshots of the pages scanned since.
+	chunks int
+	stored int
+}
+
+// CheckpointStore keeps the progress of paused region scans.
+type CheckpointStore interface {
+	// GetCheckpoint returns the checkpoint of region, or nil when the last
+	// scan of the region was complete.
+	GetCheckpoint(ctx context.Context, region string) (*Checkpoint, error)
+	// PutCheckpoint stores checkpoint, replacing the earlier checkpoint of its
+	// region. A checkpoint is never resumed without its snapshots.
+	PutCheckpoint(ctx context.Context, checkpoint *Checkpoint) error
+	// DeleteCheckpoint removes the checkpoint of a region whose scan
+	// completed.
+	DeleteCheckpoint(ctx context.Context, checkpoint *Checkpoint) error
+}
+
+// GetCheckpoint returns the checkpoint of region, or nil when the last scan of
+// the region was complete.
+func (s *DynamoDBStore) GetCheckpoint(ctx context.Context, region string) (*Checkpoint, error) {
+	var checkpoint *Checkpoint
+	var chunks [][]SnapshotInfo
+	storedChunks := -1
+	var lastEvaluatedKey map[string]ddbTypes.AttributeValue
+
+	for {
+		result, err := s.table.Client.Query(ctx, &dynamodb.QueryInput{
+			TableName:              aws.String(s.table.Name),
+			KeyConditionExpression: aws.String("pk = :pk"),
+			ExpressionAttributeValues: map[string]ddbTypes.AttributeValue{
+				":pk": &ddbTypes.AttributeValueMemberS{Value: checkpointKey(s.table.Account, region)},
+			},
+			ExclusiveStartKey: lastEvaluatedKey,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("unable to query checkpoint of region %s: %v", region, err)
+		}
+
+		for _, item := range result.Items {
+			sk := item["sk"].(*ddbTypes.AttributeValueMemberS).Value
+			if sk == checkpointPositionKey {
+				checkpoint = &Checkpoint{
+					Region:    region,
+					Listing:   item["listing"].(*ddbTypes.AttributeValueMemberS).Value,
+					Pages:     int(numberAttribute(item, "pages")),
+					StartedAt: time.Unix(numberAttribute(item, "startedAt"), 0).UTC(),
+				}
+				if marker, ok := item["marker"].(*ddbTypes.AttributeValueMemberS); ok {
+					checkpoint.Marker = marker.Value
+				}
+				if _, ok := item["chunks"]; ok {
+					storedChunks = int(numberAttribute(item, "chunks"))
+				}
+				continue
+			}
+
+			var chunk []SnapshotInfo
+			data := item["snapshots"].(*ddbTypes.AttributeValueMemberS).Value
+			if err := json.Unmarshal([]byte(data), &chunk); err != nil {
+				return nil, fmt.Errorf("invalid checkpoint %s of region %s: %v", sk, region, err)
+			}
+			chunks = append(chunks, chunk)
+		}
+
+		lastEvaluatedKey = result.LastEvaluatedKey
+		if lastEvaluatedKey == nil {
+			break
+		}
+	}
+
+	// Chunks without a position belong to a checkpoint that was being deleted
+	if checkpoint == nil {
+		return nil, nil
+	}
+
+	// Chunks past those of the position are left over from a checkpoint whose
+	// deletion failed part way. They sort after the chunks of the position.
+	if storedChunks >= 0 && storedChunks < len(chunks) {
+		chunks = chunks[:storedChunks]
+	}
+	for _, chunk := range chunks {
+		checkpoint.Snapshots = append(checkpoint.Snapshots, chunk...)
+	}
+	checkpoint.chunks = len(chunks)
+	checkpoint.stored = len(checkpoint.Snapshots)
+	return checkpoint, nil
+}
+
+// PutCheckpoint stores the position of checkpoint along with the snapshots
+// added since it was read. The position is written last, so a checkpoint is
+// never resumed without its snapshots.
+func (s *DynamoDBStore) PutCheckpoint(ctx context.Context, checkpoint *Checkpoint) error {
+	expirationTime := strconv.FormatInt(time.Now().Add(checkpointTTL).Unix(), 10)
+
+	var writeRequests []ddbTypes.WriteRequest
+	added := checkpoint.Snapshots[checkpoint.stored:]
+	for start := 0; start < len(added); start += checkpointChunkSize {
+		end := min(start+checkpointChunkSize, len(added))
+		data, err := json.Marshal(added[start:end])
+		if err != nil {
+			return fmt.Errorf("unable to marshal checkpoint of region %s: %v", checkpoint.Region, err)
+		}
+		writeRequests = append(writeRequests, ddbTypes.WriteRequest{
+			PutRequest: &ddbTypes.PutRequest{
+				Item: map[string]ddbTypes.AttributeValue{
+					"pk":        &ddbTypes.AttributeValueMemberS{Value: checkpointKey(s.table.Account, checkpoint.Region)},
+					"sk":        &ddbTypes.AttributeValueMemberS{Value: checkpointChunkKey(checkpoint.chunks + len(writeRequests))},
+					"snapshots": &ddbTypes.AttributeValueMemberS{Value: string(data)},
+					"ttl":       &ddbTypes.AttributeValueMemberN{Value: expirationTime},
+				},
+			},
+		})
+	}
+	if err := batchWrite(ctx, s.table, writeRequests); err != nil {
+		return fmt.Errorf("unable to store checkpoint of region %s: %v", checkpoint.Region, err)
+	}
+
+	item := map[string]ddbTypes.AttributeValue{
+		"pk":        &ddbTypes.AttributeValueMemberS{Value: checkpointKey(s.table.Account, checkpoint.Region)},
+		"sk":        &ddbTypes.AttributeValueMemberS{Value: checkpointPositionKey},
+		"listing":   &ddbTypes.AttributeValueMemberS{Value: checkpoint.Listing},
+		"pages":     &ddbTypes.AttributeValueMemberN{Value: strconv.Itoa(checkpoint.Pages)},
+		"chunks":    &ddbTypes.AttributeValueMemberN{Value: strconv.Itoa(checkpoint.chunks + len(writeRequests))},
+		"startedAt": &ddbTypes.AttributeValueMemberN{Value: strconv.FormatInt(checkpoint.StartedAt.Unix(), 10)},
+		"ttl":       &ddbTypes.AttributeValueMemberN{Value: expirationTime},
+	}
+	if checkpoint.Marker != "" {
+		item["marker"] = &ddbTypes.AttributeValueMemberS{Value: checkpoint.Marker}
+	}
+	_, err := s.table.Client.PutItem(ctx, &dynamodb.PutItemInput{
+		TableName: aws.String(s.table.Name),
+		Item:      item,
+	})
+	if err != nil {
+		return fmt.Errorf("unable to store checkpoint of region %s: %v", checkpoint.Region, err)
+	}
+
+	checkpoint.chunks += len(writeRequests)
+	checkpoint.stored = len(checkpoint.Snapshots)
+	return nil
+}
+
+// DeleteCheckpoint removes the checkpoint of a region whose scan completed. The
+// position is deleted on its own before the chunks, so a failure part way
+// leaves no checkpoint that could be resumed. Chunks that could not be deleted
+// are ignored by later checkpoints of the region and expire with their TTL.
+func (s *DynamoDBStore) DeleteCheckpoint(ctx context.Context, checkpoint *Checkpoint) error {
+	for _, keys := range [][]string{{checkpointPositionKey}, chunkKeys(checkpoint.chunks)} {
+		writeRequests := make([]ddbTypes.WriteRequest, len(keys))
+		for i, sk := range keys {
+			writeRequests[i] = ddbTypes.WriteRequest{
+				DeleteRequest: &ddbTypes.DeleteRequest{
+					Key: map[string]ddbTypes.AttributeValue{
+						"pk": &ddbTypes.AttributeValueMemberS{Value: checkpointKey(s.table.Account, checkpoint.Region)},
+						"sk": &ddbTypes.AttributeValueMemberS{Value: sk},
+					},
+				},
+			}
+		}
+		if err := batchWrite(ctx, s.table, writeRequests); err != nil {
+			return fmt.Errorf("unable to delete checkpoint of region %s: %v", checkpoint.Region, err)
+		}
+	}
+	return nil
+}
+
+func chunkKeys(chunks int) []string {
+	keys := make([]string, chunks)
+	for i := range keys {
+		keys[i] = checkpointChunkKey(i)
+	}
+	return keys
+}
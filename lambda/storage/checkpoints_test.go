@@ -0,0 +1,147 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGetCheckpointAfterFailures(t *testing.T) {
+	ctx := context.Background()
+	checkpointOf := func(snapshots int) *Checkpoint {
+		checkpoint := &Checkpoint{Region: "eu-west-1", Listing: "instance", Pages: 1, StartedAt: time.Unix(1732060800, 0)}
+		for i := range snapshots {
+			checkpoint.Snapshots = append(checkpoint.Snapshots, SnapshotInfo{SnapshotID: fmt.Sprintf("snap-%d", i)})
+		}
+		return checkpoint
+	}
+
+	t.Run("ignores chunks without a position", func(t *testing.T) {
+		table := newFakeDynamoDB()
+		table.failAt = 2
+		assert.Error(t, testStore(table).PutCheckpoint(ctx, checkpointOf(150)))
+
+		checkpoint, err := testStore(table).GetCheckpoint(ctx, "eu-west-1")
+		require.NoError(t, err)
+		assert.Nil(t, checkpoint)
+	})
+
+	t.Run("ignores chunks past those of the position", func(t *testing.T) {
+		table := newFakeDynamoDB()
+		store := testStore(table)
+		first := checkpointOf(150)
+		require.NoError(t, store.PutCheckpoint(ctx, first))
+
+		// Deleting the chunks fails after the position was deleted, and the
+		// next checkpoint has fewer chunks
+		table.failAt = table.writes + 2
+		assert.Error(t, store.DeleteCheckpoint(ctx, first))
+		table.failAt = 0
+		require.NoError(t, store.PutCheckpoint(ctx, checkpointOf(50)))
+
+		checkpoint, err := store.GetCheckpoint(ctx, "eu-west-1")
+		require.NoError(t, err)
+		require.NotNil(t, checkpoint)
+		assert.Len(t, checkpoint.Snapshots, 50)
+	})
+
+	t.Run("rejects invalid snapshots", func(t *testing.T) {
+		table := newFakeDynamoDB()
+		require.NoError(t, testStore(table).PutCheckpoint(ctx, checkpointOf(1)))
+		table.items[checkpointKey("123456789012", "eu-west-1")][checkpointChunkKey(0)]["snapshots"] = &types.AttributeValueMemberS{Value: "{"}
+
+		_, err := testStore(table).GetCheckpoint(ctx, "eu-west-1")
+		assert.ErrorContains(t, err, "invalid checkpoint")
+	})
+}
+
+func TestPutAndDeleteCheckpoint(t *testing.T) {
+	ctx := context.Background()
+	client := &mockDynamoDBClient{batchWriteOutput: &dynamodb.BatchWriteItemOutput{}}
+
+	checkpoint := &Checkpoint{Region: "eu-west-1", Listing: "instance", Marker: "page-2", Pages: 2, StartedAt: time.Unix(1732060800, 0)}
+	for i := 0; i < 150; i++ {
+		checkpoint.Snapshots = append(checkpoint.Snapshots, SnapshotInfo{SnapshotID: fmt.Sprintf("snap-%d", i)})
+	}
+	require.NoError(t, testStore(client).PutCheckpoint(ctx, checkpoint))
+
+	chunks := client.capturedBatchWrite.RequestItems["test-table"]
+	require.Len(t, chunks, 2)
+	assert.Equal(t, "chunk#00000", chunks[0].PutRequest.Item["sk"].(*types.AttributeValueMemberS).Value)
+	assert.Equal(t, "chunk#00001", chunks[1].PutRequest.Item["sk"].(*types.AttributeValueMemberS).Value)
+	assert.Contains(t, chunks[0].PutRequest.Item, "ttl")
+
+	position := client.capturedPutItem.Item
+	assert.Equal(t, "checkpoint#123456789012#eu-west-1", position["pk"].(*types.AttributeValueMemberS).Value)
+	assert.Equal(t, "position", position["sk"].(*types.AttributeValueMemberS).Value)
+	assert.Equal(t, "page-2", position["marker"].(*types.AttributeValueMemberS).Value)
+	assert.Equal(t, "2", position["pages"].(*types.AttributeValueMemberN).Value)
+	assert.Equal(t, "2", position["chunks"].(*types.AttributeValueMemberN).Value)
+
+	// A later checkpoint only stores the snapshots added since
+	client.capturedBatchWrite = nil
+	checkpoint.Snapshots = append(checkpoint.Snapshots, SnapshotInfo{SnapshotID: "snap-150"})
+	checkpoint.Listing, checkpoint.Marker = "cluster", ""
+	require.NoError(t, testStore(client).PutCheckpoint(ctx, checkpoint))
+
+	chunks = client.capturedBatchWrite.RequestItems["test-table"]
+	require.Len(t, chunks, 1)
+	assert.Equal(t, "chunk#00002", chunks[0].PutRequest.Item["sk"].(*types.AttributeValueMemberS).Value)
+	assert.NotContains(t, client.capturedPutItem.Item, "marker")
+	assert.Equal(t, "3", client.capturedPutItem.Item["chunks"].(*types.AttributeValueMemberN).Value)
+
+	// The chunks are deleted after the position
+	require.NoError(t, testStore(client).DeleteCheckpoint(ctx, checkpoint))
+	deletes := client.capturedBatchWrite.RequestItems["test-table"]
+	require.Len(t, deletes, 3)
+	assert.Equal(t, "chunk#00000", deletes[0].DeleteRequest.Key["sk"].(*types.AttributeValueMemberS).Value)
+	assert.Equal(t, "chunk#00002", deletes[2].DeleteRequest.Key["sk"].(*types.AttributeValueMemberS).Value)
+}
+
+// batchRecorder records the batches written and fails the failAt-th one.
+type batchRecorder struct {
+	mockDynamoDBClient
+	failAt  int
+	batches [][]types.WriteRequest
+}
+
+func (m *batchRecorder) BatchWriteItem(ctx context.Context, params *dynamodb.BatchWriteItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.BatchWriteItemOutput, error) {
+	m.batches = append(m.batches, params.RequestItems["test-table"])
+	if len(m.batches) == m.failAt {
+		return nil, fmt.Errorf("DynamoDB error")
+	}
+	return &dynamodb.BatchWriteItemOutput{}, nil
+}
+
+func TestDeleteCheckpointFailure(t *testing.T) {
+	checkpoint := &Checkpoint{Region: "eu-west-1", Listing: "instance", chunks: 2}
+
+	t.Run("keeps the chunks when the position cannot be deleted", func(t *testing.T) {
+		client := &batchRecorder{failAt: 1}
+		err := testStore(client).DeleteCheckpoint(context.Background(), checkpoint)
+		assert.ErrorContains(t, err, "unable to delete checkpoint of region eu-west-1")
+		assert.Len(t, client.batches, 1)
+	})
+
+	t.Run("deletes the position before the chunks fail", func(t *testing.T) {
+		client := &batchRecorder{failAt: 2}
+		err := testStore(client).DeleteCheckpoint(context.Background(), checkpoint)
+		assert.ErrorContains(t, err, "unable to delete checkpoint of region eu-west-1")
+		require.Len(t, client.batches, 2)
+		require.Len(t, client.batches[0], 1)
+		assert.Equal(t, "position", client.batches[0][0].DeleteRequest.Key["sk"].(*types.AttributeValueMemberS).Value)
+	})
+}
+
+func TestPutCheckpointFailure(t *testing.T) {
+	client := &mockDynamoDBClient{putItemErr: fmt.Errorf("DynamoDB error")}
+	checkpoint := &Checkpoint{Region: "eu-west-1", Listing: "instance"}
+
+	assert.ErrorContains(t, testStore(client).PutCheckpoint(context.Background(), checkpoint), "unable to store checkpoint of region eu-west-1")
+}
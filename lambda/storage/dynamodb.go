@@ -3,7 +3,7 @@ package storage
 import (
 	"context"
 	"fmt"
-	"os"
+	"math/rand/v2"
 	"time"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
@@ -14,89 +14,193 @@ import (
 type DDBClient interface {
 	Query(ctx context.Context, params *dynamodb.QueryInput, optFns ...func(*dynamodb.Options)) (*dynamodb.QueryOutput, error)
 	BatchWriteItem(ctx context.Context, params *dynamodb.BatchWriteItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.BatchWriteItemOutput, error)
+	GetItem(ctx context.Context, params *dynamodb.GetItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.GetItemOutput, error)
+	PutItem(ctx context.Context, params *dynamodb.PutItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.PutItemOutput, error)
 }
 
-func GetProcessedSnapshots(ctx context.Context, ddbClient DDBClient, region string) (map[string]string, error) {
-	processedSnapshots := make(map[string]string)
-	var lastEvaluatedKey map[string]ddbTypes.AttributeValue
+// Table is a DynamoDB table and the account whose rows it keeps. The rows of
+// an account are kept in the partitions of Account.
+type Table struct {
+	Client  DDBClient
+	Name    string
+	Account string
+}
 
-	for {
-		input := &dynamodb.QueryInput{
-			TableName:              aws.String(os.Getenv("DYNAMODB_TABLE_NAME")),
-			KeyConditionExpression: aws.String("pk = :region"),
-			ExpressionAttributeValues: map[string]ddbTypes.AttributeValue{
-				":region": &ddbTypes.AttributeValueMemberS{Value: region},
-			},
-		}
+// DynamoDBStore is the StateStore of a DynamoDB table for the rows of an
+// account. Snapshot status rows are kept in the snapshot partition of their
+// account and region, sorted by snapshot ARN; see keys.go for the other rows.
+type DynamoDBStore struct {
+	table Table
+}
 
-		if lastEvaluatedKey != nil {
-			input.ExclusiveStartKey = lastEvaluatedKey
-		}
+func NewDynamoDBStore(client DDBClient, table, account string) *DynamoDBStore {
+	return &DynamoDBStore{table: Table{Client: client, Name: table, Account: account}}
+}
+
+func (s *DynamoDBStore) GetProcessedSnapshots(ctx context.Context, region string) (map[string]SnapshotState, error) {
+	processedSnapshots, err := s.queryStates(ctx, &dynamodb.QueryInput{
+		TableName:              aws.String(s.table.Name),
+		KeyConditionExpression: aws.String("pk = :pk"),
+		ExpressionAttributeValues: map[string]ddbTypes.AttributeValue{
+			":pk": &ddbTypes.AttributeValueMemberS{Value: snapshotKey(s.table.Account, region)},
+		},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("unable to query snapshots from DynamoDB in region %s: %v", region, err)
+	}
+	return processedSnapshots, nil
+}
 
-		result, err := ddbClient.Query(ctx, input)
+// GetSourceSnapshots looks the snapshots of a database up in the source index.
+func (s *DynamoDBStore) GetSourceSnapshots(ctx context.Context, region, sourceType, sourceID string) (map[string]string, error) {
+	sourceSnapshots, err := s.queryStates(ctx, &dynamodb.QueryInput{
+		TableName:              aws.String(s.table.Name),
+		IndexName:              aws.String(sourceIndex),
+		KeyConditionExpression: aws.String("#source = :source"),
+		ExpressionAttributeNames: map[string]string{
+			"#source": "source",
+		},
+		ExpressionAttributeValues: map[string]ddbTypes.AttributeValue{
+			":source": &ddbTypes.AttributeValueMemberS{Value: sourceKey(s.table.Account, region, sourceType, sourceID)},
+		},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("unable to query snapshots of database %s in region %s: %v", sourceID, region, err)
+	}
+	return Statuses(sourceSnapshots), nil
+}
+
+// queryStates returns the state of the snapshot rows of input by snapshot
+// key. Rows without a TTL, which the source index does not project, keep a
+// zero ExpiresAt.
+func (s *DynamoDBStore) queryStates(ctx context.Context, input *dynamodb.QueryInput) (map[string]SnapshotState, error) {
+	states := make(map[string]SnapshotState)
+	for {
+		result, err := s.table.Client.Query(ctx, input)
 		if err != nil {
-			return nil, fmt.Errorf("unable to query snapshots from DynamoDB in region %s: %v", region, err)
+			return nil, err
 		}
 
 		for _, item := range result.Items {
-			snapshotID := item["sk"].(*ddbTypes.AttributeValueMemberS).Value
-			status := item["status"].(*ddbTypes.AttributeValueMemberS).Value
-			processedSnapshots[snapshotID] = status
+			key := item["sk"].(*ddbTypes.AttributeValueMemberS).Value
+			state := SnapshotState{Status: item["status"].(*ddbTypes.AttributeValueMemberS).Value}
+			if ttl := numberAttribute(item, "ttl"); ttl > 0 {
+				state.ExpiresAt = time.Unix(ttl, 0)
+			}
+			states[key] = state
 		}
 
-		lastEvaluatedKey = result.LastEvaluatedKey
-		if lastEvaluatedKey == nil {
+		input.ExclusiveStartKey = result.LastEvaluatedKey
+		if input.ExclusiveStartKey == nil {
 			break // No more items to fetch
 		}
 	}
-
-	return processedSnapshots, nil
+	return states, nil
 }
 
-// BatchUpdateSnapshotStates updates multiple snapshot states at once using BatchWriteItem
-func BatchUpdateSnapshotStates(ctx context.Context, ddbClient DDBClient, region string, snapshots []SnapshotInfo, snapshotAgeDays int) error {
-	if len(snapshots) == 0 {
+// Retries of the items that BatchWriteItem leaves unprocessed, for example
+// when the table is throttled. The delay doubles with every attempt, up to
+// batchWriteMaxDelay, and a random part of it is waited.
+const (
+	batchWriteAttempts  = 8
+	batchWriteBaseDelay = 50 * time.Millisecond
+	batchWriteMaxDelay  = 5 * time.Second
+)
+
+// sleep waits between retries of unprocessed items. Tests replace it to run
+// without delays.
+var sleep = func(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
 		return nil
+	case <-ctx.Done():
+		return ctx.Err()
 	}
+}
 
-	// DynamoDB BatchWriteItem can process up to 25 items at once
+// backoff returns the delay before retry attempt, with full jitter.
+func backoff(attempt int) time.Duration {
+	delay := min(batchWriteBaseDelay<<attempt, batchWriteMaxDelay)
+	return rand.N(delay) + 1
+}
+
+// batchWrite sends writeRequests to table in batches of 25, the most
+// BatchWriteItem accepts. Items left unprocessed are retried with backoff; it
+// fails when items are still unprocessed after batchWriteAttempts.
+func batchWrite(ctx context.Context, table Table, writeRequests []ddbTypes.WriteRequest) error {
 	const batchSize = 25
-	expirationTime := time.Now().Add(time.Duration(snapshotAgeDays) * 24 * time.Hour)
-	tableName := os.Getenv("DYNAMODB_TABLE_NAME")
 
-	// Process snapshots in batches of 25
-	for i := 0; i < len(snapshots); i += batchSize {
+	for i := 0; i < len(writeRequests); i += batchSize {
 		end := i + batchSize
-		if end > len(snapshots) {
-			end = len(snapshots)
+		if end > len(writeRequests) {
+			end = len(writeRequests)
 		}
 
-		batch := snapshots[i:end]
-		writeRequests := make([]ddbTypes.WriteRequest, len(batch))
-
-		for j, snapshot := range batch {
-			writeRequests[j] = ddbTypes.WriteRequest{
-				PutRequest: &ddbTypes.PutRequest{
-					Item: map[string]ddbTypes.AttributeValue{
-						"pk":     &ddbTypes.AttributeValueMemberS{Value: region},
-						"sk":     &ddbTypes.AttributeValueMemberS{Value: snapshot.SnapshotID},
-						"status": &ddbTypes.AttributeValueMemberS{Value: snapshot.Status},
-						"ttl":    &ddbTypes.AttributeValueMemberN{Value: fmt.Sprintf("%d", expirationTime.Unix())},
-					},
+		pending := writeRequests[i:end]
+		for attempt := 0; ; attempt++ {
+			output, err := table.Client.BatchWriteItem(ctx, &dynamodb.BatchWriteItemInput{
+				RequestItems: map[string][]ddbTypes.WriteRequest{
+					table.Name: pending,
 				},
+			})
+			if err != nil {
+				return err
+			}
+			if output == nil || len(output.UnprocessedItems[table.Name]) == 0 {
+				break
+			}
+
+			pending = output.UnprocessedItems[table.Name]
+			if attempt+1 == batchWriteAttempts {
+				return fmt.Errorf("%d items unprocessed after %d attempts", len(pending), batchWriteAttempts)
+			}
+			fmt.Printf("Retrying %d unprocessed DynamoDB writes\n", len(pending))
+			if err := sleep(ctx, backoff(attempt)); err != nil {
+				return err
 			}
 		}
+	}
 
-		_, err := ddbClient.BatchWriteItem(ctx, &dynamodb.BatchWriteItemInput{
-			RequestItems: map[string][]ddbTypes.WriteRequest{
-				tableName: writeRequests,
-			},
-		})
+	return nil
+}
 
-		if err != nil {
-			return fmt.Errorf("unable to batch update snapshot states in DynamoDB for region %s: %v", region, err)
+// BatchUpdateSnapshotStates updates multiple snapshot states at once using BatchWriteItem
+func (s *DynamoDBStore) BatchUpdateSnapshotStates(ctx context.Context, region string, snapshots []SnapshotInfo, retention Retention) error {
+	if len(snapshots) == 0 {
+		return nil
+	}
+
+	now := time.Now()
+	writeRequests := make([]ddbTypes.WriteRequest, len(snapshots))
+	for i, snapshot := range snapshots {
+		writeRequests[i] = ddbTypes.WriteRequest{
+			PutRequest: &ddbTypes.PutRequest{
+				Item: s.snapshotItem(region, snapshot, retention.ExpiresAt(snapshot.Status, now)),
+			},
 		}
 	}
 
+	if err := batchWrite(ctx, s.table, writeRequests); err != nil {
+		return fmt.Errorf("unable to batch update snapshot states in DynamoDB for region %s: %v", region, err)
+	}
+
 	return nil
 }
+
+// snapshotItem is the status row of snapshot. Rows of snapshots with a source
+// database are added to the source index.
+func (s *DynamoDBStore) snapshotItem(region string, snapshot SnapshotInfo, expirationTime time.Time) map[string]ddbTypes.AttributeValue {
+	item := map[string]ddbTypes.AttributeValue{
+		"pk":         &ddbTypes.AttributeValueMemberS{Value: snapshotKey(s.table.Account, region)},
+		"sk":         &ddbTypes.AttributeValueMemberS{Value: snapshot.Key()},
+		"snapshotId": &ddbTypes.AttributeValueMemberS{Value: snapshot.SnapshotID},
+		"status":     &ddbTypes.AttributeValueMemberS{Value: snapshot.Status},
+		"ttl":        &ddbTypes.AttributeValueMemberN{Value: fmt.Sprintf("%d", expirationTime.Unix())},
+	}
+	if snapshot.SourceID != "" {
+		item["source"] = &ddbTypes.AttributeValueMemberS{Value: sourceKey(s.table.Account, region, snapshot.SnapshotType, snapshot.SourceID)}
+	}
+	return item
+}
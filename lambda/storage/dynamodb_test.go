@@ -3,8 +3,11 @@ package storage
 import (
 	"context"
 	"fmt"
+	"maps"
 	"os"
+	"slices"
 	"strconv"
+	"strings"
 	"testing"
 	"time"
 
@@ -16,12 +19,18 @@ import (
 type mockDynamoDBClient struct {
 	queryOutput        *dynamodb.QueryOutput
 	batchWriteOutput   *dynamodb.BatchWriteItemOutput
+	getItemOutput      *dynamodb.GetItemOutput
 	queryErr           error
 	batchWriteItemErr  error
+	getItemErr         error
+	putItemErr         error
+	capturedQuery      *dynamodb.QueryInput
 	capturedBatchWrite *dynamodb.BatchWriteItemInput
+	capturedPutItem    *dynamodb.PutItemInput
 }
 
 func (m *mockDynamoDBClient) Query(ctx context.Context, params *dynamodb.QueryInput, optFns ...func(*dynamodb.Options)) (*dynamodb.QueryOutput, error) {
+	m.capturedQuery = params
 	if m.queryErr != nil {
 		return nil, m.queryErr
 	}
@@ -36,6 +45,110 @@ func (m *mockDynamoDBClient) BatchWriteItem(ctx context.Context, params *dynamod
 	return m.batchWriteOutput, nil
 }
 
+func (m *mockDynamoDBClient) GetItem(ctx context.Context, params *dynamodb.GetItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.GetItemOutput, error) {
+	if m.getItemErr != nil {
+		return nil, m.getItemErr
+	}
+	return m.getItemOutput, nil
+}
+
+func (m *mockDynamoDBClient) PutItem(ctx context.Context, params *dynamodb.PutItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.PutItemOutput, error) {
+	m.capturedPutItem = params
+	if m.putItemErr != nil {
+		return nil, m.putItemErr
+	}
+	return &dynamodb.PutItemOutput{}, nil
+}
+
+// testStore is the DynamoDBStore of client in tests.
+func testStore(client DDBClient) *DynamoDBStore {
+	return NewDynamoDBStore(client, "test-table", "123456789012")
+}
+
+// fakeDynamoDB is an in-memory table for round trips through DynamoDBStore.
+// Queries match the partition key and an optional sort key prefix; the
+// indexes, TTL and conditions are not supported. With failAt set, the
+// failAt-th write and those after it fail.
+type fakeDynamoDB struct {
+	items  map[string]map[string]map[string]types.AttributeValue
+	writes int
+	failAt int
+}
+
+func newFakeDynamoDB() *fakeDynamoDB {
+	return &fakeDynamoDB{items: make(map[string]map[string]map[string]types.AttributeValue)}
+}
+
+func stringValue(value types.AttributeValue) string {
+	if value, ok := value.(*types.AttributeValueMemberS); ok {
+		return value.Value
+	}
+	return ""
+}
+
+func (f *fakeDynamoDB) write() error {
+	f.writes++
+	if f.failAt > 0 && f.writes >= f.failAt {
+		return fmt.Errorf("DynamoDB error")
+	}
+	return nil
+}
+
+func (f *fakeDynamoDB) put(item map[string]types.AttributeValue) {
+	pk, sk := stringValue(item["pk"]), stringValue(item["sk"])
+	if f.items[pk] == nil {
+		f.items[pk] = make(map[string]map[string]types.AttributeValue)
+	}
+	f.items[pk][sk] = item
+}
+
+// delete removes the item with pk and sk.
+func (f *fakeDynamoDB) delete(pk, sk string) {
+	delete(f.items[pk], sk)
+}
+
+func (f *fakeDynamoDB) Query(ctx context.Context, params *dynamodb.QueryInput, optFns ...func(*dynamodb.Options)) (*dynamodb.QueryOutput, error) {
+	partition := f.items[stringValue(params.ExpressionAttributeValues[":pk"])]
+	prefix := stringValue(params.ExpressionAttributeValues[":prefix"])
+
+	output := &dynamodb.QueryOutput{}
+	for _, sk := range slices.Sorted(maps.Keys(partition)) {
+		if strings.HasPrefix(sk, prefix) {
+			output.Items = append(output.Items, partition[sk])
+		}
+	}
+	return output, nil
+}
+
+func (f *fakeDynamoDB) BatchWriteItem(ctx context.Context, params *dynamodb.BatchWriteItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.BatchWriteItemOutput, error) {
+	if err := f.write(); err != nil {
+		return nil, err
+	}
+	for _, requests := range params.RequestItems {
+		for _, request := range requests {
+			if request.PutRequest != nil {
+				f.put(request.PutRequest.Item)
+			}
+			if request.DeleteRequest != nil {
+				f.delete(stringValue(request.DeleteRequest.Key["pk"]), stringValue(request.DeleteRequest.Key["sk"]))
+			}
+		}
+	}
+	return &dynamodb.BatchWriteItemOutput{}, nil
+}
+
+func (f *fakeDynamoDB) GetItem(ctx context.Context, params *dynamodb.GetItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.GetItemOutput, error) {
+	return &dynamodb.GetItemOutput{Item: f.items[stringValue(params.Key["pk"])][stringValue(params.Key["sk"])]}, nil
+}
+
+func (f *fakeDynamoDB) PutItem(ctx context.Context, params *dynamodb.PutItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.PutItemOutput, error) {
+	if err := f.write(); err != nil {
+		return nil, err
+	}
+	f.put(params.Item)
+	return &dynamodb.PutItemOutput{}, nil
+}
+
 func TestGetProcessedSnapshots(t *testing.T) {
 	ctx := context.Background()
 	region := "us-west-2"
@@ -43,7 +156,7 @@ func TestGetProcessedSnapshots(t *testing.T) {
 	tests := []struct {
 		name           string
 		client         DDBClient
-		expectedResult map[string]string
+		expectedResult map[string]SnapshotState
 		wantErr        bool
 	}{
 		{
@@ -58,6 +171,9 @@ func TestGetProcessedSnapshots(t *testing.T) {
 							"status": &types.AttributeValueMemberS{
 								Value: "available",
 							},
+							"ttl": &types.AttributeValueMemberN{
+								Value: "1732060800",
+							},
 						},
 						{
 							"sk": &types.AttributeValueMemberS{
@@ -70,9 +186,31 @@ func TestGetProcessedSnapshots(t *testing.T) {
 					},
 				},
 			},
-			expectedResult: map[string]string{
-				"snap-1": "available",
-				"snap-2": "creating",
+			expectedResult: map[string]SnapshotState{
+				"snap-1": {Status: "available", ExpiresAt: time.Unix(1732060800, 0)},
+				"snap-2": {Status: "creating"},
+			},
+			wantErr: false,
+		},
+		{
+			name: "tells instance and cluster snapshots of the same name apart",
+			client: &mockDynamoDBClient{
+				queryOutput: &dynamodb.QueryOutput{
+					Items: []map[string]types.AttributeValue{
+						{
+							"sk":     &types.AttributeValueMemberS{Value: "arn:aws:rds:us-west-2:123456789012:snapshot:nightly"},
+							"status": &types.AttributeValueMemberS{Value: "failed"},
+						},
+						{
+							"sk":     &types.AttributeValueMemberS{Value: "arn:aws:rds:us-west-2:123456789012:cluster-snapshot:nightly"},
+							"status": &types.AttributeValueMemberS{Value: "available"},
+						},
+					},
+				},
+			},
+			expectedResult: map[string]SnapshotState{
+				"arn:aws:rds:us-west-2:123456789012:snapshot:nightly":         {Status: "failed"},
+				"arn:aws:rds:us-west-2:123456789012:cluster-snapshot:nightly": {Status: "available"},
 			},
 			wantErr: false,
 		},
@@ -83,7 +221,7 @@ func TestGetProcessedSnapshots(t *testing.T) {
 					Items: []map[string]types.AttributeValue{},
 				},
 			},
-			expectedResult: map[string]string{},
+			expectedResult: map[string]SnapshotState{},
 			wantErr:        false,
 		},
 		{
@@ -98,7 +236,7 @@ func TestGetProcessedSnapshots(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			result, err := GetProcessedSnapshots(ctx, tt.client, region)
+			result, err := NewDynamoDBStore(tt.client, "test-table", "123456789012").GetProcessedSnapshots(ctx, region)
 
 			if tt.wantErr {
 				assert.Error(t, err)
@@ -116,7 +254,6 @@ func TestBatchUpdateSnapshotStates(t *testing.T) {
 	now := time.Now()
 
 	// Set environment variables for tests
-	t.Setenv("DYNAMODB_TABLE_NAME", "test-table")
 	t.Setenv("SCHEDULE_EXPRESSION", "rate(10 minutes)")
 	t.Setenv("SNAPSHOT_AGE_DAYS", "7")
 
@@ -197,7 +334,7 @@ func TestBatchUpdateSnapshotStates(t *testing.T) {
 			tt.client.capturedBatchWrite = nil
 			snapshotAgeDays, _ := strconv.Atoi(os.Getenv("SNAPSHOT_AGE_DAYS"))
 
-			err := BatchUpdateSnapshotStates(ctx, tt.client, region, tt.snapshots, snapshotAgeDays)
+			err := NewDynamoDBStore(tt.client, "test-table", "123456789012").BatchUpdateSnapshotStates(ctx, region, tt.snapshots, Retention{Days: snapshotAgeDays})
 
 			if tt.wantErr {
 				assert.Error(t, err)
@@ -228,3 +365,130 @@ func TestBatchUpdateSnapshotStates(t *testing.T) {
 		})
 	}
 }
+
+func TestSnapshotStateKeys(t *testing.T) {
+	ctx := context.Background()
+	snapshot := SnapshotInfo{
+		SnapshotID:   "nightly",
+		SnapshotArn:  "arn:aws:rds:us-west-2:123456789012:cluster-snapshot:nightly",
+		SnapshotType: "cluster",
+		SourceID:     "aurora-1",
+		Status:       "failed",
+	}
+
+	t.Run("keys status rows by account, region and ARN", func(t *testing.T) {
+		client := &mockDynamoDBClient{batchWriteOutput: &dynamodb.BatchWriteItemOutput{}}
+		store := NewDynamoDBStore(client, "test-table", "123456789012")
+		assert.NoError(t, store.BatchUpdateSnapshotStates(ctx, "us-west-2", []SnapshotInfo{snapshot}, Retention{Days: 7}))
+
+		item := client.capturedBatchWrite.RequestItems["test-table"][0].PutRequest.Item
+		assert.Equal(t, "snapshot#123456789012#us-west-2", item["pk"].(*types.AttributeValueMemberS).Value)
+		assert.Equal(t, snapshot.SnapshotArn, item["sk"].(*types.AttributeValueMemberS).Value)
+		assert.Equal(t, "nightly", item["snapshotId"].(*types.AttributeValueMemberS).Value)
+		assert.Equal(t, "123456789012#us-west-2#cluster/aurora-1", item["source"].(*types.AttributeValueMemberS).Value)
+	})
+
+	t.Run("looks snapshots up by source database", func(t *testing.T) {
+		client := &mockDynamoDBClient{
+			queryOutput: &dynamodb.QueryOutput{
+				Items: []map[string]types.AttributeValue{
+					{
+						"sk":     &types.AttributeValueMemberS{Value: snapshot.SnapshotArn},
+						"status": &types.AttributeValueMemberS{Value: "failed"},
+					},
+				},
+			},
+		}
+		store := NewDynamoDBStore(client, "test-table", "123456789012")
+
+		snapshots, err := store.GetSourceSnapshots(ctx, "us-west-2", "cluster", "aurora-1")
+		assert.NoError(t, err)
+		assert.Equal(t, map[string]string{snapshot.SnapshotArn: "failed"}, snapshots)
+		assert.Equal(t, "source", *client.capturedQuery.IndexName)
+		assert.Equal(t, "123456789012#us-west-2#cluster/aurora-1",
+			client.capturedQuery.ExpressionAttributeValues[":source"].(*types.AttributeValueMemberS).Value)
+	})
+}
+
+// throttledDynamoDBClient leaves the last item of a batch unprocessed for the
+// first throttled calls, as DynamoDB does when the table is throttled.
+type throttledDynamoDBClient struct {
+	mockDynamoDBClient
+	throttled int
+	calls     int
+	written   []string
+}
+
+func (m *throttledDynamoDBClient) BatchWriteItem(ctx context.Context, params *dynamodb.BatchWriteItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.BatchWriteItemOutput, error) {
+	m.calls++
+	requests := params.RequestItems["test-table"]
+	if m.calls <= m.throttled {
+		last := len(requests) - 1
+		requests, unprocessed := requests[:last], requests[last:]
+		for _, request := range requests {
+			m.written = append(m.written, request.PutRequest.Item["sk"].(*types.AttributeValueMemberS).Value)
+		}
+		return &dynamodb.BatchWriteItemOutput{
+			UnprocessedItems: map[string][]types.WriteRequest{"test-table": unprocessed},
+		}, nil
+	}
+	for _, request := range requests {
+		m.written = append(m.written, request.PutRequest.Item["sk"].(*types.AttributeValueMemberS).Value)
+	}
+	return &dynamodb.BatchWriteItemOutput{}, nil
+}
+
+func TestBatchWriteRetriesUnprocessedItems(t *testing.T) {
+	ctx := context.Background()
+
+	var delays []time.Duration
+	defer func(original func(context.Context, time.Duration) error) { sleep = original }(sleep)
+	sleep = func(ctx context.Context, d time.Duration) error {
+		delays = append(delays, d)
+		return ctx.Err()
+	}
+
+	snapshots := []SnapshotInfo{{SnapshotID: "snap-1", Status: "available"}, {SnapshotID: "snap-2", Status: "failed"}}
+
+	t.Run("writes items left unprocessed", func(t *testing.T) {
+		delays = nil
+		client := &throttledDynamoDBClient{throttled: 3}
+
+		assert.NoError(t, NewDynamoDBStore(client, "test-table", "123456789012").BatchUpdateSnapshotStates(ctx, "us-west-2", snapshots, Retention{Days: 7}))
+		assert.Equal(t, 4, client.calls)
+		assert.Equal(t, []string{"snap-1", "snap-2"}, client.written)
+		assert.Len(t, delays, 3)
+		for attempt, delay := range delays {
+			assert.Positive(t, delay)
+			assert.LessOrEqual(t, delay, batchWriteBaseDelay<<attempt)
+		}
+	})
+
+	t.Run("fails when items stay unprocessed", func(t *testing.T) {
+		delays = nil
+		client := &throttledDynamoDBClient{throttled: 100}
+
+		err := NewDynamoDBStore(client, "test-table", "123456789012").BatchUpdateSnapshotStates(ctx, "us-west-2", snapshots, Retention{Days: 7})
+		assert.ErrorContains(t, err, "1 items unprocessed after 8 attempts")
+		assert.Equal(t, batchWriteAttempts, client.calls)
+		assert.Len(t, delays, batchWriteAttempts-1)
+	})
+
+	t.Run("stops retrying when the context is done", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(ctx)
+		cancel()
+		client := &throttledDynamoDBClient{throttled: 100}
+
+		err := NewDynamoDBStore(client, "test-table", "123456789012").BatchUpdateSnapshotStates(ctx, "us-west-2", snapshots, Retention{Days: 7})
+		assert.ErrorContains(t, err, context.Canceled.Error())
+		assert.Equal(t, 1, client.calls)
+	})
+}
+
+func TestBackoff(t *testing.T) {
+	for attempt := 0; attempt < 12; attempt++ {
+		delay := backoff(attempt)
+		assert.Positive(t, delay)
+		assert.LessOrEqual(t, delay, batchWriteMaxDelay)
+	}
+}
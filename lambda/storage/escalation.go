@@ -0,0 +1,149 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	ddbTypes "github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// escalationPrefix marks escalation rows in the resource partition of their
+// region.
+const escalationPrefix = "escalation#"
+
+// EscalationState tracks the reminders sent for an unhealthy database.
+type EscalationState struct {
+	Region       string
+	DatabaseType string
+	DatabaseID   string
+	Problem      string
+	SnapshotID   string
+	Since        time.Time
+	LastNotified time.Time
+	Reminders    int
+}
+
+// Key identifies the database of the state within its region.
+func (s EscalationState) Key() string {
+	return s.DatabaseType + "/" + s.DatabaseID
+}
+
+// EscalationStore keeps the reminders sent for unhealthy databases.
+type EscalationStore interface {
+	// GetEscalationStates returns the escalation states of region keyed by
+	// EscalationState.Key.
+	GetEscalationStates(ctx context.Context, region string) (map[string]EscalationState, error)
+	// PutEscalationStates creates or replaces escalation states.
+	PutEscalationStates(ctx context.Context, states []EscalationState) error
+	// DeleteEscalationStates removes the states of databases that recovered.
+	DeleteEscalationStates(ctx context.Context, states []EscalationState) error
+}
+
+// GetEscalationStates returns the escalation states of region keyed by
+// EscalationState.Key.
+func (s *DynamoDBStore) GetEscalationStates(ctx context.Context, region string) (map[string]EscalationState, error) {
+	states := make(map[string]EscalationState)
+	var lastEvaluatedKey map[string]ddbTypes.AttributeValue
+
+	for {
+		result, err := s.table.Client.Query(ctx, &dynamodb.QueryInput{
+			TableName:              aws.String(s.table.Name),
+			KeyConditionExpression: aws.String("pk = :pk AND begins_with(sk, :prefix)"),
+			ExpressionAttributeValues: map[string]ddbTypes.AttributeValue{
+				":pk":     &ddbTypes.AttributeValueMemberS{Value: resourceKey(s.table.Account, region)},
+				":prefix": &ddbTypes.AttributeValueMemberS{Value: escalationPrefix},
+			},
+			ExclusiveStartKey: lastEvaluatedKey,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("unable to query escalation states in region %s: %v", region, err)
+		}
+
+		for _, item := range result.Items {
+			state, err := escalationStateFromItem(region, item)
+			if err != nil {
+				return nil, err
+			}
+			states[state.Key()] = state
+		}
+
+		lastEvaluatedKey = result.LastEvaluatedKey
+		if lastEvaluatedKey == nil {
+			break
+		}
+	}
+
+	return states, nil
+}
+
+// PutEscalationStates creates or replaces escalation states. The rows have no
+// TTL; they are deleted once the database recovers.
+func (s *DynamoDBStore) PutEscalationStates(ctx context.Context, states []EscalationState) error {
+	writeRequests := make([]ddbTypes.WriteRequest, len(states))
+	for i, state := range states {
+		writeRequests[i] = ddbTypes.WriteRequest{
+			PutRequest: &ddbTypes.PutRequest{
+				Item: map[string]ddbTypes.AttributeValue{
+					"pk":           &ddbTypes.AttributeValueMemberS{Value: resourceKey(s.table.Account, state.Region)},
+					"sk":           &ddbTypes.AttributeValueMemberS{Value: escalationPrefix + state.Key()},
+					"problem":      &ddbTypes.AttributeValueMemberS{Value: state.Problem},
+					"snapshotId":   &ddbTypes.AttributeValueMemberS{Value: state.SnapshotID},
+					"since":        &ddbTypes.AttributeValueMemberN{Value: strconv.FormatInt(state.Since.Unix(), 10)},
+					"lastNotified": &ddbTypes.AttributeValueMemberN{Value: strconv.FormatInt(state.LastNotified.Unix(), 10)},
+					"reminders":    &ddbTypes.AttributeValueMemberN{Value: strconv.Itoa(state.Reminders)},
+				},
+			},
+		}
+	}
+
+	if err := batchWrite(ctx, s.table, writeRequests); err != nil {
+		return fmt.Errorf("unable to store escalation states: %v", err)
+	}
+	return nil
+}
+
+// DeleteEscalationStates removes the states of databases that recovered.
+func (s *DynamoDBStore) DeleteEscalationStates(ctx context.Context, states []EscalationState) error {
+	writeRequests := make([]ddbTypes.WriteRequest, len(states))
+	for i, state := range states {
+		writeRequests[i] = ddbTypes.WriteRequest{
+			DeleteRequest: &ddbTypes.DeleteRequest{
+				Key: map[string]ddbTypes.AttributeValue{
+					"pk": &ddbTypes.AttributeValueMemberS{Value: resourceKey(s.table.Account, state.Region)},
+					"sk": &ddbTypes.AttributeValueMemberS{Value: escalationPrefix + state.Key()},
+				},
+			},
+		}
+	}
+
+	if err := batchWrite(ctx, s.table, writeRequests); err != nil {
+		return fmt.Errorf("unable to delete escalation states: %v", err)
+	}
+	return nil
+}
+
+func escalationStateFromItem(region string, item map[string]ddbTypes.AttributeValue) (EscalationState, error) {
+	sk := item["sk"].(*ddbTypes.AttributeValueMemberS).Value
+	databaseType, databaseID, ok := strings.Cut(strings.TrimPrefix(sk, escalationPrefix), "/")
+	if !ok {
+		return EscalationState{}, fmt.Errorf("invalid escalation key %q in region %s", sk, region)
+	}
+
+	state := EscalationState{
+		Region:       region,
+		DatabaseType: databaseType,
+		DatabaseID:   databaseID,
+		Problem:      item["problem"].(*ddbTypes.AttributeValueMemberS).Value,
+		SnapshotID:   item["snapshotId"].(*ddbTypes.AttributeValueMemberS).Value,
+	}
+
+	state.Since = time.Unix(numberAttribute(item, "since"), 0).UTC()
+	state.LastNotified = time.Unix(numberAttribute(item, "lastNotified"), 0).UTC()
+	state.Reminders = int(numberAttribute(item, "reminders"))
+	return state, nil
+}
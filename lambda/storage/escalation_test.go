@@ -0,0 +1,37 @@
+package storage
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPutAndDeleteEscalationStates(t *testing.T) {
+	state := EscalationState{
+		Region:       "us-east-1",
+		DatabaseType: "cluster",
+		DatabaseID:   "aurora-1",
+		Problem:      "missing",
+		Since:        time.Unix(1732060800, 0),
+		LastNotified: time.Unix(1732104000, 0),
+		Reminders:    1,
+	}
+
+	client := &mockDynamoDBClient{batchWriteOutput: &dynamodb.BatchWriteItemOutput{}}
+	assert.NoError(t, testStore(client).PutEscalationStates(context.Background(), []EscalationState{state}))
+
+	item := client.capturedBatchWrite.RequestItems["test-table"][0].PutRequest.Item
+	assert.Equal(t, "resource#123456789012#us-east-1", item["pk"].(*types.AttributeValueMemberS).Value)
+	assert.Equal(t, "escalation#cluster/aurora-1", item["sk"].(*types.AttributeValueMemberS).Value)
+	assert.Equal(t, "1732104000", item["lastNotified"].(*types.AttributeValueMemberN).Value)
+	assert.Equal(t, "1", item["reminders"].(*types.AttributeValueMemberN).Value)
+	assert.NotContains(t, item, "ttl")
+
+	assert.NoError(t, testStore(client).DeleteEscalationStates(context.Background(), []EscalationState{state}))
+	key := client.capturedBatchWrite.RequestItems["test-table"][0].DeleteRequest.Key
+	assert.Equal(t, "escalation#cluster/aurora-1", key["sk"].(*types.AttributeValueMemberS).Value)
+}
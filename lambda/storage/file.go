@@ -0,0 +1,376 @@
+package storage
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"maps"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// FileStore is a StateStore kept in a local JSON file, so the monitor can run
+// outside AWS and keep its state and other rows between runs. The file is read once when the
+// store is opened and replaced after every change. A FileStore is safe for
+// concurrent use within a process, but the file must not be shared between
+// processes.
+type FileStore struct {
+	mu   sync.Mutex
+	path string
+	data stateData
+}
+
+// NewFileStore opens the store in path, which is created on the first change
+// if it does not exist.
+func NewFileStore(path string) (*FileStore, error) {
+	store := &FileStore{path: path, data: newStateData()}
+
+	content, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return store, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("unable to read state file %s: %v", path, err)
+	}
+	if err := json.Unmarshal(content, &store.data); err != nil {
+		return nil, fmt.Errorf("invalid state file %s: %v", path, err)
+	}
+
+	// Sections missing from the file are empty
+	store.data.init()
+	return store, nil
+}
+
+// save writes the store to a temporary file that replaces path, so a failed
+// write never leaves a partial file.
+func (s *FileStore) save() error {
+	content, err := json.MarshalIndent(s.data, "", "  ")
+	if err != nil {
+		return fmt.Errorf("unable to marshal state file %s: %v", s.path, err)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(s.path), filepath.Base(s.path)+".*")
+	if err != nil {
+		return fmt.Errorf("unable to write state file %s: %v", s.path, err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(content); err != nil {
+		tmp.Close()
+		return fmt.Errorf("unable to write state file %s: %v", s.path, err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("unable to write state file %s: %v", s.path, err)
+	}
+	if err := os.Rename(tmp.Name(), s.path); err != nil {
+		return fmt.Errorf("unable to write state file %s: %v", s.path, err)
+	}
+	return nil
+}
+
+func (s *FileStore) GetProcessedSnapshots(ctx context.Context, region string) (map[string]SnapshotState, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.data.getProcessedSnapshots(region, time.Now()), nil
+}
+
+func (s *FileStore) GetSourceSnapshots(ctx context.Context, region, sourceType, sourceID string) (map[string]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.data.getSourceSnapshots(region, sourceType+"/"+sourceID, time.Now()), nil
+}
+
+func (s *FileStore) BatchUpdateSnapshotStates(ctx context.Context, region string, snapshots []SnapshotInfo, retention Retention) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(snapshots) == 0 {
+		return nil
+	}
+	s.data.batchUpdateSnapshotStates(region, snapshots, retention, time.Now())
+	return s.save()
+}
+
+func (s *FileStore) AppendHistory(ctx context.Context, region string, transitions []Transition, retentionDays int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(transitions) == 0 {
+		return nil
+	}
+	s.data.appendHistory(region, transitions, retentionDays, time.Now())
+	return s.save()
+}
+
+func (s *FileStore) GetSnapshotTimeline(ctx context.Context, region, snapshotKey string) ([]Transition, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.data.getHistory(region, snapshotTransitions(snapshotKey), time.Now()), nil
+}
+
+func (s *FileStore) GetDatabaseTimeline(ctx context.Context, region, sourceType, sourceID string) ([]Transition, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.data.getHistory(region, databaseTransitions(sourceType, sourceID), time.Now()), nil
+}
+
+func (s *FileStore) AcquireLock(ctx context.Context, name, owner string, expiresAt, now time.Time) (Lock, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	lock, acquired := s.data.acquireLock(name, owner, expiresAt, now)
+	if !acquired {
+		return lock, false, nil
+	}
+	return lock, true, s.save()
+}
+
+func (s *FileStore) ReleaseLock(ctx context.Context, name, owner string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.data.releaseLock(name, owner)
+	return s.save()
+}
+
+func (s *FileStore) GetOutboxEntries(ctx context.Context) ([]*OutboxEntry, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.data.getOutboxEntries(), nil
+}
+
+func (s *FileStore) PutOutboxEntry(ctx context.Context, entry *OutboxEntry) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.data.putOutboxEntry(entry)
+	return s.save()
+}
+
+func (s *FileStore) MarkOutboxDelivered(ctx context.Context, entry *OutboxEntry, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if entry.IsDelivered(key) {
+		return nil
+	}
+	s.data.markOutboxDelivered(entry, key)
+	return s.save()
+}
+
+func (s *FileStore) DeleteOutboxEntry(ctx context.Context, entry *OutboxEntry) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.data.Outbox, entry.ID)
+	return s.save()
+}
+
+func (s *FileStore) GetCheckpoint(ctx context.Context, region string) (*Checkpoint, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.data.getCheckpoint(region, time.Now()), nil
+}
+
+func (s *FileStore) PutCheckpoint(ctx context.Context, checkpoint *Checkpoint) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.data.putCheckpoint(checkpoint, time.Now())
+	return s.save()
+}
+
+func (s *FileStore) DeleteCheckpoint(ctx context.Context, checkpoint *Checkpoint) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.data.Checkpoints, checkpoint.Region)
+	return s.save()
+}
+
+func (s *FileStore) PutHeldChanges(ctx context.Context, changes []HeldChange) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(changes) == 0 {
+		return nil
+	}
+	s.data.putHeldChanges(changes, time.Now())
+	return s.save()
+}
+
+func (s *FileStore) GetHeldChanges(ctx context.Context, window string) ([]HeldChange, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.data.getHeldChanges(window, time.Now()), nil
+}
+
+func (s *FileStore) DeleteHeldChanges(ctx context.Context, changes []HeldChange) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(changes) == 0 {
+		return nil
+	}
+	s.data.deleteHeldChanges(changes)
+	return s.save()
+}
+
+func (s *FileStore) PutAcknowledgement(ctx context.Context, ack Acknowledgement) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.data.putAcknowledgement(ack, time.Now())
+	return s.save()
+}
+
+func (s *FileStore) GetAcknowledgements(ctx context.Context, region string) (map[string]Acknowledgement, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.data.Acknowledgements.get(region), nil
+}
+
+func (s *FileStore) DeleteAcknowledgements(ctx context.Context, acks []Acknowledgement) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(acks) == 0 {
+		return nil
+	}
+	s.data.deleteAcknowledgements(acks)
+	return s.save()
+}
+
+func (s *FileStore) GetDatabaseHealth(ctx context.Context, region string) (map[string]DatabaseHealth, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.data.Health.get(region), nil
+}
+
+func (s *FileStore) PutDatabaseHealth(ctx context.Context, records []DatabaseHealth) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(records) == 0 {
+		return nil
+	}
+	s.data.putDatabaseHealth(records)
+	return s.save()
+}
+
+func (s *FileStore) DeleteDatabaseHealth(ctx context.Context, records []DatabaseHealth) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(records) == 0 {
+		return nil
+	}
+	s.data.deleteDatabaseHealth(records)
+	return s.save()
+}
+
+func (s *FileStore) GetEscalationStates(ctx context.Context, region string) (map[string]EscalationState, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.data.Escalations.get(region), nil
+}
+
+func (s *FileStore) PutEscalationStates(ctx context.Context, states []EscalationState) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(states) == 0 {
+		return nil
+	}
+	s.data.putEscalationStates(states)
+	return s.save()
+}
+
+func (s *FileStore) DeleteEscalationStates(ctx context.Context, states []EscalationState) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(states) == 0 {
+		return nil
+	}
+	s.data.deleteEscalationStates(states)
+	return s.save()
+}
+
+func (s *FileStore) PutReportMetrics(ctx context.Context, metrics ReportMetrics) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.data.putReportMetrics(metrics, time.Now())
+	return s.save()
+}
+
+func (s *FileStore) GetReportMetrics(ctx context.Context, period, date string) (*ReportMetrics, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.data.getReportMetrics(period, date, time.Now()), nil
+}
+
+func (s *FileStore) GetScanFailures(ctx context.Context) (map[string]ScanFailure, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return maps.Clone(s.data.ScanFailures), nil
+}
+
+func (s *FileStore) PutScanFailures(ctx context.Context, failures []ScanFailure) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(failures) == 0 {
+		return nil
+	}
+	s.data.putScanFailures(failures)
+	return s.save()
+}
+
+func (s *FileStore) DeleteScanFailures(ctx context.Context, failures []ScanFailure) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(failures) == 0 {
+		return nil
+	}
+	s.data.deleteScanFailures(failures)
+	return s.save()
+}
+
+func (s *FileStore) GetFindingRecords(ctx context.Context, region string) (map[string]FindingRecord, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.data.Findings.get(region), nil
+}
+
+func (s *FileStore) PutFindingRecords(ctx context.Context, records []FindingRecord) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(records) == 0 {
+		return nil
+	}
+	s.data.putFindingRecords(records)
+	return s.save()
+}
+
+func (s *FileStore) DeleteFindingRecords(ctx context.Context, records []FindingRecord) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(records) == 0 {
+		return nil
+	}
+	s.data.deleteFindingRecords(records)
+	return s.save()
+}
+
+func (s *FileStore) GetOpsItemRecords(ctx context.Context, region string) (map[string]OpsItemRecord, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.data.OpsItems.get(region), nil
+}
+
+func (s *FileStore) PutOpsItemRecords(ctx context.Context, records []OpsItemRecord) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(records) == 0 {
+		return nil
+	}
+	s.data.putOpsItemRecords(records)
+	return s.save()
+}
+
+func (s *FileStore) DeleteOpsItemRecords(ctx context.Context, records []OpsItemRecord) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(records) == 0 {
+		return nil
+	}
+	s.data.deleteOpsItemRecords(records)
+	return s.save()
+}
@@ -0,0 +1,124 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	ddbTypes "github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// findingPrefix marks the rows of active Security Hub findings in the resource
+// partition of their region.
+const findingPrefix = "finding#"
+
+// FindingRecord tracks a finding imported into Security Hub, so that it keeps
+// its creation time across runs and can be resolved once its condition
+// clears. The violation behind the finding is stored as an opaque JSON payload.
+type FindingRecord struct {
+	Region       string
+	ID           string
+	CreatedAt    time.Time
+	LastImported time.Time
+	Payload      string
+}
+
+// FindingStore keeps the findings imported into Security Hub until they are
+// resolved.
+type FindingStore interface {
+	// GetFindingRecords returns the active findings of region keyed by ID.
+	GetFindingRecords(ctx context.Context, region string) (map[string]FindingRecord, error)
+	// PutFindingRecords creates or replaces finding records.
+	PutFindingRecords(ctx context.Context, records []FindingRecord) error
+	// DeleteFindingRecords removes the records of resolved findings.
+	DeleteFindingRecords(ctx context.Context, records []FindingRecord) error
+}
+
+// GetFindingRecords returns the active findings of region keyed by ID.
+func (s *DynamoDBStore) GetFindingRecords(ctx context.Context, region string) (map[string]FindingRecord, error) {
+	records := make(map[string]FindingRecord)
+	var lastEvaluatedKey map[string]ddbTypes.AttributeValue
+
+	for {
+		result, err := s.table.Client.Query(ctx, &dynamodb.QueryInput{
+			TableName:              aws.String(s.table.Name),
+			KeyConditionExpression: aws.String("pk = :pk AND begins_with(sk, :prefix)"),
+			ExpressionAttributeValues: map[string]ddbTypes.AttributeValue{
+				":pk":     &ddbTypes.AttributeValueMemberS{Value: resourceKey(s.table.Account, region)},
+				":prefix": &ddbTypes.AttributeValueMemberS{Value: findingPrefix},
+			},
+			ExclusiveStartKey: lastEvaluatedKey,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("unable to query findings in region %s: %v", region, err)
+		}
+
+		for _, item := range result.Items {
+			record := FindingRecord{
+				Region:       region,
+				ID:           strings.TrimPrefix(item["sk"].(*ddbTypes.AttributeValueMemberS).Value, findingPrefix),
+				CreatedAt:    time.Unix(numberAttribute(item, "createdAt"), 0).UTC(),
+				LastImported: time.Unix(numberAttribute(item, "lastImported"), 0).UTC(),
+			}
+			if payload, ok := item["payload"].(*ddbTypes.AttributeValueMemberS); ok {
+				record.Payload = payload.Value
+			}
+			records[record.ID] = record
+		}
+
+		lastEvaluatedKey = result.LastEvaluatedKey
+		if lastEvaluatedKey == nil {
+			break
+		}
+	}
+
+	return records, nil
+}
+
+// PutFindingRecords creates or replaces finding records. The rows have no TTL;
+// they are deleted once the finding is resolved.
+func (s *DynamoDBStore) PutFindingRecords(ctx context.Context, records []FindingRecord) error {
+	writeRequests := make([]ddbTypes.WriteRequest, len(records))
+	for i, record := range records {
+		writeRequests[i] = ddbTypes.WriteRequest{
+			PutRequest: &ddbTypes.PutRequest{
+				Item: map[string]ddbTypes.AttributeValue{
+					"pk":           &ddbTypes.AttributeValueMemberS{Value: resourceKey(s.table.Account, record.Region)},
+					"sk":           &ddbTypes.AttributeValueMemberS{Value: findingPrefix + record.ID},
+					"createdAt":    &ddbTypes.AttributeValueMemberN{Value: strconv.FormatInt(record.CreatedAt.Unix(), 10)},
+					"lastImported": &ddbTypes.AttributeValueMemberN{Value: strconv.FormatInt(record.LastImported.Unix(), 10)},
+					"payload":      &ddbTypes.AttributeValueMemberS{Value: record.Payload},
+				},
+			},
+		}
+	}
+
+	if err := batchWrite(ctx, s.table, writeRequests); err != nil {
+		return fmt.Errorf("unable to store findings: %v", err)
+	}
+	return nil
+}
+
+// DeleteFindingRecords removes the records of resolved findings.
+func (s *DynamoDBStore) DeleteFindingRecords(ctx context.Context, records []FindingRecord) error {
+	writeRequests := make([]ddbTypes.WriteRequest, len(records))
+	for i, record := range records {
+		writeRequests[i] = ddbTypes.WriteRequest{
+			DeleteRequest: &ddbTypes.DeleteRequest{
+				Key: map[string]ddbTypes.AttributeValue{
+					"pk": &ddbTypes.AttributeValueMemberS{Value: resourceKey(s.table.Account, record.Region)},
+					"sk": &ddbTypes.AttributeValueMemberS{Value: findingPrefix + record.ID},
+				},
+			},
+		}
+	}
+
+	if err := batchWrite(ctx, s.table, writeRequests); err != nil {
+		return fmt.Errorf("unable to delete findings: %v", err)
+	}
+	return nil
+}
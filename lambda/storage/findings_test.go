@@ -0,0 +1,35 @@
+package storage
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPutAndDeleteFindingRecords(t *testing.T) {
+	record := FindingRecord{
+		Region:       "us-east-1",
+		ID:           "public-snapshot/arn:aws:rds:us-east-1:123456789012:snapshot:export",
+		CreatedAt:    time.Unix(1732060800, 0),
+		LastImported: time.Unix(1732104000, 0),
+		Payload:      `{"check":"public-snapshot"}`,
+	}
+
+	client := &mockDynamoDBClient{batchWriteOutput: &dynamodb.BatchWriteItemOutput{}}
+	assert.NoError(t, testStore(client).PutFindingRecords(context.Background(), []FindingRecord{record}))
+
+	item := client.capturedBatchWrite.RequestItems["test-table"][0].PutRequest.Item
+	assert.Equal(t, "resource#123456789012#us-east-1", item["pk"].(*types.AttributeValueMemberS).Value)
+	assert.Equal(t, "finding#public-snapshot/arn:aws:rds:us-east-1:123456789012:snapshot:export", item["sk"].(*types.AttributeValueMemberS).Value)
+	assert.Equal(t, "1732060800", item["createdAt"].(*types.AttributeValueMemberN).Value)
+	assert.Equal(t, `{"check":"public-snapshot"}`, item["payload"].(*types.AttributeValueMemberS).Value)
+	assert.NotContains(t, item, "ttl")
+
+	assert.NoError(t, testStore(client).DeleteFindingRecords(context.Background(), []FindingRecord{record}))
+	key := client.capturedBatchWrite.RequestItems["test-table"][0].DeleteRequest.Key
+	assert.Equal(t, "finding#public-snapshot/arn:aws:rds:us-east-1:123456789012:snapshot:export", key["sk"].(*types.AttributeValueMemberS).Value)
+}
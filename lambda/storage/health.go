@@ -0,0 +1,132 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	ddbTypes "github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// healthPrefix marks the rows of unhealthy databases in the resource partition
+// of their region.
+const healthPrefix = "health#"
+
+// DatabaseHealth records that the backups of a database failed. Since is the
+// creation time of the first failed snapshot; the row is deleted once a later
+// snapshot is available.
+type DatabaseHealth struct {
+	Region           string
+	DatabaseType     string
+	DatabaseID       string
+	FailedSnapshotID string
+	Since            time.Time
+}
+
+// Key identifies the database within its region.
+func (h DatabaseHealth) Key() string {
+	return h.DatabaseType + "/" + h.DatabaseID
+}
+
+// HealthStore keeps the databases whose backups failed until they recover.
+type HealthStore interface {
+	// GetDatabaseHealth returns the unhealthy databases of region keyed by
+	// DatabaseHealth.Key.
+	GetDatabaseHealth(ctx context.Context, region string) (map[string]DatabaseHealth, error)
+	// PutDatabaseHealth records unhealthy databases.
+	PutDatabaseHealth(ctx context.Context, records []DatabaseHealth) error
+	// DeleteDatabaseHealth removes the records of databases that recovered.
+	DeleteDatabaseHealth(ctx context.Context, records []DatabaseHealth) error
+}
+
+// GetDatabaseHealth returns the unhealthy databases of region keyed by
+// DatabaseHealth.Key.
+func (s *DynamoDBStore) GetDatabaseHealth(ctx context.Context, region string) (map[string]DatabaseHealth, error) {
+	health := make(map[string]DatabaseHealth)
+	var lastEvaluatedKey map[string]ddbTypes.AttributeValue
+
+	for {
+		result, err := s.table.Client.Query(ctx, &dynamodb.QueryInput{
+			TableName:              aws.String(s.table.Name),
+			KeyConditionExpression: aws.String("pk = :pk AND begins_with(sk, :prefix)"),
+			ExpressionAttributeValues: map[string]ddbTypes.AttributeValue{
+				":pk":     &ddbTypes.AttributeValueMemberS{Value: resourceKey(s.table.Account, region)},
+				":prefix": &ddbTypes.AttributeValueMemberS{Value: healthPrefix},
+			},
+			ExclusiveStartKey: lastEvaluatedKey,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("unable to query database health in region %s: %v", region, err)
+		}
+
+		for _, item := range result.Items {
+			sk := item["sk"].(*ddbTypes.AttributeValueMemberS).Value
+			databaseType, databaseID, ok := strings.Cut(strings.TrimPrefix(sk, healthPrefix), "/")
+			if !ok {
+				return nil, fmt.Errorf("invalid database health key %q in region %s", sk, region)
+			}
+			record := DatabaseHealth{
+				Region:           region,
+				DatabaseType:     databaseType,
+				DatabaseID:       databaseID,
+				FailedSnapshotID: item["failedSnapshotId"].(*ddbTypes.AttributeValueMemberS).Value,
+				Since:            time.Unix(numberAttribute(item, "since"), 0).UTC(),
+			}
+			health[record.Key()] = record
+		}
+
+		lastEvaluatedKey = result.LastEvaluatedKey
+		if lastEvaluatedKey == nil {
+			break
+		}
+	}
+
+	return health, nil
+}
+
+// PutDatabaseHealth records unhealthy databases. The rows have no TTL; they
+// are deleted once the database recovers.
+func (s *DynamoDBStore) PutDatabaseHealth(ctx context.Context, records []DatabaseHealth) error {
+	writeRequests := make([]ddbTypes.WriteRequest, len(records))
+	for i, record := range records {
+		writeRequests[i] = ddbTypes.WriteRequest{
+			PutRequest: &ddbTypes.PutRequest{
+				Item: map[string]ddbTypes.AttributeValue{
+					"pk":               &ddbTypes.AttributeValueMemberS{Value: resourceKey(s.table.Account, record.Region)},
+					"sk":               &ddbTypes.AttributeValueMemberS{Value: healthPrefix + record.Key()},
+					"failedSnapshotId": &ddbTypes.AttributeValueMemberS{Value: record.FailedSnapshotID},
+					"since":            &ddbTypes.AttributeValueMemberN{Value: strconv.FormatInt(record.Since.Unix(), 10)},
+				},
+			},
+		}
+	}
+
+	if err := batchWrite(ctx, s.table, writeRequests); err != nil {
+		return fmt.Errorf("unable to store database health: %v", err)
+	}
+	return nil
+}
+
+// DeleteDatabaseHealth removes the records of databases that recovered.
+func (s *DynamoDBStore) DeleteDatabaseHealth(ctx context.Context, records []DatabaseHealth) error {
+	writeRequests := make([]ddbTypes.WriteRequest, len(records))
+	for i, record := range records {
+		writeRequests[i] = ddbTypes.WriteRequest{
+			DeleteRequest: &ddbTypes.DeleteRequest{
+				Key: map[string]ddbTypes.AttributeValue{
+					"pk": &ddbTypes.AttributeValueMemberS{Value: resourceKey(s.table.Account, record.Region)},
+					"sk": &ddbTypes.AttributeValueMemberS{Value: healthPrefix + record.Key()},
+				},
+			},
+		}
+	}
+
+	if err := batchWrite(ctx, s.table, writeRequests); err != nil {
+		return fmt.Errorf("unable to delete database health: %v", err)
+	}
+	return nil
+}
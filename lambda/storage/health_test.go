@@ -0,0 +1,33 @@
+package storage
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPutAndDeleteDatabaseHealth(t *testing.T) {
+	record := DatabaseHealth{
+		Region:           "us-east-1",
+		DatabaseType:     "instance",
+		DatabaseID:       "orders",
+		FailedSnapshotID: "rds:orders-1",
+		Since:            time.Unix(1732060800, 0),
+	}
+
+	client := &mockDynamoDBClient{batchWriteOutput: &dynamodb.BatchWriteItemOutput{}}
+	assert.NoError(t, testStore(client).PutDatabaseHealth(context.Background(), []DatabaseHealth{record}))
+
+	item := client.capturedBatchWrite.RequestItems["test-table"][0].PutRequest.Item
+	assert.Equal(t, "health#instance/orders", item["sk"].(*types.AttributeValueMemberS).Value)
+	assert.Equal(t, "1732060800", item["since"].(*types.AttributeValueMemberN).Value)
+	assert.NotContains(t, item, "ttl")
+
+	assert.NoError(t, testStore(client).DeleteDatabaseHealth(context.Background(), []DatabaseHealth{record}))
+	key := client.capturedBatchWrite.RequestItems["test-table"][0].DeleteRequest.Key
+	assert.Equal(t, "health#instance/orders", key["sk"].(*types.AttributeValueMemberS).Value)
+}
@@ -0,0 +1,116 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	ddbTypes "github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// heldRetentionDays bounds how long held changes are kept when a suppression
+// window never closes, e.g. after it was removed from the configuration.
+const heldRetentionDays = 30
+
+// HeldChange is a change held back by a suppression window. The change itself
+// is stored as an opaque JSON payload.
+type HeldChange struct {
+	Window  string
+	ID      string
+	Payload string
+}
+
+// HeldChangeStore keeps the changes held back by suppression windows until
+// their catch-up digest was sent.
+type HeldChangeStore interface {
+	// PutHeldChanges stores changes held back by suppression windows. Storing
+	// the same change twice overwrites the earlier copy.
+	PutHeldChanges(ctx context.Context, changes []HeldChange) error
+	// GetHeldChanges returns the changes held back by window.
+	GetHeldChanges(ctx context.Context, window string) ([]HeldChange, error)
+	// DeleteHeldChanges removes held changes once their catch-up digest was
+	// sent.
+	DeleteHeldChanges(ctx context.Context, changes []HeldChange) error
+}
+
+// PutHeldChanges stores changes held back by suppression windows. Storing the
+// same change twice overwrites the earlier copy.
+func (s *DynamoDBStore) PutHeldChanges(ctx context.Context, changes []HeldChange) error {
+	expirationTime := time.Now().AddDate(0, 0, heldRetentionDays)
+
+	writeRequests := make([]ddbTypes.WriteRequest, len(changes))
+	for i, change := range changes {
+		writeRequests[i] = ddbTypes.WriteRequest{
+			PutRequest: &ddbTypes.PutRequest{
+				Item: map[string]ddbTypes.AttributeValue{
+					"pk":      &ddbTypes.AttributeValueMemberS{Value: heldKey(s.table.Account, change.Window)},
+					"sk":      &ddbTypes.AttributeValueMemberS{Value: change.ID},
+					"payload": &ddbTypes.AttributeValueMemberS{Value: change.Payload},
+					"ttl":     &ddbTypes.AttributeValueMemberN{Value: fmt.Sprintf("%d", expirationTime.Unix())},
+				},
+			},
+		}
+	}
+
+	if err := batchWrite(ctx, s.table, writeRequests); err != nil {
+		return fmt.Errorf("unable to store held changes: %v", err)
+	}
+	return nil
+}
+
+// GetHeldChanges returns the changes held back by window.
+func (s *DynamoDBStore) GetHeldChanges(ctx context.Context, window string) ([]HeldChange, error) {
+	var changes []HeldChange
+	var lastEvaluatedKey map[string]ddbTypes.AttributeValue
+
+	for {
+		result, err := s.table.Client.Query(ctx, &dynamodb.QueryInput{
+			TableName:              aws.String(s.table.Name),
+			KeyConditionExpression: aws.String("pk = :pk"),
+			ExpressionAttributeValues: map[string]ddbTypes.AttributeValue{
+				":pk": &ddbTypes.AttributeValueMemberS{Value: heldKey(s.table.Account, window)},
+			},
+			ExclusiveStartKey: lastEvaluatedKey,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("unable to query changes held by window %s: %v", window, err)
+		}
+
+		for _, item := range result.Items {
+			changes = append(changes, HeldChange{
+				Window:  window,
+				ID:      item["sk"].(*ddbTypes.AttributeValueMemberS).Value,
+				Payload: item["payload"].(*ddbTypes.AttributeValueMemberS).Value,
+			})
+		}
+
+		lastEvaluatedKey = result.LastEvaluatedKey
+		if lastEvaluatedKey == nil {
+			break
+		}
+	}
+
+	return changes, nil
+}
+
+// DeleteHeldChanges removes held changes once their catch-up digest was sent.
+func (s *DynamoDBStore) DeleteHeldChanges(ctx context.Context, changes []HeldChange) error {
+	writeRequests := make([]ddbTypes.WriteRequest, len(changes))
+	for i, change := range changes {
+		writeRequests[i] = ddbTypes.WriteRequest{
+			DeleteRequest: &ddbTypes.DeleteRequest{
+				Key: map[string]ddbTypes.AttributeValue{
+					"pk": &ddbTypes.AttributeValueMemberS{Value: heldKey(s.table.Account, change.Window)},
+					"sk": &ddbTypes.AttributeValueMemberS{Value: change.ID},
+				},
+			},
+		}
+	}
+
+	if err := batchWrite(ctx, s.table, writeRequests); err != nil {
+		return fmt.Errorf("unable to delete held changes: %v", err)
+	}
+	return nil
+}
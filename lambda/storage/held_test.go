@@ -0,0 +1,43 @@
+package storage
+
+import (
+	"context"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPutHeldChanges(t *testing.T) {
+
+	client := &mockDynamoDBClient{batchWriteOutput: &dynamodb.BatchWriteItemOutput{}}
+	err := testStore(client).PutHeldChanges(context.Background(), []HeldChange{
+		{Window: "nightly", ID: "us-west-2#snap-1#available", Payload: `{"SnapshotID":"snap-1"}`},
+	})
+	assert.NoError(t, err)
+
+	requests := client.capturedBatchWrite.RequestItems["test-table"]
+	assert.Len(t, requests, 1)
+	item := requests[0].PutRequest.Item
+	assert.Equal(t, "held#123456789012#nightly", item["pk"].(*types.AttributeValueMemberS).Value)
+	assert.Equal(t, "us-west-2#snap-1#available", item["sk"].(*types.AttributeValueMemberS).Value)
+	assert.Equal(t, `{"SnapshotID":"snap-1"}`, item["payload"].(*types.AttributeValueMemberS).Value)
+	assert.Contains(t, item, "ttl")
+}
+
+func TestDeleteHeldChanges(t *testing.T) {
+
+	client := &mockDynamoDBClient{batchWriteOutput: &dynamodb.BatchWriteItemOutput{}}
+	err := testStore(client).DeleteHeldChanges(context.Background(), []HeldChange{
+		{Window: "nightly", ID: "us-west-2#snap-1#available"},
+	})
+	assert.NoError(t, err)
+
+	requests := client.capturedBatchWrite.RequestItems["test-table"]
+	assert.Len(t, requests, 1)
+	assert.Nil(t, requests[0].PutRequest)
+	key := requests[0].DeleteRequest.Key
+	assert.Equal(t, "held#123456789012#nightly", key["pk"].(*types.AttributeValueMemberS).Value)
+	assert.Equal(t, "us-west-2#snap-1#available", key["sk"].(*types.AttributeValueMemberS).Value)
+}
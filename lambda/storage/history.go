@@ -0,0 +1,125 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	ddbTypes "github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// historySourceIndex is the global secondary index of transitions by the
+// database of their snapshot, sorted by observation time.
+const historySourceIndex = "history-source"
+
+// historySortKey orders the transitions of a snapshot by observation time.
+// Snapshot ARNs and identifiers cannot contain '#', so the prefix of one
+// snapshot never matches another.
+func historySortKey(snapshotKey string, observedAt time.Time) string {
+	return fmt.Sprintf("%s#%020d", snapshotKey, observedAt.UnixNano())
+}
+
+func (s *DynamoDBStore) AppendHistory(ctx context.Context, region string, transitions []Transition, retentionDays int) error {
+	writeRequests := make([]ddbTypes.WriteRequest, len(transitions))
+	for i, transition := range transitions {
+		writeRequests[i] = ddbTypes.WriteRequest{
+			PutRequest: &ddbTypes.PutRequest{
+				Item: s.transitionItem(region, transition, retentionDays),
+			},
+		}
+	}
+
+	if err := batchWrite(ctx, s.table, writeRequests); err != nil {
+		return fmt.Errorf("unable to store snapshot history in region %s: %v", region, err)
+	}
+	return nil
+}
+
+// transitionItem is the history row of transition. Rows of snapshots with a
+// source database are added to the history source index.
+func (s *DynamoDBStore) transitionItem(region string, transition Transition, retentionDays int) map[string]ddbTypes.AttributeValue {
+	expirationTime := transition.ObservedAt.AddDate(0, 0, retentionDays)
+	item := map[string]ddbTypes.AttributeValue{
+		"pk":          &ddbTypes.AttributeValueMemberS{Value: historyKey(s.table.Account, region)},
+		"sk":          &ddbTypes.AttributeValueMemberS{Value: historySortKey(transition.SnapshotKey, transition.ObservedAt)},
+		"snapshotKey": &ddbTypes.AttributeValueMemberS{Value: transition.SnapshotKey},
+		"snapshotId":  &ddbTypes.AttributeValueMemberS{Value: transition.SnapshotID},
+		"from":        &ddbTypes.AttributeValueMemberS{Value: transition.From},
+		"to":          &ddbTypes.AttributeValueMemberS{Value: transition.To},
+		"observedAt":  &ddbTypes.AttributeValueMemberN{Value: strconv.FormatInt(transition.ObservedAt.UnixNano(), 10)},
+		"runId":       &ddbTypes.AttributeValueMemberS{Value: transition.RunID},
+		"ttl":         &ddbTypes.AttributeValueMemberN{Value: strconv.FormatInt(expirationTime.Unix(), 10)},
+	}
+	if transition.SourceID != "" {
+		item["sourceType"] = &ddbTypes.AttributeValueMemberS{Value: transition.SourceType}
+		item["sourceId"] = &ddbTypes.AttributeValueMemberS{Value: transition.SourceID}
+		item["historySource"] = &ddbTypes.AttributeValueMemberS{
+			Value: sourceKey(s.table.Account, region, transition.SourceType, transition.SourceID),
+		}
+	}
+	return item
+}
+
+func (s *DynamoDBStore) GetSnapshotTimeline(ctx context.Context, region, snapshotKey string) ([]Transition, error) {
+	transitions, err := s.queryHistory(ctx, &dynamodb.QueryInput{
+		TableName:              aws.String(s.table.Name),
+		KeyConditionExpression: aws.String("pk = :pk AND begins_with(sk, :prefix)"),
+		ExpressionAttributeValues: map[string]ddbTypes.AttributeValue{
+			":pk":     &ddbTypes.AttributeValueMemberS{Value: historyKey(s.table.Account, region)},
+			":prefix": &ddbTypes.AttributeValueMemberS{Value: snapshotKey + "#"},
+		},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("unable to query history of snapshot %s in region %s: %v", snapshotKey, region, err)
+	}
+	return transitions, nil
+}
+
+func (s *DynamoDBStore) GetDatabaseTimeline(ctx context.Context, region, sourceType, sourceID string) ([]Transition, error) {
+	transitions, err := s.queryHistory(ctx, &dynamodb.QueryInput{
+		TableName:              aws.String(s.table.Name),
+		IndexName:              aws.String(historySourceIndex),
+		KeyConditionExpression: aws.String("historySource = :source"),
+		ExpressionAttributeValues: map[string]ddbTypes.AttributeValue{
+			":source": &ddbTypes.AttributeValueMemberS{Value: sourceKey(s.table.Account, region, sourceType, sourceID)},
+		},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("unable to query history of database %s in region %s: %v", sourceID, region, err)
+	}
+	return transitions, nil
+}
+
+// queryHistory returns the transitions of the history rows of input, in the
+// order of the query.
+func (s *DynamoDBStore) queryHistory(ctx context.Context, input *dynamodb.QueryInput) ([]Transition, error) {
+	var transitions []Transition
+	for {
+		result, err := s.table.Client.Query(ctx, input)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, item := range result.Items {
+			transitions = append(transitions, Transition{
+				SnapshotKey: stringAttribute(item, "snapshotKey"),
+				SnapshotID:  stringAttribute(item, "snapshotId"),
+				SourceType:  stringAttribute(item, "sourceType"),
+				SourceID:    stringAttribute(item, "sourceId"),
+				From:        stringAttribute(item, "from"),
+				To:          stringAttribute(item, "to"),
+				ObservedAt:  time.Unix(0, numberAttribute(item, "observedAt")).UTC(),
+				RunID:       stringAttribute(item, "runId"),
+			})
+		}
+
+		input.ExclusiveStartKey = result.LastEvaluatedKey
+		if input.ExclusiveStartKey == nil {
+			break
+		}
+	}
+	return transitions, nil
+}
@@ -0,0 +1,78 @@
+package storage
+
+import (
+	"context"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	ddbTypes "github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testSnapshotArn = "arn:aws:rds:us-west-2:123456789012:snapshot:nightly"
+
+func testTransition(observedAt time.Time) Transition {
+	return Transition{
+		SnapshotKey: testSnapshotArn,
+		SnapshotID:  "nightly",
+		SourceType:  "instance",
+		SourceID:    "orders",
+		From:        "creating",
+		To:          "failed",
+		ObservedAt:  observedAt,
+		RunID:       "run-1",
+	}
+}
+
+func TestAppendHistory(t *testing.T) {
+	ctx := context.Background()
+	observedAt := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	client := &mockDynamoDBClient{batchWriteOutput: &dynamodb.BatchWriteItemOutput{}}
+
+	err := NewDynamoDBStore(client, "test-table", "123456789012").AppendHistory(ctx, "us-west-2",
+		[]Transition{testTransition(observedAt)}, 400)
+	require.NoError(t, err)
+
+	requests := client.capturedBatchWrite.RequestItems["test-table"]
+	require.Len(t, requests, 1)
+	item := requests[0].PutRequest.Item
+	assert.Equal(t, "history#123456789012#us-west-2", item["pk"].(*ddbTypes.AttributeValueMemberS).Value)
+	assert.Equal(t, historySortKey(testSnapshotArn, observedAt), item["sk"].(*ddbTypes.AttributeValueMemberS).Value)
+	assert.Equal(t, "run-1", item["runId"].(*ddbTypes.AttributeValueMemberS).Value)
+	assert.Equal(t, "123456789012#us-west-2#instance/orders", item["historySource"].(*ddbTypes.AttributeValueMemberS).Value)
+	assert.Equal(t, strconv.FormatInt(observedAt.AddDate(0, 0, 400).Unix(), 10), item["ttl"].(*ddbTypes.AttributeValueMemberN).Value)
+}
+
+func TestGetTimeline(t *testing.T) {
+	ctx := context.Background()
+	observedAt := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+
+	// Rows read back as the item written by AppendHistory
+	writer := &mockDynamoDBClient{batchWriteOutput: &dynamodb.BatchWriteItemOutput{}}
+	require.NoError(t, NewDynamoDBStore(writer, "test-table", "123456789012").AppendHistory(ctx, "us-west-2",
+		[]Transition{testTransition(observedAt)}, 400))
+	item := writer.capturedBatchWrite.RequestItems["test-table"][0].PutRequest.Item
+
+	t.Run("of a snapshot", func(t *testing.T) {
+		client := &mockDynamoDBClient{queryOutput: &dynamodb.QueryOutput{Items: []map[string]ddbTypes.AttributeValue{item}}}
+		timeline, err := NewDynamoDBStore(client, "test-table", "123456789012").GetSnapshotTimeline(ctx, "us-west-2", testSnapshotArn)
+		require.NoError(t, err)
+		assert.Equal(t, []Transition{testTransition(observedAt)}, timeline)
+		assert.Nil(t, client.capturedQuery.IndexName)
+		assert.Equal(t, testSnapshotArn+"#", client.capturedQuery.ExpressionAttributeValues[":prefix"].(*ddbTypes.AttributeValueMemberS).Value)
+	})
+
+	t.Run("of a database", func(t *testing.T) {
+		client := &mockDynamoDBClient{queryOutput: &dynamodb.QueryOutput{Items: []map[string]ddbTypes.AttributeValue{item}}}
+		timeline, err := NewDynamoDBStore(client, "test-table", "123456789012").GetDatabaseTimeline(ctx, "us-west-2", "instance", "orders")
+		require.NoError(t, err)
+		assert.Equal(t, []Transition{testTransition(observedAt)}, timeline)
+		assert.Equal(t, "history-source", aws.ToString(client.capturedQuery.IndexName))
+		assert.Equal(t, "123456789012#us-west-2#instance/orders",
+			client.capturedQuery.ExpressionAttributeValues[":source"].(*ddbTypes.AttributeValueMemberS).Value)
+	})
+}
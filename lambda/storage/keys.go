@@ -0,0 +1,79 @@
+package storage
+
+import "strings"
+
+// Item types of the table. The partition key of an item starts with its type,
+// followed by the account and, for regional items, the region:
+//
+//	snapshot#<account>#<region>    snapshot status rows, sorted by snapshot ARN
+//	resource#<account>#<region>    database rows: health, acknowledgements,
+//	                               escalations, findings and OpsItems, each
+//	                               under its own sort key prefix
+//	checkpoint#<account>#<region>  paused scans
+//	history#<account>#<region>     status transitions
+//	lock#<account>                 leases on units of work
+//	held#<account>#<window>        changes held back by a suppression window
+//	report#<account>#<period>      metrics of past summary reports
+//	outbox#<account>               digests not completed yet
+//	scan-failure#<account>         stages that keep failing, by region
+const (
+	snapshotType    = "snapshot"
+	resourceType    = "resource"
+	checkpointType  = "checkpoint"
+	historyType     = "history"
+	lockType        = "lock"
+	heldType        = "held"
+	reportType      = "report"
+	outboxType      = "outbox"
+	scanFailureType = "scan-failure"
+)
+
+// sourceIndex is the global secondary index of snapshot status rows by the
+// database they were taken from.
+const sourceIndex = "source"
+
+func partitionKey(itemType string, scope ...string) string {
+	return itemType + "#" + strings.Join(scope, "#")
+}
+
+func snapshotKey(account, region string) string {
+	return partitionKey(snapshotType, account, region)
+}
+
+func resourceKey(account, region string) string {
+	return partitionKey(resourceType, account, region)
+}
+
+func checkpointKey(account, region string) string {
+	return partitionKey(checkpointType, account, region)
+}
+
+func historyKey(account, region string) string {
+	return partitionKey(historyType, account, region)
+}
+
+func lockKey(account string) string {
+	return partitionKey(lockType, account)
+}
+
+func heldKey(account, window string) string {
+	return partitionKey(heldType, account, window)
+}
+
+func reportKey(account, period string) string {
+	return partitionKey(reportType, account, period)
+}
+
+func outboxKey(account string) string {
+	return partitionKey(outboxType, account)
+}
+
+func scanFailureKey(account string) string {
+	return partitionKey(scanFailureType, account)
+}
+
+// sourceKey is the sourceIndex partition of the snapshots of a database,
+// whose type is instance or cluster.
+func sourceKey(account, region, sourceType, sourceID string) string {
+	return account + "#" + region + "#" + sourceType + "/" + sourceID
+}
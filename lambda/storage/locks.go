@@ -0,0 +1,86 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	ddbTypes "github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+const (
+	// lockTTL removes lock rows a day after their lease expired.
+	lockTTL = 24 * time.Hour
+)
+
+// AcquireLock writes the lock on the condition that it is free, expired or
+// held by owner, so two runs never both take it. A failed condition returns
+// the lock item of the other owner.
+func (s *DynamoDBStore) AcquireLock(ctx context.Context, name, owner string, expiresAt, now time.Time) (Lock, bool, error) {
+	_, err := s.table.Client.PutItem(ctx, &dynamodb.PutItemInput{
+		TableName:                           aws.String(s.table.Name),
+		Item:                                s.lockItem(name, owner, expiresAt),
+		ConditionExpression:                 aws.String("attribute_not_exists(pk) OR #owner = :owner OR expiresAt <= :now"),
+		ReturnValuesOnConditionCheckFailure: ddbTypes.ReturnValuesOnConditionCheckFailureAllOld,
+		ExpressionAttributeNames: map[string]string{
+			"#owner": "owner",
+		},
+		ExpressionAttributeValues: map[string]ddbTypes.AttributeValue{
+			":owner": &ddbTypes.AttributeValueMemberS{Value: owner},
+			":now":   &ddbTypes.AttributeValueMemberN{Value: strconv.FormatInt(now.Unix(), 10)},
+		},
+	})
+	var conditionFailed *ddbTypes.ConditionalCheckFailedException
+	if errors.As(err, &conditionFailed) {
+		return lockFromItem(name, conditionFailed.Item), false, nil
+	}
+	if err != nil {
+		return Lock{}, false, fmt.Errorf("unable to acquire lock %s: %v", name, err)
+	}
+	return Lock{Name: name, Owner: owner, ExpiresAt: expiresAt}, true, nil
+}
+
+// ReleaseLock expires the lease of owner. A lock that another owner took over
+// in the meantime is left alone.
+func (s *DynamoDBStore) ReleaseLock(ctx context.Context, name, owner string) error {
+	_, err := s.table.Client.PutItem(ctx, &dynamodb.PutItemInput{
+		TableName:           aws.String(s.table.Name),
+		Item:                s.lockItem(name, owner, time.Unix(0, 0)),
+		ConditionExpression: aws.String("#owner = :owner"),
+		ExpressionAttributeNames: map[string]string{
+			"#owner": "owner",
+		},
+		ExpressionAttributeValues: map[string]ddbTypes.AttributeValue{
+			":owner": &ddbTypes.AttributeValueMemberS{Value: owner},
+		},
+	})
+	var conditionFailed *ddbTypes.ConditionalCheckFailedException
+	if err != nil && !errors.As(err, &conditionFailed) {
+		return fmt.Errorf("unable to release lock %s: %v", name, err)
+	}
+	return nil
+}
+
+func (s *DynamoDBStore) lockItem(name, owner string, expiresAt time.Time) map[string]ddbTypes.AttributeValue {
+	return map[string]ddbTypes.AttributeValue{
+		"pk":        &ddbTypes.AttributeValueMemberS{Value: lockKey(s.table.Account)},
+		"sk":        &ddbTypes.AttributeValueMemberS{Value: name},
+		"owner":     &ddbTypes.AttributeValueMemberS{Value: owner},
+		"expiresAt": &ddbTypes.AttributeValueMemberN{Value: strconv.FormatInt(expiresAt.Unix(), 10)},
+		"ttl":       &ddbTypes.AttributeValueMemberN{Value: strconv.FormatInt(expiresAt.Add(lockTTL).Unix(), 10)},
+	}
+}
+
+// lockFromItem reads the lock item of name, which is empty when DynamoDB did
+// not return it.
+func lockFromItem(name string, item map[string]ddbTypes.AttributeValue) Lock {
+	return Lock{
+		Name:      name,
+		Owner:     stringAttribute(item, "owner"),
+		ExpiresAt: time.Unix(numberAttribute(item, "expiresAt"), 0),
+	}
+}
@@ -0,0 +1,88 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	ddbTypes "github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAcquireLock(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now()
+
+	tests := []struct {
+		name         string
+		putItemErr   error
+		wantAcquired bool
+		wantOwner    string
+		wantErr      bool
+	}{
+		{
+			name:         "acquires a free lock",
+			wantAcquired: true,
+			wantOwner:    "run-1",
+		},
+		{
+			name: "does not acquire a lock held by another owner",
+			putItemErr: &ddbTypes.ConditionalCheckFailedException{
+				Message: aws.String("The conditional request failed"),
+				Item: map[string]ddbTypes.AttributeValue{
+					"owner":     &ddbTypes.AttributeValueMemberS{Value: "run-0"},
+					"expiresAt": &ddbTypes.AttributeValueMemberN{Value: "1732060800"},
+				},
+			},
+			wantAcquired: false,
+			wantOwner:    "run-0",
+		},
+		{
+			name:       "handles DynamoDB error",
+			putItemErr: fmt.Errorf("DynamoDB error"),
+			wantErr:    true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := &mockDynamoDBClient{putItemErr: tt.putItemErr}
+			store := NewDynamoDBStore(client, "test-table", "123456789012")
+
+			lock, acquired, err := store.AcquireLock(ctx, "us-west-2", "run-1", now.Add(time.Minute), now)
+			if tt.wantErr {
+				assert.ErrorContains(t, err, "unable to acquire lock us-west-2")
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.wantAcquired, acquired)
+			assert.Equal(t, tt.wantOwner, lock.Owner)
+
+			input := client.capturedPutItem
+			assert.Equal(t, "test-table", aws.ToString(input.TableName))
+			assert.Equal(t, "lock#123456789012", input.Item["pk"].(*ddbTypes.AttributeValueMemberS).Value)
+			assert.Equal(t, "us-west-2", input.Item["sk"].(*ddbTypes.AttributeValueMemberS).Value)
+			assert.Equal(t, "run-1", input.Item["owner"].(*ddbTypes.AttributeValueMemberS).Value)
+			assert.Contains(t, aws.ToString(input.ConditionExpression), "attribute_not_exists(pk)")
+			assert.Equal(t, ddbTypes.ReturnValuesOnConditionCheckFailureAllOld, input.ReturnValuesOnConditionCheckFailure)
+		})
+	}
+}
+
+func TestReleaseLock(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("expires the lease of the owner", func(t *testing.T) {
+		client := &mockDynamoDBClient{}
+		require.NoError(t, NewDynamoDBStore(client, "test-table", "123456789012").ReleaseLock(ctx, "us-west-2", "run-1"))
+		assert.Equal(t, "0", client.capturedPutItem.Item["expiresAt"].(*ddbTypes.AttributeValueMemberN).Value)
+	})
+
+	t.Run("ignores a lock taken over by another owner", func(t *testing.T) {
+		client := &mockDynamoDBClient{putItemErr: &ddbTypes.ConditionalCheckFailedException{}}
+		assert.NoError(t, NewDynamoDBStore(client, "test-table", "123456789012").ReleaseLock(ctx, "us-west-2", "run-1"))
+	})
+}
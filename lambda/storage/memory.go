@@ -0,0 +1,693 @@
+package storage
+
+import (
+	"context"
+	"maps"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+)
+
+// stateData is the content of a MemoryStore or FileStore. Expired states,
+// transitions and other rows with a TTL in DynamoDB are left out when read,
+// and deleted by the next write of their kind so the content does not grow.
+type stateData struct {
+	States  map[string]map[string]stateRecord `json:"states"`
+	History map[string][]historyRecord        `json:"history"`
+	Locks   map[string]Lock                   `json:"locks"`
+
+	Outbox           map[string]OutboxEntry      `json:"outbox"`
+	Checkpoints      map[string]checkpointRecord `json:"checkpoints"`
+	Held             rows[heldRecord]            `json:"held"`
+	Acknowledgements rows[Acknowledgement]       `json:"acknowledgements"`
+	Health           rows[DatabaseHealth]        `json:"health"`
+	Escalations      rows[EscalationState]       `json:"escalations"`
+	Reports          rows[reportRecord]          `json:"reports"`
+	ScanFailures     map[string]ScanFailure      `json:"scanFailures"`
+	Findings         rows[FindingRecord]         `json:"findings"`
+	OpsItems         rows[OpsItemRecord]         `json:"opsItems"`
+}
+
+type stateRecord struct {
+	Status    string    `json:"status"`
+	Source    string    `json:"source,omitempty"`
+	ExpiresAt time.Time `json:"expiresAt"`
+}
+
+type historyRecord struct {
+	Transition
+	ExpiresAt time.Time `json:"expiresAt"`
+}
+
+type checkpointRecord struct {
+	Checkpoint
+	ExpiresAt time.Time `json:"expiresAt"`
+}
+
+type heldRecord struct {
+	Payload   string    `json:"payload"`
+	ExpiresAt time.Time `json:"expiresAt"`
+}
+
+type reportRecord struct {
+	ReportMetrics
+	ExpiresAt time.Time `json:"expiresAt"`
+}
+
+// rows are the records of each partition, such as a region, by key.
+type rows[T any] map[string]map[string]T
+
+// get returns a copy of the records of partition.
+func (r rows[T]) get(partition string) map[string]T {
+	records := make(map[string]T, len(r[partition]))
+	maps.Copy(records, r[partition])
+	return records
+}
+
+func (r rows[T]) put(partition, key string, record T) {
+	if r[partition] == nil {
+		r[partition] = make(map[string]T)
+	}
+	r[partition][key] = record
+}
+
+func (r rows[T]) delete(partition, key string) {
+	delete(r[partition], key)
+	if len(r[partition]) == 0 {
+		delete(r, partition)
+	}
+}
+
+// prune deletes the records that expired.
+func (r rows[T]) prune(expired func(T) bool) {
+	for partition, records := range r {
+		maps.DeleteFunc(records, func(_ string, record T) bool {
+			return expired(record)
+		})
+		if len(records) == 0 {
+			delete(r, partition)
+		}
+	}
+}
+
+func newStateData() stateData {
+	var d stateData
+	d.init()
+	return d
+}
+
+// init creates the sections that are missing, for example from a file written
+// before they were added.
+func (d *stateData) init() {
+	if d.States == nil {
+		d.States = make(map[string]map[string]stateRecord)
+	}
+	if d.History == nil {
+		d.History = make(map[string][]historyRecord)
+	}
+	if d.Locks == nil {
+		d.Locks = make(map[string]Lock)
+	}
+	if d.Outbox == nil {
+		d.Outbox = make(map[string]OutboxEntry)
+	}
+	if d.Checkpoints == nil {
+		d.Checkpoints = make(map[string]checkpointRecord)
+	}
+	if d.Held == nil {
+		d.Held = make(rows[heldRecord])
+	}
+	if d.Acknowledgements == nil {
+		d.Acknowledgements = make(rows[Acknowledgement])
+	}
+	if d.Health == nil {
+		d.Health = make(rows[DatabaseHealth])
+	}
+	if d.Escalations == nil {
+		d.Escalations = make(rows[EscalationState])
+	}
+	if d.Reports == nil {
+		d.Reports = make(rows[reportRecord])
+	}
+	if d.ScanFailures == nil {
+		d.ScanFailures = make(map[string]ScanFailure)
+	}
+	if d.Findings == nil {
+		d.Findings = make(rows[FindingRecord])
+	}
+	if d.OpsItems == nil {
+		d.OpsItems = make(rows[OpsItemRecord])
+	}
+}
+
+func (d *stateData) getProcessedSnapshots(region string, now time.Time) map[string]SnapshotState {
+	processedSnapshots := make(map[string]SnapshotState)
+	for key, record := range d.States[region] {
+		if now.Before(record.ExpiresAt) {
+			processedSnapshots[key] = SnapshotState{Status: record.Status, ExpiresAt: record.ExpiresAt}
+		}
+	}
+	return processedSnapshots
+}
+
+func (d *stateData) getSourceSnapshots(region, source string, now time.Time) map[string]string {
+	sourceSnapshots := make(map[string]string)
+	for key, record := range d.States[region] {
+		if record.Source == source && now.Before(record.ExpiresAt) {
+			sourceSnapshots[key] = record.Status
+		}
+	}
+	return sourceSnapshots
+}
+
+func (d *stateData) batchUpdateSnapshotStates(region string, snapshots []SnapshotInfo, retention Retention, now time.Time) {
+	if len(snapshots) == 0 {
+		return
+	}
+	d.pruneStates(now)
+	if d.States[region] == nil {
+		d.States[region] = make(map[string]stateRecord)
+	}
+	for _, snapshot := range snapshots {
+		d.States[region][snapshot.Key()] = stateRecord{
+			Status:    snapshot.Status,
+			Source:    snapshot.SnapshotType + "/" + snapshot.SourceID,
+			ExpiresAt: retention.ExpiresAt(snapshot.Status, now),
+		}
+	}
+}
+
+// appendHistory records transitions, replacing those recorded before for the
+// same snapshot and observation time.
+func (d *stateData) appendHistory(region string, transitions []Transition, retentionDays int, now time.Time) {
+	d.pruneHistory(now)
+	for _, transition := range transitions {
+		record := historyRecord{
+			Transition: transition,
+			ExpiresAt:  transition.ObservedAt.AddDate(0, 0, retentionDays),
+		}
+		i := slices.IndexFunc(d.History[region], func(recorded historyRecord) bool {
+			return recorded.SnapshotKey == transition.SnapshotKey && recorded.ObservedAt.Equal(transition.ObservedAt)
+		})
+		if i >= 0 {
+			d.History[region][i] = record
+		} else {
+			d.History[region] = append(d.History[region], record)
+		}
+	}
+}
+
+// pruneStates deletes the states that expired.
+func (d *stateData) pruneStates(now time.Time) {
+	for region, records := range d.States {
+		maps.DeleteFunc(records, func(_ string, record stateRecord) bool {
+			return !now.Before(record.ExpiresAt)
+		})
+		if len(records) == 0 {
+			delete(d.States, region)
+		}
+	}
+}
+
+// pruneHistory deletes the transitions that expired.
+func (d *stateData) pruneHistory(now time.Time) {
+	for region, records := range d.History {
+		records = slices.DeleteFunc(records, func(record historyRecord) bool {
+			return !now.Before(record.ExpiresAt)
+		})
+		if len(records) == 0 {
+			delete(d.History, region)
+		} else {
+			d.History[region] = records
+		}
+	}
+}
+
+// getHistory returns the transitions of region that match, oldest first.
+func (d *stateData) getHistory(region string, match func(Transition) bool, now time.Time) []Transition {
+	var transitions []Transition
+	for _, record := range d.History[region] {
+		if match(record.Transition) && now.Before(record.ExpiresAt) {
+			transitions = append(transitions, record.Transition)
+		}
+	}
+	sort.SliceStable(transitions, func(i, j int) bool {
+		return transitions[i].ObservedAt.Before(transitions[j].ObservedAt)
+	})
+	return transitions
+}
+
+func snapshotTransitions(snapshotKey string) func(Transition) bool {
+	return func(transition Transition) bool {
+		return transition.SnapshotKey == snapshotKey
+	}
+}
+
+func databaseTransitions(sourceType, sourceID string) func(Transition) bool {
+	return func(transition Transition) bool {
+		return transition.SourceType == sourceType && transition.SourceID == sourceID
+	}
+}
+
+func (d *stateData) acquireLock(name, owner string, expiresAt, now time.Time) (Lock, bool) {
+	if lock := d.Locks[name]; lock.heldByOther(owner, now) {
+		return lock, false
+	}
+	d.Locks[name] = Lock{Name: name, Owner: owner, ExpiresAt: expiresAt}
+	return d.Locks[name], true
+}
+
+func (d *stateData) releaseLock(name, owner string) {
+	if d.Locks[name].Owner == owner {
+		delete(d.Locks, name)
+	}
+}
+
+// getOutboxEntries returns copies of the entries, oldest first.
+func (d *stateData) getOutboxEntries() []*OutboxEntry {
+	ids := slices.Sorted(maps.Keys(d.Outbox))
+	entries := make([]*OutboxEntry, len(ids))
+	for i, id := range ids {
+		entry := d.Outbox[id]
+		entry.Payload = slices.Clone(entry.Payload)
+		entry.Delivered = slices.Clone(entry.Delivered)
+		entries[i] = &entry
+	}
+	return entries
+}
+
+func (d *stateData) putOutboxEntry(entry *OutboxEntry) {
+	stored := *entry
+	stored.Payload = slices.Clone(entry.Payload)
+	stored.Delivered = slices.Clone(entry.Delivered)
+	d.Outbox[entry.ID] = stored
+}
+
+func (d *stateData) getCheckpoint(region string, now time.Time) *Checkpoint {
+	record, ok := d.Checkpoints[region]
+	if !ok || !now.Before(record.ExpiresAt) {
+		return nil
+	}
+	checkpoint := record.Checkpoint
+	checkpoint.Snapshots = slices.Clone(record.Snapshots)
+	return &checkpoint
+}
+
+func (d *stateData) putCheckpoint(checkpoint *Checkpoint, now time.Time) {
+	maps.DeleteFunc(d.Checkpoints, func(_ string, record checkpointRecord) bool {
+		return !now.Before(record.ExpiresAt)
+	})
+	record := checkpointRecord{Checkpoint: *checkpoint, ExpiresAt: now.Add(checkpointTTL)}
+	record.Snapshots = slices.Clone(checkpoint.Snapshots)
+	d.Checkpoints[checkpoint.Region] = record
+}
+
+func (d *stateData) getHeldChanges(window string, now time.Time) []HeldChange {
+	var changes []HeldChange
+	for _, id := range slices.Sorted(maps.Keys(d.Held[window])) {
+		if record := d.Held[window][id]; now.Before(record.ExpiresAt) {
+			changes = append(changes, HeldChange{Window: window, ID: id, Payload: record.Payload})
+		}
+	}
+	return changes
+}
+
+func (d *stateData) putHeldChanges(changes []HeldChange, now time.Time) {
+	d.Held.prune(func(record heldRecord) bool {
+		return !now.Before(record.ExpiresAt)
+	})
+	expirationTime := now.AddDate(0, 0, heldRetentionDays)
+	for _, change := range changes {
+		d.Held.put(change.Window, change.ID, heldRecord{Payload: change.Payload, ExpiresAt: expirationTime})
+	}
+}
+
+func (d *stateData) putAcknowledgement(ack Acknowledgement, now time.Time) {
+	d.Acknowledgements.prune(func(ack Acknowledgement) bool {
+		return !ack.Active(now)
+	})
+	d.Acknowledgements.put(ack.Region, ack.Key(), ack)
+}
+
+func (d *stateData) getReportMetrics(period, date string, now time.Time) *ReportMetrics {
+	record, ok := d.Reports[period][date]
+	if !ok || !now.Before(record.ExpiresAt) {
+		return nil
+	}
+	return &record.ReportMetrics
+}
+
+func (d *stateData) putReportMetrics(metrics ReportMetrics, now time.Time) {
+	d.Reports.prune(func(record reportRecord) bool {
+		return !now.Before(record.ExpiresAt)
+	})
+	d.Reports.put(metrics.Period, metrics.Date, reportRecord{
+		ReportMetrics: metrics,
+		ExpiresAt:     now.AddDate(0, 0, reportRetentionDays),
+	})
+}
+
+func (d *stateData) markOutboxDelivered(entry *OutboxEntry, key string) {
+	entry.Delivered = append(entry.Delivered, key)
+	d.putOutboxEntry(entry)
+}
+
+func (d *stateData) deleteHeldChanges(changes []HeldChange) {
+	for _, change := range changes {
+		d.Held.delete(change.Window, change.ID)
+	}
+}
+
+func (d *stateData) deleteAcknowledgements(acks []Acknowledgement) {
+	for _, ack := range acks {
+		d.Acknowledgements.delete(ack.Region, ack.Key())
+	}
+}
+
+func (d *stateData) putDatabaseHealth(records []DatabaseHealth) {
+	for _, record := range records {
+		d.Health.put(record.Region, record.Key(), record)
+	}
+}
+
+func (d *stateData) deleteDatabaseHealth(records []DatabaseHealth) {
+	for _, record := range records {
+		d.Health.delete(record.Region, record.Key())
+	}
+}
+
+func (d *stateData) putEscalationStates(states []EscalationState) {
+	for _, state := range states {
+		d.Escalations.put(state.Region, state.Key(), state)
+	}
+}
+
+func (d *stateData) deleteEscalationStates(states []EscalationState) {
+	for _, state := range states {
+		d.Escalations.delete(state.Region, state.Key())
+	}
+}
+
+func (d *stateData) putScanFailures(failures []ScanFailure) {
+	for _, failure := range failures {
+		d.ScanFailures[failure.Key()] = failure
+	}
+}
+
+func (d *stateData) deleteScanFailures(failures []ScanFailure) {
+	for _, failure := range failures {
+		delete(d.ScanFailures, failure.Key())
+	}
+}
+
+func (d *stateData) putFindingRecords(records []FindingRecord) {
+	for _, record := range records {
+		d.Findings.put(record.Region, record.ID, record)
+	}
+}
+
+func (d *stateData) deleteFindingRecords(records []FindingRecord) {
+	for _, record := range records {
+		d.Findings.delete(record.Region, record.ID)
+	}
+}
+
+func (d *stateData) putOpsItemRecords(records []OpsItemRecord) {
+	for _, record := range records {
+		d.OpsItems.put(record.Region, record.ResourceArn, record)
+	}
+}
+
+func (d *stateData) deleteOpsItemRecords(records []OpsItemRecord) {
+	for _, record := range records {
+		d.OpsItems.delete(record.Region, record.ResourceArn)
+	}
+}
+
+// MemoryStore is a StateStore that keeps everything in memory, for tests and
+// for runs whose state need not outlive the process. It is safe for
+// concurrent use.
+type MemoryStore struct {
+	mu   sync.Mutex
+	data stateData
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{data: newStateData()}
+}
+
+func (s *MemoryStore) GetProcessedSnapshots(ctx context.Context, region string) (map[string]SnapshotState, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.data.getProcessedSnapshots(region, time.Now()), nil
+}
+
+func (s *MemoryStore) GetSourceSnapshots(ctx context.Context, region, sourceType, sourceID string) (map[string]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.data.getSourceSnapshots(region, sourceType+"/"+sourceID, time.Now()), nil
+}
+
+func (s *MemoryStore) BatchUpdateSnapshotStates(ctx context.Context, region string, snapshots []SnapshotInfo, retention Retention) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.data.batchUpdateSnapshotStates(region, snapshots, retention, time.Now())
+	return nil
+}
+
+func (s *MemoryStore) AppendHistory(ctx context.Context, region string, transitions []Transition, retentionDays int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.data.appendHistory(region, transitions, retentionDays, time.Now())
+	return nil
+}
+
+func (s *MemoryStore) GetSnapshotTimeline(ctx context.Context, region, snapshotKey string) ([]Transition, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.data.getHistory(region, snapshotTransitions(snapshotKey), time.Now()), nil
+}
+
+func (s *MemoryStore) GetDatabaseTimeline(ctx context.Context, region, sourceType, sourceID string) ([]Transition, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.data.getHistory(region, databaseTransitions(sourceType, sourceID), time.Now()), nil
+}
+
+func (s *MemoryStore) AcquireLock(ctx context.Context, name, owner string, expiresAt, now time.Time) (Lock, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	lock, acquired := s.data.acquireLock(name, owner, expiresAt, now)
+	return lock, acquired, nil
+}
+
+func (s *MemoryStore) ReleaseLock(ctx context.Context, name, owner string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.data.releaseLock(name, owner)
+	return nil
+}
+
+func (s *MemoryStore) GetOutboxEntries(ctx context.Context) ([]*OutboxEntry, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.data.getOutboxEntries(), nil
+}
+
+func (s *MemoryStore) PutOutboxEntry(ctx context.Context, entry *OutboxEntry) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.data.putOutboxEntry(entry)
+	return nil
+}
+
+func (s *MemoryStore) MarkOutboxDelivered(ctx context.Context, entry *OutboxEntry, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if entry.IsDelivered(key) {
+		return nil
+	}
+	s.data.markOutboxDelivered(entry, key)
+	return nil
+}
+
+func (s *MemoryStore) DeleteOutboxEntry(ctx context.Context, entry *OutboxEntry) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.data.Outbox, entry.ID)
+	return nil
+}
+
+func (s *MemoryStore) GetCheckpoint(ctx context.Context, region string) (*Checkpoint, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.data.getCheckpoint(region, time.Now()), nil
+}
+
+func (s *MemoryStore) PutCheckpoint(ctx context.Context, checkpoint *Checkpoint) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.data.putCheckpoint(checkpoint, time.Now())
+	return nil
+}
+
+func (s *MemoryStore) DeleteCheckpoint(ctx context.Context, checkpoint *Checkpoint) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.data.Checkpoints, checkpoint.Region)
+	return nil
+}
+
+func (s *MemoryStore) PutHeldChanges(ctx context.Context, changes []HeldChange) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.data.putHeldChanges(changes, time.Now())
+	return nil
+}
+
+func (s *MemoryStore) GetHeldChanges(ctx context.Context, window string) ([]HeldChange, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.data.getHeldChanges(window, time.Now()), nil
+}
+
+func (s *MemoryStore) DeleteHeldChanges(ctx context.Context, changes []HeldChange) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.data.deleteHeldChanges(changes)
+	return nil
+}
+
+func (s *MemoryStore) PutAcknowledgement(ctx context.Context, ack Acknowledgement) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.data.putAcknowledgement(ack, time.Now())
+	return nil
+}
+
+func (s *MemoryStore) GetAcknowledgements(ctx context.Context, region string) (map[string]Acknowledgement, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.data.Acknowledgements.get(region), nil
+}
+
+func (s *MemoryStore) DeleteAcknowledgements(ctx context.Context, acks []Acknowledgement) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.data.deleteAcknowledgements(acks)
+	return nil
+}
+
+func (s *MemoryStore) GetDatabaseHealth(ctx context.Context, region string) (map[string]DatabaseHealth, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.data.Health.get(region), nil
+}
+
+func (s *MemoryStore) PutDatabaseHealth(ctx context.Context, records []DatabaseHealth) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.data.putDatabaseHealth(records)
+	return nil
+}
+
+func (s *MemoryStore) DeleteDatabaseHealth(ctx context.Context, records []DatabaseHealth) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.data.deleteDatabaseHealth(records)
+	return nil
+}
+
+func (s *MemoryStore) GetEscalationStates(ctx context.Context, region string) (map[string]EscalationState, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.data.Escalations.get(region), nil
+}
+
+func (s *MemoryStore) PutEscalationStates(ctx context.Context, states []EscalationState) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.data.putEscalationStates(states)
+	return nil
+}
+
+func (s *MemoryStore) DeleteEscalationStates(ctx context.Context, states []EscalationState) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.data.deleteEscalationStates(states)
+	return nil
+}
+
+func (s *MemoryStore) PutReportMetrics(ctx context.Context, metrics ReportMetrics) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.data.putReportMetrics(metrics, time.Now())
+	return nil
+}
+
+func (s *MemoryStore) GetReportMetrics(ctx context.Context, period, date string) (*ReportMetrics, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.data.getReportMetrics(period, date, time.Now()), nil
+}
+
+func (s *MemoryStore) GetScanFailures(ctx context.Context) (map[string]ScanFailure, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return maps.Clone(s.data.ScanFailures), nil
+}
+
+func (s *MemoryStore) PutScanFailures(ctx context.Context, failures []ScanFailure) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.data.putScanFailures(failures)
+	return nil
+}
+
+func (s *MemoryStore) DeleteScanFailures(ctx context.Context, failures []ScanFailure) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.data.deleteScanFailures(failures)
+	return nil
+}
+
+func (s *MemoryStore) GetFindingRecords(ctx context.Context, region string) (map[string]FindingRecord, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.data.Findings.get(region), nil
+}
+
+func (s *MemoryStore) PutFindingRecords(ctx context.Context, records []FindingRecord) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.data.putFindingRecords(records)
+	return nil
+}
+
+func (s *MemoryStore) DeleteFindingRecords(ctx context.Context, records []FindingRecord) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.data.deleteFindingRecords(records)
+	return nil
+}
+
+func (s *MemoryStore) GetOpsItemRecords(ctx context.Context, region string) (map[string]OpsItemRecord, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.data.OpsItems.get(region), nil
+}
+
+func (s *MemoryStore) PutOpsItemRecords(ctx context.Context, records []OpsItemRecord) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.data.putOpsItemRecords(records)
+	return nil
+}
+
+func (s *MemoryStore) DeleteOpsItemRecords(ctx context.Context, records []OpsItemRecord) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.data.deleteOpsItemRecords(records)
+	return nil
+}
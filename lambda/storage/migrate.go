@@ -0,0 +1,226 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	ddbTypes "github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// MigrationClient is the DynamoDB API used by MigrateKeys, which reads the
+// whole table.
+type MigrationClient interface {
+	DDBClient
+	Scan(ctx context.Context, params *dynamodb.ScanInput, optFns ...func(*dynamodb.Options)) (*dynamodb.ScanOutput, error)
+}
+
+// SnapshotResolver returns the snapshots of region named snapshotID: none when
+// the snapshot no longer exists, and two when an instance and a cluster
+// snapshot share the name.
+type SnapshotResolver func(ctx context.Context, region, snapshotID string) ([]SnapshotInfo, error)
+
+// MigrationStats counts the items rewritten by MigrateKeys. Other are the
+// outbox, held change, report and scan failure rows; Dropped are the status
+// rows of snapshots that no longer exist.
+type MigrationStats struct {
+	Snapshots   int
+	Resources   int
+	Checkpoints int
+	Locks       int
+	History     int
+	Other       int
+	Dropped     int
+}
+
+// MigrateKeys rewrites the items of table that use the keys of the single
+// account layout, where snapshot status rows and database rows shared a
+// partition named after the region and status rows were keyed by snapshot
+// identifier. Each item is written under the key of its type for account,
+// then the old item is deleted. Status rows and transitions are keyed by the
+// ARN that resolve returns and keep their TTL. Items already migrated are left alone, so the
+// migration can be run again after a failure. With dryRun set nothing is
+// written.
+func MigrateKeys(ctx context.Context, client MigrationClient, table, account string,
+	resolve SnapshotResolver, dryRun bool) (MigrationStats, error) {
+
+	store := NewDynamoDBStore(client, table, account)
+	var stats MigrationStats
+	var lastEvaluatedKey map[string]ddbTypes.AttributeValue
+
+	for {
+		result, err := client.Scan(ctx, &dynamodb.ScanInput{
+			TableName:         aws.String(table),
+			ExclusiveStartKey: lastEvaluatedKey,
+		})
+		if err != nil {
+			return stats, fmt.Errorf("unable to scan table %s: %v", table, err)
+		}
+
+		var puts, deletes []ddbTypes.WriteRequest
+		for _, item := range result.Items {
+			newItems, err := store.migrateItem(ctx, item, resolve, &stats)
+			if err != nil {
+				return stats, err
+			}
+			if newItems == nil {
+				continue
+			}
+			for _, newItem := range newItems {
+				puts = append(puts, ddbTypes.WriteRequest{PutRequest: &ddbTypes.PutRequest{Item: newItem}})
+			}
+			deletes = append(deletes, ddbTypes.WriteRequest{
+				DeleteRequest: &ddbTypes.DeleteRequest{
+					Key: map[string]ddbTypes.AttributeValue{"pk": item["pk"], "sk": item["sk"]},
+				},
+			})
+		}
+
+		// The old items are only deleted once the new ones are written
+		if !dryRun {
+			if err := batchWrite(ctx, store.table, puts); err != nil {
+				return stats, fmt.Errorf("unable to write migrated items: %v", err)
+			}
+			if err := batchWrite(ctx, store.table, deletes); err != nil {
+				return stats, fmt.Errorf("unable to delete migrated items: %v", err)
+			}
+		}
+
+		lastEvaluatedKey = result.LastEvaluatedKey
+		if lastEvaluatedKey == nil {
+			break
+		}
+	}
+
+	return stats, nil
+}
+
+// legacyRegion matches the region names that partitioned the single account
+// layout, so keys of the current layout, which start with an item type, are
+// never taken for legacy ones.
+var legacyRegion = regexp.MustCompile(`^[a-z]{2}(-[a-z]+)+-[0-9]+$`)
+
+// migrateItem returns the items that replace item, an empty slice when item
+// is to be deleted without replacement, and nil when it is kept as it is.
+// Only the partition keys of the single account layout are migrated:
+//
+//	<region>             snapshot status rows, and database rows whose sort
+//	                     key has a type prefix
+//	checkpoint#<region>  paused scans
+//	history#<region>     status transitions, keyed by snapshot identifier
+//	lock                 leases
+//	held#<window>        held changes
+//	report#<period>      report metrics
+//	outbox               outbox entries
+//	scan-failure         scan failures
+func (s *DynamoDBStore) migrateItem(ctx context.Context, item map[string]ddbTypes.AttributeValue,
+	resolve SnapshotResolver, stats *MigrationStats) ([]map[string]ddbTypes.AttributeValue, error) {
+
+	pk := item["pk"].(*ddbTypes.AttributeValueMemberS).Value
+	sk := item["sk"].(*ddbTypes.AttributeValueMemberS).Value
+	itemType, scope, _ := strings.Cut(pk, "#")
+
+	switch {
+	case pk == lockType:
+		stats.Locks++
+		return []map[string]ddbTypes.AttributeValue{withPartition(item, lockKey(s.table.Account))}, nil
+
+	case pk == outboxType || pk == scanFailureType:
+		stats.Other++
+		return []map[string]ddbTypes.AttributeValue{withPartition(item, partitionKey(pk, s.table.Account))}, nil
+
+	case (itemType == heldType || itemType == reportType) && scope != "" && !strings.Contains(scope, "#"):
+		stats.Other++
+		return []map[string]ddbTypes.AttributeValue{
+			withPartition(item, partitionKey(itemType, s.table.Account, scope)),
+		}, nil
+
+	case itemType == checkpointType && legacyRegion.MatchString(scope):
+		stats.Checkpoints++
+		return []map[string]ddbTypes.AttributeValue{withPartition(item, checkpointKey(s.table.Account, scope))}, nil
+
+	case itemType == historyType && legacyRegion.MatchString(scope):
+		newItem, err := s.migrateTransition(ctx, scope, item, resolve)
+		if err != nil {
+			return nil, err
+		}
+		stats.History++
+		return []map[string]ddbTypes.AttributeValue{newItem}, nil
+
+	case !legacyRegion.MatchString(pk):
+		// Items of the current layout keep their keys
+		return nil, nil
+
+	case strings.Contains(sk, "#"):
+		stats.Resources++
+		return []map[string]ddbTypes.AttributeValue{withPartition(item, resourceKey(s.table.Account, pk))}, nil
+	}
+
+	// A snapshot status row, in the partition of its region
+	snapshots, err := resolve(ctx, pk, sk)
+	if err != nil {
+		return nil, fmt.Errorf("unable to resolve snapshot %s in region %s: %v", sk, pk, err)
+	}
+	if len(snapshots) == 0 {
+		stats.Dropped++
+		return []map[string]ddbTypes.AttributeValue{}, nil
+	}
+
+	status := item["status"].(*ddbTypes.AttributeValueMemberS).Value
+	expirationTime := time.Unix(numberAttribute(item, "ttl"), 0)
+	newItems := make([]map[string]ddbTypes.AttributeValue, len(snapshots))
+	for i, snapshot := range snapshots {
+		snapshot.Status = status
+		newItems[i] = s.snapshotItem(pk, snapshot, expirationTime)
+	}
+	stats.Snapshots += len(newItems)
+	return newItems, nil
+}
+
+// migrateTransition returns the history row of a transition recorded by
+// snapshot identifier. It is keyed by the ARN of the snapshot when the
+// identifier resolves to a single snapshot, and by the identifier otherwise,
+// so the history of deleted snapshots is kept. The row keeps its TTL.
+func (s *DynamoDBStore) migrateTransition(ctx context.Context, region string, item map[string]ddbTypes.AttributeValue,
+	resolve SnapshotResolver) (map[string]ddbTypes.AttributeValue, error) {
+
+	// Snapshot identifiers cannot contain '#'
+	snapshotID, _, _ := strings.Cut(item["sk"].(*ddbTypes.AttributeValueMemberS).Value, "#")
+	snapshots, err := resolve(ctx, region, snapshotID)
+	if err != nil {
+		return nil, fmt.Errorf("unable to resolve snapshot %s in region %s: %v", snapshotID, region, err)
+	}
+	snapshot := SnapshotInfo{SnapshotID: snapshotID}
+	if len(snapshots) == 1 {
+		snapshot = snapshots[0]
+	}
+
+	newItem := s.transitionItem(region, Transition{
+		SnapshotKey: snapshot.Key(),
+		SnapshotID:  snapshotID,
+		SourceType:  snapshot.SnapshotType,
+		SourceID:    snapshot.SourceID,
+		From:        stringAttribute(item, "from"),
+		To:          stringAttribute(item, "to"),
+		ObservedAt:  time.Unix(0, numberAttribute(item, "observedAt")),
+	}, 0)
+	delete(newItem, "ttl")
+	if ttl, ok := item["ttl"]; ok {
+		newItem["ttl"] = ttl
+	}
+	return newItem, nil
+}
+
+// withPartition returns a copy of item in partition pk.
+func withPartition(item map[string]ddbTypes.AttributeValue, pk string) map[string]ddbTypes.AttributeValue {
+	newItem := make(map[string]ddbTypes.AttributeValue, len(item))
+	for name, value := range item {
+		newItem[name] = value
+	}
+	newItem["pk"] = &ddbTypes.AttributeValueMemberS{Value: pk}
+	return newItem
+}
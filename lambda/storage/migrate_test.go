@@ -0,0 +1,173 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// migrationTable is an in-memory table that returns all its items in one
+// scan page.
+type migrationTable struct {
+	mockDynamoDBClient
+	items map[string]map[string]types.AttributeValue
+}
+
+func itemKey(item map[string]types.AttributeValue) string {
+	return item["pk"].(*types.AttributeValueMemberS).Value + "|" + item["sk"].(*types.AttributeValueMemberS).Value
+}
+
+func newMigrationTable(items ...map[string]types.AttributeValue) *migrationTable {
+	table := &migrationTable{items: make(map[string]map[string]types.AttributeValue)}
+	for _, item := range items {
+		table.items[itemKey(item)] = item
+	}
+	return table
+}
+
+func (m *migrationTable) Scan(ctx context.Context, params *dynamodb.ScanInput, optFns ...func(*dynamodb.Options)) (*dynamodb.ScanOutput, error) {
+	output := &dynamodb.ScanOutput{}
+	for _, item := range m.items {
+		output.Items = append(output.Items, item)
+	}
+	return output, nil
+}
+
+func (m *migrationTable) BatchWriteItem(ctx context.Context, params *dynamodb.BatchWriteItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.BatchWriteItemOutput, error) {
+	for _, request := range params.RequestItems["test-table"] {
+		if request.PutRequest != nil {
+			m.items[itemKey(request.PutRequest.Item)] = request.PutRequest.Item
+		}
+		if request.DeleteRequest != nil {
+			delete(m.items, itemKey(request.DeleteRequest.Key))
+		}
+	}
+	return &dynamodb.BatchWriteItemOutput{}, nil
+}
+
+func (m *migrationTable) keys() []string {
+	var keys []string
+	for key := range m.items {
+		keys = append(keys, key)
+	}
+	return keys
+}
+
+func stringItem(attributes ...string) map[string]types.AttributeValue {
+	item := make(map[string]types.AttributeValue)
+	for i := 0; i < len(attributes); i += 2 {
+		item[attributes[i]] = &types.AttributeValueMemberS{Value: attributes[i+1]}
+	}
+	return item
+}
+
+func TestMigrateKeys(t *testing.T) {
+	ctx := context.Background()
+	const account = "123456789012"
+
+	nightly := stringItem("pk", "us-west-2", "sk", "nightly", "status", "failed")
+	nightly["ttl"] = &types.AttributeValueMemberN{Value: "1732104000"}
+
+	// Transitions of a snapshot that resolves to one ARN, and of one that
+	// does not
+	weeklyFailed := stringItem("pk", "history#us-west-2", "sk", "weekly#01732100000000000000", "from", "creating", "to", "failed")
+	weeklyFailed["observedAt"] = &types.AttributeValueMemberN{Value: "1732100000000000000"}
+	weeklyFailed["ttl"] = &types.AttributeValueMemberN{Value: "1739876000"}
+	nightlyFailed := stringItem("pk", "history#us-west-2", "sk", "nightly#01732100000000000000", "to", "failed")
+	nightlyFailed["observedAt"] = &types.AttributeValueMemberN{Value: "1732100000000000000"}
+
+	oldItems := []map[string]types.AttributeValue{
+		nightly,
+		weeklyFailed,
+		nightlyFailed,
+		stringItem("pk", "us-west-2", "sk", "deleted", "status", "available"),
+		stringItem("pk", "us-west-2", "sk", "health#instance/orders", "failedSnapshotId", "nightly"),
+		stringItem("pk", "checkpoint#us-west-2", "sk", "position", "marker", "page-2"),
+		stringItem("pk", "lock", "sk", "us-west-2", "owner", "run-1"),
+		stringItem("pk", "outbox", "sk", "00000000000000000001-abcd"),
+		stringItem("pk", "scan-failure", "sk", "us-west-2#scan"),
+		stringItem("pk", "report#daily", "sk", "2024-11-20"),
+		stringItem("pk", "held#nightly", "sk", "change-1"),
+	}
+
+	// An instance and a cluster snapshot share the name nightly
+	resolve := func(ctx context.Context, region, snapshotID string) ([]SnapshotInfo, error) {
+		switch snapshotID {
+		case "nightly":
+			return []SnapshotInfo{
+				{SnapshotID: "nightly", SnapshotArn: "arn:aws:rds:us-west-2:123456789012:snapshot:nightly", SnapshotType: "instance", SourceID: "orders"},
+				{SnapshotID: "nightly", SnapshotArn: "arn:aws:rds:us-west-2:123456789012:cluster-snapshot:nightly", SnapshotType: "cluster", SourceID: "catalog"},
+			}, nil
+		case "weekly":
+			return []SnapshotInfo{
+				{SnapshotID: "weekly", SnapshotArn: "arn:aws:rds:us-west-2:123456789012:snapshot:weekly", SnapshotType: "instance", SourceID: "orders"},
+			}, nil
+		}
+		return nil, nil
+	}
+
+	wantKeys := []string{
+		"snapshot#123456789012#us-west-2|arn:aws:rds:us-west-2:123456789012:snapshot:nightly",
+		"snapshot#123456789012#us-west-2|arn:aws:rds:us-west-2:123456789012:cluster-snapshot:nightly",
+		"resource#123456789012#us-west-2|health#instance/orders",
+		"checkpoint#123456789012#us-west-2|position",
+		"lock#123456789012|us-west-2",
+		"outbox#123456789012|00000000000000000001-abcd",
+		"scan-failure#123456789012|us-west-2#scan",
+		"report#123456789012#daily|2024-11-20",
+		"held#123456789012#nightly|change-1",
+		"history#123456789012#us-west-2|arn:aws:rds:us-west-2:123456789012:snapshot:weekly#01732100000000000000",
+		"history#123456789012#us-west-2|nightly#01732100000000000000",
+	}
+
+	t.Run("rewrites items under the keys of their type", func(t *testing.T) {
+		table := newMigrationTable(oldItems...)
+		stats, err := MigrateKeys(ctx, table, "test-table", account, resolve, false)
+		require.NoError(t, err)
+
+		assert.Equal(t, MigrationStats{Snapshots: 2, Resources: 1, Checkpoints: 1, Locks: 1, History: 2, Other: 4, Dropped: 1}, stats)
+		assert.ElementsMatch(t, wantKeys, table.keys())
+
+		migrated := table.items["snapshot#123456789012#us-west-2|arn:aws:rds:us-west-2:123456789012:snapshot:nightly"]
+		assert.Equal(t, "failed", migrated["status"].(*types.AttributeValueMemberS).Value)
+		assert.Equal(t, "1732104000", migrated["ttl"].(*types.AttributeValueMemberN).Value)
+		assert.Equal(t, "123456789012#us-west-2#instance/orders", migrated["source"].(*types.AttributeValueMemberS).Value)
+
+		transition := table.items["history#123456789012#us-west-2|arn:aws:rds:us-west-2:123456789012:snapshot:weekly#01732100000000000000"]
+		assert.Equal(t, "arn:aws:rds:us-west-2:123456789012:snapshot:weekly", transition["snapshotKey"].(*types.AttributeValueMemberS).Value)
+		assert.Equal(t, "failed", transition["to"].(*types.AttributeValueMemberS).Value)
+		assert.Equal(t, "1732100000000000000", transition["observedAt"].(*types.AttributeValueMemberN).Value)
+		assert.Equal(t, "1739876000", transition["ttl"].(*types.AttributeValueMemberN).Value)
+		assert.Equal(t, "123456789012#us-west-2#instance/orders", transition["historySource"].(*types.AttributeValueMemberS).Value)
+
+		// Running it again changes nothing
+		stats, err = MigrateKeys(ctx, table, "test-table", account, resolve, false)
+		require.NoError(t, err)
+		assert.Equal(t, MigrationStats{}, stats)
+		assert.ElementsMatch(t, wantKeys, table.keys())
+	})
+
+	t.Run("writes nothing in a dry run", func(t *testing.T) {
+		table := newMigrationTable(oldItems...)
+		stats, err := MigrateKeys(ctx, table, "test-table", account, resolve, true)
+		require.NoError(t, err)
+
+		assert.Equal(t, 2, stats.Snapshots)
+		assert.Len(t, table.items, len(oldItems))
+		assert.Contains(t, table.items, "us-west-2|nightly")
+	})
+
+	t.Run("stops when a snapshot cannot be resolved", func(t *testing.T) {
+		table := newMigrationTable(oldItems...)
+		_, err := MigrateKeys(ctx, table, "test-table", account,
+			func(ctx context.Context, region, snapshotID string) ([]SnapshotInfo, error) {
+				return nil, fmt.Errorf("RDS error")
+			}, false)
+		assert.ErrorContains(t, err, "unable to resolve snapshot")
+	})
+}
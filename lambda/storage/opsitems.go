@@ -0,0 +1,127 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	ddbTypes "github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// opsItemPrefix marks the rows of open OpsItems in the resource partition of
+// their region.
+const opsItemPrefix = "opsitem#"
+
+// OpsItemRecord links a database with the OpsItem opened for its backups.
+// SnapshotID is the latest snapshot attached to the OpsItem.
+type OpsItemRecord struct {
+	Region      string
+	ResourceArn string
+	OpsItemID   string
+	Problem     string
+	SnapshotID  string
+	CreatedAt   time.Time
+}
+
+// OpsItemStore keeps the OpsItems opened for databases until they are
+// resolved.
+type OpsItemStore interface {
+	// GetOpsItemRecords returns the open OpsItems of region keyed by resource
+	// ARN.
+	GetOpsItemRecords(ctx context.Context, region string) (map[string]OpsItemRecord, error)
+	// PutOpsItemRecords creates or replaces OpsItem records.
+	PutOpsItemRecords(ctx context.Context, records []OpsItemRecord) error
+	// DeleteOpsItemRecords removes the records of resolved OpsItems.
+	DeleteOpsItemRecords(ctx context.Context, records []OpsItemRecord) error
+}
+
+// GetOpsItemRecords returns the open OpsItems of region keyed by resource ARN.
+func (s *DynamoDBStore) GetOpsItemRecords(ctx context.Context, region string) (map[string]OpsItemRecord, error) {
+	records := make(map[string]OpsItemRecord)
+	var lastEvaluatedKey map[string]ddbTypes.AttributeValue
+
+	for {
+		result, err := s.table.Client.Query(ctx, &dynamodb.QueryInput{
+			TableName:              aws.String(s.table.Name),
+			KeyConditionExpression: aws.String("pk = :pk AND begins_with(sk, :prefix)"),
+			ExpressionAttributeValues: map[string]ddbTypes.AttributeValue{
+				":pk":     &ddbTypes.AttributeValueMemberS{Value: resourceKey(s.table.Account, region)},
+				":prefix": &ddbTypes.AttributeValueMemberS{Value: opsItemPrefix},
+			},
+			ExclusiveStartKey: lastEvaluatedKey,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("unable to query OpsItems in region %s: %v", region, err)
+		}
+
+		for _, item := range result.Items {
+			record := OpsItemRecord{
+				Region:      region,
+				ResourceArn: strings.TrimPrefix(item["sk"].(*ddbTypes.AttributeValueMemberS).Value, opsItemPrefix),
+				OpsItemID:   item["opsItemId"].(*ddbTypes.AttributeValueMemberS).Value,
+				Problem:     item["problem"].(*ddbTypes.AttributeValueMemberS).Value,
+				CreatedAt:   time.Unix(numberAttribute(item, "createdAt"), 0).UTC(),
+			}
+			if snapshotID, ok := item["snapshotId"].(*ddbTypes.AttributeValueMemberS); ok {
+				record.SnapshotID = snapshotID.Value
+			}
+			records[record.ResourceArn] = record
+		}
+
+		lastEvaluatedKey = result.LastEvaluatedKey
+		if lastEvaluatedKey == nil {
+			break
+		}
+	}
+
+	return records, nil
+}
+
+// PutOpsItemRecords creates or replaces OpsItem records. The rows have no TTL;
+// they are deleted once the OpsItem is resolved.
+func (s *DynamoDBStore) PutOpsItemRecords(ctx context.Context, records []OpsItemRecord) error {
+	writeRequests := make([]ddbTypes.WriteRequest, len(records))
+	for i, record := range records {
+		writeRequests[i] = ddbTypes.WriteRequest{
+			PutRequest: &ddbTypes.PutRequest{
+				Item: map[string]ddbTypes.AttributeValue{
+					"pk":         &ddbTypes.AttributeValueMemberS{Value: resourceKey(s.table.Account, record.Region)},
+					"sk":         &ddbTypes.AttributeValueMemberS{Value: opsItemPrefix + record.ResourceArn},
+					"opsItemId":  &ddbTypes.AttributeValueMemberS{Value: record.OpsItemID},
+					"problem":    &ddbTypes.AttributeValueMemberS{Value: record.Problem},
+					"snapshotId": &ddbTypes.AttributeValueMemberS{Value: record.SnapshotID},
+					"createdAt":  &ddbTypes.AttributeValueMemberN{Value: strconv.FormatInt(record.CreatedAt.Unix(), 10)},
+				},
+			},
+		}
+	}
+
+	if err := batchWrite(ctx, s.table, writeRequests); err != nil {
+		return fmt.Errorf("unable to store OpsItems: %v", err)
+	}
+	return nil
+}
+
+// DeleteOpsItemRecords removes the records of resolved OpsItems.
+func (s *DynamoDBStore) DeleteOpsItemRecords(ctx context.Context, records []OpsItemRecord) error {
+	writeRequests := make([]ddbTypes.WriteRequest, len(records))
+	for i, record := range records {
+		writeRequests[i] = ddbTypes.WriteRequest{
+			DeleteRequest: &ddbTypes.DeleteRequest{
+				Key: map[string]ddbTypes.AttributeValue{
+					"pk": &ddbTypes.AttributeValueMemberS{Value: resourceKey(s.table.Account, record.Region)},
+					"sk": &ddbTypes.AttributeValueMemberS{Value: opsItemPrefix + record.ResourceArn},
+				},
+			},
+		}
+	}
+
+	if err := batchWrite(ctx, s.table, writeRequests); err != nil {
+		return fmt.Errorf("unable to delete OpsItems: %v", err)
+	}
+	return nil
+}
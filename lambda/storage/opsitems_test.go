@@ -0,0 +1,33 @@
+package storage
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPutAndDeleteOpsItemRecords(t *testing.T) {
+	record := OpsItemRecord{
+		Region:      "us-east-1",
+		ResourceArn: "arn:aws:rds:us-east-1:123456789012:cluster:catalog",
+		OpsItemID:   "oi-0123456789ab",
+		Problem:     "missing",
+		CreatedAt:   time.Unix(1732060800, 0),
+	}
+
+	client := &mockDynamoDBClient{batchWriteOutput: &dynamodb.BatchWriteItemOutput{}}
+	assert.NoError(t, testStore(client).PutOpsItemRecords(context.Background(), []OpsItemRecord{record}))
+
+	item := client.capturedBatchWrite.RequestItems["test-table"][0].PutRequest.Item
+	assert.Equal(t, "opsitem#arn:aws:rds:us-east-1:123456789012:cluster:catalog", item["sk"].(*types.AttributeValueMemberS).Value)
+	assert.Equal(t, "oi-0123456789ab", item["opsItemId"].(*types.AttributeValueMemberS).Value)
+	assert.NotContains(t, item, "ttl")
+
+	assert.NoError(t, testStore(client).DeleteOpsItemRecords(context.Background(), []OpsItemRecord{record}))
+	key := client.capturedBatchWrite.RequestItems["test-table"][0].DeleteRequest.Key
+	assert.Equal(t, "opsitem#arn:aws:rds:us-east-1:123456789012:cluster:catalog", key["sk"].(*types.AttributeValueMemberS).Value)
+}
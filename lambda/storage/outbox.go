@@ -0,0 +1,230 @@
+package storage
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	ddbTypes "github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// outboxChunkSize is the most payload bytes stored per item, which keeps items
+// below the DynamoDB item size limit of 400 KB.
+const outboxChunkSize = 350 * 1024
+
+func outboxChunkKey(id string, chunk int) string {
+	return fmt.Sprintf("%s#chunk#%05d", id, chunk)
+}
+
+// OutboxEntry is a digest recorded before it is sent and before the snapshot
+// states it reports are stored, so a run that stops part way is completed by
+// the next run instead of losing or repeating the digest. Payload is the
+// encoded digest, opaque to storage; Delivered are the keys of the
+// deliveries made already.
+type OutboxEntry struct {
+	ID        string
+	CreatedAt time.Time
+	Payload   []byte
+	Delivered []string
+	chunks    int
+}
+
+// OutboxStore keeps the digests that were not completed yet.
+type OutboxStore interface {
+	// GetOutboxEntries returns the entries that were not completed, oldest
+	// first.
+	GetOutboxEntries(ctx context.Context) ([]*OutboxEntry, error)
+	// PutOutboxEntry stores entry. An entry is never read without its
+	// payload.
+	PutOutboxEntry(ctx context.Context, entry *OutboxEntry) error
+	// MarkOutboxDelivered records that the delivery of entry with key was
+	// made.
+	MarkOutboxDelivered(ctx context.Context, entry *OutboxEntry, key string) error
+	// DeleteOutboxEntry removes an entry that was delivered to every
+	// destination and whose snapshot states were stored.
+	DeleteOutboxEntry(ctx context.Context, entry *OutboxEntry) error
+}
+
+// NewOutboxEntry returns an entry with a new ID. IDs sort in the order the
+// entries were created.
+func NewOutboxEntry(payload []byte, now time.Time) (*OutboxEntry, error) {
+	random := make([]byte, 4)
+	if _, err := rand.Read(random); err != nil {
+		return nil, fmt.Errorf("unable to create outbox entry ID: %v", err)
+	}
+	return &OutboxEntry{
+		ID:        fmt.Sprintf("%020d-%s", now.UnixNano(), hex.EncodeToString(random)),
+		CreatedAt: now,
+		Payload:   payload,
+	}, nil
+}
+
+// IsDelivered reports whether the delivery with key was made.
+func (e *OutboxEntry) IsDelivered(key string) bool {
+	return slices.Contains(e.Delivered, key)
+}
+
+// GetOutboxEntries returns the entries that were not completed, oldest first.
+func (s *DynamoDBStore) GetOutboxEntries(ctx context.Context) ([]*OutboxEntry, error) {
+	entries := make(map[string]*OutboxEntry)
+	chunks := make(map[string]map[int][]byte)
+	var lastEvaluatedKey map[string]ddbTypes.AttributeValue
+
+	for {
+		result, err := s.table.Client.Query(ctx, &dynamodb.QueryInput{
+			TableName:              aws.String(s.table.Name),
+			KeyConditionExpression: aws.String("pk = :pk"),
+			ExpressionAttributeValues: map[string]ddbTypes.AttributeValue{
+				":pk": &ddbTypes.AttributeValueMemberS{Value: outboxKey(s.table.Account)},
+			},
+			ExclusiveStartKey: lastEvaluatedKey,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("unable to query outbox: %v", err)
+		}
+
+		for _, item := range result.Items {
+			sk := item["sk"].(*ddbTypes.AttributeValueMemberS).Value
+			id, chunkKey, isChunk := strings.Cut(sk, "#chunk#")
+			if isChunk {
+				chunk, err := strconv.Atoi(chunkKey)
+				if err != nil {
+					return nil, fmt.Errorf("invalid outbox key %q", sk)
+				}
+				if chunks[id] == nil {
+					chunks[id] = make(map[int][]byte)
+				}
+				chunks[id][chunk] = item["payload"].(*ddbTypes.AttributeValueMemberB).Value
+				continue
+			}
+
+			entry := &OutboxEntry{
+				ID:        id,
+				CreatedAt: time.Unix(numberAttribute(item, "createdAt"), 0).UTC(),
+				chunks:    int(numberAttribute(item, "chunks")),
+			}
+			if delivered, ok := item["delivered"].(*ddbTypes.AttributeValueMemberSS); ok {
+				entry.Delivered = delivered.Value
+			}
+			entries[id] = entry
+		}
+
+		lastEvaluatedKey = result.LastEvaluatedKey
+		if lastEvaluatedKey == nil {
+			break
+		}
+	}
+
+	// Chunks without an entry belong to an entry that was being stored or
+	// deleted
+	ids := make([]string, 0, len(entries))
+	for id, entry := range entries {
+		for chunk := 0; chunk < entry.chunks; chunk++ {
+			data, ok := chunks[id][chunk]
+			if !ok {
+				return nil, fmt.Errorf("outbox entry %s is missing chunk %d", id, chunk)
+			}
+			entry.Payload = append(entry.Payload, data...)
+		}
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	result := make([]*OutboxEntry, len(ids))
+	for i, id := range ids {
+		result[i] = entries[id]
+	}
+	return result, nil
+}
+
+// PutOutboxEntry stores entry. The payload is written first, so an entry is
+// never read without it.
+func (s *DynamoDBStore) PutOutboxEntry(ctx context.Context, entry *OutboxEntry) error {
+	var writeRequests []ddbTypes.WriteRequest
+	for start := 0; start < len(entry.Payload); start += outboxChunkSize {
+		end := min(start+outboxChunkSize, len(entry.Payload))
+		writeRequests = append(writeRequests, ddbTypes.WriteRequest{
+			PutRequest: &ddbTypes.PutRequest{
+				Item: map[string]ddbTypes.AttributeValue{
+					"pk":      &ddbTypes.AttributeValueMemberS{Value: outboxKey(s.table.Account)},
+					"sk":      &ddbTypes.AttributeValueMemberS{Value: outboxChunkKey(entry.ID, len(writeRequests))},
+					"payload": &ddbTypes.AttributeValueMemberB{Value: entry.Payload[start:end]},
+				},
+			},
+		})
+	}
+	if err := batchWrite(ctx, s.table, writeRequests); err != nil {
+		return fmt.Errorf("unable to store outbox entry %s: %v", entry.ID, err)
+	}
+
+	entry.chunks = len(writeRequests)
+	return s.putOutboxHeader(ctx, entry)
+}
+
+// MarkOutboxDelivered records that the delivery of entry with key was made.
+func (s *DynamoDBStore) MarkOutboxDelivered(ctx context.Context, entry *OutboxEntry, key string) error {
+	if entry.IsDelivered(key) {
+		return nil
+	}
+	entry.Delivered = append(entry.Delivered, key)
+	return s.putOutboxHeader(ctx, entry)
+}
+
+func (s *DynamoDBStore) putOutboxHeader(ctx context.Context, entry *OutboxEntry) error {
+	item := map[string]ddbTypes.AttributeValue{
+		"pk":        &ddbTypes.AttributeValueMemberS{Value: outboxKey(s.table.Account)},
+		"sk":        &ddbTypes.AttributeValueMemberS{Value: entry.ID},
+		"createdAt": &ddbTypes.AttributeValueMemberN{Value: strconv.FormatInt(entry.CreatedAt.Unix(), 10)},
+		"chunks":    &ddbTypes.AttributeValueMemberN{Value: strconv.Itoa(entry.chunks)},
+	}
+	// String sets cannot be empty
+	if len(entry.Delivered) > 0 {
+		item["delivered"] = &ddbTypes.AttributeValueMemberSS{Value: entry.Delivered}
+	}
+
+	_, err := s.table.Client.PutItem(ctx, &dynamodb.PutItemInput{
+		TableName: aws.String(s.table.Name),
+		Item:      item,
+	})
+	if err != nil {
+		return fmt.Errorf("unable to store outbox entry %s: %v", entry.ID, err)
+	}
+	return nil
+}
+
+// DeleteOutboxEntry removes an entry that was delivered to every destination
+// and whose snapshot states were stored. The entry is deleted before its
+// payload, so a failure part way leaves no entry that could be read.
+func (s *DynamoDBStore) DeleteOutboxEntry(ctx context.Context, entry *OutboxEntry) error {
+	payloadKeys := make([]string, entry.chunks)
+	for chunk := range payloadKeys {
+		payloadKeys[chunk] = outboxChunkKey(entry.ID, chunk)
+	}
+
+	// A batch may apply its writes in any order
+	for _, keys := range [][]string{{entry.ID}, payloadKeys} {
+		writeRequests := make([]ddbTypes.WriteRequest, len(keys))
+		for i, sk := range keys {
+			writeRequests[i] = ddbTypes.WriteRequest{
+				DeleteRequest: &ddbTypes.DeleteRequest{
+					Key: map[string]ddbTypes.AttributeValue{
+						"pk": &ddbTypes.AttributeValueMemberS{Value: outboxKey(s.table.Account)},
+						"sk": &ddbTypes.AttributeValueMemberS{Value: sk},
+					},
+				},
+			}
+		}
+		if err := batchWrite(ctx, s.table, writeRequests); err != nil {
+			return fmt.Errorf("unable to delete outbox entry %s: %v", entry.ID, err)
+		}
+	}
+	return nil
+}
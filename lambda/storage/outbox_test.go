@@ -0,0 +1,82 @@
+package storage
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGetOutboxEntriesAfterFailures(t *testing.T) {
+	ctx := context.Background()
+	payload := []byte(strings.Repeat("x", outboxChunkSize+1))
+
+	t.Run("skips the chunks of an entry that was not stored", func(t *testing.T) {
+		table := newFakeDynamoDB()
+		entry, err := NewOutboxEntry(payload, time.Unix(1732060800, 0))
+		require.NoError(t, err)
+		table.failAt = 2
+		assert.Error(t, testStore(table).PutOutboxEntry(ctx, entry))
+
+		entries, err := testStore(table).GetOutboxEntries(ctx)
+		require.NoError(t, err)
+		assert.Empty(t, entries)
+	})
+
+	t.Run("rejects an entry with a missing chunk", func(t *testing.T) {
+		table := newFakeDynamoDB()
+		entry, err := NewOutboxEntry(payload, time.Unix(1732060800, 0))
+		require.NoError(t, err)
+		require.NoError(t, testStore(table).PutOutboxEntry(ctx, entry))
+		table.delete(outboxKey("123456789012"), outboxChunkKey(entry.ID, 1))
+
+		_, err = testStore(table).GetOutboxEntries(ctx)
+		assert.ErrorContains(t, err, "missing chunk 1")
+	})
+}
+
+func TestPutMarkAndDeleteOutboxEntry(t *testing.T) {
+	ctx := context.Background()
+	client := &mockDynamoDBClient{batchWriteOutput: &dynamodb.BatchWriteItemOutput{}}
+
+	payload := []byte(strings.Repeat("x", outboxChunkSize+1))
+	entry, err := NewOutboxEntry(payload, time.Unix(1732060800, 0))
+	require.NoError(t, err)
+	require.NoError(t, testStore(client).PutOutboxEntry(ctx, entry))
+
+	chunks := client.capturedBatchWrite.RequestItems["test-table"]
+	require.Len(t, chunks, 2)
+	assert.Equal(t, entry.ID+"#chunk#00001", chunks[1].PutRequest.Item["sk"].(*types.AttributeValueMemberS).Value)
+	assert.Len(t, chunks[1].PutRequest.Item["payload"].(*types.AttributeValueMemberB).Value, 1)
+
+	item := client.capturedPutItem.Item
+	assert.Equal(t, entry.ID, item["sk"].(*types.AttributeValueMemberS).Value)
+	assert.Equal(t, "2", item["chunks"].(*types.AttributeValueMemberN).Value)
+	assert.NotContains(t, item, "delivered")
+	assert.NotContains(t, item, "ttl")
+
+	require.NoError(t, testStore(client).MarkOutboxDelivered(ctx, entry, "email"))
+	assert.Equal(t, []string{"email"}, client.capturedPutItem.Item["delivered"].(*types.AttributeValueMemberSS).Value)
+	assert.True(t, entry.IsDelivered("email"))
+
+	// The entry is deleted before its chunks
+	require.NoError(t, testStore(client).DeleteOutboxEntry(ctx, entry))
+	deletes := client.capturedBatchWrite.RequestItems["test-table"]
+	require.Len(t, deletes, 2)
+	assert.Equal(t, entry.ID+"#chunk#00000", deletes[0].DeleteRequest.Key["sk"].(*types.AttributeValueMemberS).Value)
+}
+
+func TestNewOutboxEntry(t *testing.T) {
+	earlier, err := NewOutboxEntry(nil, time.Unix(1732060800, 0))
+	require.NoError(t, err)
+	later, err := NewOutboxEntry(nil, time.Unix(1732060801, 0))
+	require.NoError(t, err)
+
+	assert.Less(t, earlier.ID, later.ID)
+	assert.NotContains(t, earlier.ID, "#")
+}
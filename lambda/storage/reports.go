@@ -0,0 +1,92 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	ddbTypes "github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// reportRetentionDays keeps report metrics long enough for month-over-month comparisons.
+const reportRetentionDays = 35
+
+// ReportStore keeps the metrics of past summary reports for
+// reportRetentionDays.
+type ReportStore interface {
+	// PutReportMetrics stores the metrics of a report under its period and
+	// date.
+	PutReportMetrics(ctx context.Context, metrics ReportMetrics) error
+	// GetReportMetrics returns the metrics stored for period and date, or nil
+	// when no report was stored for that day.
+	GetReportMetrics(ctx context.Context, period, date string) (*ReportMetrics, error)
+}
+
+// PutReportMetrics stores the metrics of a report under its period and date.
+func (s *DynamoDBStore) PutReportMetrics(ctx context.Context, metrics ReportMetrics) error {
+	expirationTime := time.Now().AddDate(0, 0, reportRetentionDays)
+
+	_, err := s.table.Client.PutItem(ctx, &dynamodb.PutItemInput{
+		TableName: aws.String(s.table.Name),
+		Item: map[string]ddbTypes.AttributeValue{
+			"pk":              &ddbTypes.AttributeValueMemberS{Value: reportKey(s.table.Account, metrics.Period)},
+			"sk":              &ddbTypes.AttributeValueMemberS{Value: metrics.Date},
+			"databases":       &ddbTypes.AttributeValueMemberN{Value: strconv.Itoa(metrics.Databases)},
+			"snapshotsTaken":  &ddbTypes.AttributeValueMemberN{Value: strconv.Itoa(metrics.SnapshotsTaken)},
+			"failures":        &ddbTypes.AttributeValueMemberN{Value: strconv.Itoa(metrics.Failures)},
+			"coverageGaps":    &ddbTypes.AttributeValueMemberN{Value: strconv.Itoa(metrics.CoverageGaps)},
+			"totalStorageGiB": &ddbTypes.AttributeValueMemberN{Value: strconv.FormatInt(metrics.TotalStorageGiB, 10)},
+			"ttl":             &ddbTypes.AttributeValueMemberN{Value: fmt.Sprintf("%d", expirationTime.Unix())},
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("unable to store %s report metrics for %s: %v", metrics.Period, metrics.Date, err)
+	}
+	return nil
+}
+
+// GetReportMetrics returns the metrics stored for period and date, or nil when
+// no report was stored for that day.
+func (s *DynamoDBStore) GetReportMetrics(ctx context.Context, period, date string) (*ReportMetrics, error) {
+	result, err := s.table.Client.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName: aws.String(s.table.Name),
+		Key: map[string]ddbTypes.AttributeValue{
+			"pk": &ddbTypes.AttributeValueMemberS{Value: reportKey(s.table.Account, period)},
+			"sk": &ddbTypes.AttributeValueMemberS{Value: date},
+		},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("unable to get %s report metrics for %s: %v", period, date, err)
+	}
+	if len(result.Item) == 0 {
+		return nil, nil
+	}
+
+	metrics := &ReportMetrics{Period: period, Date: date}
+	metrics.Databases = int(numberAttribute(result.Item, "databases"))
+	metrics.SnapshotsTaken = int(numberAttribute(result.Item, "snapshotsTaken"))
+	metrics.Failures = int(numberAttribute(result.Item, "failures"))
+	metrics.CoverageGaps = int(numberAttribute(result.Item, "coverageGaps"))
+	metrics.TotalStorageGiB = numberAttribute(result.Item, "totalStorageGiB")
+	return metrics, nil
+}
+
+func numberAttribute(item map[string]ddbTypes.AttributeValue, name string) int64 {
+	attribute, ok := item[name].(*ddbTypes.AttributeValueMemberN)
+	if !ok {
+		return 0
+	}
+	value, _ := strconv.ParseInt(attribute.Value, 10, 64)
+	return value
+}
+
+func stringAttribute(item map[string]ddbTypes.AttributeValue, name string) string {
+	attribute, ok := item[name].(*ddbTypes.AttributeValueMemberS)
+	if !ok {
+		return ""
+	}
+	return attribute.Value
+}
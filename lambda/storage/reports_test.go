@@ -0,0 +1,52 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPutReportMetrics(t *testing.T) {
+
+	tests := []struct {
+		name    string
+		client  *mockDynamoDBClient
+		wantErr bool
+	}{
+		{
+			name:   "stores metrics under period and date",
+			client: &mockDynamoDBClient{},
+		},
+		{
+			name:    "handles DynamoDB error",
+			client:  &mockDynamoDBClient{putItemErr: fmt.Errorf("DynamoDB error")},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := testStore(tt.client).PutReportMetrics(context.Background(), ReportMetrics{
+				Period:          "weekly",
+				Date:            "2024-11-18",
+				SnapshotsTaken:  42,
+				TotalStorageGiB: 1200,
+			})
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+
+			item := tt.client.capturedPutItem.Item
+			assert.Equal(t, "test-table", *tt.client.capturedPutItem.TableName)
+			assert.Equal(t, "report#123456789012#weekly", item["pk"].(*types.AttributeValueMemberS).Value)
+			assert.Equal(t, "2024-11-18", item["sk"].(*types.AttributeValueMemberS).Value)
+			assert.Equal(t, "42", item["snapshotsTaken"].(*types.AttributeValueMemberN).Value)
+			assert.Equal(t, "1200", item["totalStorageGiB"].(*types.AttributeValueMemberN).Value)
+		})
+	}
+}
@@ -0,0 +1,51 @@
+package storage
+
+import "time"
+
+// SnapshotState is the recorded state of a snapshot.
+type SnapshotState struct {
+	Status    string
+	ExpiresAt time.Time
+}
+
+// Statuses returns the status of each state of states.
+func Statuses(states map[string]SnapshotState) map[string]string {
+	statuses := make(map[string]string, len(states))
+	for key, state := range states {
+		statuses[key] = state.Status
+	}
+	return statuses
+}
+
+// Retention is how long the state of a snapshot is kept after a scan last
+// listed the snapshot. States are renewed while scans list their snapshot, so
+// a state only expires once its snapshot was deleted or is no longer scanned.
+type Retention struct {
+	// Days applies to the statuses without a retention of their own
+	Days int
+	// StatusDays are the retentions of single statuses, for example to keep
+	// the states of failed snapshots longer
+	StatusDays map[string]int
+}
+
+func (r Retention) period(status string) time.Duration {
+	days, ok := r.StatusDays[status]
+	if !ok {
+		days = r.Days
+	}
+	return time.Duration(days) * 24 * time.Hour
+}
+
+// ExpiresAt returns when a state of status expires when its snapshot was last
+// listed at now.
+func (r Retention) ExpiresAt(status string, now time.Time) time.Time {
+	return now.Add(r.period(status))
+}
+
+// NeedsRenewal reports whether state, whose snapshot is listed at now, is to
+// be written again: once less than half its retention is left. A state is
+// thus written at most twice per retention, and does not expire as long as
+// scans run more often than that.
+func (r Retention) NeedsRenewal(state SnapshotState, now time.Time) bool {
+	return state.ExpiresAt.Before(now.Add(r.period(state.Status) / 2))
+}
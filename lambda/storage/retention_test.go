@@ -0,0 +1,49 @@
+package storage
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRetention(t *testing.T) {
+	now := time.Date(2024, 11, 20, 8, 0, 0, 0, time.UTC)
+	retention := Retention{Days: 7, StatusDays: map[string]int{"failed": 90}}
+
+	assert.Equal(t, now.AddDate(0, 0, 7), retention.ExpiresAt("available", now))
+	assert.Equal(t, now.AddDate(0, 0, 90), retention.ExpiresAt("failed", now))
+
+	tests := []struct {
+		name  string
+		state SnapshotState
+		want  bool
+	}{
+		{
+			name:  "keeps a state with more than half its retention left",
+			state: SnapshotState{Status: "available", ExpiresAt: now.AddDate(0, 0, 4)},
+			want:  false,
+		},
+		{
+			name:  "renews a state with less than half its retention left",
+			state: SnapshotState{Status: "available", ExpiresAt: now.AddDate(0, 0, 3)},
+			want:  true,
+		},
+		{
+			name:  "renews by the retention of the status",
+			state: SnapshotState{Status: "failed", ExpiresAt: now.AddDate(0, 0, 30)},
+			want:  true,
+		},
+		{
+			name:  "renews a state without a TTL",
+			state: SnapshotState{Status: "failed"},
+			want:  true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, retention.NeedsRenewal(tt.state, now))
+		})
+	}
+}
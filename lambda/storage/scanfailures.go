@@ -0,0 +1,125 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	ddbTypes "github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// ScanFailure records that a stage of the run keeps failing for a region, so
+// the failure is notified once instead of on every run. Since is the time of
+// the first failure; the row is deleted once the stage completes again.
+type ScanFailure struct {
+	Region string
+	Stage  string
+	Error  string
+	Since  time.Time
+}
+
+// Key identifies the failure across runs.
+func (f ScanFailure) Key() string {
+	return f.Region + "/" + f.Stage
+}
+
+// ScanFailureStore keeps the stages that keep failing.
+type ScanFailureStore interface {
+	// GetScanFailures returns the recorded failures keyed by ScanFailure.Key.
+	GetScanFailures(ctx context.Context) (map[string]ScanFailure, error)
+	// PutScanFailures records failures.
+	PutScanFailures(ctx context.Context, failures []ScanFailure) error
+	// DeleteScanFailures removes the failures of stages that completed again.
+	DeleteScanFailures(ctx context.Context, failures []ScanFailure) error
+}
+
+// GetScanFailures returns the recorded failures keyed by ScanFailure.Key.
+func (s *DynamoDBStore) GetScanFailures(ctx context.Context) (map[string]ScanFailure, error) {
+	failures := make(map[string]ScanFailure)
+	var lastEvaluatedKey map[string]ddbTypes.AttributeValue
+
+	for {
+		result, err := s.table.Client.Query(ctx, &dynamodb.QueryInput{
+			TableName:              aws.String(s.table.Name),
+			KeyConditionExpression: aws.String("pk = :pk"),
+			ExpressionAttributeValues: map[string]ddbTypes.AttributeValue{
+				":pk": &ddbTypes.AttributeValueMemberS{Value: scanFailureKey(s.table.Account)},
+			},
+			ExclusiveStartKey: lastEvaluatedKey,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("unable to query scan failures: %v", err)
+		}
+
+		for _, item := range result.Items {
+			sk := item["sk"].(*ddbTypes.AttributeValueMemberS).Value
+			region, stage, ok := strings.Cut(sk, "/")
+			if !ok {
+				return nil, fmt.Errorf("invalid scan failure key %q", sk)
+			}
+			failure := ScanFailure{
+				Region: region,
+				Stage:  stage,
+				Since:  time.Unix(numberAttribute(item, "since"), 0).UTC(),
+			}
+			if message, ok := item["error"].(*ddbTypes.AttributeValueMemberS); ok {
+				failure.Error = message.Value
+			}
+			failures[failure.Key()] = failure
+		}
+
+		lastEvaluatedKey = result.LastEvaluatedKey
+		if lastEvaluatedKey == nil {
+			break
+		}
+	}
+
+	return failures, nil
+}
+
+// PutScanFailures records failures. The rows have no TTL; they are deleted
+// once the stage completes again.
+func (s *DynamoDBStore) PutScanFailures(ctx context.Context, failures []ScanFailure) error {
+	writeRequests := make([]ddbTypes.WriteRequest, len(failures))
+	for i, failure := range failures {
+		writeRequests[i] = ddbTypes.WriteRequest{
+			PutRequest: &ddbTypes.PutRequest{
+				Item: map[string]ddbTypes.AttributeValue{
+					"pk":    &ddbTypes.AttributeValueMemberS{Value: scanFailureKey(s.table.Account)},
+					"sk":    &ddbTypes.AttributeValueMemberS{Value: failure.Key()},
+					"error": &ddbTypes.AttributeValueMemberS{Value: failure.Error},
+					"since": &ddbTypes.AttributeValueMemberN{Value: strconv.FormatInt(failure.Since.Unix(), 10)},
+				},
+			},
+		}
+	}
+
+	if err := batchWrite(ctx, s.table, writeRequests); err != nil {
+		return fmt.Errorf("unable to store scan failures: %v", err)
+	}
+	return nil
+}
+
+// DeleteScanFailures removes the failures of stages that completed again.
+func (s *DynamoDBStore) DeleteScanFailures(ctx context.Context, failures []ScanFailure) error {
+	writeRequests := make([]ddbTypes.WriteRequest, len(failures))
+	for i, failure := range failures {
+		writeRequests[i] = ddbTypes.WriteRequest{
+			DeleteRequest: &ddbTypes.DeleteRequest{
+				Key: map[string]ddbTypes.AttributeValue{
+					"pk": &ddbTypes.AttributeValueMemberS{Value: scanFailureKey(s.table.Account)},
+					"sk": &ddbTypes.AttributeValueMemberS{Value: failure.Key()},
+				},
+			},
+		}
+	}
+
+	if err := batchWrite(ctx, s.table, writeRequests); err != nil {
+		return fmt.Errorf("unable to delete scan failures: %v", err)
+	}
+	return nil
+}
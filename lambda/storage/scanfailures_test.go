@@ -0,0 +1,33 @@
+package storage
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPutAndDeleteScanFailures(t *testing.T) {
+	failure := ScanFailure{
+		Region: "ap-south-1",
+		Stage:  "ops-items",
+		Error:  "throttled",
+		Since:  time.Unix(1732060800, 0),
+	}
+
+	client := &mockDynamoDBClient{batchWriteOutput: &dynamodb.BatchWriteItemOutput{}}
+	assert.NoError(t, testStore(client).PutScanFailures(context.Background(), []ScanFailure{failure}))
+
+	item := client.capturedBatchWrite.RequestItems["test-table"][0].PutRequest.Item
+	assert.Equal(t, "scan-failure#123456789012", item["pk"].(*types.AttributeValueMemberS).Value)
+	assert.Equal(t, "ap-south-1/ops-items", item["sk"].(*types.AttributeValueMemberS).Value)
+	assert.Equal(t, "throttled", item["error"].(*types.AttributeValueMemberS).Value)
+	assert.NotContains(t, item, "ttl")
+
+	assert.NoError(t, testStore(client).DeleteScanFailures(context.Background(), []ScanFailure{failure}))
+	key := client.capturedBatchWrite.RequestItems["test-table"][0].DeleteRequest.Key
+	assert.Equal(t, "ap-south-1/ops-items", key["sk"].(*types.AttributeValueMemberS).Value)
+}
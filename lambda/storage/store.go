@@ -0,0 +1,90 @@
+package storage
+
+import (
+	"context"
+	"time"
+)
+
+// StateStore keeps the recorded state of the monitored snapshots: the last
+// status of each snapshot, the history of their status transitions, the locks
+// that keep concurrent runs apart, and the rows of the stores it embeds.
+// DynamoDBStore is used in AWS; MemoryStore and FileStore let the monitor and
+// its tests run without DynamoDB.
+type StateStore interface {
+	OutboxStore
+	CheckpointStore
+	HeldChangeStore
+	AcknowledgementStore
+	HealthStore
+	EscalationStore
+	ReportStore
+	ScanFailureStore
+	FindingStore
+	OpsItemStore
+
+	// GetProcessedSnapshots returns the recorded state of each snapshot of
+	// region by SnapshotInfo.Key.
+	GetProcessedSnapshots(ctx context.Context, region string) (map[string]SnapshotState, error)
+	// GetSourceSnapshots returns the recorded status of the snapshots of a
+	// database of region by SnapshotInfo.Key. sourceType is instance or
+	// cluster.
+	GetSourceSnapshots(ctx context.Context, region, sourceType, sourceID string) (map[string]string, error)
+	// BatchUpdateSnapshotStates records the status of snapshots, listed now,
+	// for their retention.
+	BatchUpdateSnapshotStates(ctx context.Context, region string, snapshots []SnapshotInfo, retention Retention) error
+
+	// AppendHistory records status transitions of snapshots of region, kept
+	// for retentionDays after they were observed. Transitions are never
+	// changed once recorded; appending a transition again, with the same
+	// snapshot and observation time, writes the same record.
+	AppendHistory(ctx context.Context, region string, transitions []Transition, retentionDays int) error
+	// GetSnapshotTimeline returns the transitions of a snapshot, identified by
+	// SnapshotInfo.Key, oldest first.
+	GetSnapshotTimeline(ctx context.Context, region, snapshotKey string) ([]Transition, error)
+	// GetDatabaseTimeline returns the transitions of the snapshots of a
+	// database, oldest first. sourceType is instance or cluster.
+	GetDatabaseTimeline(ctx context.Context, region, sourceType, sourceID string) ([]Transition, error)
+
+	// AcquireLock takes the lock name for owner until expiresAt. It fails,
+	// returning false and the lock of the other owner, while another owner
+	// holds a lock that has not expired at now. An owner that holds the lock
+	// extends it.
+	AcquireLock(ctx context.Context, name, owner string, expiresAt, now time.Time) (Lock, bool, error)
+	// ReleaseLock gives up the lock name if owner holds it.
+	ReleaseLock(ctx context.Context, name, owner string) error
+}
+
+// DefaultHistoryRetentionDays keeps transitions for audits of the past year.
+const DefaultHistoryRetentionDays = 400
+
+// Transition is a status change of a snapshot as observed by the run RunID.
+// From is empty for a snapshot seen for the first time.
+type Transition struct {
+	// SnapshotKey is the SnapshotInfo.Key of the snapshot
+	SnapshotKey string
+	SnapshotID  string
+	SourceType  string
+	SourceID    string
+	From        string
+	To          string
+	ObservedAt  time.Time
+	RunID       string
+}
+
+// Lock is a lease on a unit of work, held by Owner until ExpiresAt.
+type Lock struct {
+	Name      string
+	Owner     string
+	ExpiresAt time.Time
+}
+
+// heldByOther reports whether another owner than owner holds the lock at now.
+func (l Lock) heldByOther(owner string, now time.Time) bool {
+	return l.Owner != "" && l.Owner != owner && now.Before(l.ExpiresAt)
+}
+
+var (
+	_ StateStore = (*DynamoDBStore)(nil)
+	_ StateStore = (*MemoryStore)(nil)
+	_ StateStore = (*FileStore)(nil)
+)
@@ -0,0 +1,568 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testStores are the stores that need no AWS, each returning a new empty store.
+var testStores = map[string]func(t *testing.T) StateStore{
+	"memory": func(t *testing.T) StateStore {
+		return NewMemoryStore()
+	},
+	"file": func(t *testing.T) StateStore {
+		store, err := NewFileStore(filepath.Join(t.TempDir(), "state.json"))
+		require.NoError(t, err)
+		return store
+	},
+}
+
+// rowStores are testStores and a DynamoDBStore of a fake table, for the rows
+// outside the snapshot states, history and locks.
+var rowStores = map[string]func(t *testing.T) StateStore{
+	"memory": testStores["memory"],
+	"file":   testStores["file"],
+	"dynamodb": func(t *testing.T) StateStore {
+		return testStore(newFakeDynamoDB())
+	},
+}
+
+func TestStateStore(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now()
+
+	for name, newStore := range testStores {
+		t.Run(name, func(t *testing.T) {
+			t.Run("stores snapshot states by region", func(t *testing.T) {
+				store := newStore(t)
+				require.NoError(t, store.BatchUpdateSnapshotStates(ctx, "us-west-2", []SnapshotInfo{
+					{SnapshotID: "snap-1", Status: "available"},
+					{SnapshotID: "snap-2", Status: "failed"},
+				}, Retention{Days: 7}))
+				require.NoError(t, store.BatchUpdateSnapshotStates(ctx, "us-west-2", []SnapshotInfo{
+					{SnapshotID: "snap-2", Status: "available"},
+				}, Retention{Days: 7}))
+
+				processed, err := store.GetProcessedSnapshots(ctx, "us-west-2")
+				require.NoError(t, err)
+				assert.Equal(t, map[string]string{"snap-1": "available", "snap-2": "available"}, Statuses(processed))
+
+				processed, err = store.GetProcessedSnapshots(ctx, "eu-west-1")
+				require.NoError(t, err)
+				assert.Empty(t, processed)
+			})
+
+			t.Run("looks snapshots up by source database", func(t *testing.T) {
+				store := newStore(t)
+				require.NoError(t, store.BatchUpdateSnapshotStates(ctx, "us-west-2", []SnapshotInfo{
+					{SnapshotID: "nightly", SnapshotArn: "arn:aws:rds:us-west-2:123456789012:snapshot:nightly",
+						SnapshotType: "instance", SourceID: "orders", Status: "failed"},
+					{SnapshotID: "nightly", SnapshotArn: "arn:aws:rds:us-west-2:123456789012:cluster-snapshot:nightly",
+						SnapshotType: "cluster", SourceID: "orders", Status: "available"},
+				}, Retention{Days: 7}))
+
+				snapshots, err := store.GetSourceSnapshots(ctx, "us-west-2", "instance", "orders")
+				require.NoError(t, err)
+				assert.Equal(t, map[string]string{"arn:aws:rds:us-west-2:123456789012:snapshot:nightly": "failed"}, snapshots)
+			})
+
+			t.Run("leaves out expired states", func(t *testing.T) {
+				store := newStore(t)
+				require.NoError(t, store.BatchUpdateSnapshotStates(ctx, "us-west-2", []SnapshotInfo{
+					{SnapshotID: "snap-1", Status: "available"},
+				}, Retention{}))
+
+				processed, err := store.GetProcessedSnapshots(ctx, "us-west-2")
+				require.NoError(t, err)
+				assert.Empty(t, processed)
+			})
+
+			t.Run("keeps states for the retention of their status", func(t *testing.T) {
+				store := newStore(t)
+				require.NoError(t, store.BatchUpdateSnapshotStates(ctx, "us-west-2", []SnapshotInfo{
+					{SnapshotID: "snap-1", Status: "available"},
+					{SnapshotID: "snap-2", Status: "failed"},
+				}, Retention{Days: 7, StatusDays: map[string]int{"failed": 90}}))
+
+				processed, err := store.GetProcessedSnapshots(ctx, "us-west-2")
+				require.NoError(t, err)
+				assert.WithinDuration(t, time.Now().AddDate(0, 0, 7), processed["snap-1"].ExpiresAt, time.Minute)
+				assert.WithinDuration(t, time.Now().AddDate(0, 0, 90), processed["snap-2"].ExpiresAt, time.Minute)
+			})
+
+			t.Run("returns the history of a snapshot oldest first", func(t *testing.T) {
+				store := newStore(t)
+				require.NoError(t, store.AppendHistory(ctx, "us-west-2", []Transition{
+					{SnapshotKey: "snap-1", From: "creating", To: "failed", ObservedAt: now.Add(-time.Hour)},
+					{SnapshotKey: "snap-10", To: "creating", ObservedAt: now},
+				}, 30))
+				require.NoError(t, store.AppendHistory(ctx, "us-west-2", []Transition{
+					{SnapshotKey: "snap-1", To: "creating", ObservedAt: now.Add(-2 * time.Hour)},
+				}, 30))
+
+				history, err := store.GetSnapshotTimeline(ctx, "us-west-2", "snap-1")
+				require.NoError(t, err)
+				require.Len(t, history, 2)
+				assert.Equal(t, "creating", history[0].To)
+				assert.Equal(t, "creating", history[1].From)
+				assert.Equal(t, "failed", history[1].To)
+				assert.True(t, history[1].ObservedAt.Equal(now.Add(-time.Hour)))
+
+				history, err = store.GetSnapshotTimeline(ctx, "us-west-2", "snap-2")
+				require.NoError(t, err)
+				assert.Empty(t, history)
+			})
+
+			t.Run("returns the history of a database oldest first", func(t *testing.T) {
+				store := newStore(t)
+				require.NoError(t, store.AppendHistory(ctx, "us-west-2", []Transition{
+					{SnapshotKey: "snap-2", SourceType: "instance", SourceID: "orders", To: "failed", ObservedAt: now},
+					{SnapshotKey: "snap-1", SourceType: "instance", SourceID: "orders", To: "available", ObservedAt: now.Add(-time.Hour)},
+					{SnapshotKey: "snap-3", SourceType: "cluster", SourceID: "orders", To: "failed", ObservedAt: now},
+				}, 30))
+
+				timeline, err := store.GetDatabaseTimeline(ctx, "us-west-2", "instance", "orders")
+				require.NoError(t, err)
+				require.Len(t, timeline, 2)
+				assert.Equal(t, "snap-1", timeline[0].SnapshotKey)
+				assert.Equal(t, "snap-2", timeline[1].SnapshotKey)
+			})
+
+			t.Run("records a transition appended again once", func(t *testing.T) {
+				store := newStore(t)
+				transition := Transition{SnapshotKey: "snap-1", To: "failed", ObservedAt: now, RunID: "run-1"}
+				require.NoError(t, store.AppendHistory(ctx, "us-west-2", []Transition{transition}, 30))
+				require.NoError(t, store.AppendHistory(ctx, "us-west-2", []Transition{transition}, 30))
+
+				timeline, err := store.GetSnapshotTimeline(ctx, "us-west-2", "snap-1")
+				require.NoError(t, err)
+				require.Len(t, timeline, 1)
+				assert.Equal(t, "run-1", timeline[0].RunID)
+			})
+
+			t.Run("leaves out expired history", func(t *testing.T) {
+				store := newStore(t)
+				require.NoError(t, store.AppendHistory(ctx, "us-west-2", []Transition{
+					{SnapshotKey: "snap-1", To: "failed", ObservedAt: now.AddDate(0, 0, -31)},
+				}, 30))
+
+				history, err := store.GetSnapshotTimeline(ctx, "us-west-2", "snap-1")
+				require.NoError(t, err)
+				assert.Empty(t, history)
+			})
+
+			t.Run("keeps a lock from other owners until it expires", func(t *testing.T) {
+				store := newStore(t)
+				_, acquired, err := store.AcquireLock(ctx, "us-west-2", "run-1", now.Add(time.Minute), now)
+				require.NoError(t, err)
+				assert.True(t, acquired)
+
+				holder, acquired, err := store.AcquireLock(ctx, "us-west-2", "run-2", now.Add(time.Minute), now)
+				require.NoError(t, err)
+				assert.False(t, acquired)
+				assert.Equal(t, "run-1", holder.Owner)
+
+				// The owner extends its lease
+				_, acquired, err = store.AcquireLock(ctx, "us-west-2", "run-1", now.Add(2*time.Minute), now)
+				require.NoError(t, err)
+				assert.True(t, acquired)
+
+				_, acquired, err = store.AcquireLock(ctx, "us-west-2", "run-2", now.Add(3*time.Minute), now.Add(2*time.Minute))
+				require.NoError(t, err)
+				assert.True(t, acquired)
+			})
+
+			t.Run("releases a lock held by the owner only", func(t *testing.T) {
+				store := newStore(t)
+				_, acquired, err := store.AcquireLock(ctx, "us-west-2", "run-1", now.Add(time.Minute), now)
+				require.NoError(t, err)
+				require.True(t, acquired)
+
+				require.NoError(t, store.ReleaseLock(ctx, "us-west-2", "run-2"))
+				_, acquired, err = store.AcquireLock(ctx, "us-west-2", "run-2", now.Add(time.Minute), now)
+				require.NoError(t, err)
+				assert.False(t, acquired)
+
+				require.NoError(t, store.ReleaseLock(ctx, "us-west-2", "run-1"))
+				_, acquired, err = store.AcquireLock(ctx, "us-west-2", "run-2", now.Add(time.Minute), now)
+				require.NoError(t, err)
+				assert.True(t, acquired)
+			})
+		})
+	}
+}
+
+func TestStoreRows(t *testing.T) {
+	ctx := context.Background()
+	// DynamoDB keeps times in seconds
+	now := time.Now().UTC().Truncate(time.Second)
+
+	for name, newStore := range rowStores {
+		t.Run(name, func(t *testing.T) {
+			t.Run("keeps outbox entries until they are deleted", func(t *testing.T) {
+				store := newStore(t)
+				first, err := NewOutboxEntry([]byte(`{"Digest":{}}`), now.Add(-time.Minute))
+				require.NoError(t, err)
+				// The payload of the second entry takes two DynamoDB items
+				second, err := NewOutboxEntry([]byte(strings.Repeat("x", outboxChunkSize+1)), now)
+				require.NoError(t, err)
+				require.NoError(t, store.PutOutboxEntry(ctx, second))
+				require.NoError(t, store.PutOutboxEntry(ctx, first))
+				require.NoError(t, store.MarkOutboxDelivered(ctx, second, "email"))
+				require.NoError(t, store.MarkOutboxDelivered(ctx, second, "email"))
+				assert.Equal(t, []string{"email"}, second.Delivered)
+
+				entries, err := store.GetOutboxEntries(ctx)
+				require.NoError(t, err)
+				require.Len(t, entries, 2)
+				assert.Equal(t, first.ID, entries[0].ID)
+				assert.Equal(t, first.Payload, entries[0].Payload)
+				assert.True(t, first.CreatedAt.Equal(entries[0].CreatedAt))
+				assert.Empty(t, entries[0].Delivered)
+				assert.Equal(t, second.ID, entries[1].ID)
+				assert.Equal(t, second.Payload, entries[1].Payload)
+				assert.True(t, entries[1].IsDelivered("email"))
+
+				require.NoError(t, store.DeleteOutboxEntry(ctx, entries[0]))
+				entries, err = store.GetOutboxEntries(ctx)
+				require.NoError(t, err)
+				require.Len(t, entries, 1)
+				assert.Equal(t, second.ID, entries[0].ID)
+			})
+
+			t.Run("resumes a checkpoint until it is deleted", func(t *testing.T) {
+				store := newStore(t)
+				checkpoint, err := store.GetCheckpoint(ctx, "eu-west-1")
+				require.NoError(t, err)
+				assert.Nil(t, checkpoint)
+
+				// The snapshots take two DynamoDB items
+				checkpoint = &Checkpoint{Region: "eu-west-1", Listing: "instance", Marker: "page-2", Pages: 2, StartedAt: now}
+				for i := range 150 {
+					checkpoint.Snapshots = append(checkpoint.Snapshots, SnapshotInfo{SnapshotID: fmt.Sprintf("snap-%d", i)})
+				}
+				require.NoError(t, store.PutCheckpoint(ctx, checkpoint))
+
+				resumed, err := store.GetCheckpoint(ctx, "eu-west-1")
+				require.NoError(t, err)
+				require.NotNil(t, resumed)
+				assert.Equal(t, "instance", resumed.Listing)
+				assert.Equal(t, "page-2", resumed.Marker)
+				assert.Equal(t, 2, resumed.Pages)
+				assert.True(t, now.Equal(resumed.StartedAt))
+				assert.Equal(t, checkpoint.Snapshots, resumed.Snapshots)
+
+				// The resumed scan adds a page
+				resumed.Snapshots = append(resumed.Snapshots, SnapshotInfo{SnapshotID: "snap-150"})
+				resumed.Listing, resumed.Marker, resumed.Pages = "cluster", "", 3
+				require.NoError(t, store.PutCheckpoint(ctx, resumed))
+
+				latest, err := store.GetCheckpoint(ctx, "eu-west-1")
+				require.NoError(t, err)
+				require.NotNil(t, latest)
+				assert.Equal(t, "cluster", latest.Listing)
+				assert.Empty(t, latest.Marker)
+				assert.Len(t, latest.Snapshots, 151)
+
+				other, err := store.GetCheckpoint(ctx, "us-west-2")
+				require.NoError(t, err)
+				assert.Nil(t, other)
+
+				require.NoError(t, store.DeleteCheckpoint(ctx, latest))
+				deleted, err := store.GetCheckpoint(ctx, "eu-west-1")
+				require.NoError(t, err)
+				assert.Nil(t, deleted)
+			})
+
+			t.Run("keeps held changes by window", func(t *testing.T) {
+				store := newStore(t)
+				require.NoError(t, store.PutHeldChanges(ctx, []HeldChange{
+					{Window: "nightly", ID: "us-west-2#snap-2#failed", Payload: `{"SnapshotID":"snap-2"}`},
+					{Window: "nightly", ID: "us-west-2#snap-1#failed", Payload: `{}`},
+					{Window: "weekend", ID: "us-west-2#snap-3#failed", Payload: `{}`},
+				}))
+				// Storing a change again overwrites it
+				require.NoError(t, store.PutHeldChanges(ctx, []HeldChange{
+					{Window: "nightly", ID: "us-west-2#snap-1#failed", Payload: `{"SnapshotID":"snap-1"}`},
+				}))
+
+				held, err := store.GetHeldChanges(ctx, "nightly")
+				require.NoError(t, err)
+				assert.Equal(t, []HeldChange{
+					{Window: "nightly", ID: "us-west-2#snap-1#failed", Payload: `{"SnapshotID":"snap-1"}`},
+					{Window: "nightly", ID: "us-west-2#snap-2#failed", Payload: `{"SnapshotID":"snap-2"}`},
+				}, held)
+
+				require.NoError(t, store.DeleteHeldChanges(ctx, held))
+				held, err = store.GetHeldChanges(ctx, "nightly")
+				require.NoError(t, err)
+				assert.Empty(t, held)
+				held, err = store.GetHeldChanges(ctx, "weekend")
+				require.NoError(t, err)
+				assert.Len(t, held, 1)
+			})
+
+			t.Run("keeps acknowledgements by region", func(t *testing.T) {
+				store := newStore(t)
+				ack := Acknowledgement{
+					Region:       "us-east-1",
+					DatabaseType: "cluster",
+					DatabaseID:   "aurora-1",
+					Action:       "snooze",
+					CreatedAt:    now,
+					Until:        now.Add(time.Hour),
+				}
+				require.NoError(t, store.PutAcknowledgement(ctx, ack))
+
+				acks, err := store.GetAcknowledgements(ctx, "us-east-1")
+				require.NoError(t, err)
+				assert.Equal(t, map[string]Acknowledgement{"cluster/aurora-1": ack}, acks)
+				acks, err = store.GetAcknowledgements(ctx, "eu-west-1")
+				require.NoError(t, err)
+				assert.Empty(t, acks)
+
+				require.NoError(t, store.DeleteAcknowledgements(ctx, []Acknowledgement{ack}))
+				acks, err = store.GetAcknowledgements(ctx, "us-east-1")
+				require.NoError(t, err)
+				assert.Empty(t, acks)
+			})
+
+			t.Run("keeps database health by region", func(t *testing.T) {
+				store := newStore(t)
+				orders := DatabaseHealth{Region: "us-east-1", DatabaseType: "instance", DatabaseID: "orders", FailedSnapshotID: "snap-1", Since: now}
+				billing := DatabaseHealth{Region: "us-east-1", DatabaseType: "cluster", DatabaseID: "billing", FailedSnapshotID: "snap-2", Since: now}
+				require.NoError(t, store.PutDatabaseHealth(ctx, []DatabaseHealth{orders, billing}))
+
+				health, err := store.GetDatabaseHealth(ctx, "us-east-1")
+				require.NoError(t, err)
+				assert.Equal(t, map[string]DatabaseHealth{"instance/orders": orders, "cluster/billing": billing}, health)
+
+				require.NoError(t, store.DeleteDatabaseHealth(ctx, []DatabaseHealth{orders}))
+				health, err = store.GetDatabaseHealth(ctx, "us-east-1")
+				require.NoError(t, err)
+				assert.Equal(t, map[string]DatabaseHealth{"cluster/billing": billing}, health)
+			})
+
+			t.Run("keeps escalation states by region", func(t *testing.T) {
+				store := newStore(t)
+				state := EscalationState{
+					Region:       "us-east-1",
+					DatabaseType: "cluster",
+					DatabaseID:   "aurora-1",
+					Problem:      "missing",
+					SnapshotID:   "snap-1",
+					Since:        now.Add(-time.Hour),
+					LastNotified: now,
+					Reminders:    1,
+				}
+				require.NoError(t, store.PutEscalationStates(ctx, []EscalationState{state}))
+
+				states, err := store.GetEscalationStates(ctx, "us-east-1")
+				require.NoError(t, err)
+				assert.Equal(t, map[string]EscalationState{"cluster/aurora-1": state}, states)
+
+				require.NoError(t, store.DeleteEscalationStates(ctx, []EscalationState{state}))
+				states, err = store.GetEscalationStates(ctx, "us-east-1")
+				require.NoError(t, err)
+				assert.Empty(t, states)
+			})
+
+			t.Run("keeps report metrics by period and date", func(t *testing.T) {
+				store := newStore(t)
+				metrics := ReportMetrics{
+					Period:          "weekly",
+					Date:            "2024-11-18",
+					Databases:       5,
+					SnapshotsTaken:  42,
+					Failures:        1,
+					CoverageGaps:    2,
+					TotalStorageGiB: 1200,
+				}
+				require.NoError(t, store.PutReportMetrics(ctx, metrics))
+
+				stored, err := store.GetReportMetrics(ctx, "weekly", "2024-11-18")
+				require.NoError(t, err)
+				assert.Equal(t, &metrics, stored)
+				stored, err = store.GetReportMetrics(ctx, "daily", "2024-11-18")
+				require.NoError(t, err)
+				assert.Nil(t, stored)
+			})
+
+			t.Run("keeps scan failures until they are deleted", func(t *testing.T) {
+				store := newStore(t)
+				scan := ScanFailure{Region: "ap-south-1", Stage: "scan", Error: "AccessDenied", Since: now}
+				opsItems := ScanFailure{Region: "ap-south-1", Stage: "ops-items", Error: "throttled", Since: now}
+				require.NoError(t, store.PutScanFailures(ctx, []ScanFailure{scan, opsItems}))
+
+				failures, err := store.GetScanFailures(ctx)
+				require.NoError(t, err)
+				assert.Equal(t, map[string]ScanFailure{"ap-south-1/scan": scan, "ap-south-1/ops-items": opsItems}, failures)
+
+				require.NoError(t, store.DeleteScanFailures(ctx, []ScanFailure{scan}))
+				failures, err = store.GetScanFailures(ctx)
+				require.NoError(t, err)
+				assert.Equal(t, map[string]ScanFailure{"ap-south-1/ops-items": opsItems}, failures)
+			})
+
+			t.Run("keeps findings by region", func(t *testing.T) {
+				store := newStore(t)
+				record := FindingRecord{Region: "us-east-1", ID: "finding-1", CreatedAt: now.Add(-time.Hour), LastImported: now, Payload: `{"Rule":"retention"}`}
+				require.NoError(t, store.PutFindingRecords(ctx, []FindingRecord{record}))
+
+				records, err := store.GetFindingRecords(ctx, "us-east-1")
+				require.NoError(t, err)
+				assert.Equal(t, map[string]FindingRecord{"finding-1": record}, records)
+
+				require.NoError(t, store.DeleteFindingRecords(ctx, []FindingRecord{record}))
+				records, err = store.GetFindingRecords(ctx, "us-east-1")
+				require.NoError(t, err)
+				assert.Empty(t, records)
+			})
+
+			t.Run("keeps OpsItems by region", func(t *testing.T) {
+				store := newStore(t)
+				arn := "arn:aws:rds:us-east-1:123456789012:db:orders"
+				record := OpsItemRecord{Region: "us-east-1", ResourceArn: arn, OpsItemID: "oi-1", Problem: "failed", SnapshotID: "snap-1", CreatedAt: now}
+				require.NoError(t, store.PutOpsItemRecords(ctx, []OpsItemRecord{record}))
+
+				records, err := store.GetOpsItemRecords(ctx, "us-east-1")
+				require.NoError(t, err)
+				assert.Equal(t, map[string]OpsItemRecord{arn: record}, records)
+
+				require.NoError(t, store.DeleteOpsItemRecords(ctx, []OpsItemRecord{record}))
+				records, err = store.GetOpsItemRecords(ctx, "us-east-1")
+				require.NoError(t, err)
+				assert.Empty(t, records)
+			})
+		})
+	}
+}
+
+func TestMemoryStoreExpiry(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryStore()
+
+	// Rows stored long ago have expired by now
+	longAgo := time.Now().AddDate(-1, 0, 0)
+	store.data.putHeldChanges([]HeldChange{{Window: "nightly", ID: "old", Payload: "{}"}}, longAgo)
+	store.data.putCheckpoint(&Checkpoint{Region: "eu-west-1", Listing: "instance"}, longAgo)
+	store.data.putReportMetrics(ReportMetrics{Period: "daily", Date: "2023-11-18"}, longAgo)
+	store.data.putAcknowledgement(Acknowledgement{Region: "us-east-1", DatabaseType: "instance", DatabaseID: "orders", Until: longAgo}, longAgo)
+
+	held, err := store.GetHeldChanges(ctx, "nightly")
+	require.NoError(t, err)
+	assert.Empty(t, held)
+	checkpoint, err := store.GetCheckpoint(ctx, "eu-west-1")
+	require.NoError(t, err)
+	assert.Nil(t, checkpoint)
+	metrics, err := store.GetReportMetrics(ctx, "daily", "2023-11-18")
+	require.NoError(t, err)
+	assert.Nil(t, metrics)
+
+	// The next write of their kind deletes them
+	require.NoError(t, store.PutHeldChanges(ctx, []HeldChange{{Window: "weekend", ID: "new", Payload: "{}"}}))
+	require.NoError(t, store.PutCheckpoint(ctx, &Checkpoint{Region: "us-west-2", Listing: "instance"}))
+	require.NoError(t, store.PutReportMetrics(ctx, ReportMetrics{Period: "daily", Date: "2024-11-18"}))
+	require.NoError(t, store.PutAcknowledgement(ctx, Acknowledgement{Region: "us-east-1", DatabaseType: "instance", DatabaseID: "billing", Until: time.Now().Add(time.Hour)}))
+	assert.NotContains(t, store.data.Held, "nightly")
+	assert.NotContains(t, store.data.Checkpoints, "eu-west-1")
+	assert.NotContains(t, store.data.Reports["daily"], "2023-11-18")
+	assert.NotContains(t, store.data.Acknowledgements["us-east-1"], "instance/orders")
+}
+
+func TestFileStore(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "state.json")
+
+	t.Run("keeps the state between opens", func(t *testing.T) {
+		store, err := NewFileStore(path)
+		require.NoError(t, err)
+		require.NoError(t, store.BatchUpdateSnapshotStates(ctx, "us-west-2", []SnapshotInfo{
+			{SnapshotID: "snap-1", Status: "failed"},
+		}, Retention{Days: 7}))
+		require.NoError(t, store.AppendHistory(ctx, "us-west-2", []Transition{
+			{SnapshotKey: "snap-1", To: "failed", ObservedAt: time.Now()},
+		}, 30))
+		entry, err := NewOutboxEntry([]byte(`{"Digest":{}}`), time.Now())
+		require.NoError(t, err)
+		require.NoError(t, store.PutOutboxEntry(ctx, entry))
+		require.NoError(t, store.PutHeldChanges(ctx, []HeldChange{{Window: "nightly", ID: "snap-1", Payload: "{}"}}))
+
+		reopened, err := NewFileStore(path)
+		require.NoError(t, err)
+		processed, err := reopened.GetProcessedSnapshots(ctx, "us-west-2")
+		require.NoError(t, err)
+		assert.Equal(t, map[string]string{"snap-1": "failed"}, Statuses(processed))
+		history, err := reopened.GetSnapshotTimeline(ctx, "us-west-2", "snap-1")
+		require.NoError(t, err)
+		assert.Len(t, history, 1)
+		entries, err := reopened.GetOutboxEntries(ctx)
+		require.NoError(t, err)
+		require.Len(t, entries, 1)
+		assert.Equal(t, entry.Payload, entries[0].Payload)
+		held, err := reopened.GetHeldChanges(ctx, "nightly")
+		require.NoError(t, err)
+		assert.Len(t, held, 1)
+	})
+
+	t.Run("leaves no temporary files", func(t *testing.T) {
+		entries, err := os.ReadDir(filepath.Dir(path))
+		require.NoError(t, err)
+		require.Len(t, entries, 1)
+		assert.Equal(t, "state.json", entries[0].Name())
+	})
+
+	t.Run("deletes expired states and transitions", func(t *testing.T) {
+		expiring := filepath.Join(t.TempDir(), "state.json")
+		store, err := NewFileStore(expiring)
+		require.NoError(t, err)
+
+		// States and transitions recorded long ago have expired by now
+		longAgo := time.Now().AddDate(-1, 0, 0)
+		var snapshots []SnapshotInfo
+		var transitions []Transition
+		for i := range 100 {
+			snapshotID := fmt.Sprintf("old-%d", i)
+			snapshots = append(snapshots, SnapshotInfo{SnapshotID: snapshotID, Status: "failed"})
+			transitions = append(transitions, Transition{SnapshotKey: snapshotID, To: "failed", ObservedAt: longAgo})
+		}
+		store.data.batchUpdateSnapshotStates("eu-west-1", snapshots, Retention{Days: 7}, longAgo)
+		store.data.appendHistory("eu-west-1", transitions, 30, longAgo)
+		require.NoError(t, store.save())
+		before, err := os.Stat(expiring)
+		require.NoError(t, err)
+
+		require.NoError(t, store.BatchUpdateSnapshotStates(ctx, "us-west-2", []SnapshotInfo{
+			{SnapshotID: "snap-1", Status: "failed"},
+		}, Retention{Days: 7}))
+		require.NoError(t, store.AppendHistory(ctx, "us-west-2", []Transition{
+			{SnapshotKey: "snap-1", To: "failed", ObservedAt: time.Now()},
+		}, 30))
+		after, err := os.Stat(expiring)
+		require.NoError(t, err)
+		assert.Less(t, after.Size(), before.Size())
+
+		reopened, err := NewFileStore(expiring)
+		require.NoError(t, err)
+		assert.NotContains(t, reopened.data.States, "eu-west-1")
+		assert.NotContains(t, reopened.data.History, "eu-west-1")
+		assert.Len(t, reopened.data.States["us-west-2"], 1)
+		assert.Len(t, reopened.data.History["us-west-2"], 1)
+	})
+
+	t.Run("rejects an invalid file", func(t *testing.T) {
+		invalid := filepath.Join(t.TempDir(), "state.json")
+		require.NoError(t, os.WriteFile(invalid, []byte("not json"), 0o600))
+
+		_, err := NewFileStore(invalid)
+		assert.ErrorContains(t, err, "invalid state file")
+	})
+}
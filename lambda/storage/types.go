@@ -1,10 +1,47 @@
 package storage
 
-import "time"
+import (
+	"strings"
+	"time"
+)
 
 type SnapshotInfo struct {
 	SnapshotID   string
+	SnapshotArn  string
 	SnapshotType string
+	CreationType string
+	SourceID     string
 	CreateTime   time.Time
 	Status       string
+	Tags         map[string]string
+	StorageGiB   int32
+	Encrypted    bool
+}
+
+// Key identifies the snapshot in the recorded states: its ARN, which tells
+// instance and cluster snapshots of the same name apart. Snapshots without an
+// ARN are identified by their identifier.
+func (s SnapshotInfo) Key() string {
+	if s.SnapshotArn != "" {
+		return s.SnapshotArn
+	}
+	return s.SnapshotID
+}
+
+// IsFailedStatus reports whether status is one of a snapshot that failed,
+// including the incompatible statuses of snapshots that cannot be restored.
+func IsFailedStatus(status string) bool {
+	return status == "failed" || status == "error" || strings.HasPrefix(status, "incompatible")
+}
+
+// ReportMetrics are the headline numbers of a summary report, kept so that
+// later reports can show a trend.
+type ReportMetrics struct {
+	Period          string
+	Date            string
+	Databases       int
+	SnapshotsTaken  int
+	Failures        int
+	CoverageGaps    int
+	TotalStorageGiB int64
 }
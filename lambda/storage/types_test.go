@@ -0,0 +1,20 @@
+package storage
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIsFailedStatus(t *testing.T) {
+	for status, failed := range map[string]bool{
+		"failed":                  true,
+		"error":                   true,
+		"incompatible-restore":    true,
+		"incompatible-parameters": true,
+		"available":               false,
+		"creating":                false,
+	} {
+		assert.Equal(t, failed, IsFailedStatus(status), status)
+	}
+}
@@ -0,0 +1,141 @@
+package suppression
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// searchLimit bounds how far back Previous looks for an occurrence. It covers
+// schedules that fire at least once a month.
+const searchLimit = 35 * 24 * time.Hour
+
+// Schedule is a parsed five-field cron expression: minute, hour, day of month,
+// month and day of week (0 or 7 is Sunday). Fields accept *, lists, ranges and
+// steps, e.g. "0 22 * * 5" or "*/15 0-6 * * 1-5".
+type Schedule struct {
+	minutes     [60]bool
+	hours       [24]bool
+	daysOfMonth [32]bool
+	months      [13]bool
+	daysOfWeek  [7]bool
+	// Day of month and day of week are combined with OR when both are restricted,
+	// as in standard cron.
+	domRestricted bool
+	dowRestricted bool
+}
+
+// ParseCron parses a five-field cron expression.
+func ParseCron(expr string) (Schedule, error) {
+	fields := strings.Fields(expr)
+	if len(fields) != 5 {
+		return Schedule{}, fmt.Errorf("cron expression %q must have 5 fields", expr)
+	}
+
+	var s Schedule
+	var err error
+	if err = parseField(fields[0], 0, 59, s.minutes[:]); err != nil {
+		return Schedule{}, fmt.Errorf("invalid minute in %q: %v", expr, err)
+	}
+	if err = parseField(fields[1], 0, 23, s.hours[:]); err != nil {
+		return Schedule{}, fmt.Errorf("invalid hour in %q: %v", expr, err)
+	}
+	if err = parseField(fields[2], 1, 31, s.daysOfMonth[:]); err != nil {
+		return Schedule{}, fmt.Errorf("invalid day of month in %q: %v", expr, err)
+	}
+	if err = parseField(fields[3], 1, 12, s.months[:]); err != nil {
+		return Schedule{}, fmt.Errorf("invalid month in %q: %v", expr, err)
+	}
+
+	var daysOfWeek [8]bool
+	if err = parseField(fields[4], 0, 7, daysOfWeek[:]); err != nil {
+		return Schedule{}, fmt.Errorf("invalid day of week in %q: %v", expr, err)
+	}
+	copy(s.daysOfWeek[:], daysOfWeek[:7])
+	s.daysOfWeek[0] = s.daysOfWeek[0] || daysOfWeek[7]
+
+	s.domRestricted = fields[2] != "*"
+	s.dowRestricted = fields[4] != "*"
+	return s, nil
+}
+
+func parseField(field string, min, max int, values []bool) error {
+	for _, part := range strings.Split(field, ",") {
+		step := 1
+		if i := strings.Index(part, "/"); i >= 0 {
+			var err error
+			step, err = strconv.Atoi(part[i+1:])
+			if err != nil || step <= 0 {
+				return fmt.Errorf("invalid step in %q", part)
+			}
+			part = part[:i]
+		}
+
+		low, high := min, max
+		if part != "*" {
+			bounds := strings.SplitN(part, "-", 2)
+			var err error
+			low, err = strconv.Atoi(bounds[0])
+			if err != nil {
+				return fmt.Errorf("invalid value %q", part)
+			}
+			high = low
+			if len(bounds) == 2 {
+				high, err = strconv.Atoi(bounds[1])
+				if err != nil {
+					return fmt.Errorf("invalid value %q", part)
+				}
+			} else if step > 1 {
+				high = max
+			}
+		}
+		if low < min || high > max || low > high {
+			return fmt.Errorf("value %q out of range %d-%d", part, min, max)
+		}
+
+		for v := low; v <= high; v += step {
+			values[v] = true
+		}
+	}
+	return nil
+}
+
+// Matches reports whether the schedule fires in the minute of t, evaluated in
+// the location of t.
+func (s Schedule) Matches(t time.Time) bool {
+	return s.minutes[t.Minute()] && s.hours[t.Hour()] && s.months[t.Month()] && s.dayMatches(t)
+}
+
+// Previous returns the latest minute at or before t in which the schedule fires,
+// and false when it does not fire within the search limit.
+func (s Schedule) Previous(t time.Time) (time.Time, bool) {
+	t = t.Truncate(time.Minute)
+	earliest := t.Add(-searchLimit)
+
+	for !t.Before(earliest) {
+		if !s.months[t.Month()] || !s.dayMatches(t) {
+			// Skip to the last minute of the previous day
+			t = time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location()).Add(-time.Minute)
+			continue
+		}
+		if !s.hours[t.Hour()] {
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), 0, 0, 0, t.Location()).Add(-time.Minute)
+			continue
+		}
+		if s.minutes[t.Minute()] {
+			return t, true
+		}
+		t = t.Add(-time.Minute)
+	}
+	return time.Time{}, false
+}
+
+func (s Schedule) dayMatches(t time.Time) bool {
+	domMatch := s.daysOfMonth[t.Day()]
+	dowMatch := s.daysOfWeek[t.Weekday()]
+	if s.domRestricted && s.dowRestricted {
+		return domMatch || dowMatch
+	}
+	return domMatch && dowMatch
+}
@@ -0,0 +1,93 @@
+package suppression
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseCron(t *testing.T) {
+	tests := []struct {
+		name    string
+		expr    string
+		wantErr bool
+	}{
+		{name: "every minute", expr: "* * * * *"},
+		{name: "lists ranges and steps", expr: "0,30 */2 1-15 1-12/3 1-5"},
+		{name: "sunday as seven", expr: "0 0 * * 7"},
+		{name: "too few fields", expr: "0 22 * *", wantErr: true},
+		{name: "minute out of range", expr: "60 * * * *", wantErr: true},
+		{name: "inverted range", expr: "* 10-2 * * *", wantErr: true},
+		{name: "invalid step", expr: "*/0 * * * *", wantErr: true},
+		{name: "not a number", expr: "* * * jan *", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ParseCron(tt.expr)
+			if tt.wantErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestScheduleMatches(t *testing.T) {
+	// 2024-11-22 is a Friday
+	friday := time.Date(2024, 11, 22, 22, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name string
+		expr string
+		t    time.Time
+		want bool
+	}{
+		{name: "exact minute", expr: "0 22 * * 5", t: friday, want: true},
+		{name: "other weekday", expr: "0 22 * * 1", t: friday, want: false},
+		{name: "sunday as seven", expr: "0 22 * * 7", t: friday.AddDate(0, 0, 2), want: true},
+		{name: "step", expr: "*/15 * * * *", t: friday.Add(45 * time.Minute), want: true},
+		{name: "day of month or weekday", expr: "0 22 1 * 5", t: friday, want: true},
+		{name: "month mismatch", expr: "0 22 * 12 *", t: friday, want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			schedule, err := ParseCron(tt.expr)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, schedule.Matches(tt.t))
+		})
+	}
+}
+
+func TestSchedulePrevious(t *testing.T) {
+	now := time.Date(2024, 11, 20, 10, 17, 42, 0, time.UTC)
+
+	tests := []struct {
+		name   string
+		expr   string
+		want   time.Time
+		wantOK bool
+	}{
+		{name: "current minute", expr: "* * * * *", want: time.Date(2024, 11, 20, 10, 17, 0, 0, time.UTC), wantOK: true},
+		{name: "earlier today", expr: "30 6 * * *", want: time.Date(2024, 11, 20, 6, 30, 0, 0, time.UTC), wantOK: true},
+		{name: "yesterday", expr: "0 22 * * *", want: time.Date(2024, 11, 19, 22, 0, 0, 0, time.UTC), wantOK: true},
+		{name: "last weekday", expr: "0 22 * * 5", want: time.Date(2024, 11, 15, 22, 0, 0, 0, time.UTC), wantOK: true},
+		{name: "never within limit", expr: "0 0 31 2 *", wantOK: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			schedule, err := ParseCron(tt.expr)
+			assert.NoError(t, err)
+
+			got, ok := schedule.Previous(now)
+			assert.Equal(t, tt.wantOK, ok)
+			if tt.wantOK {
+				assert.Equal(t, tt.want, got)
+			}
+		})
+	}
+}
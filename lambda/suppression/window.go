@@ -0,0 +1,125 @@
+package suppression
+
+import (
+	"fmt"
+	"path"
+	"time"
+
+	"rds-backup-monitor/lambda/types"
+)
+
+// Window is a parsed suppression window.
+type Window struct {
+	config   types.SuppressionWindow
+	start    Schedule
+	stop     Schedule
+	location *time.Location
+}
+
+// NewWindows parses and validates the configured suppression windows.
+func NewWindows(configs []types.SuppressionWindow) ([]Window, error) {
+	windows := make([]Window, 0, len(configs))
+	names := make(map[string]bool)
+
+	for i, config := range configs {
+		if config.Name == "" {
+			return nil, fmt.Errorf("suppression window %d: name is required", i)
+		}
+		if names[config.Name] {
+			return nil, fmt.Errorf("suppression window %d: duplicate name %q", i, config.Name)
+		}
+		names[config.Name] = true
+
+		start, err := ParseCron(config.Start)
+		if err != nil {
+			return nil, fmt.Errorf("suppression window %s: invalid start: %v", config.Name, err)
+		}
+		stop, err := ParseCron(config.Stop)
+		if err != nil {
+			return nil, fmt.Errorf("suppression window %s: invalid stop: %v", config.Name, err)
+		}
+
+		location := time.UTC
+		if config.Timezone != "" {
+			location, err = time.LoadLocation(config.Timezone)
+			if err != nil {
+				return nil, fmt.Errorf("suppression window %s: invalid timezone %q: %v", config.Name, config.Timezone, err)
+			}
+		}
+
+		for _, pattern := range config.Identifiers {
+			if _, err := path.Match(pattern, ""); err != nil {
+				return nil, fmt.Errorf("suppression window %s: invalid identifier pattern %q: %v", config.Name, pattern, err)
+			}
+		}
+		for key, pattern := range config.Tags {
+			if _, err := path.Match(pattern, ""); err != nil {
+				return nil, fmt.Errorf("suppression window %s: invalid pattern %q for tag %s: %v", config.Name, pattern, key, err)
+			}
+		}
+
+		windows = append(windows, Window{config: config, start: start, stop: stop, location: location})
+	}
+
+	return windows, nil
+}
+
+func (w Window) Name() string {
+	return w.config.Name
+}
+
+// Active reports whether the window is open at now: its latest start is more
+// recent than its latest stop. A start and stop in the same minute close it.
+func (w Window) Active(now time.Time) bool {
+	local := now.In(w.location)
+
+	lastStart, ok := w.start.Previous(local)
+	if !ok {
+		return false
+	}
+	lastStop, ok := w.stop.Previous(local)
+	return !ok || lastStart.After(lastStop)
+}
+
+// Covers reports whether a change of the resource identified by identifiers,
+// with the given region and tags, is in the scope of the window. Identifier
+// patterns match when any identifier matches.
+func (w Window) Covers(region string, identifiers []string, tags map[string]string) bool {
+	if len(w.config.Regions) > 0 && !containsString(w.config.Regions, region) {
+		return false
+	}
+
+	if len(w.config.Identifiers) > 0 {
+		matched := false
+		for _, pattern := range w.config.Identifiers {
+			for _, identifier := range identifiers {
+				if ok, _ := path.Match(pattern, identifier); ok {
+					matched = true
+				}
+			}
+		}
+		if !matched {
+			return false
+		}
+	}
+
+	for key, pattern := range w.config.Tags {
+		value, ok := tags[key]
+		if !ok {
+			return false
+		}
+		if matched, _ := path.Match(pattern, value); !matched {
+			return false
+		}
+	}
+	return true
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
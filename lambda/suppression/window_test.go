@@ -0,0 +1,120 @@
+package suppression
+
+import (
+	"testing"
+	"time"
+
+	"rds-backup-monitor/lambda/types"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewWindows(t *testing.T) {
+	tests := []struct {
+		name    string
+		configs []types.SuppressionWindow
+		wantErr bool
+	}{
+		{
+			name: "valid window",
+			configs: []types.SuppressionWindow{
+				{Name: "nightly", Start: "0 22 * * *", Stop: "0 6 * * *", Timezone: "Europe/Berlin"},
+			},
+		},
+		{name: "missing name", configs: []types.SuppressionWindow{{Start: "0 22 * * *", Stop: "0 6 * * *"}}, wantErr: true},
+		{
+			name: "duplicate name",
+			configs: []types.SuppressionWindow{
+				{Name: "nightly", Start: "0 22 * * *", Stop: "0 6 * * *"},
+				{Name: "nightly", Start: "0 1 * * *", Stop: "0 2 * * *"},
+			},
+			wantErr: true,
+		},
+		{name: "invalid start", configs: []types.SuppressionWindow{{Name: "w", Start: "22:00", Stop: "0 6 * * *"}}, wantErr: true},
+		{name: "invalid timezone", configs: []types.SuppressionWindow{{Name: "w", Start: "0 22 * * *", Stop: "0 6 * * *", Timezone: "Mars/Olympus"}}, wantErr: true},
+		{name: "invalid pattern", configs: []types.SuppressionWindow{{Name: "w", Start: "0 22 * * *", Stop: "0 6 * * *", Identifiers: []string{"db-["}}}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			windows, err := NewWindows(tt.configs)
+			if tt.wantErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+				assert.Len(t, windows, len(tt.configs))
+			}
+		})
+	}
+}
+
+func TestWindowActive(t *testing.T) {
+	windows, err := NewWindows([]types.SuppressionWindow{
+		{Name: "nightly", Start: "0 22 * * *", Stop: "0 6 * * *", Timezone: "Europe/Berlin"},
+		{Name: "weekend", Start: "0 0 * * 6", Stop: "0 0 * * 1"},
+		{Name: "never", Start: "0 0 31 2 *", Stop: "0 0 * * *"},
+	})
+	assert.NoError(t, err)
+	nightly, weekend, never := windows[0], windows[1], windows[2]
+
+	tests := []struct {
+		name   string
+		window Window
+		now    time.Time
+		want   bool
+	}{
+		// Berlin is UTC+1 in November
+		{name: "before start", window: nightly, now: time.Date(2024, 11, 20, 20, 59, 0, 0, time.UTC), want: false},
+		{name: "at start", window: nightly, now: time.Date(2024, 11, 20, 21, 0, 0, 0, time.UTC), want: true},
+		{name: "past midnight", window: nightly, now: time.Date(2024, 11, 21, 3, 0, 0, 0, time.UTC), want: true},
+		{name: "at stop", window: nightly, now: time.Date(2024, 11, 21, 5, 0, 0, 0, time.UTC), want: false},
+		{name: "saturday", window: weekend, now: time.Date(2024, 11, 23, 12, 0, 0, 0, time.UTC), want: true},
+		{name: "sunday night", window: weekend, now: time.Date(2024, 11, 24, 23, 59, 0, 0, time.UTC), want: true},
+		{name: "monday", window: weekend, now: time.Date(2024, 11, 25, 0, 1, 0, 0, time.UTC), want: false},
+		{name: "start never fires", window: never, now: time.Date(2024, 11, 20, 12, 0, 0, 0, time.UTC), want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, tt.window.Active(tt.now))
+		})
+	}
+}
+
+func TestWindowCovers(t *testing.T) {
+	windows, err := NewWindows([]types.SuppressionWindow{
+		{Name: "all", Start: "0 22 * * *", Stop: "0 6 * * *"},
+		{
+			Name:        "scoped",
+			Start:       "0 22 * * *",
+			Stop:        "0 6 * * *",
+			Regions:     []string{"us-west-2"},
+			Identifiers: []string{"analytics-*"},
+			Tags:        map[string]string{"env": "dev*"},
+		},
+	})
+	assert.NoError(t, err)
+	all, scoped := windows[0], windows[1]
+
+	tests := []struct {
+		name        string
+		window      Window
+		region      string
+		identifiers []string
+		tags        map[string]string
+		want        bool
+	}{
+		{name: "empty scope covers everything", window: all, region: "eu-west-1", identifiers: []string{"db-1"}, want: true},
+		{name: "all criteria match", window: scoped, region: "us-west-2", identifiers: []string{"analytics-1", "rds:analytics-1-2024"}, tags: map[string]string{"env": "development"}, want: true},
+		{name: "any identifier matches", window: scoped, region: "us-west-2", identifiers: []string{"orders", "analytics-copy"}, tags: map[string]string{"env": "dev"}, want: true},
+		{name: "region mismatch", window: scoped, region: "eu-west-1", identifiers: []string{"analytics-1"}, tags: map[string]string{"env": "dev"}, want: false},
+		{name: "identifier mismatch", window: scoped, region: "us-west-2", identifiers: []string{"orders"}, tags: map[string]string{"env": "dev"}, want: false},
+		{name: "missing tag", window: scoped, region: "us-west-2", identifiers: []string{"analytics-1"}, want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, tt.window.Covers(tt.region, tt.identifiers, tt.tags))
+		})
+	}
+}
@@ -5,4 +5,112 @@ type Configuration struct {
 	StatusesToMonitor  []string
 	ScheduleExpression string
 	SnapshotAgeDays    int
+	AccountID          string
+	MessageFormat      string
+	TemplateDir        string
+	SNSTopicArn        string
+	SeverityRules      []SeverityRule
+	SeverityRoutes     map[string][]string
+	CoverageHours      int
+	SuppressionWindows []SuppressionWindow
+	Escalation         *EscalationPolicy
+	OwnerRouting       *OwnerRouting
+	// SecurityHubFindings imports compliance findings into Security Hub.
+	SecurityHubFindings bool
+	MinRetentionDays    int
+	// OpsItems opens OpsCenter OpsItems for failed and missing backups.
+	OpsItems bool
+	// EventBusName receives a SnapshotStatusChanged event for every change.
+	EventBusName string
+	// MaxListedChanges and MaxMessagesPerRun limit the digests of each
+	// notifier in a run; zero selects the defaults.
+	MaxListedChanges  int
+	MaxMessagesPerRun int
+	// RegionParallelism is the number of regions scanned at the same time.
+	RegionParallelism int
+	// IgnoreRules select snapshots whose changes are recorded but never
+	// notified.
+	IgnoreRules []IgnoreRule
+	// HistoryRetentionDays is how long status transitions are kept; zero
+	// selects the default.
+	HistoryRetentionDays int
+	// StatusRetentionDays are the days the state of a snapshot in one of
+	// these statuses is kept after a scan last listed the snapshot. States of
+	// other statuses are kept for SnapshotAgeDays.
+	StatusRetentionDays map[string]int
+}
+
+// InvocationEvent is the input of a scheduled invocation. Mode selects between
+// change monitoring, the default, and summary reports of the given Period.
+type InvocationEvent struct {
+	Mode   string `json:"mode"`
+	Period string `json:"period"`
+}
+
+// SeverityRule assigns Severity to a change when every non-empty field matches.
+// List fields match when any of their values equals the change's value.
+type SeverityRule struct {
+	Severity     string            `json:"severity"`
+	FromStatus   []string          `json:"fromStatus,omitempty"`
+	ToStatus     []string          `json:"toStatus,omitempty"`
+	SnapshotType []string          `json:"snapshotType,omitempty"`
+	CreationType []string          `json:"creationType,omitempty"`
+	Regions      []string          `json:"regions,omitempty"`
+	Tags         map[string]string `json:"tags,omitempty"`
+	Identifier   string            `json:"identifier,omitempty"`
+}
+
+// IgnoreRule matches snapshots whose changes are never notified, such as the
+// snapshots of restore tests. A rule matches when every non-empty field
+// matches. SnapshotID and SourceID are globs, or regular expressions when
+// enclosed in slashes; tag values are globs.
+type IgnoreRule struct {
+	Name         string            `json:"name,omitempty"`
+	SnapshotID   string            `json:"snapshotId,omitempty"`
+	SourceID     string            `json:"sourceId,omitempty"`
+	SnapshotType []string          `json:"snapshotType,omitempty"`
+	Tags         map[string]string `json:"tags,omitempty"`
+}
+
+// SuppressionWindow is a recurring maintenance window or quiet period. Start
+// and Stop are five-field cron expressions evaluated in Timezone. Changes in
+// scope are held back while the window is open and sent as a catch-up digest
+// once it closes. An empty scope covers every change.
+type SuppressionWindow struct {
+	Name        string            `json:"name"`
+	Start       string            `json:"start"`
+	Stop        string            `json:"stop"`
+	Timezone    string            `json:"timezone,omitempty"`
+	Regions     []string          `json:"regions,omitempty"`
+	Identifiers []string          `json:"identifiers,omitempty"`
+	Tags        map[string]string `json:"tags,omitempty"`
+}
+
+// EscalationPolicy re-alerts while a database's latest snapshot is failed or
+// no snapshot was taken within the coverage window. Intervals are Go duration
+// strings between consecutive reminders; the last interval repeats. Once
+// EscalateAfter reminders were sent, reminders also go to EscalationTopicArn.
+type EscalationPolicy struct {
+	Intervals          []string `json:"intervals"`
+	EscalateAfter      int      `json:"escalateAfter"`
+	EscalationTopicArn string   `json:"escalationTopicArn,omitempty"`
+}
+
+// OwnerRouting sends the changes of each owner's databases to the owner's
+// destination. The owner is the value of the first tag in TagKeys found on the
+// source DB instance or cluster; tag keys are matched case-insensitively.
+// Changes of databases without an owner in Owners go to the default routes.
+type OwnerRouting struct {
+	TagKeys []string                    `json:"tagKeys,omitempty"`
+	Owners  map[string]OwnerDestination `json:"owners"`
+}
+
+// OwnerDestination is where an owner's digest is sent: an SNS topic or a Slack
+// incoming webhook, which posts to the channel it was created for. Email
+// destinations are turned into an SNS topic with an email subscription by the
+// stack, so the function only sees TopicArn.
+type OwnerDestination struct {
+	TopicArn        string `json:"topicArn,omitempty"`
+	SlackWebhookURL string `json:"slackWebhookUrl,omitempty"`
+	Email           string `json:"email,omitempty"`
 }
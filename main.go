@@ -2,7 +2,9 @@ package main
 
 import (
 	"context"
+	"encoding/json"
 	"log"
+	"strconv"
 
 	"github.com/aws/aws-cdk-go/awscdk/v2"
 	"github.com/aws/aws-sdk-go-v2/config"
@@ -79,6 +81,150 @@ func main() {
 		}
 	}
 
+	// Get notification message format from context or use default
+	messageFormat := "text"
+	messageFormatContext := app.Node().TryGetContext(jsii.String("message_format"))
+	if messageFormatContext != nil {
+		if messageFormatStr, ok := messageFormatContext.(string); ok && messageFormatStr != "" {
+			messageFormat = messageFormatStr
+		}
+	}
+
+	// Get optional notification template directory from context
+	templateDir := ""
+	templateDirContext := app.Node().TryGetContext(jsii.String("template_dir"))
+	if templateDirContext != nil {
+		if templateDirStr, ok := templateDirContext.(string); ok {
+			templateDir = templateDirStr
+		}
+	}
+
+	// Get severity rules and routes from context; they are passed to the
+	// function as JSON documents
+	severityRules := contextJSON(app, "severity_rules")
+	severityRoutes := map[string][]string{}
+	if routes := contextJSON(app, "severity_routes"); routes != "" {
+		if err := json.Unmarshal([]byte(routes), &severityRoutes); err != nil {
+			log.Fatalf("unable to parse severity_routes from context, %v", err)
+		}
+	}
+
+	// Get suppression windows from context; passed to the function as JSON
+	suppressionWindows := contextJSON(app, "suppression_windows")
+
+	// Get ignore rules from context; passed to the function as JSON
+	ignoreRules := contextJSON(app, "ignore_rules")
+
+	// Get the owner routing table from context; passed to the function as JSON
+	ownerRouting := contextJSON(app, "owner_routing")
+
+	// Get the escalation policy from context; the function receives it as JSON
+	// and the stack needs the escalation topic to grant publishing
+	escalationPolicy := contextJSON(app, "escalation_policy")
+	escalationTopicArn := ""
+	if escalationPolicy != "" {
+		var policy struct {
+			EscalationTopicArn string `json:"escalationTopicArn"`
+		}
+		if err := json.Unmarshal([]byte(escalationPolicy), &policy); err != nil {
+			log.Fatalf("unable to parse escalation_policy from context, %v", err)
+		}
+		escalationTopicArn = policy.EscalationTopicArn
+	}
+
+	// Deploy the acknowledge and snooze API when enabled in context
+	ackAPI := contextBool(app, "ack_api")
+	snoozeDuration := ""
+	if snoozeContext, ok := app.Node().TryGetContext(jsii.String("snooze_duration")).(string); ok {
+		snoozeDuration = snoozeContext
+	}
+
+	// Import compliance findings into Security Hub when enabled in context
+	securityHubFindings := contextBool(app, "security_hub_findings")
+	minRetentionDays := ""
+	if retentionContext, ok := app.Node().TryGetContext(jsii.String("min_retention_days")).(string); ok {
+		minRetentionDays = retentionContext
+	}
+
+	// Open OpsCenter OpsItems for failed and missing backups when enabled in
+	// context
+	opsItems := contextBool(app, "ops_items")
+
+	// Put SnapshotStatusChanged events on a custom event bus, optionally
+	// created by the stack along with a schema registry entry
+	eventBusName := ""
+	if busContext, ok := app.Node().TryGetContext(jsii.String("event_bus")).(string); ok {
+		eventBusName = busContext
+	}
+	createEventBus := contextBool(app, "create_event_bus")
+	eventSchema := contextBool(app, "event_schema")
+
+	// Get the digest limits of each notifier from context or use the function
+	// defaults
+	maxListedChanges := ""
+	if listedContext, ok := app.Node().TryGetContext(jsii.String("max_listed_changes")).(string); ok {
+		maxListedChanges = listedContext
+	}
+	maxMessagesPerRun := ""
+	if messagesContext, ok := app.Node().TryGetContext(jsii.String("max_messages_per_run")).(string); ok {
+		maxMessagesPerRun = messagesContext
+	}
+
+	// Get the number of regions scanned at the same time from context
+	regionParallelism := ""
+	if parallelismContext, ok := app.Node().TryGetContext(jsii.String("region_parallelism")).(string); ok {
+		regionParallelism = parallelismContext
+	}
+
+	// Get the retention of the status transition history from context
+	historyRetentionDays := ""
+	if retentionContext, ok := app.Node().TryGetContext(jsii.String("history_retention_days")).(string); ok {
+		historyRetentionDays = retentionContext
+	}
+
+	// Get the per-status retention of snapshot states from context, as a JSON
+	// object of days by status
+	statusRetentionDays := contextJSON(app, "status_retention_days")
+
+	// Get the reserved concurrency of the function from context; the region
+	// locks keep overlapping runs apart without it
+	var concurrency *float64
+	if concurrencyContext := contextJSON(app, "reserved_concurrency"); concurrencyContext != "" {
+		value, err := strconv.ParseFloat(concurrencyContext, 64)
+		if err != nil {
+			log.Fatalf("unable to parse reserved_concurrency from context, %v", err)
+		}
+		concurrency = jsii.Number(value)
+	}
+
+	// Resume paused region scans right away instead of on the next schedule
+	resumeImmediately := contextBool(app, "resume_immediately")
+
+	// Leave the history-source index out, for the first of two deployments
+	// that add both table indexes
+	deferHistoryIndex := contextBool(app, "defer_history_index")
+
+	// Get summary report schedules from context or use defaults; an empty
+	// schedule disables the report
+	reportSchedules := map[string]string{
+		"daily":  "cron(0 8 * * ? *)",
+		"weekly": "cron(0 8 ? * MON *)",
+	}
+	if schedules := contextJSON(app, "report_schedules"); schedules != "" {
+		if err := json.Unmarshal([]byte(schedules), &reportSchedules); err != nil {
+			log.Fatalf("unable to parse report_schedules from context, %v", err)
+		}
+	}
+
+	// Get report coverage window from context or use the function default
+	coverageHours := ""
+	coverageContext := app.Node().TryGetContext(jsii.String("report_coverage_hours"))
+	if coverageContext != nil {
+		if coverageStr, ok := coverageContext.(string); ok {
+			coverageHours = coverageStr
+		}
+	}
+
 	rds_backup_monitor.NewRdsBackupMonitorStack(app, "RdsBackupMonitorStack", &rds_backup_monitor.RdsBackupMonitorStackProps{
 		//Change based on your desired monitor frequency. Maximum granularity is 1 minute.
 		//See: https://docs.aws.amazon.com/eventbridge/latest/userguide/eb-scheduled-rule-pattern.html#eb-rate-expressions
@@ -87,7 +233,63 @@ func main() {
 		Status:             &status,
 		NotificationEmail:  jsii.String(email),
 		SnapshotAgeDays:    jsii.String(snapshotAgeDays),
+		MessageFormat:      jsii.String(messageFormat),
+		TemplateDir:        jsii.String(templateDir),
+		SeverityRules:      jsii.String(severityRules),
+		SeverityRoutes:     &severityRoutes,
+		ReportSchedules:    &reportSchedules,
+		CoverageHours:      jsii.String(coverageHours),
+		SuppressionWindows: jsii.String(suppressionWindows),
+		EscalationPolicy:   jsii.String(escalationPolicy),
+		EscalationTopicArn: jsii.String(escalationTopicArn),
+		AckAPI:             ackAPI,
+		SnoozeDuration:     jsii.String(snoozeDuration),
+		OwnerRouting:       jsii.String(ownerRouting),
+		SecurityHub:        securityHubFindings,
+		MinRetentionDays:   jsii.String(minRetentionDays),
+		OpsItems:           opsItems,
+		EventBusName:       jsii.String(eventBusName),
+		CreateEventBus:     createEventBus,
+		EventSchema:        eventSchema,
+		MaxListedChanges:   jsii.String(maxListedChanges),
+		MaxMessagesPerRun:  jsii.String(maxMessagesPerRun),
+		IgnoreRules:        jsii.String(ignoreRules),
+		RegionParallelism:  jsii.String(regionParallelism),
+		ResumeImmediately:  resumeImmediately,
+		HistoryRetention:   jsii.String(historyRetentionDays),
+		Concurrency:        concurrency,
+		StatusRetention:    jsii.String(statusRetentionDays),
+		DeferHistoryIndex:  deferHistoryIndex,
 	})
 
 	app.Synth(nil)
 }
+
+// contextBool returns the context value for key as a boolean. Values given on
+// the command line arrive as strings.
+func contextBool(app awscdk.App, key string) bool {
+	switch value := app.Node().TryGetContext(jsii.String(key)).(type) {
+	case bool:
+		return value
+	case string:
+		return value == "true"
+	}
+	return false
+}
+
+// contextJSON returns the context value for key encoded as JSON. Values given
+// on the command line arrive as strings and are returned unchanged.
+func contextJSON(app awscdk.App, key string) string {
+	value := app.Node().TryGetContext(jsii.String(key))
+	if value == nil {
+		return ""
+	}
+	if str, ok := value.(string); ok {
+		return str
+	}
+	encoded, err := json.Marshal(value)
+	if err != nil {
+		log.Fatalf("unable to encode %s from context, %v", key, err)
+	}
+	return string(encoded)
+}
@@ -1,14 +1,20 @@
 package rds_backup_monitor
 
 import (
+	"encoding/json"
+	"os"
+	"regexp"
+	"sort"
 	"strings"
 
 	"github.com/aws/aws-cdk-go/awscdk/v2"
 	"github.com/aws/aws-cdk-go/awscdk/v2/awsdynamodb"
 	"github.com/aws/aws-cdk-go/awscdk/v2/awsevents"
+	"github.com/aws/aws-cdk-go/awscdk/v2/awseventschemas"
 	"github.com/aws/aws-cdk-go/awscdk/v2/awseventstargets"
 	"github.com/aws/aws-cdk-go/awscdk/v2/awsiam"
 	"github.com/aws/aws-cdk-go/awscdk/v2/awslambda"
+	"github.com/aws/aws-cdk-go/awscdk/v2/awssecretsmanager"
 	"github.com/aws/aws-cdk-go/awscdk/v2/awssns"
 	awscdklambdagoalpha "github.com/aws/aws-cdk-go/awscdklambdagoalpha/v2"
 	"github.com/aws/constructs-go/constructs/v10"
@@ -22,8 +28,42 @@ type RdsBackupMonitorStackProps struct {
 	Status             *[]string
 	NotificationEmail  *string
 	SnapshotAgeDays    *string
+	MessageFormat      *string
+	TemplateDir        *string
+	SeverityRules      *string
+	SeverityRoutes     *map[string][]string
+	ReportSchedules    *map[string]string
+	CoverageHours      *string
+	SuppressionWindows *string
+	EscalationPolicy   *string
+	EscalationTopicArn *string
+	AckAPI             bool
+	SnoozeDuration     *string
+	OwnerRouting       *string
+	SecurityHub        bool
+	MinRetentionDays   *string
+	OpsItems           bool
+	EventBusName       *string
+	CreateEventBus     bool
+	EventSchema        bool
+	MaxListedChanges   *string
+	MaxMessagesPerRun  *string
+	IgnoreRules        *string
+	RegionParallelism  *string
+	ResumeImmediately  bool
+	HistoryRetention   *string
+	Concurrency        *float64
+	StatusRetention    *string
+	DeferHistoryIndex  bool
 }
 
+// defaultEventBusName names the event bus created when no name is given.
+const defaultEventBusName = "rds-backup-monitor"
+
+// constructIDUnsafe matches the characters of an owner name that are replaced
+// in the construct ID of its topic.
+var constructIDUnsafe = regexp.MustCompile(`[^A-Za-z0-9-]`)
+
 func NewRdsBackupMonitorStack(scope constructs.Construct, id string, props *RdsBackupMonitorStackProps) awscdk.Stack {
 	var sprops awscdk.StackProps
 	if props != nil {
@@ -42,6 +82,44 @@ func NewRdsBackupMonitorStack(scope constructs.Construct, id string, props *RdsB
 		Topic:    topic,
 	})
 
+	messageFormat := "text"
+	if props.MessageFormat != nil {
+		messageFormat = *props.MessageFormat
+	}
+
+	// Snapshot status rows by the database they were taken from
+	indexes := []*awsdynamodb.GlobalSecondaryIndexPropsV2{
+		{
+			IndexName: jsii.String("source"),
+			PartitionKey: &awsdynamodb.Attribute{
+				Name: jsii.String("source"),
+				Type: awsdynamodb.AttributeType_STRING,
+			},
+			SortKey: &awsdynamodb.Attribute{
+				Name: jsii.String("sk"),
+				Type: awsdynamodb.AttributeType_STRING,
+			},
+			ProjectionType:   awsdynamodb.ProjectionType_INCLUDE,
+			NonKeyAttributes: jsii.Strings("status", "snapshotId"),
+		},
+	}
+	// Status transitions by database, in the order they were observed.
+	// CloudFormation adds a single index per table update, so tables that
+	// gain both indexes add this one in a second deployment
+	if !props.DeferHistoryIndex {
+		indexes = append(indexes, &awsdynamodb.GlobalSecondaryIndexPropsV2{
+			IndexName: jsii.String("history-source"),
+			PartitionKey: &awsdynamodb.Attribute{
+				Name: jsii.String("historySource"),
+				Type: awsdynamodb.AttributeType_STRING,
+			},
+			SortKey: &awsdynamodb.Attribute{
+				Name: jsii.String("observedAt"),
+				Type: awsdynamodb.AttributeType_NUMBER,
+			},
+		})
+	}
+
 	// DynamoDB Table to record last checked time
 	table := awsdynamodb.NewTableV2(stack, jsii.String("RdsBackupMonitorTable"), &awsdynamodb.TablePropsV2{
 		PartitionKey: &awsdynamodb.Attribute{
@@ -52,8 +130,9 @@ func NewRdsBackupMonitorStack(scope constructs.Construct, id string, props *RdsB
 			Name: jsii.String("sk"),
 			Type: awsdynamodb.AttributeType_STRING,
 		},
-		TimeToLiveAttribute: jsii.String("ttl"),
-		PointInTimeRecovery: jsii.Bool(true),
+		TimeToLiveAttribute:    jsii.String("ttl"),
+		PointInTimeRecovery:    jsii.Bool(true),
+		GlobalSecondaryIndexes: &indexes,
 	})
 
 	lambdaFn := awscdklambdagoalpha.NewGoFunction(stack, jsii.String("RdsBackupMonitorFunction"), &awscdklambdagoalpha.GoFunctionProps{
@@ -67,12 +146,275 @@ func NewRdsBackupMonitorStack(scope constructs.Construct, id string, props *RdsB
 			"DYNAMODB_TABLE_NAME":  table.TableName(),
 			"SCHEDULE_EXPRESSION": props.ScheduleExpression,
 			"SNAPSHOT_AGE_DAYS":    props.SnapshotAgeDays,
+			"ACCOUNT_ID":           stack.Account(),
+			"MESSAGE_FORMAT":       jsii.String(messageFormat),
 		},
 	})
 
+	// Ship operator supplied notification templates as a layer mounted at /opt
+	if props.TemplateDir != nil && *props.TemplateDir != "" {
+		templateLayer := awslambda.NewLayerVersion(stack, jsii.String("RdsBackupMonitorTemplates"), &awslambda.LayerVersionProps{
+			Code:        awslambda.Code_FromAsset(props.TemplateDir, nil),
+			Description: jsii.String("Notification templates for the RDS backup monitor"),
+		})
+		lambdaFn.AddLayers(templateLayer)
+		lambdaFn.AddEnvironment(jsii.String("TEMPLATE_DIR"), jsii.String("/opt"), nil)
+	}
+
+	// Route changes by severity to additional SNS topics
+	if props.SeverityRules != nil && *props.SeverityRules != "" {
+		lambdaFn.AddEnvironment(jsii.String("SEVERITY_RULES"), props.SeverityRules, nil)
+	}
+	if props.SeverityRoutes != nil && len(*props.SeverityRoutes) > 0 {
+		routes, err := json.Marshal(*props.SeverityRoutes)
+		if err != nil {
+			panic(err)
+		}
+		lambdaFn.AddEnvironment(jsii.String("SEVERITY_ROUTES"), jsii.String(string(routes)), nil)
+
+		var routeTopicArns []*string
+		for _, topicArns := range *props.SeverityRoutes {
+			for _, topicArn := range topicArns {
+				routeTopicArns = append(routeTopicArns, jsii.String(topicArn))
+			}
+		}
+		lambdaFn.AddToRolePolicy(awsiam.NewPolicyStatement(&awsiam.PolicyStatementProps{
+			Actions:   jsii.Strings("sns:Publish"),
+			Resources: &routeTopicArns,
+		}))
+	}
+
+	// Route changes to owners by tag. Email destinations get an SNS topic of
+	// their own, which the function receives as the owner's topicArn.
+	if props.OwnerRouting != nil && *props.OwnerRouting != "" {
+		var routing struct {
+			TagKeys []string                     `json:"tagKeys,omitempty"`
+			Owners  map[string]map[string]string `json:"owners"`
+		}
+		if err := json.Unmarshal([]byte(*props.OwnerRouting), &routing); err != nil {
+			panic(err)
+		}
+
+		owners := make([]string, 0, len(routing.Owners))
+		for owner := range routing.Owners {
+			owners = append(owners, owner)
+		}
+		sort.Strings(owners)
+
+		var ownerTopicArns []*string
+		for _, owner := range owners {
+			destination := routing.Owners[owner]
+			switch {
+			case destination["topicArn"] != "":
+				ownerTopicArns = append(ownerTopicArns, jsii.String(destination["topicArn"]))
+			case destination["slackWebhookUrl"] == "" && destination["email"] != "":
+				id := constructIDUnsafe.ReplaceAllString(owner, "-")
+				ownerTopic := awssns.NewTopic(stack, jsii.String("RdsSnapshotOwnerTopic-"+id), &awssns.TopicProps{
+					DisplayName: jsii.String("RDS Snapshot Notifications for " + owner),
+				})
+				awssns.NewSubscription(stack, jsii.String("RdsSnapshotOwnerSubscription-"+id), &awssns.SubscriptionProps{
+					Protocol: awssns.SubscriptionProtocol_EMAIL,
+					Endpoint: jsii.String(destination["email"]),
+					Topic:    ownerTopic,
+				})
+				ownerTopic.GrantPublish(lambdaFn)
+				destination["topicArn"] = *ownerTopic.TopicArn()
+			}
+		}
+		if len(ownerTopicArns) > 0 {
+			lambdaFn.AddToRolePolicy(awsiam.NewPolicyStatement(&awsiam.PolicyStatementProps{
+				Actions:   jsii.Strings("sns:Publish"),
+				Resources: &ownerTopicArns,
+			}))
+		}
+
+		encoded, err := json.Marshal(routing)
+		if err != nil {
+			panic(err)
+		}
+		lambdaFn.AddEnvironment(jsii.String("OWNER_ROUTING"), jsii.String(string(encoded)), nil)
+	}
+
+	// Compliance findings in Security Hub. Snapshot sharing is read to find
+	// public snapshots; findings are imported into each monitored region.
+	if props.SecurityHub {
+		lambdaFn.AddEnvironment(jsii.String("SECURITY_HUB_FINDINGS"), jsii.String("true"), nil)
+		if props.MinRetentionDays != nil && *props.MinRetentionDays != "" {
+			lambdaFn.AddEnvironment(jsii.String("MIN_RETENTION_DAYS"), props.MinRetentionDays, nil)
+		}
+		lambdaFn.AddToRolePolicy(awsiam.NewPolicyStatement(&awsiam.PolicyStatementProps{
+			Actions:   jsii.Strings("rds:DescribeDBSnapshotAttributes", "rds:DescribeDBClusterSnapshotAttributes"),
+			Resources: jsii.Strings("*"),
+		}))
+		lambdaFn.AddToRolePolicy(awsiam.NewPolicyStatement(&awsiam.PolicyStatementProps{
+			Actions: jsii.Strings("securityhub:BatchImportFindings"),
+			Resources: jsii.Strings(*awscdk.Fn_Join(jsii.String(""), &[]*string{
+				jsii.String("arn:"), stack.Partition(), jsii.String(":securityhub:*:"), stack.Account(),
+				jsii.String(":product/"), stack.Account(), jsii.String("/default"),
+			})),
+		}))
+	}
+
+	// OpsCenter OpsItems for failed and missing backups, opened and resolved
+	// in each monitored region
+	if props.OpsItems {
+		lambdaFn.AddEnvironment(jsii.String("OPS_ITEMS"), jsii.String("true"), nil)
+		lambdaFn.AddToRolePolicy(awsiam.NewPolicyStatement(&awsiam.PolicyStatementProps{
+			Actions:   jsii.Strings("ssm:CreateOpsItem", "ssm:UpdateOpsItem"),
+			Resources: jsii.Strings("*"),
+		}))
+	}
+
+	// SnapshotStatusChanged events on a custom event bus, created by the stack
+	// or given by name or ARN
+	eventBusName := ""
+	if props.EventBusName != nil {
+		eventBusName = *props.EventBusName
+	}
+	var eventBus awsevents.IEventBus
+	switch {
+	case props.CreateEventBus:
+		if eventBusName == "" {
+			eventBusName = defaultEventBusName
+		}
+		eventBus = awsevents.NewEventBus(stack, jsii.String("RdsSnapshotEventBus"), &awsevents.EventBusProps{
+			EventBusName: jsii.String(eventBusName),
+		})
+		awscdk.NewCfnOutput(stack, jsii.String("EventBusArn"), &awscdk.CfnOutputProps{
+			Value:       eventBus.EventBusArn(),
+			Description: jsii.String("Event bus that receives SnapshotStatusChanged events"),
+		})
+	case strings.HasPrefix(eventBusName, "arn:"):
+		eventBus = awsevents.EventBus_FromEventBusArn(stack, jsii.String("RdsSnapshotEventBus"), jsii.String(eventBusName))
+	case eventBusName != "":
+		eventBus = awsevents.EventBus_FromEventBusName(stack, jsii.String("RdsSnapshotEventBus"), jsii.String(eventBusName))
+	}
+	if eventBus != nil {
+		lambdaFn.AddEnvironment(jsii.String("EVENT_BUS_NAME"), jsii.String(eventBusName), nil)
+		eventBus.GrantPutEventsTo(lambdaFn)
+	}
+
+	// Schema registry entry that documents the detail of the events, so
+	// subscribers can download code bindings for it
+	if props.EventSchema {
+		content, err := os.ReadFile("schemas/snapshot-status-changed.schema.json")
+		if err != nil {
+			panic(err)
+		}
+		registry := awseventschemas.NewCfnRegistry(stack, jsii.String("RdsSnapshotEventRegistry"), &awseventschemas.CfnRegistryProps{
+			RegistryName: jsii.String("rds-backup-monitor"),
+			Description:  jsii.String("Events put on the event bus by the RDS backup monitor"),
+		})
+		schema := awseventschemas.NewCfnSchema(stack, jsii.String("RdsSnapshotEventSchema"), &awseventschemas.CfnSchemaProps{
+			RegistryName: registry.AttrRegistryName(),
+			SchemaName:   jsii.String("rds-backup-monitor@SnapshotStatusChanged"),
+			Type:         jsii.String("JSONSchemaDraft4"),
+			Content:      jsii.String(string(content)),
+			Description:  jsii.String("SnapshotStatusChanged event of the RDS backup monitor"),
+		})
+		schema.AddDependency(registry)
+	}
+
+	// Regions scanned at the same time
+	if props.RegionParallelism != nil && *props.RegionParallelism != "" {
+		lambdaFn.AddEnvironment(jsii.String("REGION_PARALLELISM"), props.RegionParallelism, nil)
+	}
+
+	// Limits of the digests sent to each notifier in a run
+	if props.MaxListedChanges != nil && *props.MaxListedChanges != "" {
+		lambdaFn.AddEnvironment(jsii.String("MAX_LISTED_CHANGES"), props.MaxListedChanges, nil)
+	}
+	if props.MaxMessagesPerRun != nil && *props.MaxMessagesPerRun != "" {
+		lambdaFn.AddEnvironment(jsii.String("MAX_MESSAGES_PER_RUN"), props.MaxMessagesPerRun, nil)
+	}
+
+	// Maintenance windows and quiet hours
+	if props.SuppressionWindows != nil && *props.SuppressionWindows != "" {
+		lambdaFn.AddEnvironment(jsii.String("SUPPRESSION_WINDOWS"), props.SuppressionWindows, nil)
+	}
+
+	// Snapshots whose changes are never notified
+	if props.IgnoreRules != nil && *props.IgnoreRules != "" {
+		lambdaFn.AddEnvironment(jsii.String("IGNORE_RULES"), props.IgnoreRules, nil)
+	}
+
+	// Retention of the status transition history
+	if props.HistoryRetention != nil && *props.HistoryRetention != "" {
+		lambdaFn.AddEnvironment(jsii.String("HISTORY_RETENTION_DAYS"), props.HistoryRetention, nil)
+	}
+
+	// Retention of the snapshot states of single statuses
+	if props.StatusRetention != nil && *props.StatusRetention != "" {
+		lambdaFn.AddEnvironment(jsii.String("STATUS_RETENTION_DAYS"), props.StatusRetention, nil)
+	}
+
+	// Reserved concurrency also keeps runs from overlapping, at the cost of
+	// throttling a report or resume that starts during a run. The region
+	// locks keep runs apart without it.
+	if props.Concurrency != nil {
+		lambdaFn.Node().DefaultChild().(awslambda.CfnFunction).SetReservedConcurrentExecutions(props.Concurrency)
+	}
+
+	// Reminders for unhealthy databases, escalated to a second topic
+	if props.EscalationPolicy != nil && *props.EscalationPolicy != "" {
+		lambdaFn.AddEnvironment(jsii.String("ESCALATION_POLICY"), props.EscalationPolicy, nil)
+	}
+	if props.EscalationTopicArn != nil && *props.EscalationTopicArn != "" {
+		lambdaFn.AddToRolePolicy(awsiam.NewPolicyStatement(&awsiam.PolicyStatementProps{
+			Actions:   jsii.Strings("sns:Publish"),
+			Resources: jsii.Strings(*props.EscalationTopicArn),
+		}))
+	}
+
+	// Acknowledge and snooze API behind a function URL. Requests are
+	// authenticated by the signature of the links in notifications.
+	if props.AckAPI {
+		ackSecret := awssecretsmanager.NewSecret(stack, jsii.String("RdsBackupMonitorAckSecret"), &awssecretsmanager.SecretProps{
+			Description: jsii.String("Key that signs acknowledge and snooze links of the RDS backup monitor"),
+			GenerateSecretString: &awssecretsmanager.SecretStringGenerator{
+				PasswordLength:     jsii.Number(64),
+				ExcludePunctuation: jsii.Bool(true),
+			},
+		})
+
+		ackFn := awscdklambdagoalpha.NewGoFunction(stack, jsii.String("RdsBackupMonitorAckFunction"), &awscdklambdagoalpha.GoFunctionProps{
+			Runtime: awslambda.Runtime_PROVIDED_AL2023(),
+			Entry:   jsii.String("lambda/ackapi"),
+			Timeout: awscdk.Duration_Seconds(jsii.Number(10)),
+			Environment: &map[string]*string{
+				"DYNAMODB_TABLE_NAME": table.TableName(),
+				"ACCOUNT_ID":          stack.Account(),
+				"ACK_SECRET_ARN":      ackSecret.SecretArn(),
+			},
+		})
+		ackFn.Role().AddManagedPolicy(
+			awsiam.ManagedPolicy_FromAwsManagedPolicyName(
+				jsii.String("service-role/AWSLambdaBasicExecutionRole")))
+		ackSecret.GrantRead(ackFn, nil)
+		table.GrantWriteData(ackFn)
+
+		ackURL := ackFn.AddFunctionUrl(&awslambda.FunctionUrlOptions{
+			AuthType:   awslambda.FunctionUrlAuthType_NONE,
+			InvokeMode: awslambda.InvokeMode_RESPONSE_STREAM,
+		})
+
+		lambdaFn.AddEnvironment(jsii.String("ACK_BASE_URL"), ackURL.Url(), nil)
+		lambdaFn.AddEnvironment(jsii.String("ACK_SECRET_ARN"), ackSecret.SecretArn(), nil)
+		if props.SnoozeDuration != nil && *props.SnoozeDuration != "" {
+			lambdaFn.AddEnvironment(jsii.String("ACK_SNOOZE_DURATION"), props.SnoozeDuration, nil)
+		}
+		ackSecret.GrantRead(lambdaFn, nil)
+
+		awscdk.NewCfnOutput(stack, jsii.String("AckApiUrl"), &awscdk.CfnOutputProps{
+			Value:       ackURL.Url(),
+			Description: jsii.String("Base URL of the acknowledge and snooze API"),
+		})
+	}
+
 	// Grant Lambda permission to describe DB snapshots and publish to SNS
 	lambdaFn.AddToRolePolicy(awsiam.NewPolicyStatement(&awsiam.PolicyStatementProps{
-		Actions:   jsii.Strings("rds:DescribeDBSnapshots", "rds:DescribeDBClusterSnapshots"),
+		Actions: jsii.Strings("rds:DescribeDBSnapshots", "rds:DescribeDBClusterSnapshots",
+			"rds:DescribeDBInstances", "rds:DescribeDBClusters"),
 		Resources: jsii.Strings("*"),
 	}))
 	lambdaFn.Role().AddManagedPolicy(
@@ -93,5 +435,54 @@ func NewRdsBackupMonitorStack(scope constructs.Construct, id string, props *RdsB
 
 	rule.AddTarget(awseventstargets.NewLambdaFunction(lambdaFn, &awseventstargets.LambdaFunctionProps{}))
 
+	// Region scans that pause ahead of the timeout put an event on the default
+	// event bus, which invokes the function again to resume them
+	if props.ResumeImmediately {
+		lambdaFn.AddEnvironment(jsii.String("RESUME_IMMEDIATELY"), jsii.String("true"), nil)
+		lambdaFn.AddToRolePolicy(awsiam.NewPolicyStatement(&awsiam.PolicyStatementProps{
+			Actions: jsii.Strings("events:PutEvents"),
+			Resources: jsii.Strings(*stack.FormatArn(&awscdk.ArnComponents{
+				Service:      jsii.String("events"),
+				Resource:     jsii.String("event-bus"),
+				ResourceName: jsii.String("default"),
+			})),
+		}))
+
+		resumeRule := awsevents.NewRule(stack, jsii.String("RdsBackupMonitorResumeRule"), &awsevents.RuleProps{
+			EventPattern: &awsevents.EventPattern{
+				Source:     jsii.Strings("rds-backup-monitor"),
+				DetailType: jsii.Strings("ScanResumeRequested"),
+			},
+		})
+		resumeRule.AddTarget(awseventstargets.NewLambdaFunction(lambdaFn, &awseventstargets.LambdaFunctionProps{
+			Event: awsevents.RuleTargetInput_FromObject(map[string]string{
+				"mode": "monitor",
+			}),
+		}))
+	}
+
+	// Summary report schedules, one rule per report period
+	if props.CoverageHours != nil && *props.CoverageHours != "" {
+		lambdaFn.AddEnvironment(jsii.String("REPORT_COVERAGE_HOURS"), props.CoverageHours, nil)
+	}
+	if props.ReportSchedules != nil {
+		for _, period := range []string{"daily", "weekly"} {
+			reportSchedule, ok := (*props.ReportSchedules)[period]
+			if !ok || reportSchedule == "" {
+				continue
+			}
+
+			reportRule := awsevents.NewRule(stack, jsii.String("RdsBackupMonitorReportRule-"+period), &awsevents.RuleProps{
+				Schedule: awsevents.Schedule_Expression(jsii.String(reportSchedule)),
+			})
+			reportRule.AddTarget(awseventstargets.NewLambdaFunction(lambdaFn, &awseventstargets.LambdaFunctionProps{
+				Event: awsevents.RuleTargetInput_FromObject(map[string]string{
+					"mode":   "report",
+					"period": period,
+				}),
+			}))
+		}
+	}
+
 	return stack
 }